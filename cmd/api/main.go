@@ -3,15 +3,22 @@ package main
 import (
 	"fmt"
 	"log"
+	"net/http"
+	"time"
 
 	"github.com/Thanhdat-debug/demo_login/internal/config"
 	"github.com/Thanhdat-debug/demo_login/internal/handlers"
+	"github.com/Thanhdat-debug/demo_login/internal/keys"
 	"github.com/Thanhdat-debug/demo_login/internal/middleware"
 	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/ratelimit"
 	"github.com/Thanhdat-debug/demo_login/internal/repository"
 	"github.com/Thanhdat-debug/demo_login/internal/services"
 	"github.com/Thanhdat-debug/demo_login/pkg/database"
 	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/Thanhdat-debug/demo_login/pkg/mailer"
+	"github.com/Thanhdat-debug/demo_login/pkg/password"
+	"github.com/Thanhdat-debug/demo_login/pkg/sms"
 	"github.com/gin-gonic/gin"
 )
 
@@ -48,25 +55,242 @@ func main() {
 	appLogger.Info("Connected to database successfully")
 
 	// Auto Migrate các model
-	if err := db.AutoMigrate(&models.User{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.Session{}, &models.SigningKey{}, &models.RecoveryCode{}, &models.WebAuthnCredential{}, &models.WebAuthnChallenge{}, &models.UserToken{}, &models.LoginFailure{}, &models.RateLimitEntry{}, &models.PasswordHistory{}, &models.APIKey{}, &models.OAuthClient{}, &models.OAuthAuthorizationCode{}, &models.OAuthConsent{}, &models.UserIdentity{}, &models.PhoneOTP{}); err != nil {
 		appLogger.Error("Failed to auto migrate models:", err)
 		log.Fatal(err)
 	}
 	appLogger.Info("Auto migration completed")
 
+	// Cấu hình thuật toán băm mật khẩu; hash cũ vẫn được chấp nhận và được hash lại khi user đăng nhập
+	passwordHasher, err := password.New(appConfig.PasswordHashAlgorithm, appConfig.BcryptCost, password.Argon2idParams{
+		Memory:      uint32(appConfig.Argon2Memory),
+		Iterations:  uint32(appConfig.Argon2Iterations),
+		Parallelism: uint8(appConfig.Argon2Parallelism),
+	})
+	if err != nil {
+		appLogger.Error("Invalid password hash configuration:", err)
+		log.Fatal(err)
+	}
+	password.SetDefault(passwordHasher)
+
+	// Chính sách mật khẩu, áp dụng khi đăng ký, đổi và đặt lại mật khẩu
+	passwordPolicy := &password.Policy{
+		MinLength:     appConfig.PasswordMinLength,
+		MaxLength:     appConfig.PasswordMaxLength,
+		RequireLower:  appConfig.PasswordRequireLower,
+		RequireUpper:  appConfig.PasswordRequireUpper,
+		RequireDigit:  appConfig.PasswordRequireDigit,
+		RequireSymbol: appConfig.PasswordRequireSymbol,
+		MinStrength:   appConfig.PasswordMinStrength,
+	}
+	if appConfig.PasswordBreachedFile != "" {
+		breachedList, err := password.OpenBreachedList(appConfig.PasswordBreachedFile)
+		if err != nil {
+			appLogger.Error("Failed to open breached password list:", err)
+			log.Fatal(err)
+		}
+		defer breachedList.Close()
+		passwordPolicy.Breached = breachedList
+	}
+
 	// Khởi tạo repository
 	userRepo := repository.NewUserRepository(db, appLogger)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db, appLogger)
+	sessionRepo := repository.NewSessionRepository(db, appLogger)
+	signingKeyRepo := repository.NewSigningKeyRepository(db, appLogger)
+	recoveryCodeRepo := repository.NewRecoveryCodeRepository(db, appLogger)
+	webAuthnRepo := repository.NewWebAuthnRepository(db, appLogger)
+	userTokenRepo := repository.NewUserTokenRepository(db, appLogger)
+	loginFailureRepo := repository.NewLoginFailureRepository(db, appLogger)
+	passwordHistoryRepo := repository.NewPasswordHistoryRepository(db, appLogger)
+	apiKeyRepo := repository.NewAPIKeyRepository(db, appLogger)
+	oauthClientRepo := repository.NewOAuthClientRepository(db, appLogger)
+	oauthCodeRepo := repository.NewOAuthCodeRepository(db, appLogger)
+	oauthConsentRepo := repository.NewOAuthConsentRepository(db, appLogger)
+	userIdentityRepo := repository.NewUserIdentityRepository(db, appLogger)
+	phoneOTPRepo := repository.NewPhoneOTPRepository(db, appLogger)
+
+	// Khởi tạo nơi lưu danh sách JWT bị thu hồi
+	var revocationStore repository.RevocationStore
+	if appConfig.RevocationStore == "memory" {
+		revocationStore = repository.NewMemoryRevocationStore()
+	} else {
+		revocationStore = repository.NewDBRevocationStore(db, appLogger)
+	}
+	stopRevocationCleanup := services.StartRevocationCleanup(revocationStore, appConfig.RevocationCleanupInterval, appLogger)
+	defer stopRevocationCleanup()
+
+	// Tải khóa ký JWT từ cấu hình và nạp keyring từ database
+	configKey, err := keys.LoadSigningKey(appConfig.JWTSigningAlg, appConfig.JWTPrivateKeyFile, []byte(appConfig.JWTSecret), appConfig.JWTKeyID)
+	if err != nil {
+		appLogger.Error("Failed to load JWT signing key:", err)
+		log.Fatal(err)
+	}
+	keyEncrypter, err := keys.NewEncrypter(appConfig.SigningKeyEncryptionKey)
+	if err != nil {
+		appLogger.Error("Invalid SIGNING_KEY_ENCRYPTION_KEY:", err)
+		log.Fatal(err)
+	}
+	keyring := keys.NewKeyring(configKey)
+	keyService := services.NewKeyService(signingKeyRepo, keyring, keyEncrypter, appConfig, appLogger)
+	if err := keyService.Bootstrap(configKey); err != nil {
+		appLogger.Error("Failed to load signing keys:", err)
+		log.Fatal(err)
+	}
+	appLogger.Infof("Using JWT signing key %s (%s)", keyring.Active().ID, keyring.Active().Algorithm())
+	if keyring.Active().IsSymmetric() {
+		appLogger.Infof("OpenID Connect is disabled: ID tokens need an RS256, ES256 or EdDSA signing key")
+	}
+	stopKeyringReload := services.StartKeyringReload(keyService, appConfig.KeyringReloadInterval, appLogger)
+	defer stopKeyringReload()
+
+	// Khởi tạo mail sender và hàng đợi gửi email bất đồng bộ
+	var mailSender mailer.Sender
+	switch appConfig.MailDriver {
+	case "log":
+		mailSender = mailer.NewLogSender(appLogger)
+	case "smtp":
+		mailSender = mailer.NewSMTPSender(mailer.SMTPConfig{
+			Host:     appConfig.SMTPHost,
+			Port:     appConfig.SMTPPort,
+			Username: appConfig.SMTPUsername,
+			Password: appConfig.SMTPPassword,
+			From:     appConfig.MailFrom,
+		})
+	case "file":
+		mailSender = mailer.NewFileSender(appConfig.MailFilePath, appConfig.MailFrom)
+	case "memory":
+		mailSender = mailer.NewMemorySender()
+	default:
+		log.Fatalf("Unknown MAIL_DRIVER: %s", appConfig.MailDriver)
+	}
+	// Khởi tạo SMS sender (mã OTP qua số điện thoại)
+	var smsSender sms.Sender
+	switch appConfig.SMSDriver {
+	case "log":
+		smsSender = sms.NewLogSender(appLogger)
+	case "file":
+		smsSender = sms.NewFileSender(appConfig.SMSFilePath)
+	case "memory":
+		smsSender = sms.NewMemorySender()
+	default:
+		log.Fatalf("Unknown SMS_DRIVER: %s", appConfig.SMSDriver)
+	}
+
+	mailQueue := mailer.NewQueue(mailSender, mailer.QueueOptions{
+		Size:        appConfig.MailQueueSize,
+		Workers:     appConfig.MailQueueWorkers,
+		MaxAttempts: appConfig.MailMaxAttempts,
+		RetryDelay:  appConfig.MailRetryDelay,
+	}, appLogger)
+	defer mailQueue.Close()
+
+	mailRenderer, err := mailer.NewRenderer(appConfig.MailDefaultLocale)
+	if err != nil {
+		appLogger.Error("Failed to load mail templates:", err)
+		log.Fatal(err)
+	}
 
 	// Khởi tạo service
-	authService := services.NewAuthService(userRepo, appConfig, appLogger)
-	userService := services.NewUserService(userRepo, appLogger)
+	sessionService := services.NewSessionService(sessionRepo, refreshTokenRepo, appConfig, appLogger)
+	stopSessionCleanup := services.StartSessionCleanup(sessionRepo, appConfig.RevocationCleanupInterval, appLogger)
+	defer stopSessionCleanup()
+	mfaService := services.NewMFAService(userRepo, recoveryCodeRepo, appConfig, appLogger)
+	webAuthnService, err := services.NewWebAuthnService(userRepo, webAuthnRepo, appConfig, appLogger)
+	if err != nil {
+		appLogger.Error("Failed to configure WebAuthn:", err)
+		log.Fatal(err)
+	}
+	lockoutService := services.NewLockoutService(userRepo, loginFailureRepo, appConfig, appLogger)
+	stopLoginFailureCleanup := services.StartLoginFailureCleanup(loginFailureRepo, appConfig.RevocationCleanupInterval, appConfig.LoginIPWindow, appLogger)
+	defer stopLoginFailureCleanup()
+	mailService := services.NewMailService(mailRenderer, mailQueue, appConfig, appLogger)
+	emailVerificationService := services.NewEmailVerificationService(userRepo, userTokenRepo, mailService, appConfig, appLogger)
+	passwordService := services.NewPasswordService(userRepo, passwordHistoryRepo, passwordPolicy, appConfig, appLogger)
+	passwordResetService := services.NewPasswordResetService(userRepo, userTokenRepo, sessionService, mailService, passwordService, appConfig, appLogger)
+	// Các nguồn xác thực username/mật khẩu, thử lần lượt theo thứ tự trong AUTH_BACKENDS
+	var authenticators []services.Authenticator
+	for _, backend := range appConfig.AuthBackends {
+		switch backend {
+		case services.AuthBackendLocal:
+			authenticators = append(authenticators, services.NewLocalAuthenticator(userRepo, userIdentityRepo, appConfig, appLogger))
+		case services.AuthBackendLDAP:
+			authenticators = append(authenticators, services.NewLDAPAuthenticator(userRepo, userIdentityRepo, appConfig, appLogger))
+		default:
+			log.Fatalf("Unknown AUTH_BACKENDS entry: %s", backend)
+		}
+	}
+	authService := services.NewAuthService(userRepo, userIdentityRepo, refreshTokenRepo, revocationStore, sessionService, mfaService, webAuthnService, emailVerificationService, mailService, lockoutService, passwordService, authenticators, keyring, appConfig, appLogger)
+	userService := services.NewUserService(userRepo, userIdentityRepo, refreshTokenRepo, userTokenRepo, passwordService, passwordResetService, sessionService, appLogger)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, userRepo, appLogger)
+	oauthClientService := services.NewOAuthClientService(oauthClientRepo, appLogger)
+	oauthService := services.NewOAuthService(oauthClientService, oauthCodeRepo, oauthConsentRepo, refreshTokenRepo, userRepo, revocationStore, sessionService, authService, keyring, appConfig, appLogger)
+	stopOAuthCodeCleanup := services.StartOAuthCodeCleanup(oauthCodeRepo, appConfig.RevocationCleanupInterval, appLogger)
+	defer stopOAuthCodeCleanup()
+	stopWebAuthnChallengeCleanup := services.StartWebAuthnChallengeCleanup(webAuthnRepo, appConfig.RevocationCleanupInterval, appLogger)
+	defer stopWebAuthnChallengeCleanup()
+	socialProviders, err := services.NewSocialProviders(appConfig, &http.Client{Timeout: 10 * time.Second})
+	if err != nil {
+		appLogger.Error("Invalid social login provider configuration:", err)
+		log.Fatal(err)
+	}
+	socialLoginService := services.NewSocialLoginService(socialProviders, userIdentityRepo, userRepo, authService, keyring, appConfig, appLogger)
+	phoneService := services.NewPhoneService(userRepo, phoneOTPRepo, userIdentityRepo, lockoutService, authService, smsSender, appConfig, appLogger)
+	magicLinkService := services.NewMagicLinkService(userRepo, userIdentityRepo, revocationStore, mailService, authService, keyring, appConfig, appLogger)
+	samlService, err := services.NewSAMLService(userIdentityRepo, userRepo, revocationStore, authService, keyring, &http.Client{Timeout: 10 * time.Second}, appConfig, appLogger)
+	if err != nil {
+		appLogger.Error("Invalid SAML provider configuration:", err)
+		log.Fatal(err)
+	}
 
 	// Khởi tạo middleware
-	authMiddleware := middleware.NewAuthMiddleware(authService, appLogger)
+	authMiddleware := middleware.NewAuthMiddleware(authService, apiKeyService, appLogger)
 
 	// Khởi tạo handler
 	authHandler := handlers.NewAuthHandler(authService, appLogger)
-	userHandler := handlers.NewUserHandler(userService, appLogger)
+	userHandler := handlers.NewUserHandler(userService, lockoutService, appLogger)
+	sessionHandler := handlers.NewSessionHandler(sessionService, appLogger)
+	keyHandler := handlers.NewKeyHandler(keyService, appLogger)
+	mfaHandler := handlers.NewMFAHandler(mfaService, appLogger)
+	webAuthnHandler := handlers.NewWebAuthnHandler(webAuthnService, appLogger)
+	emailVerificationHandler := handlers.NewEmailVerificationHandler(emailVerificationService, appLogger)
+	passwordResetHandler := handlers.NewPasswordResetHandler(passwordResetService, appLogger)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService, appLogger)
+	oauthHandler := handlers.NewOAuthHandler(oauthService, oauthClientService, authService, appConfig, appLogger)
+	oauthClientHandler := handlers.NewOAuthClientHandler(oauthClientService, appLogger)
+	socialHandler := handlers.NewSocialHandler(socialLoginService, appConfig, appLogger)
+	samlHandler := handlers.NewSAMLHandler(samlService, appConfig, appLogger)
+	magicLinkHandler := handlers.NewMagicLinkHandler(magicLinkService, appConfig, appLogger)
+	phoneHandler := handlers.NewPhoneHandler(phoneService, appLogger)
+
+	// Khởi tạo giới hạn số request
+	var rateLimitStore ratelimit.Store
+	if appConfig.RateLimitEnabled {
+		if appConfig.RateLimitStore == "db" {
+			rateLimitStore = ratelimit.NewSQLStore(db, appLogger)
+		} else {
+			rateLimitStore = ratelimit.NewMemoryStore()
+		}
+		stopRateLimitCleanup := ratelimit.StartCleanup(rateLimitStore, appConfig.RevocationCleanupInterval, appLogger)
+		defer stopRateLimitCleanup()
+	}
+	rateLimit := middleware.NewRateLimitMiddleware(rateLimitStore, appLogger)
+
+	policy := func(name, spec string) ratelimit.Policy {
+		p, err := ratelimit.ParsePolicy(name, spec, ratelimit.Algorithm(appConfig.RateLimitAlgorithm))
+		if err != nil {
+			appLogger.Error("Invalid rate limit policy:", err)
+			log.Fatal(err)
+		}
+		return p
+	}
+	loginLimit := rateLimit.Limit(policy("login", appConfig.RateLimitLogin), middleware.KeyByIP)
+	registerLimit := rateLimit.Limit(policy("register", appConfig.RateLimitRegister), middleware.KeyByIP)
+	emailLimit := rateLimit.Limit(policy("email", appConfig.RateLimitEmail), middleware.KeyByIP)
+	smsLimit := rateLimit.Limit(policy("sms", appConfig.RateLimitSMS), middleware.KeyByIP)
+	publicLimit := rateLimit.Limit(policy("public", appConfig.RateLimitPublic), middleware.KeyByIP)
+	apiLimit := rateLimit.Limit(policy("api", appConfig.RateLimitAPI), middleware.KeyByUser)
+	apiKeyLimit := rateLimit.Limit(policy("api", appConfig.RateLimitAPI), middleware.KeyByAPIKey)
 
 	// Khởi tạo Gin router
 	router := gin.Default()
@@ -75,8 +299,8 @@ func main() {
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Length")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Length, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		if c.Request.Method == "OPTIONS" {
@@ -89,26 +313,133 @@ func main() {
 
 	// Định nghĩa các API route
 
-	// Public routes (không cần xác thực)
-	router.POST("/api/auth/register", authHandler.Register)
-	router.POST("/api/auth/login", authHandler.Login)
-	router.GET("/api/auth/validate", authHandler.ValidateToken)
+	// Public routes (không cần xác thực), giới hạn theo IP; các route nhạy cảm có thêm hạn mức riêng
+	public := router.Group("/api/auth")
+	public.Use(publicLimit)
+	{
+		public.POST("/register", registerLimit, authHandler.Register)
+		public.POST("/login", loginLimit, authHandler.Login)
+		public.POST("/refresh", authHandler.Refresh)
+		public.POST("/verify-email", emailVerificationHandler.VerifyEmail)
+		public.POST("/verify-email/resend", emailLimit, emailVerificationHandler.ResendVerification)
+		public.POST("/password/forgot", emailLimit, passwordResetHandler.ForgotPassword)
+		public.POST("/password/reset", loginLimit, passwordResetHandler.ResetPassword)
+		public.POST("/invitation/accept", loginLimit, passwordResetHandler.AcceptInvitation)
+		public.POST("/password/change", loginLimit, authHandler.ChangeExpiredPassword)
+		public.POST("/magic-link", emailLimit, magicLinkHandler.RequestLink)
+		public.POST("/magic-link/consume", loginLimit, magicLinkHandler.Consume)
+		public.POST("/phone/otp", smsLimit, phoneHandler.RequestLoginCode)
+		public.POST("/phone/login", loginLimit, phoneHandler.Login)
+		public.POST("/mfa/verify", loginLimit, authHandler.VerifyMFA)
+		public.POST("/mfa/webauthn/begin", loginLimit, authHandler.BeginMFAWebAuthn)
+		public.POST("/mfa/webauthn/finish", loginLimit, authHandler.VerifyMFAWebAuthn)
+		public.POST("/webauthn/login/begin", loginLimit, authHandler.BeginPasskeyLogin)
+		public.POST("/webauthn/login/finish", loginLimit, authHandler.FinishPasskeyLogin)
+		public.GET("/validate", authHandler.ValidateToken)
+
+		// Đăng nhập bằng identity provider bên ngoài (Google, GitHub, OIDC provider bất kỳ)
+		public.GET("/social/providers", socialHandler.Providers)
+		public.GET("/social/:provider", loginLimit, socialHandler.Begin)
+		public.GET("/social/:provider/callback", loginLimit, socialHandler.Callback)
+
+		// Đăng nhập bằng SAML 2.0 (service này là service provider)
+		public.GET("/saml/providers", samlHandler.Providers)
+		public.GET("/saml/:provider/metadata", samlHandler.Metadata)
+		public.GET("/saml/:provider", loginLimit, samlHandler.Begin)
+		public.POST("/saml/:provider/acs", loginLimit, samlHandler.ACS)
+	}
+	router.GET("/.well-known/jwks.json", publicLimit, authHandler.JWKS)
 
-	// Protected routes (cần xác thực JWT)
+	// OAuth 2.0 authorization server: trang đăng nhập/consent và token endpoint cho các ứng dụng bên thứ ba
+	oauth := router.Group("/oauth")
+	oauth.Use(publicLimit)
+	{
+		oauth.GET("/authorize", oauthHandler.Authorize)
+		oauth.POST("/authorize", loginLimit, oauthHandler.AuthorizeSubmit)
+		oauth.POST("/token", oauthHandler.Token)
+		oauth.POST("/introspect", oauthHandler.Introspect)
+		oauth.POST("/revoke", oauthHandler.Revoke)
+	}
+
+	// OpenID Connect: discovery document và userinfo endpoint
+	router.GET("/.well-known/openid-configuration", publicLimit, oauthHandler.Discovery)
+	router.GET("/userinfo", publicLimit, oauthHandler.UserInfo)
+	router.POST("/userinfo", publicLimit, oauthHandler.UserInfo)
+
+	// Routes chấp nhận JWT hoặc API key; API key phải có scope tương ứng. Giới hạn theo API key, hoặc theo user khi dùng JWT
+	scoped := router.Group("/api")
+	scoped.Use(authMiddleware.APIKeyOrJWTAuthMiddleware(), apiKeyLimit)
+	{
+		scoped.GET("/users/profile", authMiddleware.RequireScope(services.ScopeProfileRead), userHandler.GetProfile)
+		scoped.PUT("/users/profile", authMiddleware.RequireScope(services.ScopeProfileWrite), userHandler.UpdateProfile)
+		scoped.GET("/users/sessions", authMiddleware.RequireScope(services.ScopeSessionsRead), sessionHandler.ListSessions)
+		scoped.DELETE("/users/sessions/:id", authMiddleware.RequireScope(services.ScopeSessionsWrite), sessionHandler.RevokeSession)
+		scoped.GET("/admin/users", authMiddleware.AdminRequired(), authMiddleware.RequireScope(services.ScopeAdminUsersRead), userHandler.GetUsersList)
+		scoped.GET("/admin/users/:id", authMiddleware.AdminRequired(), authMiddleware.RequireScope(services.ScopeAdminUsersRead), userHandler.GetUser)
+	}
+
+	// Protected routes (chỉ chấp nhận JWT), giới hạn theo user
 	protected := router.Group("/api")
-	protected.Use(authMiddleware.JWTAuthMiddleware())
+	protected.Use(authMiddleware.JWTAuthMiddleware(), apiLimit)
 	{
+		// Auth routes
+		protected.POST("/auth/logout", authHandler.Logout)
+
 		// User routes
-		protected.GET("/users/profile", userHandler.GetProfile)
-		protected.PUT("/users/profile", userHandler.UpdateProfile)
 		protected.PUT("/users/change-password", userHandler.ChangePassword)
 		protected.DELETE("/users/account", userHandler.DeleteAccount)
 
+		// Số điện thoại
+		protected.POST("/users/phone", smsLimit, phoneHandler.RequestVerification)
+		protected.POST("/users/phone/verify", phoneHandler.ConfirmVerification)
+		protected.DELETE("/users/phone", phoneHandler.RemovePhone)
+
+		// Session routes
+		protected.POST("/users/sessions/revoke-others", sessionHandler.RevokeOtherSessions)
+
+		// API key routes
+		protected.POST("/users/api-keys", apiKeyHandler.CreateAPIKey)
+		protected.GET("/users/api-keys", apiKeyHandler.ListAPIKeys)
+		protected.DELETE("/users/api-keys/:id", apiKeyHandler.RevokeAPIKey)
+
+		// MFA routes
+		protected.POST("/users/mfa/totp/setup", mfaHandler.SetupTOTP)
+		protected.POST("/users/mfa/totp/confirm", mfaHandler.ConfirmTOTP)
+		protected.POST("/users/mfa/totp/disable", mfaHandler.DisableTOTP)
+
+		// Passkey (WebAuthn) routes
+		protected.POST("/users/webauthn/register/begin", webAuthnHandler.BeginRegistration)
+		protected.POST("/users/webauthn/register/finish", webAuthnHandler.FinishRegistration)
+		protected.GET("/users/webauthn/credentials", webAuthnHandler.ListCredentials)
+		protected.DELETE("/users/webauthn/credentials/:id", webAuthnHandler.DeleteCredential)
+
+		// Liên kết tài khoản với identity provider bên ngoài
+		protected.POST("/users/identities/:provider", socialHandler.BeginLink)
+		protected.GET("/users/identities", socialHandler.ListIdentities)
+		protected.DELETE("/users/identities/:id", socialHandler.Unlink)
+
 		// Admin routes
 		admin := protected.Group("/admin")
 		admin.Use(authMiddleware.AdminRequired())
 		{
-			admin.GET("/users", userHandler.GetUsersList)
+			// Quản lý user
+			admin.POST("/users", userHandler.CreateUser)
+			admin.PUT("/users/:id", userHandler.UpdateUser)
+			admin.DELETE("/users/:id", userHandler.DeleteUser)
+			admin.PUT("/users/:id/role", userHandler.ChangeRole)
+			admin.POST("/users/:id/reset-password", userHandler.ForcePasswordReset)
+			admin.POST("/users/:id/unlock", userHandler.UnlockUser)
+
+			// Quản lý khóa ký JWT
+			admin.GET("/keys", keyHandler.ListKeys)
+			admin.POST("/keys", keyHandler.GenerateKey)
+			admin.POST("/keys/:kid/promote", keyHandler.PromoteKey)
+			admin.POST("/keys/:kid/retire", keyHandler.RetireKey)
+
+			// Quản lý OAuth client
+			admin.POST("/oauth/clients", oauthClientHandler.CreateClient)
+			admin.GET("/oauth/clients", oauthClientHandler.ListClients)
+			admin.DELETE("/oauth/clients/:client_id", oauthClientHandler.DeleteClient)
 		}
 	}
 
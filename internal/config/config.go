@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,6 +19,231 @@ type Config struct {
 	DBName     string
 	JWTSecret  string
 	ServerPort string
+
+	// Thuật toán ký JWT (HS256, RS256, ES256, EdDSA), file khóa bí mật PEM và kid
+	JWTSigningAlg     string
+	JWTPrivateKeyFile string
+	JWTKeyID          string
+
+	// Khóa mã hóa khóa (KEK, 32 byte dạng base64) dùng để mã hóa khóa ký trước khi lưu vào database
+	SigningKeyEncryptionKey string
+
+	// Chu kỳ nạp lại keyring từ database (đồng bộ khóa giữa các instance)
+	KeyringReloadInterval time.Duration
+
+	// Thời gian sống của access token và refresh token
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// Nơi lưu danh sách JWT bị thu hồi ("db" hoặc "memory") và chu kỳ dọn dẹp
+	RevocationStore           string
+	RevocationCleanupInterval time.Duration
+
+	// Xác thực hai lớp: tên hiển thị trong ứng dụng xác thực và thời gian sống của MFA challenge token
+	MFAIssuer       string
+	MFAChallengeTTL time.Duration
+
+	// Relying party cho WebAuthn/passkey
+	WebAuthnRPID      string
+	WebAuthnRPName    string
+	WebAuthnRPOrigins []string
+
+	// URL gốc của ứng dụng web, dùng để tạo link trong email
+	AppBaseURL string
+
+	// Gửi email: driver ("log", "smtp", "file", "memory"), địa chỉ gửi và ngôn ngữ mặc định của template
+	MailDriver        string
+	MailFrom          string
+	MailDefaultLocale string
+	MailFilePath      string
+
+	// Thông tin kết nối SMTP (MAIL_DRIVER=smtp)
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// Hàng đợi gửi email: kích thước, số worker, số lần thử và thời gian chờ trước lần thử lại đầu tiên
+	MailQueueSize    int
+	MailQueueWorkers int
+	MailMaxAttempts  int
+	MailRetryDelay   time.Duration
+
+	// Gửi SMS: driver ("log", "file", "memory") và file nhận tin nhắn khi SMS_DRIVER=file
+	SMSDriver   string
+	SMSFilePath string
+
+	// Số điện thoại và mã OTP qua SMS: mã quốc gia thêm vào số nội địa bắt đầu bằng 0, cho phép đăng nhập
+	// bằng mã OTP, độ dài và thời gian sống của mã, số lần nhập sai tối đa, khoảng cách tối thiểu giữa hai lần gửi mã
+	PhoneDefaultCountryCode string
+	PhoneLoginEnabled       bool
+	PhoneOTPLength          int
+	PhoneOTPTTL             time.Duration
+	PhoneOTPMaxAttempts     int
+	PhoneOTPResendInterval  time.Duration
+
+	// Gửi email cảnh báo khi tài khoản đăng nhập từ thiết bị mới
+	LoginAlerts bool
+
+	// Chống dò mật khẩu: số lần sai liên tiếp trước khi khóa tài khoản, thời gian khóa ban đầu
+	// (tăng gấp đôi sau mỗi lần sai tiếp theo) và thời gian khóa tối đa
+	LoginMaxFailures        int
+	LoginLockoutDuration    time.Duration
+	LoginLockoutMaxDuration time.Duration
+
+	// Số lần đăng nhập sai tối đa của một IP trong cửa sổ thời gian
+	LoginIPMaxFailures int
+	LoginIPWindow      time.Duration
+
+	// Xác minh email: bắt buộc xác minh trước khi đăng nhập và thời gian sống của token xác minh
+	RequireEmailVerification bool
+	EmailVerificationTTL     time.Duration
+
+	// Thời gian sống của link đặt lại mật khẩu và của lời mời gửi cho user do admin tạo
+	PasswordResetTTL time.Duration
+	InvitationTTL    time.Duration
+
+	// Đăng nhập không mật khẩu bằng link gửi qua email: bật/tắt, thời gian sống của link
+	// và có bắt buộc mở link trên trình duyệt đã yêu cầu (cookie nonce) hay không
+	MagicLinkEnabled     bool
+	MagicLinkTTL         time.Duration
+	MagicLinkBindBrowser bool
+
+	// Giới hạn số request: bật/tắt, nơi lưu trạng thái ("memory" hoặc "db"), thuật toán
+	// ("sliding_window" hoặc "token_bucket") và hạn mức dạng "<số request>/<cửa sổ>" của từng nhóm route
+	RateLimitEnabled   bool
+	RateLimitStore     string
+	RateLimitAlgorithm string
+	RateLimitLogin     string
+	RateLimitRegister  string
+	RateLimitEmail     string
+	RateLimitSMS       string
+	RateLimitPublic    string
+	RateLimitAPI       string
+
+	// Băm mật khẩu: thuật toán cho hash mới ("argon2id" hoặc "bcrypt"), cost của bcrypt
+	// và tham số của argon2id (bộ nhớ KiB, số vòng, số luồng)
+	PasswordHashAlgorithm string
+	BcryptCost            int
+	Argon2Memory          int
+	Argon2Iterations      int
+	Argon2Parallelism     int
+
+	// Chính sách mật khẩu: độ dài, các loại ký tự bắt buộc, điểm độ mạnh tối thiểu (1-4)
+	// và file danh sách mật khẩu bị lộ định dạng SHA-1 của Have I Been Pwned (để trống để tắt)
+	PasswordMinLength     int
+	PasswordMaxLength     int
+	PasswordRequireLower  bool
+	PasswordRequireUpper  bool
+	PasswordRequireDigit  bool
+	PasswordRequireSymbol bool
+	PasswordMinStrength   int
+	PasswordBreachedFile  string
+
+	// Lịch sử mật khẩu: số mật khẩu gần nhất (gồm mật khẩu hiện tại) không được dùng lại,
+	// tuổi tối đa của mật khẩu (0 = không giới hạn) và thời gian sống của token đổi mật khẩu khi hết hạn
+	PasswordHistorySize    int
+	PasswordMaxAge         time.Duration
+	PasswordChangeTokenTTL time.Duration
+
+	// OAuth 2.0 authorization server: issuer (URL gốc của service này), thời gian sống của authorization code,
+	// access token và refresh token cấp cho client, và của phiên đăng nhập (cookie) trên trang /oauth/authorize
+	OAuthIssuer          string
+	OAuthCodeTTL         time.Duration
+	OAuthAccessTokenTTL  time.Duration
+	OAuthRefreshTokenTTL time.Duration
+	OAuthSessionTTL      time.Duration
+
+	// Đăng nhập bằng identity provider bên ngoài (Google, GitHub, IdP nội bộ...): danh sách provider,
+	// tự tạo user mới khi chưa có tài khoản, tự liên kết với tài khoản có cùng email đã xác minh
+	// và thời gian sống của state giữa lúc chuyển sang provider và callback
+	SocialProviders     []SocialProvider
+	SocialAutoProvision bool
+	SocialLinkByEmail   bool
+	SocialStateTTL      time.Duration
+
+	// Các nguồn xác thực username/mật khẩu, thử lần lượt theo thứ tự: "local" (bảng users) và "ldap"
+	AuthBackends []string
+
+	// LDAP/Active Directory: kết nối, tài khoản dịch vụ, cách tìm user (mẫu DN để bind trực tiếp
+	// hoặc base DN + filter), cách lấy nhóm, tên các thuộc tính và ánh xạ nhóm sang role
+	LDAPURL                string
+	LDAPStartTLS           bool
+	LDAPInsecureSkipVerify bool
+	LDAPTimeout            time.Duration
+	LDAPBindDN             string
+	LDAPBindPassword       string
+	LDAPUserDNTemplates    []string
+	LDAPUserBaseDN         string
+	LDAPUserFilter         string
+	LDAPGroupBaseDN        string
+	LDAPGroupFilter        string
+	LDAPGroupAttribute     string
+	LDAPIDAttribute        string
+	LDAPUsernameAttribute  string
+	LDAPEmailAttribute     string
+	LDAPFirstNameAttribute string
+	LDAPLastNameAttribute  string
+	LDAPGroupRoles         []LDAPGroupRole
+	LDAPDefaultRole        string
+
+	// SAML 2.0 service provider: các IdP (đọc từ SAML_<TÊN>_*), khóa và chứng chỉ của SP dùng để ký
+	// AuthnRequest và giải mã assertion, và thời gian tối đa để hoàn tất đăng nhập tại IdP
+	SAMLProviders    []SAMLProvider
+	SAMLSPKeyFile    string
+	SAMLSPCertFile   string
+	SAMLSignRequests bool
+	SAMLRequestTTL   time.Duration
+}
+
+// SAMLProvider là cấu hình của một SAML IdP, đọc từ các biến SAML_<TÊN>_*
+type SAMLProvider struct {
+	Name          string
+	MetadataURL   string
+	MetadataFile  string
+	NameIDFormat  string
+	UsernameAttr  string // Trống = dùng NameID
+	EmailAttr     string
+	FirstNameAttr string
+	LastNameAttr  string
+	RoleAttr      string // Trống = không đồng bộ role
+	RoleMappings  []SAMLRoleMapping
+	DefaultRole   string
+}
+
+// SAMLRoleMapping ánh xạ một giá trị của thuộc tính role trong assertion sang role của user
+type SAMLRoleMapping struct {
+	Value string
+	Role  string
+}
+
+// LDAPGroupRole ánh xạ thành viên của một nhóm LDAP sang role của user
+type LDAPGroupRole struct {
+	GroupDN string
+	Role    string
+}
+
+// SocialProvider là cấu hình của một identity provider, đọc từ các biến SOCIAL_<TÊN>_*.
+// Với google và github, các trường để trống được lấy từ cấu hình sẵn.
+type SocialProvider struct {
+	Name         string
+	Type         string // "oidc" hoặc "oauth2"
+	ClientID     string
+	ClientSecret string
+	Issuer       string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	EmailsURL    string
+	Scopes       []string
+
+	// Tên trường trong response userinfo của provider OAuth 2.0 (mặc định là tên claim chuẩn của OIDC)
+	SubjectField       string
+	UsernameField      string
+	EmailField         string
+	EmailVerifiedField string
+	GivenNameField     string
+	FamilyNameField    string
 }
 
 // LoadConfig tải cấu hình từ file .env
@@ -34,7 +262,294 @@ func LoadConfig() (*Config, error) {
 		DBName:     os.Getenv("DB_NAME"),
 		JWTSecret:  os.Getenv("JWT_SECRET"),
 		ServerPort: os.Getenv("SERVER_PORT"),
+
+		JWTSigningAlg:     getEnv("JWT_SIGNING_ALG", "HS256"),
+		JWTPrivateKeyFile: os.Getenv("JWT_PRIVATE_KEY_FILE"),
+		JWTKeyID:          os.Getenv("JWT_KEY_ID"),
+
+		SigningKeyEncryptionKey: os.Getenv("SIGNING_KEY_ENCRYPTION_KEY"),
+
+		KeyringReloadInterval: getEnvDuration("KEYRING_RELOAD_INTERVAL", time.Minute),
+
+		AccessTokenTTL:  getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+
+		RevocationStore:           getEnv("REVOCATION_STORE", "db"),
+		RevocationCleanupInterval: getEnvDuration("REVOCATION_CLEANUP_INTERVAL", 10*time.Minute),
+
+		MFAIssuer:       getEnv("MFA_ISSUER", "demo_login"),
+		MFAChallengeTTL: getEnvDuration("MFA_CHALLENGE_TTL", 5*time.Minute),
+
+		WebAuthnRPID:      getEnv("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPName:    getEnv("WEBAUTHN_RP_NAME", "demo_login"),
+		WebAuthnRPOrigins: getEnvList("WEBAUTHN_RP_ORIGINS", []string{"http://localhost:8080"}),
+
+		AppBaseURL: getEnv("APP_BASE_URL", "http://localhost:8080"),
+
+		MailDriver:        getEnv("MAIL_DRIVER", "log"),
+		MailFrom:          getEnv("MAIL_FROM", "demo_login <no-reply@localhost>"),
+		MailDefaultLocale: getEnv("MAIL_DEFAULT_LOCALE", "vi"),
+		MailFilePath:      getEnv("MAIL_FILE_PATH", "mail.mbox"),
+
+		SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+
+		MailQueueSize:    getEnvInt("MAIL_QUEUE_SIZE", 100),
+		MailQueueWorkers: getEnvInt("MAIL_QUEUE_WORKERS", 2),
+		MailMaxAttempts:  getEnvInt("MAIL_MAX_ATTEMPTS", 5),
+		MailRetryDelay:   getEnvDuration("MAIL_RETRY_DELAY", 5*time.Second),
+
+		SMSDriver:   getEnv("SMS_DRIVER", "log"),
+		SMSFilePath: getEnv("SMS_FILE_PATH", "sms.log"),
+
+		PhoneDefaultCountryCode: getEnv("PHONE_DEFAULT_COUNTRY_CODE", "84"),
+		PhoneLoginEnabled:       getEnvBool("PHONE_LOGIN_ENABLED", true),
+		PhoneOTPLength:          getEnvInt("PHONE_OTP_LENGTH", 6),
+		PhoneOTPTTL:             getEnvDuration("PHONE_OTP_TTL", 5*time.Minute),
+		PhoneOTPMaxAttempts:     getEnvInt("PHONE_OTP_MAX_ATTEMPTS", 5),
+		PhoneOTPResendInterval:  getEnvDuration("PHONE_OTP_RESEND_INTERVAL", time.Minute),
+
+		LoginAlerts: getEnvBool("LOGIN_ALERTS", false),
+
+		LoginMaxFailures:        getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginLockoutDuration:    getEnvDuration("LOGIN_LOCKOUT_DURATION", 5*time.Minute),
+		LoginLockoutMaxDuration: getEnvDuration("LOGIN_LOCKOUT_MAX_DURATION", 24*time.Hour),
+
+		LoginIPMaxFailures: getEnvInt("LOGIN_IP_MAX_FAILURES", 20),
+		LoginIPWindow:      getEnvDuration("LOGIN_IP_WINDOW", 15*time.Minute),
+
+		RequireEmailVerification: getEnvBool("REQUIRE_EMAIL_VERIFICATION", false),
+		EmailVerificationTTL:     getEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+
+		PasswordResetTTL: getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		InvitationTTL:    getEnvDuration("INVITATION_TTL", 72*time.Hour),
+
+		MagicLinkEnabled:     getEnvBool("MAGIC_LINK_ENABLED", false),
+		MagicLinkTTL:         getEnvDuration("MAGIC_LINK_TTL", 15*time.Minute),
+		MagicLinkBindBrowser: getEnvBool("MAGIC_LINK_BIND_BROWSER", true),
+
+		RateLimitEnabled:   getEnvBool("RATE_LIMIT_ENABLED", true),
+		RateLimitStore:     getEnv("RATE_LIMIT_STORE", "memory"),
+		RateLimitAlgorithm: getEnv("RATE_LIMIT_ALGORITHM", "sliding_window"),
+		RateLimitLogin:     getEnv("RATE_LIMIT_LOGIN", "10/1m"),
+		RateLimitRegister:  getEnv("RATE_LIMIT_REGISTER", "5/1h"),
+		RateLimitEmail:     getEnv("RATE_LIMIT_EMAIL", "5/1h"),
+		RateLimitSMS:       getEnv("RATE_LIMIT_SMS", "5/1h"),
+		RateLimitPublic:    getEnv("RATE_LIMIT_PUBLIC", "60/1m"),
+		RateLimitAPI:       getEnv("RATE_LIMIT_API", "300/1m"),
+
+		PasswordHashAlgorithm: getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		BcryptCost:            getEnvInt("BCRYPT_COST", 10),
+		Argon2Memory:          getEnvInt("ARGON2_MEMORY", 19*1024),
+		Argon2Iterations:      getEnvInt("ARGON2_ITERATIONS", 2),
+		Argon2Parallelism:     getEnvInt("ARGON2_PARALLELISM", 1),
+
+		PasswordMinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength:     getEnvInt("PASSWORD_MAX_LENGTH", 64),
+		PasswordRequireLower:  getEnvBool("PASSWORD_REQUIRE_LOWER", true),
+		PasswordRequireUpper:  getEnvBool("PASSWORD_REQUIRE_UPPER", true),
+		PasswordRequireDigit:  getEnvBool("PASSWORD_REQUIRE_DIGIT", true),
+		PasswordRequireSymbol: getEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+		PasswordMinStrength:   getEnvInt("PASSWORD_MIN_STRENGTH", 2),
+		PasswordBreachedFile:  os.Getenv("PASSWORD_BREACHED_FILE"),
+
+		PasswordHistorySize:    getEnvInt("PASSWORD_HISTORY_SIZE", 5),
+		PasswordMaxAge:         getEnvDuration("PASSWORD_MAX_AGE", 0),
+		PasswordChangeTokenTTL: getEnvDuration("PASSWORD_CHANGE_TOKEN_TTL", 10*time.Minute),
+
+		OAuthIssuer:          strings.TrimRight(getEnv("OAUTH_ISSUER", "http://localhost:8080"), "/"),
+		OAuthCodeTTL:         getEnvDuration("OAUTH_CODE_TTL", time.Minute),
+		OAuthAccessTokenTTL:  getEnvDuration("OAUTH_ACCESS_TOKEN_TTL", time.Hour),
+		OAuthRefreshTokenTTL: getEnvDuration("OAUTH_REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		OAuthSessionTTL:      getEnvDuration("OAUTH_SESSION_TTL", 12*time.Hour),
+
+		SocialProviders:     loadSocialProviders(),
+		SocialAutoProvision: getEnvBool("SOCIAL_AUTO_PROVISION", true),
+		SocialLinkByEmail:   getEnvBool("SOCIAL_LINK_BY_EMAIL", true),
+		SocialStateTTL:      getEnvDuration("SOCIAL_STATE_TTL", 10*time.Minute),
+
+		AuthBackends: getEnvList("AUTH_BACKENDS", []string{"local"}),
+
+		LDAPURL:                getEnv("LDAP_URL", "ldap://localhost:389"),
+		LDAPStartTLS:           getEnvBool("LDAP_START_TLS", false),
+		LDAPInsecureSkipVerify: getEnvBool("LDAP_INSECURE_SKIP_VERIFY", false),
+		LDAPTimeout:            getEnvDuration("LDAP_TIMEOUT", 10*time.Second),
+		LDAPBindDN:             getEnv("LDAP_BIND_DN", ""),
+		LDAPBindPassword:       getEnv("LDAP_BIND_PASSWORD", ""),
+		LDAPUserDNTemplates:    getEnvListSep("LDAP_USER_DN_TEMPLATES", ";", nil),
+		LDAPUserBaseDN:         getEnv("LDAP_USER_BASE_DN", ""),
+		LDAPUserFilter:         getEnv("LDAP_USER_FILTER", "(uid={username})"),
+		LDAPGroupBaseDN:        getEnv("LDAP_GROUP_BASE_DN", ""),
+		LDAPGroupFilter:        getEnv("LDAP_GROUP_FILTER", "(|(member={dn})(uniqueMember={dn}))"),
+		LDAPGroupAttribute:     getEnv("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+		LDAPIDAttribute:        getEnv("LDAP_ID_ATTRIBUTE", ""),
+		LDAPUsernameAttribute:  getEnv("LDAP_USERNAME_ATTRIBUTE", "uid"),
+		LDAPEmailAttribute:     getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+		LDAPFirstNameAttribute: getEnv("LDAP_FIRST_NAME_ATTRIBUTE", "givenName"),
+		LDAPLastNameAttribute:  getEnv("LDAP_LAST_NAME_ATTRIBUTE", "sn"),
+		LDAPGroupRoles:         loadLDAPGroupRoles(),
+		LDAPDefaultRole:        getEnv("LDAP_DEFAULT_ROLE", "user"),
+
+		SAMLProviders:    loadSAMLProviders(),
+		SAMLSPKeyFile:    getEnv("SAML_SP_KEY_FILE", ""),
+		SAMLSPCertFile:   getEnv("SAML_SP_CERT_FILE", ""),
+		SAMLSignRequests: getEnvBool("SAML_SIGN_REQUESTS", true),
+		SAMLRequestTTL:   getEnvDuration("SAML_REQUEST_TTL", 10*time.Minute),
 	}
 
 	return config, nil
 }
+
+// getEnv đọc biến môi trường, trả về giá trị mặc định nếu biến không tồn tại
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// loadSocialProviders đọc cấu hình các provider trong SOCIAL_PROVIDERS (vd: "google,github,corp")
+func loadSocialProviders() []SocialProvider {
+	var providers []SocialProvider
+	for _, name := range getEnvList("SOCIAL_PROVIDERS", nil) {
+		name = strings.ToLower(name)
+		prefix := "SOCIAL_" + strings.ToUpper(name) + "_"
+		providers = append(providers, SocialProvider{
+			Name:               name,
+			Type:               getEnv(prefix+"TYPE", ""),
+			ClientID:           getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret:       getEnv(prefix+"CLIENT_SECRET", ""),
+			Issuer:             getEnv(prefix+"ISSUER", ""),
+			AuthURL:            getEnv(prefix+"AUTH_URL", ""),
+			TokenURL:           getEnv(prefix+"TOKEN_URL", ""),
+			UserInfoURL:        getEnv(prefix+"USERINFO_URL", ""),
+			EmailsURL:          getEnv(prefix+"EMAILS_URL", ""),
+			Scopes:             strings.Fields(getEnv(prefix+"SCOPES", "")),
+			SubjectField:       getEnv(prefix+"SUBJECT_FIELD", ""),
+			UsernameField:      getEnv(prefix+"USERNAME_FIELD", ""),
+			EmailField:         getEnv(prefix+"EMAIL_FIELD", ""),
+			EmailVerifiedField: getEnv(prefix+"EMAIL_VERIFIED_FIELD", ""),
+			GivenNameField:     getEnv(prefix+"GIVEN_NAME_FIELD", ""),
+			FamilyNameField:    getEnv(prefix+"FAMILY_NAME_FIELD", ""),
+		})
+	}
+	return providers
+}
+
+// loadSAMLProviders đọc cấu hình các IdP trong SAML_PROVIDERS (vd: "acme,globex")
+func loadSAMLProviders() []SAMLProvider {
+	var providers []SAMLProvider
+	for _, name := range getEnvList("SAML_PROVIDERS", nil) {
+		name = strings.ToLower(name)
+		prefix := "SAML_" + strings.ToUpper(name) + "_"
+		provider := SAMLProvider{
+			Name:          name,
+			MetadataURL:   getEnv(prefix+"METADATA_URL", ""),
+			MetadataFile:  getEnv(prefix+"METADATA_FILE", ""),
+			NameIDFormat:  getEnv(prefix+"NAMEID_FORMAT", "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"),
+			UsernameAttr:  getEnv(prefix+"USERNAME_ATTRIBUTE", ""),
+			EmailAttr:     getEnv(prefix+"EMAIL_ATTRIBUTE", "email"),
+			FirstNameAttr: getEnv(prefix+"FIRST_NAME_ATTRIBUTE", "givenName"),
+			LastNameAttr:  getEnv(prefix+"LAST_NAME_ATTRIBUTE", "sn"),
+			RoleAttr:      getEnv(prefix+"ROLE_ATTRIBUTE", ""),
+			DefaultRole:   getEnv(prefix+"DEFAULT_ROLE", "user"),
+		}
+		for _, item := range getEnvListSep(prefix+"ROLE_MAPPING", ";", nil) {
+			i := strings.LastIndex(item, ":")
+			if i <= 0 || i == len(item)-1 {
+				continue
+			}
+			provider.RoleMappings = append(provider.RoleMappings, SAMLRoleMapping{
+				Value: strings.TrimSpace(item[:i]),
+				Role:  strings.TrimSpace(item[i+1:]),
+			})
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// loadLDAPGroupRoles đọc LDAP_GROUP_ROLES dạng "<DN nhóm>:<role>;<DN nhóm>:<role>".
+// DN chứa dấu phẩy nên các cặp được phân tách bằng dấu chấm phẩy; mục không hợp lệ bị bỏ qua.
+func loadLDAPGroupRoles() []LDAPGroupRole {
+	var mappings []LDAPGroupRole
+	for _, item := range getEnvListSep("LDAP_GROUP_ROLES", ";", nil) {
+		i := strings.LastIndex(item, ":")
+		if i <= 0 || i == len(item)-1 {
+			continue
+		}
+		mappings = append(mappings, LDAPGroupRole{
+			GroupDN: strings.TrimSpace(item[:i]),
+			Role:    strings.TrimSpace(item[i+1:]),
+		})
+	}
+	return mappings
+}
+
+// getEnvList đọc biến môi trường dạng danh sách phân tách bằng dấu phẩy
+func getEnvList(key string, defaultValue []string) []string {
+	return getEnvListSep(key, ",", defaultValue)
+}
+
+// getEnvListSep đọc biến môi trường dạng danh sách phân tách bằng sep
+func getEnvListSep(key, sep string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvInt đọc biến môi trường dạng số nguyên dương,
+// trả về giá trị mặc định nếu biến không tồn tại hoặc không hợp lệ
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid value for %s: %q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvBool đọc biến môi trường dạng boolean ("true", "1"...),
+// trả về giá trị mặc định nếu biến không tồn tại hoặc không hợp lệ
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value for %s: %q, using default %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+// getEnvDuration đọc biến môi trường dạng duration (vd: "15m", "168h"),
+// trả về giá trị mặc định nếu biến không tồn tại hoặc không hợp lệ
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid value for %s: %q, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// APIKeyHandler xử lý các yêu cầu quản lý API key của user
+type APIKeyHandler struct {
+	apiKeyService services.APIKeyService
+	logger        *logger.Logger
+}
+
+// NewAPIKeyHandler tạo một instance mới của APIKeyHandler
+func NewAPIKeyHandler(apiKeyService services.APIKeyService, logger *logger.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+		logger:        logger,
+	}
+}
+
+// CreateAPIKeyRequest chứa thông tin API key cần tạo
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=3650"` // Bỏ trống = không hết hạn
+}
+
+// CreateAPIKey xử lý yêu cầu tạo API key mới. Key chỉ được trả về một lần trong response này.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	expiresIn := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	apiKey, rawKey, err := h.apiKeyService.CreateKey(userID.(uuid.UUID), req.Name, req.Scopes, expiresIn)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidScope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scope", "valid_scopes": services.Scopes})
+			return
+		}
+		h.logger.Errorf("CreateAPIKey error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create api key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "api key created successfully, store the key now as it will not be shown again",
+		"key":     rawKey,
+		"api_key": apiKey,
+	})
+}
+
+// ListAPIKeys xử lý yêu cầu lấy danh sách API key của user
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	apiKeys, err := h.apiKeyService.ListKeys(userID.(uuid.UUID))
+	if err != nil {
+		h.logger.Errorf("ListAPIKeys error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get api keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": apiKeys})
+}
+
+// RevokeAPIKey xử lý yêu cầu thu hồi một API key
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	keyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key id"})
+		return
+	}
+
+	if err := h.apiKeyService.RevokeKey(userID.(uuid.UUID), keyID); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+			return
+		}
+		h.logger.Errorf("RevokeAPIKey error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke api key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "api key revoked successfully"})
+}
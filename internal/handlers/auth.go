@@ -1,13 +1,19 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/Thanhdat-debug/demo_login/internal/services"
 	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/Thanhdat-debug/demo_login/pkg/password"
 	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/google/uuid"
 )
 
 // AuthHandler xử lý các yêu cầu liên quan đến xác thực
@@ -28,9 +34,10 @@ func NewAuthHandler(authService services.AuthService, logger *logger.Logger) *Au
 type RegisterRequest struct {
 	Username  string `json:"username" binding:"required,min=3,max=50"`
 	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password" binding:"required,min=6"`
+	Password  string `json:"password" binding:"required"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
+	Locale    string `json:"locale" binding:"omitempty,oneof=vi en"`
 }
 
 // Register xử lý yêu cầu đăng ký
@@ -48,6 +55,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		req.Password,
 		req.FirstName,
 		req.LastName,
+		req.Locale,
 	)
 
 	if err != nil {
@@ -55,6 +63,9 @@ func (h *AuthHandler) Register(c *gin.Context) {
 			c.JSON(http.StatusConflict, gin.H{"error": "username or email already exists"})
 			return
 		}
+		if writePasswordPolicyResponse(c, err) {
+			return
+		}
 		h.logger.Errorf("Register error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register user"})
 		return
@@ -78,24 +89,355 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Gọi service để đăng nhập
-	token, userResponse, err := h.authService.Login(req.UsernameOrEmail, req.Password)
+	result, err := h.authService.Login(req.UsernameOrEmail, req.Password, clientInfo(c))
 	if err != nil {
 		if errors.Is(err, services.ErrInvalidCredentials) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username/email or password"})
 			return
 		}
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "email address has not been verified"})
+			return
+		}
+		if errors.Is(err, services.ErrManagedAccount) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "this account must sign in through the organization identity provider"})
+			return
+		}
+		if errors.Is(err, services.ErrAuthBackendUnavailable) {
+			h.logger.Errorf("Login error: %v", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "authentication service unavailable"})
+			return
+		}
+		if errors.Is(err, services.ErrLDAPAccountConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "a local account with this email already exists, contact an administrator"})
+			return
+		}
+		if errors.Is(err, services.ErrLDAPEmailRequired) {
+			c.JSON(http.StatusConflict, gin.H{"error": "directory account has no email address, contact an administrator"})
+			return
+		}
+		if writeLockoutResponse(c, err) {
+			return
+		}
 		h.logger.Errorf("Login error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
 		return
 	}
 
+	writeLoginResponse(c, result)
+}
+
+// writeLockoutResponse trả về 423 (tài khoản bị khóa) hoặc 429 (IP đăng nhập sai quá nhiều)
+// kèm header Retry-After nếu err là lỗi khóa đăng nhập
+func writeLockoutResponse(c *gin.Context, err error) bool {
+	var lockoutErr *services.LockoutError
+	if !errors.As(err, &lockoutErr) {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(lockoutErr.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+	if errors.Is(err, services.ErrAccountLocked) {
+		c.JSON(http.StatusLocked, gin.H{"error": "account is temporarily locked", "retry_after": retryAfter})
+	} else {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed login attempts", "retry_after": retryAfter})
+	}
+	return true
+}
+
+// writePasswordPolicyResponse trả về 400 kèm danh sách quy tắc bị vi phạm nếu err là lỗi chính sách mật khẩu
+// hoặc mật khẩu mới trùng một mật khẩu gần đây
+func writePasswordPolicyResponse(c *gin.Context, err error) bool {
+	violations := passwordPolicyViolations(err)
+	if violations == nil {
+		return false
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"error": "password does not meet policy", "violations": violations})
+	return true
+}
+
+// passwordPolicyViolations trả về các vi phạm chính sách mật khẩu trong err, nil nếu err không phải lỗi chính sách
+func passwordPolicyViolations(err error) []password.Violation {
+	var policyErr *password.PolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		return policyErr.Violations
+	case errors.Is(err, services.ErrPasswordReused):
+		return []password.Violation{{Rule: "history", Message: "password must not be one of your recent passwords"}}
+	default:
+		return nil
+	}
+}
+
+// writeLoginResponse trả về kết quả đăng nhập: cặp token, hoặc MFA challenge nếu cần thêm bước xác thực
+func writeLoginResponse(c *gin.Context, result *services.LoginResult) {
+	if result.MFARequired {
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "mfa verification required",
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+			"mfa_methods":  result.MFAMethods,
+		})
+		return
+	}
+	if result.PasswordChangeRequired {
+		c.JSON(http.StatusOK, gin.H{
+			"message":                  "password expired, password change required",
+			"password_change_required": true,
+			"password_change_token":    result.PasswordChangeToken,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "login successful",
-		"token":   token,
-		"user":    userResponse,
+		"message":       "login successful",
+		"token":         result.Tokens.AccessToken,
+		"refresh_token": result.Tokens.RefreshToken,
+		"expires_in":    result.Tokens.ExpiresIn,
+		"user":          result.User,
 	})
 }
 
+// ChangeExpiredPasswordRequest chứa token đổi mật khẩu nhận được khi đăng nhập và mật khẩu mới
+type ChangeExpiredPasswordRequest struct {
+	PasswordChangeToken string `json:"password_change_token" binding:"required"`
+	NewPassword         string `json:"new_password" binding:"required"`
+}
+
+// ChangeExpiredPassword xử lý yêu cầu đổi mật khẩu đã hết hạn để hoàn tất đăng nhập
+func (h *AuthHandler) ChangeExpiredPassword(c *gin.Context) {
+	var req ChangeExpiredPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.authService.ChangeExpiredPassword(req.PasswordChangeToken, req.NewPassword, clientInfo(c))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPasswordChangeToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired password change token"})
+			return
+		}
+		if writePasswordPolicyResponse(c, err) {
+			return
+		}
+		h.logger.Errorf("ChangeExpiredPassword error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+		return
+	}
+
+	writeLoginResponse(c, result)
+}
+
+// VerifyMFARequest chứa MFA challenge token và mã xác thực từ client
+type VerifyMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// VerifyMFA xử lý bước thứ hai của đăng nhập khi user đã bật MFA
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req VerifyMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.authService.VerifyMFA(req.MFAToken, req.Code, clientInfo(c))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidMFAToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token"})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidMFACode) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid mfa code"})
+			return
+		}
+		if errors.Is(err, services.ErrMFAMethodNotEnabled) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "totp is not enabled"})
+			return
+		}
+		if writeLockoutResponse(c, err) {
+			return
+		}
+		h.logger.Errorf("VerifyMFA error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify mfa code"})
+		return
+	}
+
+	writeLoginResponse(c, result)
+}
+
+// MFAWebAuthnBeginRequest chứa MFA challenge token để bắt đầu xác thực bằng passkey
+type MFAWebAuthnBeginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// BeginMFAWebAuthn xử lý yêu cầu lấy WebAuthn challenge cho bước thứ hai của đăng nhập
+func (h *AuthHandler) BeginMFAWebAuthn(c *gin.Context) {
+	var req MFAWebAuthnBeginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	assertion, challengeID, err := h.authService.BeginMFAWebAuthn(req.MFAToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidMFAToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token"})
+			return
+		}
+		if errors.Is(err, services.ErrMFAMethodNotEnabled) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "no passkey registered"})
+			return
+		}
+		h.logger.Errorf("BeginMFAWebAuthn error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin webauthn verification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"challenge_id": challengeID, "options": assertion})
+}
+
+// MFAWebAuthnFinishRequest chứa MFA challenge token và phản hồi của authenticator
+type MFAWebAuthnFinishRequest struct {
+	MFAToken    string          `json:"mfa_token" binding:"required"`
+	ChallengeID uuid.UUID       `json:"challenge_id" binding:"required"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+}
+
+// VerifyMFAWebAuthn xử lý bước thứ hai của đăng nhập bằng passkey
+func (h *AuthHandler) VerifyMFAWebAuthn(c *gin.Context) {
+	var req MFAWebAuthnFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webauthn credential"})
+		return
+	}
+
+	result, err := h.authService.VerifyMFAWebAuthn(req.MFAToken, req.ChallengeID, response, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidMFAToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token"})
+		case errors.Is(err, services.ErrInvalidChallenge):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired webauthn challenge"})
+		case errors.Is(err, services.ErrWebAuthnFailed):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "webauthn verification failed"})
+		default:
+			h.logger.Errorf("VerifyMFAWebAuthn error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify webauthn"})
+		}
+		return
+	}
+
+	writeLoginResponse(c, result)
+}
+
+// PasskeyLoginBeginRequest chứa username/email (không bắt buộc) để bắt đầu đăng nhập bằng passkey
+type PasskeyLoginBeginRequest struct {
+	UsernameOrEmail string `json:"username_or_email"`
+}
+
+// BeginPasskeyLogin xử lý yêu cầu lấy WebAuthn challenge để đăng nhập không mật khẩu
+func (h *AuthHandler) BeginPasskeyLogin(c *gin.Context) {
+	var req PasskeyLoginBeginRequest
+	// Body có thể rỗng khi dùng discoverable credential
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	assertion, challengeID, err := h.authService.BeginPasskeyLogin(req.UsernameOrEmail)
+	if err != nil {
+		h.logger.Errorf("BeginPasskeyLogin error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin passkey login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"challenge_id": challengeID, "options": assertion})
+}
+
+// PasskeyLoginFinishRequest chứa phản hồi của authenticator khi đăng nhập bằng passkey
+type PasskeyLoginFinishRequest struct {
+	ChallengeID uuid.UUID       `json:"challenge_id" binding:"required"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+}
+
+// FinishPasskeyLogin xử lý yêu cầu hoàn tất đăng nhập bằng passkey
+func (h *AuthHandler) FinishPasskeyLogin(c *gin.Context) {
+	var req PasskeyLoginFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webauthn credential"})
+		return
+	}
+
+	result, err := h.authService.FinishPasskeyLogin(req.ChallengeID, response, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidChallenge):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired webauthn challenge"})
+		case errors.Is(err, services.ErrWebAuthnFailed):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "webauthn verification failed"})
+		case errors.Is(err, services.ErrEmailNotVerified):
+			c.JSON(http.StatusForbidden, gin.H{"error": "email address has not been verified"})
+		case errors.Is(err, services.ErrManagedAccount):
+			c.JSON(http.StatusForbidden, gin.H{"error": "this account must sign in through the organization identity provider"})
+		default:
+			h.logger.Errorf("FinishPasskeyLogin error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login with passkey"})
+		}
+		return
+	}
+
+	writeLoginResponse(c, result)
+}
+
+// RefreshRequest chứa refresh token từ client
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh xử lý yêu cầu đổi refresh token lấy cặp token mới
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.authService.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+			return
+		}
+		h.logger.Errorf("Refresh error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
 // ValidateToken xử lý yêu cầu kiểm tra token
 func (h *AuthHandler) ValidateToken(c *gin.Context) {
 	authHeader := c.GetHeader("Authorization")
@@ -121,5 +463,64 @@ func (h *AuthHandler) ValidateToken(c *gin.Context) {
 		return
 	}
 
+	// Token đã logout thì không còn hợp lệ
+	claims, ok := token.Claims.(*services.Claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+	revoked, err := h.authService.IsTokenRevoked(claims)
+	if err != nil {
+		h.logger.Errorf("ValidateToken error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to validate token"})
+		return
+	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "token is valid"})
 }
+
+// LogoutRequest chứa refresh token (tùy chọn) cần thu hồi cùng access token
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Logout xử lý yêu cầu đăng xuất, thu hồi access token hiện tại
+func (h *AuthHandler) Logout(c *gin.Context) {
+	// Lấy claims từ context (đã được set bởi JWTAuthMiddleware)
+	value, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Body là tùy chọn nên bỏ qua lỗi khi không có body
+	var req LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := h.authService.Logout(value.(*services.Claims), req.RefreshToken); err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid refresh token"})
+			return
+		}
+		h.logger.Errorf("Logout error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to logout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logout successful"})
+}
+
+// JWKS trả về các khóa công khai để các service khác tự xác thực token
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.authService.JWKS())
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// EmailVerificationHandler xử lý các yêu cầu xác minh email
+type EmailVerificationHandler struct {
+	emailVerificationService services.EmailVerificationService
+	logger                   *logger.Logger
+}
+
+// NewEmailVerificationHandler tạo một instance mới của EmailVerificationHandler
+func NewEmailVerificationHandler(emailVerificationService services.EmailVerificationService, logger *logger.Logger) *EmailVerificationHandler {
+	return &EmailVerificationHandler{
+		emailVerificationService: emailVerificationService,
+		logger:                   logger,
+	}
+}
+
+// VerifyEmailRequest chứa token xác minh từ email
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyEmail xử lý yêu cầu xác minh email
+func (h *EmailVerificationHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userResponse, err := h.emailVerificationService.VerifyEmail(req.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired verification token"})
+			return
+		}
+		h.logger.Errorf("VerifyEmail error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email verified successfully", "user": userResponse})
+}
+
+// ResendVerificationRequest chứa email cần gửi lại link xác minh
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResendVerification xử lý yêu cầu gửi lại email xác minh
+func (h *EmailVerificationHandler) ResendVerification(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.emailVerificationService.ResendVerification(req.Email); err != nil {
+		h.logger.Errorf("ResendVerification error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send verification email"})
+		return
+	}
+
+	// Luôn trả về cùng một thông báo để không tiết lộ email có tồn tại hay không
+	c.JSON(http.StatusOK, gin.H{"message": "if the email is registered and not yet verified, a verification link has been sent"})
+}
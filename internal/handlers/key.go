@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Thanhdat-debug/demo_login/internal/keys"
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// KeyHandler xử lý các yêu cầu quản lý khóa ký JWT (admin only)
+type KeyHandler struct {
+	keyService services.KeyService
+	logger     *logger.Logger
+}
+
+// NewKeyHandler tạo một instance mới của KeyHandler
+func NewKeyHandler(keyService services.KeyService, logger *logger.Logger) *KeyHandler {
+	return &KeyHandler{
+		keyService: keyService,
+		logger:     logger,
+	}
+}
+
+// ListKeys xử lý yêu cầu lấy danh sách khóa ký
+func (h *KeyHandler) ListKeys(c *gin.Context) {
+	signingKeys, err := h.keyService.ListKeys()
+	if err != nil {
+		h.logger.Errorf("ListKeys error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get signing keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": signingKeys})
+}
+
+// GenerateKeyRequest chứa thuật toán của khóa cần sinh
+type GenerateKeyRequest struct {
+	Algorithm string `json:"algorithm" binding:"required,oneof=HS256 RS256 ES256 EdDSA"`
+}
+
+// GenerateKey xử lý yêu cầu sinh khóa mới (ở trạng thái chỉ xác thực)
+func (h *KeyHandler) GenerateKey(c *gin.Context) {
+	var req GenerateKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	signingKey, err := h.keyService.GenerateKey(req.Algorithm)
+	if err != nil {
+		if errors.Is(err, keys.ErrUnsupportedAlgorithm) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported algorithm"})
+			return
+		}
+		h.logger.Errorf("GenerateKey error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate signing key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "signing key generated successfully", "key": signingKey})
+}
+
+// PromoteKey xử lý yêu cầu chuyển một khóa thành khóa ký đang hoạt động
+func (h *KeyHandler) PromoteKey(c *gin.Context) {
+	if err := h.keyService.PromoteKey(c.Param("kid")); err != nil {
+		if errors.Is(err, services.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "signing key not found"})
+			return
+		}
+		h.logger.Errorf("PromoteKey error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to promote signing key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "signing key promoted successfully"})
+}
+
+// RetireKey xử lý yêu cầu loại bỏ một khóa không còn dùng
+func (h *KeyHandler) RetireKey(c *gin.Context) {
+	if err := h.keyService.RetireKey(c.Param("kid")); err != nil {
+		switch {
+		case errors.Is(err, services.ErrKeyNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "signing key not found"})
+		case errors.Is(err, services.ErrKeyActive):
+			c.JSON(http.StatusConflict, gin.H{"error": "cannot retire the active signing key"})
+		case errors.Is(err, services.ErrKeyStillInUse):
+			c.JSON(http.StatusConflict, gin.H{"error": "tokens signed with this key may not have expired yet"})
+		default:
+			h.logger.Errorf("RetireKey error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retire signing key"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "signing key retired successfully"})
+}
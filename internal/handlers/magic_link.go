@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// magicLinkNonceCookie gắn link đăng nhập với trình duyệt đã yêu cầu link
+const magicLinkNonceCookie = "magic_link_nonce"
+
+// MagicLinkHandler xử lý các request đăng nhập bằng link gửi qua email
+type MagicLinkHandler struct {
+	magicLinkService services.MagicLinkService
+	config           *config.Config
+	logger           *logger.Logger
+}
+
+// NewMagicLinkHandler tạo một instance mới của MagicLinkHandler
+func NewMagicLinkHandler(magicLinkService services.MagicLinkService, config *config.Config, logger *logger.Logger) *MagicLinkHandler {
+	return &MagicLinkHandler{
+		magicLinkService: magicLinkService,
+		config:           config,
+		logger:           logger,
+	}
+}
+
+// MagicLinkRequest chứa email nhận link đăng nhập
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// RequestLink xử lý yêu cầu gửi link đăng nhập
+func (h *MagicLinkHandler) RequestLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nonce, err := h.magicLinkService.RequestLink(req.Email)
+	if err != nil {
+		if errors.Is(err, services.ErrMagicLinkDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "magic link login is disabled"})
+			return
+		}
+		// Lỗi chỉ được ghi log, client luôn nhận cùng một phản hồi để không tiết lộ email có tồn tại hay không
+		h.logger.Errorf("RequestMagicLink error: %v", err)
+	}
+
+	if nonce != "" {
+		h.setNonceCookie(c, nonce, int(h.config.MagicLinkTTL.Seconds()))
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "if the email is registered, a sign-in link has been sent"})
+}
+
+// ConsumeMagicLinkRequest chứa token trong link đăng nhập
+type ConsumeMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// Consume đăng nhập bằng token trong link; trả về kết quả như AuthHandler.Login
+func (h *MagicLinkHandler) Consume(c *gin.Context) {
+	var req ConsumeMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nonce, _ := c.Cookie(magicLinkNonceCookie)
+	result, err := h.magicLinkService.Consume(req.Token, nonce, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMagicLinkDisabled):
+			c.JSON(http.StatusNotFound, gin.H{"error": "magic link login is disabled"})
+		case errors.Is(err, services.ErrInvalidMagicLink):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired magic link, request a new link from this browser"})
+		case errors.Is(err, services.ErrEmailNotVerified):
+			c.JSON(http.StatusForbidden, gin.H{"error": "email address has not been verified"})
+		case errors.Is(err, services.ErrManagedAccount):
+			c.JSON(http.StatusForbidden, gin.H{"error": "this account must sign in through the organization identity provider"})
+		default:
+			if writeLockoutResponse(c, err) {
+				return
+			}
+			h.logger.Errorf("ConsumeMagicLink error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+		}
+		return
+	}
+
+	h.setNonceCookie(c, "", -1)
+	writeLoginResponse(c, result)
+}
+
+// setNonceCookie đặt (hoặc xóa khi maxAge < 0) cookie nonce, chỉ gửi kèm các request tới /api/auth/magic-link
+func (h *MagicLinkHandler) setNonceCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	secure := strings.HasPrefix(h.config.OAuthIssuer, "https://")
+	c.SetCookie(magicLinkNonceCookie, value, maxAge, "/api/auth/magic-link", "", secure, true)
+}
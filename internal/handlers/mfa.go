@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// MFAHandler xử lý các yêu cầu bật/tắt xác thực hai lớp của user
+type MFAHandler struct {
+	mfaService services.MFAService
+	logger     *logger.Logger
+}
+
+// NewMFAHandler tạo một instance mới của MFAHandler
+func NewMFAHandler(mfaService services.MFAService, logger *logger.Logger) *MFAHandler {
+	return &MFAHandler{
+		mfaService: mfaService,
+		logger:     logger,
+	}
+}
+
+// MFACodeRequest chứa mã TOTP (hoặc mã khôi phục) từ client
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// SetupTOTP xử lý yêu cầu sinh secret TOTP mới
+func (h *MFAHandler) SetupTOTP(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	setup, err := h.mfaService.SetupTOTP(userID.(uuid.UUID))
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if errors.Is(err, services.ErrMFAAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "mfa is already enabled"})
+			return
+		}
+		h.logger.Errorf("SetupTOTP error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to setup totp"})
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// ConfirmTOTP xử lý yêu cầu xác nhận mã TOTP đầu tiên để bật MFA
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recoveryCodes, err := h.mfaService.ConfirmTOTP(userID.(uuid.UUID), req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case errors.Is(err, services.ErrMFAAlreadyEnabled):
+			c.JSON(http.StatusConflict, gin.H{"error": "mfa is already enabled"})
+		case errors.Is(err, services.ErrMFASetupRequired):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "totp setup is required first"})
+		case errors.Is(err, services.ErrInvalidMFACode):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mfa code"})
+		default:
+			h.logger.Errorf("ConfirmTOTP error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to confirm totp"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "mfa enabled successfully",
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// DisableTOTP xử lý yêu cầu tắt MFA
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.mfaService.DisableTOTP(userID.(uuid.UUID), req.Code); err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case errors.Is(err, services.ErrMFANotEnabled):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mfa is not enabled"})
+		case errors.Is(err, services.ErrInvalidMFACode):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mfa code"})
+		default:
+			h.logger.Errorf("DisableTOTP error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable totp"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "mfa disabled successfully"})
+}
@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"embed"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/Thanhdat-debug/demo_login/pkg/password"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/google/uuid"
+)
+
+// oauthSessionCookie là tên cookie giữ phiên đăng nhập trên authorization server
+const oauthSessionCookie = "oauth_session"
+
+//go:embed templates/oauth/*.html
+var oauthTemplateFS embed.FS
+
+// oauthTemplates là các trang đăng nhập/consent của /oauth/authorize
+var oauthTemplates = template.Must(template.ParseFS(oauthTemplateFS, "templates/oauth/*.html"))
+
+// oauthPage là dữ liệu hiển thị trên các trang của /oauth/authorize
+type oauthPage struct {
+	Title      string
+	Error      string
+	Request    string // Authorization request đã được ký
+	ClientName string
+	Username   string
+	Scopes     []string
+	Token      string // MFA token hoặc password change token của bước đăng nhập hiện tại
+	Violations []password.Violation
+}
+
+// OAuthHandler xử lý authorization endpoint, token endpoint của OAuth 2.0 và các endpoint của OpenID Connect
+type OAuthHandler struct {
+	oauthService  services.OAuthService
+	clientService services.OAuthClientService
+	authService   services.AuthService
+	config        *config.Config
+	logger        *logger.Logger
+}
+
+// NewOAuthHandler tạo một instance mới của OAuthHandler
+func NewOAuthHandler(oauthService services.OAuthService, clientService services.OAuthClientService, authService services.AuthService, config *config.Config, logger *logger.Logger) *OAuthHandler {
+	return &OAuthHandler{
+		oauthService:  oauthService,
+		clientService: clientService,
+		authService:   authService,
+		config:        config,
+		logger:        logger,
+	}
+}
+
+// Authorize xử lý GET /oauth/authorize: kiểm tra request, hiển thị trang đăng nhập hoặc consent,
+// hoặc cấp code ngay nếu user đã đăng nhập và đã đồng ý trước đó
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	req := &services.AuthorizeRequest{
+		ResponseType:        c.Query("response_type"),
+		ClientID:            c.Query("client_id"),
+		RedirectURI:         c.Query("redirect_uri"),
+		Scope:               c.Query("scope"),
+		State:               c.Query("state"),
+		CodeChallenge:       c.Query("code_challenge"),
+		CodeChallengeMethod: c.Query("code_challenge_method"),
+		Nonce:               c.Query("nonce"),
+		Prompt:              c.Query("prompt"),
+		MaxAge:              c.Query("max_age"),
+	}
+
+	client, ok := h.validateAuthorizeRequest(c, req)
+	if !ok {
+		return
+	}
+
+	session, err := h.currentSession(c)
+	if err != nil {
+		h.logger.Errorf("OAuth session error: %v", err)
+		h.renderError(c, http.StatusInternalServerError, "failed to process authorization request")
+		return
+	}
+	if session != nil && h.oauthService.RequiresLogin(req, session) {
+		session = nil
+	}
+	if session == nil {
+		if req.HasPrompt(services.PromptNone) {
+			c.Redirect(http.StatusFound, h.oauthService.ErrorRedirect(req, &services.OAuthError{
+				Code:        services.OAuthErrLoginRequired,
+				Description: "user authentication is required",
+			}))
+			return
+		}
+		h.renderLogin(c, http.StatusOK, req, client, "", "")
+		return
+	}
+
+	h.continueAuthorize(c, req, client, session)
+}
+
+// AuthorizeSubmit xử lý POST /oauth/authorize từ các form đăng nhập, MFA, đổi mật khẩu và consent
+func (h *OAuthHandler) AuthorizeSubmit(c *gin.Context) {
+	req, sessionID, err := h.oauthService.DecodeAuthorizeRequest(c.PostForm("request"))
+	if err != nil {
+		h.renderError(c, http.StatusBadRequest, "the authorization request is invalid or has expired, please start again")
+		return
+	}
+
+	// Client có thể đã bị xóa hoặc thay đổi từ lúc bắt đầu request
+	client, ok := h.validateAuthorizeRequest(c, req)
+	if !ok {
+		return
+	}
+
+	switch c.PostForm("action") {
+	case "login":
+		username := c.PostForm("username")
+		result, err := h.authService.LoginSession(username, c.PostForm("password"), clientInfo(c))
+		h.handleLoginResult(c, req, client, result, err, func(status int, message string) {
+			h.renderLogin(c, status, req, client, username, message)
+		})
+	case "mfa":
+		mfaToken := c.PostForm("mfa_token")
+		result, err := h.authService.VerifyMFASession(mfaToken, c.PostForm("code"), clientInfo(c))
+		h.handleLoginResult(c, req, client, result, err, func(status int, message string) {
+			h.renderMFA(c, status, req, mfaToken, message)
+		})
+	case "password_change":
+		token := c.PostForm("password_change_token")
+		result, err := h.authService.ChangeExpiredPasswordSession(token, c.PostForm("new_password"), clientInfo(c))
+		if violations := passwordPolicyViolations(err); violations != nil {
+			h.renderPasswordChange(c, http.StatusBadRequest, req, token, "password does not meet policy", violations)
+			return
+		}
+		h.handleLoginResult(c, req, client, result, err, func(status int, message string) {
+			h.renderPasswordChange(c, status, req, token, message, nil)
+		})
+	case "consent":
+		h.consent(c, req, client, sessionID)
+	default:
+		h.renderError(c, http.StatusBadRequest, "invalid action")
+	}
+}
+
+// consent xử lý quyết định của user trên trang consent
+func (h *OAuthHandler) consent(c *gin.Context, req *services.AuthorizeRequest, client *models.OAuthClient, sessionID uuid.UUID) {
+	session, err := h.currentSession(c)
+	if err != nil {
+		h.logger.Errorf("OAuth session error: %v", err)
+		h.renderError(c, http.StatusInternalServerError, "failed to process authorization request")
+		return
+	}
+	// Form consent chỉ hợp lệ với đúng phiên đăng nhập đã hiển thị nó
+	if session == nil || sessionID == uuid.Nil || session.SessionID != sessionID {
+		h.renderLogin(c, http.StatusUnauthorized, req, client, "", "your session has expired, please sign in again")
+		return
+	}
+
+	switch c.PostForm("decision") {
+	case "allow":
+		h.issueCode(c, req, session, true)
+	case "deny":
+		c.Redirect(http.StatusFound, h.oauthService.ErrorRedirect(req, &services.OAuthError{
+			Code:        services.OAuthErrAccessDenied,
+			Description: "the user denied the request",
+		}))
+	default:
+		h.renderError(c, http.StatusBadRequest, "invalid decision")
+	}
+}
+
+// handleLoginResult xử lý kết quả của một bước đăng nhập: hiển thị bước tiếp theo (MFA, đổi mật khẩu),
+// lỗi qua renderFailure, hoặc mở phiên đăng nhập và tiếp tục authorization request
+func (h *OAuthHandler) handleLoginResult(c *gin.Context, req *services.AuthorizeRequest, client *models.OAuthClient, result *services.LoginResult, err error, renderFailure func(status int, message string)) {
+	if err != nil {
+		var lockoutErr *services.LockoutError
+		switch {
+		case errors.Is(err, services.ErrInvalidCredentials):
+			renderFailure(http.StatusUnauthorized, "invalid username/email or password")
+		case errors.Is(err, services.ErrEmailNotVerified):
+			renderFailure(http.StatusForbidden, "email address has not been verified")
+		case errors.Is(err, services.ErrManagedAccount):
+			renderFailure(http.StatusForbidden, "this account must sign in through your organization identity provider")
+		case errors.Is(err, services.ErrInvalidMFACode):
+			renderFailure(http.StatusUnauthorized, "invalid mfa code")
+		case errors.Is(err, services.ErrMFAMethodNotEnabled):
+			renderFailure(http.StatusBadRequest, "authenticator app is not enabled for this account")
+		case errors.Is(err, services.ErrInvalidMFAToken), errors.Is(err, services.ErrInvalidPasswordChangeToken):
+			h.renderLogin(c, http.StatusUnauthorized, req, client, "", "your sign-in has expired, please sign in again")
+		case errors.As(err, &lockoutErr):
+			renderFailure(http.StatusTooManyRequests, "too many failed login attempts, please try again later")
+		case errors.Is(err, services.ErrAuthBackendUnavailable):
+			renderFailure(http.StatusServiceUnavailable, "sign-in is temporarily unavailable, please try again later")
+		case errors.Is(err, services.ErrLDAPAccountConflict), errors.Is(err, services.ErrLDAPEmailRequired):
+			renderFailure(http.StatusConflict, "your directory account cannot be linked, please contact an administrator")
+		default:
+			h.logger.Errorf("OAuth login error: %v", err)
+			renderFailure(http.StatusInternalServerError, "failed to sign in")
+		}
+		return
+	}
+
+	if result.MFARequired {
+		h.renderMFA(c, http.StatusOK, req, result.MFAToken, "")
+		return
+	}
+	if result.PasswordChangeRequired {
+		h.renderPasswordChange(c, http.StatusOK, req, result.PasswordChangeToken, "", nil)
+		return
+	}
+
+	sessionToken, err := h.oauthService.CreateSession(result.User.ID, result.SessionID)
+	if err != nil {
+		h.logger.Errorf("OAuth create session error: %v", err)
+		h.renderError(c, http.StatusInternalServerError, "failed to sign in")
+		return
+	}
+	h.setSessionCookie(c, sessionToken)
+
+	session, err := h.oauthService.GetSession(sessionToken)
+	if err != nil || session == nil {
+		h.logger.Errorf("OAuth session error: %v", err)
+		h.renderError(c, http.StatusInternalServerError, "failed to sign in")
+		return
+	}
+	h.continueAuthorize(c, req, client, session)
+}
+
+// continueAuthorize hiển thị trang consent nếu user chưa đồng ý các scope, ngược lại cấp code
+func (h *OAuthHandler) continueAuthorize(c *gin.Context, req *services.AuthorizeRequest, client *models.OAuthClient, session *services.OAuthSession) {
+	needsConsent, err := h.oauthService.NeedsConsent(session.User.ID, req)
+	if err != nil {
+		h.logger.Errorf("OAuth consent check error: %v", err)
+		h.renderError(c, http.StatusInternalServerError, "failed to process authorization request")
+		return
+	}
+	if needsConsent {
+		if req.HasPrompt(services.PromptNone) {
+			c.Redirect(http.StatusFound, h.oauthService.ErrorRedirect(req, &services.OAuthError{
+				Code:        services.OAuthErrConsentRequired,
+				Description: "user consent is required",
+			}))
+			return
+		}
+		h.renderConsent(c, req, client, session)
+		return
+	}
+	h.issueCode(c, req, session, false)
+}
+
+// issueCode cấp authorization code và redirect về client
+func (h *OAuthHandler) issueCode(c *gin.Context, req *services.AuthorizeRequest, session *services.OAuthSession, consented bool) {
+	redirectURL, err := h.oauthService.Authorize(req, session, consented)
+	if err != nil {
+		h.logger.Errorf("OAuth authorize error: %v", err)
+		h.renderError(c, http.StatusInternalServerError, "failed to process authorization request")
+		return
+	}
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// validateAuthorizeRequest kiểm tra authorization request. Lỗi về client hoặc redirect_uri được hiển thị
+// cho user (không redirect về URI chưa được xác minh), các lỗi khác được redirect về client.
+func (h *OAuthHandler) validateAuthorizeRequest(c *gin.Context, req *services.AuthorizeRequest) (*models.OAuthClient, bool) {
+	client, err := h.oauthService.ValidateAuthorizeRequest(req)
+	if err == nil {
+		return client, true
+	}
+
+	var oauthErr *services.OAuthError
+	switch {
+	case errors.Is(err, services.ErrOAuthClientNotFound):
+		h.renderError(c, http.StatusBadRequest, "unknown client")
+	case errors.Is(err, services.ErrInvalidRedirectURI):
+		h.renderError(c, http.StatusBadRequest, "invalid redirect_uri")
+	case errors.As(err, &oauthErr):
+		c.Redirect(http.StatusFound, h.oauthService.ErrorRedirect(req, oauthErr))
+	default:
+		h.logger.Errorf("OAuth authorize request error: %v", err)
+		h.renderError(c, http.StatusInternalServerError, "failed to process authorization request")
+	}
+	return nil, false
+}
+
+// currentSession lấy phiên đăng nhập từ cookie, nil nếu user chưa đăng nhập
+func (h *OAuthHandler) currentSession(c *gin.Context) (*services.OAuthSession, error) {
+	cookie, err := c.Cookie(oauthSessionCookie)
+	if err != nil {
+		return nil, nil
+	}
+	return h.oauthService.GetSession(cookie)
+}
+
+// setSessionCookie lưu phiên đăng nhập vào cookie chỉ dùng cho /oauth
+func (h *OAuthHandler) setSessionCookie(c *gin.Context, value string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	secure := strings.HasPrefix(h.config.OAuthIssuer, "https://")
+	c.SetCookie(oauthSessionCookie, value, int(h.config.OAuthSessionTTL.Seconds()), "/oauth", "", secure, true)
+}
+
+// renderLogin hiển thị trang đăng nhập
+func (h *OAuthHandler) renderLogin(c *gin.Context, status int, req *services.AuthorizeRequest, client *models.OAuthClient, username, message string) {
+	h.renderPage(c, status, "login", req, uuid.Nil, oauthPage{Title: "Sign in", Error: message, ClientName: client.Name, Username: username})
+}
+
+// renderMFA hiển thị trang nhập mã MFA
+func (h *OAuthHandler) renderMFA(c *gin.Context, status int, req *services.AuthorizeRequest, mfaToken, message string) {
+	h.renderPage(c, status, "mfa", req, uuid.Nil, oauthPage{Title: "Two-factor authentication", Error: message, Token: mfaToken})
+}
+
+// renderPasswordChange hiển thị trang đổi mật khẩu đã hết hạn
+func (h *OAuthHandler) renderPasswordChange(c *gin.Context, status int, req *services.AuthorizeRequest, token, message string, violations []password.Violation) {
+	h.renderPage(c, status, "password_change", req, uuid.Nil, oauthPage{Title: "Change password", Error: message, Token: token, Violations: violations})
+}
+
+// renderConsent hiển thị trang consent; form chỉ hợp lệ với phiên đăng nhập hiện tại
+func (h *OAuthHandler) renderConsent(c *gin.Context, req *services.AuthorizeRequest, client *models.OAuthClient, session *services.OAuthSession) {
+	h.renderPage(c, http.StatusOK, "consent", req, session.SessionID, oauthPage{
+		Title:      "Authorize " + client.Name,
+		ClientName: client.Name,
+		Username:   session.User.Username,
+		Scopes:     strings.Fields(req.Scope),
+	})
+}
+
+// renderPage ký authorization request vào form và hiển thị trang
+func (h *OAuthHandler) renderPage(c *gin.Context, status int, name string, req *services.AuthorizeRequest, sessionID uuid.UUID, page oauthPage) {
+	encoded, err := h.oauthService.EncodeAuthorizeRequest(req, sessionID)
+	if err != nil {
+		h.logger.Errorf("OAuth encode request error: %v", err)
+		h.renderError(c, http.StatusInternalServerError, "failed to process authorization request")
+		return
+	}
+	page.Request = encoded
+	h.render(c, status, name, page)
+}
+
+// renderError hiển thị trang lỗi
+func (h *OAuthHandler) renderError(c *gin.Context, status int, message string) {
+	h.render(c, status, "error", oauthPage{Title: "Authorization error", Error: message})
+}
+
+// render hiển thị template, các trang này không được cache và không được nhúng vào trang khác
+func (h *OAuthHandler) render(c *gin.Context, status int, name string, page oauthPage) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Render(status, render.HTML{Template: oauthTemplates, Name: name, Data: page})
+}
+
+// Token xử lý POST /oauth/token (RFC 6749 mục 3.2)
+func (h *OAuthHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	response, err := h.oauthService.Token(client, services.TokenRequest{
+		GrantType:    c.PostForm("grant_type"),
+		Code:         c.PostForm("code"),
+		RedirectURI:  c.PostForm("redirect_uri"),
+		CodeVerifier: c.PostForm("code_verifier"),
+		RefreshToken: c.PostForm("refresh_token"),
+		Scope:        c.PostForm("scope"),
+	})
+	if err != nil {
+		var oauthErr *services.OAuthError
+		if errors.As(err, &oauthErr) {
+			writeOAuthError(c, http.StatusBadRequest, oauthErr)
+			return
+		}
+		h.logger.Errorf("OAuth token error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Introspect xử lý POST /oauth/introspect (RFC 7662), chỉ dành cho client confidential
+func (h *OAuthHandler) Introspect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	response, err := h.oauthService.Introspect(client, c.PostForm("token"), c.PostForm("token_type_hint"))
+	if err != nil {
+		var oauthErr *services.OAuthError
+		if errors.As(err, &oauthErr) {
+			writeOAuthError(c, http.StatusBadRequest, oauthErr)
+			return
+		}
+		h.logger.Errorf("OAuth introspect error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Revoke xử lý POST /oauth/revoke (RFC 7009). Token không hợp lệ vẫn nhận 200 theo chuẩn.
+func (h *OAuthHandler) Revoke(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	if err := h.oauthService.Revoke(client, c.PostForm("token"), c.PostForm("token_type_hint")); err != nil {
+		var oauthErr *services.OAuthError
+		if errors.As(err, &oauthErr) {
+			writeOAuthError(c, http.StatusBadRequest, oauthErr)
+			return
+		}
+		h.logger.Errorf("OAuth revoke error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// authenticateClient xác thực client bằng HTTP Basic hoặc client_id/client_secret trong body;
+// client public chỉ gửi client_id. Trả về false nếu đã ghi response lỗi.
+func (h *OAuthHandler) authenticateClient(c *gin.Context) (*models.OAuthClient, bool) {
+	clientID, clientSecret, basic := c.Request.BasicAuth()
+	if !basic {
+		clientID, clientSecret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	client, err := h.clientService.AuthenticateClient(clientID, clientSecret)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidClient) {
+			if basic {
+				c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+			}
+			writeOAuthError(c, http.StatusUnauthorized, &services.OAuthError{Code: services.OAuthErrInvalidClient, Description: "client authentication failed"})
+			return nil, false
+		}
+		h.logger.Errorf("OAuth client authentication error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return nil, false
+	}
+	return client, true
+}
+
+// writeOAuthError trả về lỗi theo định dạng của OAuth 2.0 (RFC 6749 mục 5.2)
+func writeOAuthError(c *gin.Context, status int, err *services.OAuthError) {
+	c.JSON(status, gin.H{"error": err.Code, "error_description": err.Description})
+}
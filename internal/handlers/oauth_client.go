@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// OAuthClientHandler xử lý các yêu cầu quản lý OAuth client (admin only)
+type OAuthClientHandler struct {
+	clientService services.OAuthClientService
+	logger        *logger.Logger
+}
+
+// NewOAuthClientHandler tạo một instance mới của OAuthClientHandler
+func NewOAuthClientHandler(clientService services.OAuthClientService, logger *logger.Logger) *OAuthClientHandler {
+	return &OAuthClientHandler{
+		clientService: clientService,
+		logger:        logger,
+	}
+}
+
+// CreateOAuthClientRequest chứa thông tin client cần đăng ký
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"` // Bỏ trống = authorization_code và refresh_token
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"` // Client không giữ được secret (SPA, ứng dụng native)
+}
+
+// CreateClient xử lý yêu cầu đăng ký client mới. Client secret chỉ được trả về một lần trong response này.
+func (h *OAuthClientHandler) CreateClient(c *gin.Context) {
+	var req CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client, secret, err := h.clientService.CreateClient(req.Name, req.RedirectURIs, req.GrantTypes, req.Scopes, req.Public)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidRedirectURI):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid redirect uri"})
+		case errors.Is(err, services.ErrInvalidGrantType):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid grant type"})
+		case errors.Is(err, services.ErrInvalidScope):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scope"})
+		default:
+			h.logger.Errorf("CreateOAuthClient error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create oauth client"})
+		}
+		return
+	}
+
+	response := gin.H{"message": "oauth client created successfully", "client": client}
+	if secret != "" {
+		response["message"] = "oauth client created successfully, store the client secret now as it will not be shown again"
+		response["client_secret"] = secret
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// ListClients xử lý yêu cầu lấy danh sách client
+func (h *OAuthClientHandler) ListClients(c *gin.Context) {
+	clients, err := h.clientService.ListClients()
+	if err != nil {
+		h.logger.Errorf("ListOAuthClients error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get oauth clients"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"clients": clients})
+}
+
+// DeleteClient xử lý yêu cầu xóa client
+func (h *OAuthClientHandler) DeleteClient(c *gin.Context) {
+	if err := h.clientService.DeleteClient(c.Param("client_id")); err != nil {
+		if errors.Is(err, services.ErrOAuthClientNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "oauth client not found"})
+			return
+		}
+		h.logger.Errorf("DeleteOAuthClient error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete oauth client"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "oauth client deleted successfully"})
+}
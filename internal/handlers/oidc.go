@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Discovery xử lý GET /.well-known/openid-configuration
+func (h *OAuthHandler) Discovery(c *gin.Context) {
+	document, err := h.oauthService.Discovery()
+	if err != nil {
+		// Khóa ký là khóa HMAC: service chỉ là authorization server OAuth 2.0, không phải OpenID provider
+		c.JSON(http.StatusNotFound, gin.H{"error": "openid connect is not available"})
+		return
+	}
+	c.JSON(http.StatusOK, document)
+}
+
+// UserInfo xử lý GET/POST /userinfo (OpenID Connect Core mục 5.3). Access token được gửi qua
+// header Authorization hoặc tham số access_token trong body (RFC 6750 mục 2.2).
+func (h *OAuthHandler) UserInfo(c *gin.Context) {
+	accessToken := ""
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
+		accessToken = parts[1]
+	} else if c.Request.Method == http.MethodPost {
+		accessToken = c.PostForm("access_token")
+	}
+	if accessToken == "" {
+		c.Header("WWW-Authenticate", `Bearer realm="userinfo"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_request", "error_description": "access token is required"})
+		return
+	}
+
+	userInfo, err := h.oauthService.UserInfo(accessToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidAccessToken):
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_token", "error_description": "the access token is invalid or has expired"})
+		case errors.Is(err, services.ErrInsufficientScope):
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_scope", "error_description": "the access token does not have the openid scope"})
+		default:
+			h.logger.Errorf("UserInfo error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, userInfo)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// PasswordResetHandler xử lý các yêu cầu quên/đặt lại mật khẩu
+type PasswordResetHandler struct {
+	passwordResetService services.PasswordResetService
+	logger               *logger.Logger
+}
+
+// NewPasswordResetHandler tạo một instance mới của PasswordResetHandler
+func NewPasswordResetHandler(passwordResetService services.PasswordResetService, logger *logger.Logger) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		passwordResetService: passwordResetService,
+		logger:               logger,
+	}
+}
+
+// ForgotPasswordRequest chứa email của tài khoản quên mật khẩu
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ForgotPassword xử lý yêu cầu gửi link đặt lại mật khẩu
+func (h *PasswordResetHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Lỗi chỉ được ghi log, client luôn nhận cùng một phản hồi để không tiết lộ email có tồn tại hay không
+	if err := h.passwordResetService.RequestReset(req.Email); err != nil {
+		h.logger.Errorf("ForgotPassword error: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "if the email is registered, a password reset link has been sent"})
+}
+
+// ResetPasswordRequest chứa token đặt lại mật khẩu và mật khẩu mới
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ResetPassword xử lý yêu cầu đặt mật khẩu mới
+func (h *PasswordResetHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.passwordResetService.ResetPassword(req.Token, req.NewPassword); err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired password reset token"})
+			return
+		}
+		if writePasswordPolicyResponse(c, err) {
+			return
+		}
+		h.logger.Errorf("ResetPassword error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset successfully"})
+}
+
+// AcceptInvitationRequest chứa token trong lời mời và mật khẩu đầu tiên của user
+type AcceptInvitationRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// AcceptInvitation xử lý yêu cầu nhận lời mời và đặt mật khẩu cho tài khoản do admin tạo
+func (h *PasswordResetHandler) AcceptInvitation(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.passwordResetService.AcceptInvitation(req.Token, req.NewPassword); err != nil {
+		if errors.Is(err, services.ErrInvalidInvitationToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired invitation token"})
+			return
+		}
+		if writePasswordPolicyResponse(c, err) {
+			return
+		}
+		h.logger.Errorf("AcceptInvitation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to accept invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "invitation accepted, you can now sign in"})
+}
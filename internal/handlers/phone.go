@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// PhoneHandler xử lý các request về số điện thoại và đăng nhập bằng mã OTP qua SMS
+type PhoneHandler struct {
+	phoneService services.PhoneService
+	logger       *logger.Logger
+}
+
+// NewPhoneHandler tạo một instance mới của PhoneHandler
+func NewPhoneHandler(phoneService services.PhoneService, logger *logger.Logger) *PhoneHandler {
+	return &PhoneHandler{
+		phoneService: phoneService,
+		logger:       logger,
+	}
+}
+
+// PhoneRequest chứa số điện thoại nhận mã
+type PhoneRequest struct {
+	Phone string `json:"phone" binding:"required"`
+}
+
+// PhoneCodeRequest chứa mã xác minh số điện thoại
+type PhoneCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// PhoneLoginRequest chứa số điện thoại và mã đăng nhập
+type PhoneLoginRequest struct {
+	Phone string `json:"phone" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// RequestVerification gửi mã xác minh tới số điện thoại mới của user
+func (h *PhoneHandler) RequestVerification(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req PhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.phoneService.RequestVerification(userID.(uuid.UUID), req.Phone); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidPhone):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid phone number"})
+		case errors.Is(err, services.ErrPhoneInUse):
+			c.JSON(http.StatusConflict, gin.H{"error": "phone number is already used by another account"})
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		default:
+			if writeOTPThrottleResponse(c, err) {
+				return
+			}
+			h.logger.Errorf("RequestPhoneVerification error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send verification code"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "verification code sent"})
+}
+
+// ConfirmVerification kiểm tra mã và lưu số điện thoại đã xác minh
+func (h *PhoneHandler) ConfirmVerification(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req PhoneCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.phoneService.ConfirmVerification(userID.(uuid.UUID), req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidOTP):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired code"})
+		case errors.Is(err, services.ErrOTPAttemptsExceeded):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "too many invalid codes, request a new code"})
+		case errors.Is(err, services.ErrPhoneInUse):
+			c.JSON(http.StatusConflict, gin.H{"error": "phone number is already used by another account"})
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		default:
+			h.logger.Errorf("ConfirmPhoneVerification error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify phone number"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "phone number verified successfully", "user": user})
+}
+
+// RemovePhone xóa số điện thoại khỏi tài khoản
+func (h *PhoneHandler) RemovePhone(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := h.phoneService.RemovePhone(userID.(uuid.UUID)); err != nil {
+		switch {
+		case errors.Is(err, services.ErrPhoneNotSet):
+			c.JSON(http.StatusNotFound, gin.H{"error": "no phone number on this account"})
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		default:
+			h.logger.Errorf("RemovePhone error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove phone number"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "phone number removed successfully"})
+}
+
+// RequestLoginCode gửi mã đăng nhập tới số điện thoại
+func (h *PhoneHandler) RequestLoginCode(c *gin.Context) {
+	var req PhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.phoneService.RequestLoginCode(req.Phone); err != nil {
+		switch {
+		case errors.Is(err, services.ErrPhoneLoginDisabled):
+			c.JSON(http.StatusNotFound, gin.H{"error": "phone login is disabled"})
+			return
+		case errors.Is(err, services.ErrInvalidPhone):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid phone number"})
+			return
+		}
+		// Các lỗi khác chỉ được ghi log, client luôn nhận cùng một phản hồi để không tiết lộ số điện thoại có tồn tại hay không
+		h.logger.Errorf("RequestPhoneLoginCode error: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "if the phone number is registered, a sign-in code has been sent"})
+}
+
+// Login đăng nhập bằng số điện thoại và mã; trả về kết quả như AuthHandler.Login
+func (h *PhoneHandler) Login(c *gin.Context) {
+	var req PhoneLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.phoneService.LoginWithCode(req.Phone, req.Code, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrPhoneLoginDisabled):
+			c.JSON(http.StatusNotFound, gin.H{"error": "phone login is disabled"})
+		case errors.Is(err, services.ErrInvalidOTP):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid phone number or code"})
+		case errors.Is(err, services.ErrOTPAttemptsExceeded):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "too many invalid codes, request a new code"})
+		case errors.Is(err, services.ErrEmailNotVerified):
+			c.JSON(http.StatusForbidden, gin.H{"error": "email address has not been verified"})
+		case errors.Is(err, services.ErrManagedAccount):
+			c.JSON(http.StatusForbidden, gin.H{"error": "this account must sign in through the organization identity provider"})
+		default:
+			if writeLockoutResponse(c, err) {
+				return
+			}
+			h.logger.Errorf("PhoneLogin error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+		}
+		return
+	}
+
+	writeLoginResponse(c, result)
+}
+
+// writeOTPThrottleResponse trả về 429 kèm header Retry-After nếu err cho biết mã vừa được gửi
+func writeOTPThrottleResponse(c *gin.Context, err error) bool {
+	var throttleErr *services.OTPThrottleError
+	if !errors.As(err, &throttleErr) {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(throttleErr.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "a code was sent recently, try again later", "retry_after": retryAfter})
+	return true
+}
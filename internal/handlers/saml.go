@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// samlRequestCookie giữ ID của AuthnRequest giữa lúc chuyển tới IdP và lúc IdP POST response về ACS
+const samlRequestCookie = "saml_request"
+
+// SAMLHandler xử lý các request đăng nhập bằng SAML 2.0
+type SAMLHandler struct {
+	samlService services.SAMLService
+	config      *config.Config
+	logger      *logger.Logger
+}
+
+// NewSAMLHandler tạo một instance mới của SAMLHandler
+func NewSAMLHandler(samlService services.SAMLService, config *config.Config, logger *logger.Logger) *SAMLHandler {
+	return &SAMLHandler{
+		samlService: samlService,
+		config:      config,
+		logger:      logger,
+	}
+}
+
+// Providers trả về danh sách IdP SAML có thể dùng để đăng nhập
+func (h *SAMLHandler) Providers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.samlService.Providers()})
+}
+
+// Metadata trả về metadata của SP để đăng ký với IdP
+func (h *SAMLHandler) Metadata(c *gin.Context) {
+	metadata, err := h.samlService.Metadata(c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, services.ErrSAMLProviderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "provider not found"})
+			return
+		}
+		h.logger.Errorf("SAML metadata error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build metadata"})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// Begin chuyển trình duyệt tới IdP kèm AuthnRequest
+func (h *SAMLHandler) Begin(c *gin.Context) {
+	redirectURL, requestCookie, err := h.samlService.Begin(c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, services.ErrSAMLProviderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "provider not found"})
+			return
+		}
+		h.logger.Errorf("SAML login begin error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start saml login"})
+		return
+	}
+
+	h.setRequestCookie(c, requestCookie, int(h.config.SAMLRequestTTL.Seconds()))
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// ACS (Assertion Consumer Service) nhận SAMLResponse IdP POST về và đăng nhập user
+func (h *SAMLHandler) ACS(c *gin.Context) {
+	requestCookie, _ := c.Cookie(samlRequestCookie)
+	h.setRequestCookie(c, "", -1)
+
+	samlResponse := c.PostForm("SAMLResponse")
+	if samlResponse == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SAMLResponse is required"})
+		return
+	}
+
+	result, err := h.samlService.ACS(c.Param("provider"), samlResponse, requestCookie, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSAMLProviderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "provider not found"})
+		case errors.Is(err, services.ErrInvalidSAMLRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired login request"})
+		case errors.Is(err, services.ErrInvalidSAMLResponse):
+			h.logger.Infof("SAML login via %s failed: %v", c.Param("provider"), err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid saml response"})
+		case errors.Is(err, services.ErrSAMLEmailRequired):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "identity provider did not return an email address"})
+		case errors.Is(err, services.ErrSAMLAccountConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": "a local account with this email already exists"})
+		case errors.Is(err, services.ErrEmailNotVerified):
+			c.JSON(http.StatusForbidden, gin.H{"error": "email address has not been verified"})
+		default:
+			if writeLockoutResponse(c, err) {
+				return
+			}
+			h.logger.Errorf("SAML ACS error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+		}
+		return
+	}
+
+	writeLoginResponse(c, result)
+}
+
+// setRequestCookie đặt (hoặc xóa khi maxAge < 0) cookie request, chỉ gửi kèm các request tới /api/auth/saml.
+// ACS nhận POST cross-site từ IdP nên cookie cần SameSite=None, chỉ dùng được qua HTTPS;
+// khi chạy HTTP (dev) dùng mặc định của trình duyệt.
+func (h *SAMLHandler) setRequestCookie(c *gin.Context, value string, maxAge int) {
+	secure := strings.HasPrefix(h.config.OAuthIssuer, "https://")
+	if secure {
+		c.SetSameSite(http.SameSiteNoneMode)
+	} else {
+		c.SetSameSite(http.SameSiteDefaultMode)
+	}
+	c.SetCookie(samlRequestCookie, value, maxAge, "/api/auth/saml", "", secure, true)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SessionHandler xử lý các yêu cầu quản lý session/thiết bị đăng nhập
+type SessionHandler struct {
+	sessionService services.SessionService
+	logger         *logger.Logger
+}
+
+// NewSessionHandler tạo một instance mới của SessionHandler
+func NewSessionHandler(sessionService services.SessionService, logger *logger.Logger) *SessionHandler {
+	return &SessionHandler{
+		sessionService: sessionService,
+		logger:         logger,
+	}
+}
+
+// clientInfo lấy thông tin thiết bị (user agent, IP) từ request
+func clientInfo(c *gin.Context) services.ClientInfo {
+	return services.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
+}
+
+// ListSessions xử lý yêu cầu lấy danh sách các session đang đăng nhập của user
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	sessionID, _ := c.Get("sessionID")
+
+	sessions, err := h.sessionService.ListSessions(userID.(uuid.UUID), sessionID.(uuid.UUID))
+	if err != nil {
+		h.logger.Errorf("ListSessions error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession xử lý yêu cầu đăng xuất một session cụ thể
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+
+	if err := h.sessionService.RevokeSession(userID.(uuid.UUID), sessionID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		h.logger.Errorf("RevokeSession error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked successfully"})
+}
+
+// RevokeOtherSessions xử lý yêu cầu đăng xuất tất cả các session khác ngoài session hiện tại
+func (h *SessionHandler) RevokeOtherSessions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	sessionID, _ := c.Get("sessionID")
+
+	if err := h.sessionService.RevokeOtherSessions(userID.(uuid.UUID), sessionID.(uuid.UUID)); err != nil {
+		h.logger.Errorf("RevokeOtherSessions error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "other sessions revoked successfully"})
+}
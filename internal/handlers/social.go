@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// socialStateCookie giữ state, nonce và PKCE verifier giữa lúc chuyển tới provider và callback
+const socialStateCookie = "social_state"
+
+// SocialHandler xử lý các request đăng nhập bằng identity provider bên ngoài
+type SocialHandler struct {
+	socialService services.SocialLoginService
+	config        *config.Config
+	logger        *logger.Logger
+}
+
+// NewSocialHandler tạo một instance mới của SocialHandler
+func NewSocialHandler(socialService services.SocialLoginService, config *config.Config, logger *logger.Logger) *SocialHandler {
+	return &SocialHandler{
+		socialService: socialService,
+		config:        config,
+		logger:        logger,
+	}
+}
+
+// Providers trả về danh sách provider có thể dùng để đăng nhập
+func (h *SocialHandler) Providers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.socialService.Providers()})
+}
+
+// Begin chuyển trình duyệt tới trang đăng nhập của provider
+func (h *SocialHandler) Begin(c *gin.Context) {
+	authURL, stateCookie, err := h.socialService.Begin(c.Param("provider"), uuid.Nil)
+	if err != nil {
+		h.writeBeginError(c, err)
+		return
+	}
+
+	h.setStateCookie(c, stateCookie)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// BeginLink trả về URL của provider để user đang đăng nhập liên kết thêm provider.
+// Client chuyển trình duyệt tới URL này; cookie state được đặt trong cùng response.
+func (h *SocialHandler) BeginLink(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	authURL, stateCookie, err := h.socialService.Begin(c.Param("provider"), userID.(uuid.UUID))
+	if err != nil {
+		h.writeBeginError(c, err)
+		return
+	}
+
+	h.setStateCookie(c, stateCookie)
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// Callback xử lý redirect từ provider sau khi user đăng nhập tại provider
+func (h *SocialHandler) Callback(c *gin.Context) {
+	stateCookie, _ := c.Cookie(socialStateCookie)
+	h.clearStateCookie(c)
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "identity provider returned an error", "provider_error": providerErr})
+		return
+	}
+
+	result, err := h.socialService.Callback(c.Param("provider"), c.Query("state"), c.Query("code"), stateCookie, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSocialProviderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "provider not found"})
+		case errors.Is(err, services.ErrInvalidSocialState):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired login state"})
+		case errors.Is(err, services.ErrSocialLoginFailed):
+			h.logger.Infof("Social login via %s failed: %v", c.Param("provider"), err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "failed to authenticate with identity provider"})
+		case errors.Is(err, services.ErrSocialEmailRequired):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "identity provider did not return an email address"})
+		case errors.Is(err, services.ErrSocialEmailConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": "an account with this email already exists, sign in and link the provider from your account"})
+		case errors.Is(err, services.ErrSocialAccountNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "no account is linked to this identity"})
+		case errors.Is(err, services.ErrIdentityAlreadyLinked):
+			c.JSON(http.StatusConflict, gin.H{"error": "identity is already linked to an account"})
+		case errors.Is(err, services.ErrEmailNotVerified):
+			c.JSON(http.StatusForbidden, gin.H{"error": "email address has not been verified"})
+		case errors.Is(err, services.ErrManagedAccount):
+			c.JSON(http.StatusForbidden, gin.H{"error": "this account must sign in through the organization identity provider"})
+		default:
+			if writeLockoutResponse(c, err) {
+				return
+			}
+			h.logger.Errorf("Social login callback error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+		}
+		return
+	}
+
+	if result.Identity != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "identity linked successfully", "identity": result.Identity})
+		return
+	}
+	writeLoginResponse(c, result.Login)
+}
+
+// ListIdentities trả về các provider user đã liên kết
+func (h *SocialHandler) ListIdentities(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	identities, err := h.socialService.ListIdentities(userID.(uuid.UUID))
+	if err != nil {
+		h.logger.Errorf("ListIdentities error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list identities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// Unlink xử lý yêu cầu hủy liên kết một provider
+func (h *SocialHandler) Unlink(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	identityID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid identity id"})
+		return
+	}
+
+	if err := h.socialService.Unlink(userID.(uuid.UUID), identityID); err != nil {
+		if errors.Is(err, services.ErrIdentityNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "identity not found"})
+			return
+		}
+		h.logger.Errorf("Unlink identity error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlink identity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "identity unlinked successfully"})
+}
+
+// writeBeginError trả về lỗi khi bắt đầu đăng nhập với provider
+func (h *SocialHandler) writeBeginError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrSocialProviderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "provider not found"})
+		return
+	}
+	h.logger.Errorf("Social login begin error: %v", err)
+	c.JSON(http.StatusBadGateway, gin.H{"error": "failed to contact identity provider"})
+}
+
+// setStateCookie lưu cookie state, chỉ gửi kèm các request tới /api/auth/social
+func (h *SocialHandler) setStateCookie(c *gin.Context, value string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	secure := strings.HasPrefix(h.config.OAuthIssuer, "https://")
+	c.SetCookie(socialStateCookie, value, int(h.config.SocialStateTTL.Seconds()), "/api/auth/social", "", secure, true)
+}
+
+// clearStateCookie xóa cookie state sau khi callback đã dùng nó
+func (h *SocialHandler) clearStateCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	secure := strings.HasPrefix(h.config.OAuthIssuer, "https://")
+	c.SetCookie(socialStateCookie, "", -1, "/api/auth/social", "", secure, true)
+}
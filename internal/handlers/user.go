@@ -13,15 +13,17 @@ import (
 
 // UserHandler xử lý các yêu cầu liên quan đến user
 type UserHandler struct {
-	userService services.UserService
-	logger      *logger.Logger
+	userService    services.UserService
+	lockoutService services.LockoutService
+	logger         *logger.Logger
 }
 
 // NewUserHandler tạo một instance mới của UserHandler
-func NewUserHandler(userService services.UserService, logger *logger.Logger) *UserHandler {
+func NewUserHandler(userService services.UserService, lockoutService services.LockoutService, logger *logger.Logger) *UserHandler {
 	return &UserHandler{
-		userService: userService,
-		logger:      logger,
+		userService:    userService,
+		lockoutService: lockoutService,
+		logger:         logger,
 	}
 }
 
@@ -89,7 +91,7 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 // ChangePasswordRequest chứa thông tin đổi mật khẩu từ client
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=6"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
 // ChangePassword xử lý yêu cầu thay đổi mật khẩu
@@ -119,6 +121,9 @@ func (h *UserHandler) ChangePassword(c *gin.Context) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "incorrect old password"})
 			return
 		}
+		if writePasswordPolicyResponse(c, err) {
+			return
+		}
 		h.logger.Errorf("ChangePassword error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
 		return
@@ -143,6 +148,10 @@ func (h *UserHandler) DeleteAccount(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 			return
 		}
+		if errors.Is(err, services.ErrLastAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": "cannot delete the last admin account"})
+			return
+		}
 		h.logger.Errorf("DeleteAccount error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete account"})
 		return
@@ -183,3 +192,248 @@ func (h *UserHandler) GetUsersList(c *gin.Context) {
 		"total_page": (total + int64(size) - 1) / int64(size),
 	})
 }
+
+// UnlockUser xử lý yêu cầu mở khóa tài khoản bị khóa do đăng nhập sai nhiều lần (admin only)
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	if err := h.lockoutService.Unlock(userID); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		h.logger.Errorf("UnlockUser error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user unlocked successfully"})
+}
+
+// GetUser xử lý yêu cầu lấy thông tin một user theo ID (admin only)
+func (h *UserHandler) GetUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	userResponse, err := h.userService.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		h.logger.Errorf("GetUser error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": userResponse})
+}
+
+// CreateUserRequest chứa thông tin user do admin tạo.
+// Password rỗng: user nhận email mời để tự đặt mật khẩu.
+type CreateUserRequest struct {
+	Username      string `json:"username" binding:"required,min=3,max=50"`
+	Email         string `json:"email" binding:"required,email"`
+	Password      string `json:"password"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	Role          string `json:"role" binding:"omitempty,oneof=user admin"`
+	Locale        string `json:"locale" binding:"omitempty,oneof=vi en"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// CreateUser xử lý yêu cầu tạo user mới (admin only)
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	adminID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userResponse, err := h.userService.CreateUser(adminID.(uuid.UUID), req.Username, req.Email, req.Password, req.FirstName, req.LastName, req.Role, req.Locale, req.EmailVerified)
+	if err != nil {
+		if errors.Is(err, services.ErrUserExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "username or email already exists"})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+			return
+		}
+		if writePasswordPolicyResponse(c, err) {
+			return
+		}
+		h.logger.Errorf("CreateUser error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "user created successfully", "user": userResponse})
+}
+
+// AdminUpdateUserRequest chứa thông tin admin cập nhật cho user; trường không gửi được giữ nguyên
+type AdminUpdateUserRequest struct {
+	Username      *string `json:"username" binding:"omitempty,min=3,max=50"`
+	Email         *string `json:"email" binding:"omitempty,email"`
+	FirstName     *string `json:"first_name"`
+	LastName      *string `json:"last_name"`
+	Locale        *string `json:"locale" binding:"omitempty,oneof=vi en"`
+	EmailVerified *bool   `json:"email_verified"`
+}
+
+// UpdateUser xử lý yêu cầu cập nhật thông tin user (admin only)
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var req AdminUpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userResponse, err := h.userService.AdminUpdateUser(userID, services.AdminUserUpdate{
+		Username:      req.Username,
+		Email:         req.Email,
+		FirstName:     req.FirstName,
+		LastName:      req.LastName,
+		Locale:        req.Locale,
+		EmailVerified: req.EmailVerified,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if errors.Is(err, services.ErrUserExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "username or email already exists"})
+			return
+		}
+		h.logger.Errorf("UpdateUser error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user updated successfully", "user": userResponse})
+}
+
+// DeleteUser xử lý yêu cầu xóa user (admin only)
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	if err := h.userService.DeleteUser(userID); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if errors.Is(err, services.ErrLastAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": "cannot delete the last admin account"})
+			return
+		}
+		h.logger.Errorf("DeleteUser error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user deleted successfully"})
+}
+
+// ChangeRoleRequest chứa role mới của user
+type ChangeRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=user admin"`
+}
+
+// ChangeRole xử lý yêu cầu đổi role của user (admin only)
+func (h *UserHandler) ChangeRole(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var req ChangeRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userResponse, err := h.userService.ChangeRole(userID, req.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case errors.Is(err, services.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+		case errors.Is(err, services.ErrLastAdmin):
+			c.JSON(http.StatusConflict, gin.H{"error": "cannot demote the last admin account"})
+		default:
+			h.logger.Errorf("ChangeRole error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change role"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role changed successfully", "user": userResponse})
+}
+
+// ForcePasswordResetRequest chứa mật khẩu tạm thời (không bắt buộc) admin cấp cho user
+type ForcePasswordResetRequest struct {
+	TemporaryPassword string `json:"temporary_password"`
+}
+
+// ForcePasswordReset xử lý yêu cầu buộc user đặt lại mật khẩu (admin only)
+func (h *UserHandler) ForcePasswordReset(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var req ForcePasswordResetRequest
+	// Body có thể rỗng: user nhận email đặt lại mật khẩu
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := h.userService.ForcePasswordReset(userID, req.TemporaryPassword); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if errors.Is(err, services.ErrExternallyManagedUser) {
+			c.JSON(http.StatusConflict, gin.H{"error": "password is managed by an external identity provider"})
+			return
+		}
+		if writePasswordPolicyResponse(c, err) {
+			return
+		}
+		h.logger.Errorf("ForcePasswordReset error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset required, all sessions revoked"})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Thanhdat-debug/demo_login/internal/services"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/google/uuid"
+)
+
+// WebAuthnHandler xử lý các yêu cầu quản lý passkey của user
+type WebAuthnHandler struct {
+	webAuthnService services.WebAuthnService
+	logger          *logger.Logger
+}
+
+// NewWebAuthnHandler tạo một instance mới của WebAuthnHandler
+func NewWebAuthnHandler(webAuthnService services.WebAuthnService, logger *logger.Logger) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		webAuthnService: webAuthnService,
+		logger:          logger,
+	}
+}
+
+// BeginRegistration xử lý yêu cầu lấy WebAuthn challenge để đăng ký passkey mới
+func (h *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	creation, challengeID, err := h.webAuthnService.BeginRegistration(userID.(uuid.UUID))
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		h.logger.Errorf("BeginRegistration error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin passkey registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"challenge_id": challengeID, "options": creation})
+}
+
+// FinishRegistrationRequest chứa phản hồi của authenticator khi đăng ký passkey
+type FinishRegistrationRequest struct {
+	ChallengeID uuid.UUID       `json:"challenge_id" binding:"required"`
+	Name        string          `json:"name" binding:"max=100"`
+	Credential  json.RawMessage `json:"credential" binding:"required"`
+}
+
+// FinishRegistration xử lý yêu cầu hoàn tất đăng ký passkey
+func (h *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req FinishRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webauthn credential"})
+		return
+	}
+
+	credential, err := h.webAuthnService.FinishRegistration(userID.(uuid.UUID), req.ChallengeID, req.Name, response)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case errors.Is(err, services.ErrInvalidChallenge):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired webauthn challenge"})
+		case errors.Is(err, services.ErrWebAuthnFailed):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "webauthn verification failed"})
+		default:
+			h.logger.Errorf("FinishRegistration error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register passkey"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "passkey registered successfully", "credential": credential})
+}
+
+// ListCredentials xử lý yêu cầu lấy danh sách passkey của user
+func (h *WebAuthnHandler) ListCredentials(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	credentials, err := h.webAuthnService.ListCredentials(userID.(uuid.UUID))
+	if err != nil {
+		h.logger.Errorf("ListCredentials error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get passkeys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials})
+}
+
+// DeleteCredential xử lý yêu cầu xóa một passkey
+func (h *WebAuthnHandler) DeleteCredential(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	credentialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid credential id"})
+		return
+	}
+
+	if err := h.webAuthnService.DeleteCredential(userID.(uuid.UUID), credentialID); err != nil {
+		if errors.Is(err, services.ErrCredentialNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "passkey not found"})
+			return
+		}
+		h.logger.Errorf("DeleteCredential error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete passkey"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "passkey deleted successfully"})
+}
@@ -0,0 +1,75 @@
+package keys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// sealedPrefix đánh dấu khóa bí mật đã được mã hóa, cho phép phân biệt với dữ liệu cũ chưa mã hóa
+const sealedPrefix = "enc:v1:"
+
+// Định nghĩa các lỗi
+var (
+	ErrInvalidEncryptionKey = errors.New("key encryption key must be 32 bytes encoded in base64")
+	ErrDecryptPrivateKey    = errors.New("cannot decrypt private key: wrong key encryption key or corrupted data")
+)
+
+// Encrypter mã hóa khóa bí mật trước khi lưu vào database bằng AES-256-GCM
+// với khóa mã hóa khóa (KEK) lấy từ môi trường
+type Encrypter struct {
+	aead cipher.AEAD
+}
+
+// NewEncrypter tạo Encrypter từ KEK dạng base64 (32 byte)
+func NewEncrypter(encoded string) (*Encrypter, error) {
+	kek, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(kek) != 32 {
+		return nil, ErrInvalidEncryptionKey
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Encrypter{aead: aead}, nil
+}
+
+// Seal mã hóa khóa bí mật của khóa kid. kid được dùng làm dữ liệu xác thực kèm theo
+// để bản mã không thể được chép sang một bản ghi khóa khác.
+func (e *Encrypter) Seal(kid, privateKey string) (string, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := e.aead.Seal(nonce, nonce, []byte(privateKey), []byte(kid))
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open giải mã khóa bí mật đã được mã hóa bằng Seal
+func (e *Encrypter) Open(kid, sealed string) (string, error) {
+	if !IsSealed(sealed) {
+		return "", ErrDecryptPrivateKey
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, sealedPrefix))
+	if err != nil || len(data) < e.aead.NonceSize() {
+		return "", ErrDecryptPrivateKey
+	}
+	nonce, ciphertext := data[:e.aead.NonceSize()], data[e.aead.NonceSize():]
+	plaintext, err := e.aead.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return "", ErrDecryptPrivateKey
+	}
+	return string(plaintext), nil
+}
+
+// IsSealed cho biết dữ liệu đã được mã hóa bằng Seal hay vẫn là khóa bí mật dạng rõ
+func IsSealed(data string) bool {
+	return strings.HasPrefix(data, sealedPrefix)
+}
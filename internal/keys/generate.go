@@ -0,0 +1,82 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+)
+
+// rsaKeyBits là độ dài khóa RSA được sinh ra
+const rsaKeyBits = 2048
+
+// Generate sinh một khóa ký mới theo thuật toán. kid được suy ra từ khóa.
+func Generate(alg string) (*Key, error) {
+	switch alg {
+	case AlgHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return NewHMACKey(secret, ""), nil
+	case AlgRS256:
+		privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		return withThumbprint(privateKey, alg)
+	case AlgES256:
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return withThumbprint(privateKey, alg)
+	case AlgEdDSA:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return withThumbprint(privateKey, alg)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+// MarshalPrivateKey mã hóa phần bí mật của khóa để lưu trữ:
+// secret HMAC dạng base64, khóa bất đối xứng dạng PEM PKCS#8
+func MarshalPrivateKey(key *Key) (string, error) {
+	if secret, ok := key.SignKey.([]byte); ok {
+		return base64.StdEncoding.EncodeToString(secret), nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.SignKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// UnmarshalPrivateKey khôi phục khóa đã lưu bằng MarshalPrivateKey
+func UnmarshalPrivateKey(alg, data, kid string) (*Key, error) {
+	if alg == AlgHS256 {
+		secret, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, err
+		}
+		return NewHMACKey(secret, kid), nil
+	}
+	return ParsePrivateKeyPEM([]byte(data), alg, kid)
+}
+
+// withThumbprint tạo Key từ khóa bí mật vừa sinh, dùng thumbprint làm kid
+func withThumbprint(privateKey interface{}, alg string) (*Key, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), alg, "")
+}
@@ -0,0 +1,164 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Các thuật toán ký JWT được hỗ trợ
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrKeyTypeMismatch      = errors.New("private key does not match signing algorithm")
+	ErrInvalidPEM           = errors.New("invalid PEM private key")
+)
+
+// Key là một khóa ký JWT, được định danh bằng kid trong header của token
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{} // []byte, *rsa.PrivateKey, *ecdsa.PrivateKey hoặc ed25519.PrivateKey
+	VerifyKey interface{} // []byte, *rsa.PublicKey, *ecdsa.PublicKey hoặc ed25519.PublicKey
+}
+
+// Algorithm trả về tên thuật toán ký (giá trị của header alg)
+func (k *Key) Algorithm() string {
+	return k.Method.Alg()
+}
+
+// IsSymmetric cho biết khóa có phải là khóa HMAC (không được công khai qua JWKS) hay không
+func (k *Key) IsSymmetric() bool {
+	_, ok := k.VerifyKey.([]byte)
+	return ok
+}
+
+// NewHMACKey tạo khóa HS256 từ secret. Nếu kid rỗng, kid được suy ra từ secret
+// bằng HMAC để không làm lộ secret.
+func NewHMACKey(secret []byte, kid string) *Key {
+	if kid == "" {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte("kid"))
+		kid = "hs-" + hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+	return &Key{
+		ID:        kid,
+		Method:    jwt.SigningMethodHS256,
+		SignKey:   secret,
+		VerifyKey: secret,
+	}
+}
+
+// LoadPrivateKeyFile đọc khóa bí mật dạng PEM từ file
+func LoadPrivateKeyFile(path, alg, kid string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKeyPEM(data, alg, kid)
+}
+
+// ParsePrivateKeyPEM tạo Key từ khóa bí mật dạng PEM (PKCS#8, PKCS#1 hoặc SEC 1).
+// Nếu kid rỗng, kid là JWK thumbprint (RFC 7638) của khóa công khai.
+func ParsePrivateKeyPEM(data []byte, alg, kid string) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+
+	privateKey, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := newAsymmetricKey(privateKey, alg)
+	if err != nil {
+		return nil, err
+	}
+
+	if kid == "" {
+		kid, err = Thumbprint(key.VerifyKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	key.ID = kid
+	return key, nil
+}
+
+// LoadSigningKey tạo khóa ký theo cấu hình: HS256 dùng secret, các thuật toán khác đọc từ file PEM
+func LoadSigningKey(alg, privateKeyFile string, secret []byte, kid string) (*Key, error) {
+	if alg == "" || alg == AlgHS256 {
+		if len(secret) == 0 {
+			return nil, errors.New("JWT secret is required for HS256")
+		}
+		return NewHMACKey(secret, kid), nil
+	}
+	if privateKeyFile == "" {
+		return nil, fmt.Errorf("private key file is required for %s", alg)
+	}
+	return LoadPrivateKeyFile(privateKeyFile, alg, kid)
+}
+
+// parsePrivateKey thử lần lượt các định dạng khóa bí mật phổ biến
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, ErrInvalidPEM
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, ErrInvalidPEM
+}
+
+// newAsymmetricKey kiểm tra khóa bí mật có khớp với thuật toán ký không và tạo Key tương ứng
+func newAsymmetricKey(privateKey crypto.Signer, alg string) (*Key, error) {
+	switch alg {
+	case AlgRS256:
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrKeyTypeMismatch
+		}
+		return &Key{Method: jwt.SigningMethodRS256, SignKey: rsaKey, VerifyKey: &rsaKey.PublicKey}, nil
+	case AlgES256:
+		ecKey, ok := privateKey.(*ecdsa.PrivateKey)
+		if !ok || ecKey.Curve != elliptic.P256() {
+			return nil, ErrKeyTypeMismatch
+		}
+		return &Key{Method: jwt.SigningMethodES256, SignKey: ecKey, VerifyKey: &ecKey.PublicKey}, nil
+	case AlgEdDSA:
+		edKey, ok := privateKey.(ed25519.PrivateKey)
+		if !ok {
+			return nil, ErrKeyTypeMismatch
+		}
+		return &Key{Method: jwt.SigningMethodEdDSA, SignKey: edKey, VerifyKey: edKey.Public()}, nil
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
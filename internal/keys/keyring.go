@@ -0,0 +1,108 @@
+package keys
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrUnknownKey          = errors.New("unknown signing key")
+	ErrUnexpectedAlgorithm = errors.New("unexpected signing method")
+)
+
+// Keyring giữ một khóa ký đang hoạt động cùng các khóa chỉ dùng để xác thực,
+// cho phép xoay vòng khóa mà không làm mất hiệu lực các token đã cấp.
+// Keyring an toàn khi dùng đồng thời từ nhiều goroutine.
+type Keyring struct {
+	mu     sync.RWMutex
+	active *Key
+	keys   map[string]*Key
+}
+
+// NewKeyring tạo keyring với khóa ký đang hoạt động và các khóa chỉ dùng để xác thực
+func NewKeyring(active *Key, verifyOnly ...*Key) *Keyring {
+	k := &Keyring{}
+	k.Replace(active, verifyOnly)
+	return k
+}
+
+// Active trả về khóa đang dùng để ký token mới
+func (k *Keyring) Active() *Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// Lookup tìm khóa xác thực theo kid
+func (k *Keyring) Lookup(kid string) (*Key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// Sign ký claims bằng khóa đang hoạt động, ghi kid vào header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	key := k.Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.SignKey)
+}
+
+// KeyFunc là jwt.Keyfunc tìm khóa xác thực theo kid trong header của token
+func (k *Keyring) KeyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.Lookup(kid)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	// Chỉ chấp nhận đúng thuật toán của khóa để tránh tấn công đổi thuật toán
+	if token.Method.Alg() != key.Algorithm() {
+		return nil, ErrUnexpectedAlgorithm
+	}
+	return key.VerifyKey, nil
+}
+
+// Keys trả về tất cả các khóa (kể cả khóa đang hoạt động), sắp xếp theo kid
+func (k *Keyring) Keys() []*Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	result := make([]*Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		result = append(result, key)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Replace thay toàn bộ nội dung keyring trong một thao tác
+func (k *Keyring) Replace(active *Key, verifyOnly []*Key) {
+	keys := make(map[string]*Key, len(verifyOnly)+1)
+	for _, key := range verifyOnly {
+		keys[key.ID] = key
+	}
+	if active != nil {
+		keys[active.ID] = active
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.active = active
+	k.keys = keys
+}
+
+// JWKS trả về các khóa công khai trong keyring (khóa HMAC không được công khai)
+func (k *Keyring) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range k.Keys() {
+		if jwk, ok := key.PublicJWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -12,15 +13,17 @@ import (
 
 // AuthMiddleware chứa các middleware liên quan đến xác thực
 type AuthMiddleware struct {
-	authService services.AuthService
-	logger      *logger.Logger
+	authService   services.AuthService
+	apiKeyService services.APIKeyService
+	logger        *logger.Logger
 }
 
 // NewAuthMiddleware tạo một instance mới của AuthMiddleware
-func NewAuthMiddleware(authService services.AuthService, logger *logger.Logger) *AuthMiddleware {
+func NewAuthMiddleware(authService services.AuthService, apiKeyService services.APIKeyService, logger *logger.Logger) *AuthMiddleware {
 	return &AuthMiddleware{
-		authService: authService,
-		logger:      logger,
+		authService:   authService,
+		apiKeyService: apiKeyService,
+		logger:        logger,
 	}
 }
 
@@ -55,12 +58,26 @@ func (m *AuthMiddleware) JWTAuthMiddleware() gin.HandlerFunc {
 
 		// Kiểm tra claims
 		claims, ok := token.Claims.(*services.Claims)
-		if !ok || !token.Valid {
+		if !ok || !token.Valid || claims.TokenType != services.TokenTypeAccess {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token claims"})
 			c.Abort()
 			return
 		}
 
+		// Kiểm tra token đã bị thu hồi (logout) chưa
+		revoked, err := m.authService.IsTokenRevoked(claims)
+		if err != nil {
+			m.logger.Errorf("Error checking token revocation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to validate token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		// Parse userID từ claims
 		userID, err := uuid.Parse(claims.UserID)
 		if err != nil {
@@ -69,13 +86,85 @@ func (m *AuthMiddleware) JWTAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// IsTokenRevoked đã đảm bảo session ID hợp lệ
+		sessionID, _ := uuid.Parse(claims.SessionID)
+
 		// Lưu thông tin vào context để các handler có thể sử dụng
 		c.Set("userID", userID)
+		c.Set("sessionID", sessionID)
 		c.Set("userRole", claims.Role)
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// APIKeyOrJWTAuthMiddleware xác thực request bằng API key (header X-API-Key hoặc
+// "Authorization: Bearer dlk_...") hoặc JWT. Route dùng middleware này phải khai báo RequireScope
+// để giới hạn quyền của API key.
+func (m *AuthMiddleware) APIKeyOrJWTAuthMiddleware() gin.HandlerFunc {
+	jwtAuth := m.JWTAuthMiddleware()
+	return func(c *gin.Context) {
+		rawKey := apiKeyFromRequest(c)
+		if rawKey == "" {
+			jwtAuth(c)
+			return
+		}
+
+		apiKey, user, err := m.apiKeyService.Authenticate(rawKey)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidAPIKey) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+				c.Abort()
+				return
+			}
+			m.logger.Errorf("Error authenticating api key: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to validate api key"})
+			c.Abort()
+			return
+		}
+
+		// API key không gắn với session đăng nhập nào
+		c.Set("userID", user.ID)
+		c.Set("sessionID", uuid.Nil)
+		c.Set("userRole", user.Role)
+		c.Set("apiKeyID", apiKey.ID)
+		c.Set("scopes", apiKey.ScopeList())
 		c.Next()
 	}
 }
 
+// RequireScope yêu cầu API key của request có scope cho trước; request xác thực bằng JWT luôn được chấp nhận
+func (m *AuthMiddleware) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, isAPIKey := c.Get("scopes")
+		if !isAPIKey {
+			c.Next()
+			return
+		}
+
+		for _, s := range scopes.([]string) {
+			if s == scope {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient scope", "required_scope": scope})
+		c.Abort()
+	}
+}
+
+// apiKeyFromRequest lấy API key từ header X-API-Key hoặc Authorization, trả về rỗng nếu request không dùng API key
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) == 2 && parts[0] == "Bearer" && strings.HasPrefix(parts[1], services.APIKeyPrefix) {
+		return parts[1]
+	}
+	return ""
+}
+
 // AdminRequired kiểm tra nếu user có role 'admin'
 func (m *AuthMiddleware) AdminRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LoginFailure ghi nhận một lần đăng nhập thất bại, dùng để giới hạn số lần thử theo địa chỉ IP
+type LoginFailure struct {
+	ID        uuid.UUID  `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID    *uuid.UUID `gorm:"type:char(36);index" json:"user_id,omitempty"` // Rỗng nếu tài khoản không tồn tại
+	IPAddress string     `gorm:"size:45;index:idx_login_failures_ip_created;not null" json:"ip_address"`
+	CreatedAt time.Time  `gorm:"index:idx_login_failures_ip_created" json:"created_at"`
+}
+
+// BeforeCreate tự động tạo UUID trước khi tạo bản ghi mới
+func (f *LoginFailure) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	return nil
+}
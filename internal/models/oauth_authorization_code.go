@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OAuthAuthorizationCode là authorization code (dạng hash) cấp cho client sau khi user đồng ý,
+// dùng một lần để đổi lấy token tại /oauth/token
+type OAuthAuthorizationCode struct {
+	ID                  uuid.UUID  `gorm:"type:char(36);primaryKey" json:"id"`
+	CodeHash            string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ClientID            string     `gorm:"size:64;index;not null" json:"client_id"`
+	UserID              uuid.UUID  `gorm:"type:char(36);index;not null" json:"user_id"`
+	User                User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	RedirectURI         string     `gorm:"type:text;not null" json:"redirect_uri"`
+	Scope               string     `gorm:"size:500" json:"scope"`
+	CodeChallenge       string     `gorm:"size:128;not null" json:"-"`
+	CodeChallengeMethod string     `gorm:"size:10;not null" json:"-"`
+	AuthTime            time.Time  `gorm:"not null" json:"auth_time"`      // Thời điểm user xác thực (đăng nhập)
+	Nonce               string     `gorm:"size:255" json:"-"`              // Nonce của OpenID Connect, ghi vào ID token
+	FamilyID            *uuid.UUID `gorm:"type:char(36)" json:"family_id"` // Family của refresh token đã cấp từ code này
+	ExpiresAt           time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt              *time.Time `json:"used_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// BeforeCreate tự động tạo UUID trước khi tạo bản ghi mới
+func (c *OAuthAuthorizationCode) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
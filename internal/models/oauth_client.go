@@ -0,0 +1,114 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Các grant type của OAuth 2.0 được hỗ trợ
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// OAuthClient là một ứng dụng được đăng ký để đăng nhập người dùng qua service này.
+// Client public (SPA, mobile) không có secret và bắt buộc dùng PKCE.
+type OAuthClient struct {
+	ID           uuid.UUID `gorm:"type:char(36);primaryKey" json:"id"`
+	ClientID     string    `gorm:"size:64;uniqueIndex;not null" json:"client_id"`
+	SecretHash   string    `gorm:"size:64" json:"-"` // Rỗng với client public
+	Name         string    `gorm:"size:100;not null" json:"name"`
+	RedirectURIs string    `gorm:"type:text" json:"-"` // Các redirect URI phân tách bằng xuống dòng
+	GrantTypes   string    `gorm:"size:255" json:"-"`  // Các grant type phân tách bằng dấu cách
+	Scopes       string    `gorm:"size:500" json:"-"`  // Các scope client được yêu cầu, phân tách bằng dấu cách
+	Public       bool      `gorm:"not null;default:false" json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// BeforeCreate tự động tạo UUID trước khi tạo bản ghi mới
+func (c *OAuthClient) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// RedirectURIList trả về danh sách redirect URI đã đăng ký
+func (c *OAuthClient) RedirectURIList() []string {
+	return splitNonEmpty(c.RedirectURIs, "\n")
+}
+
+// GrantTypeList trả về danh sách grant type client được phép dùng
+func (c *OAuthClient) GrantTypeList() []string {
+	return splitNonEmpty(c.GrantTypes, " ")
+}
+
+// ScopeList trả về danh sách scope client được phép yêu cầu
+func (c *OAuthClient) ScopeList() []string {
+	return splitNonEmpty(c.Scopes, " ")
+}
+
+// HasRedirectURI kiểm tra redirect URI có trùng khớp chính xác với một URI đã đăng ký không
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	return containsString(c.RedirectURIList(), uri)
+}
+
+// AllowsGrantType kiểm tra client có được phép dùng grant type không
+func (c *OAuthClient) AllowsGrantType(grantType string) bool {
+	return containsString(c.GrantTypeList(), grantType)
+}
+
+// AllowsScope kiểm tra client có được phép yêu cầu scope không
+func (c *OAuthClient) AllowsScope(scope string) bool {
+	return containsString(c.ScopeList(), scope)
+}
+
+// OAuthClientResponse là struct được sử dụng để trả về thông tin client (không gồm secret)
+type OAuthClientResponse struct {
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ToOAuthClientResponse chuyển đổi từ model OAuthClient sang OAuthClientResponse
+func (c *OAuthClient) ToOAuthClientResponse() OAuthClientResponse {
+	return OAuthClientResponse{
+		ClientID:     c.ClientID,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectURIList(),
+		GrantTypes:   c.GrantTypeList(),
+		Scopes:       c.ScopeList(),
+		Public:       c.Public,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+// splitNonEmpty tách chuỗi theo sep và bỏ các phần tử rỗng
+func splitNonEmpty(s, sep string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// containsString kiểm tra slice có chứa chuỗi s không
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OAuthConsent ghi nhận các scope user đã đồng ý cấp cho một client,
+// để lần sau không phải hỏi lại khi client yêu cầu các scope đó
+type OAuthConsent struct {
+	ID        uuid.UUID `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID    uuid.UUID `gorm:"type:char(36);uniqueIndex:idx_oauth_consents_user_client;not null" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	ClientID  string    `gorm:"size:64;uniqueIndex:idx_oauth_consents_user_client;not null" json:"client_id"`
+	Scope     string    `gorm:"size:500" json:"scope"` // Các scope phân tách bằng dấu cách
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate tự động tạo UUID trước khi tạo bản ghi mới
+func (c *OAuthConsent) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// Covers kiểm tra consent đã bao gồm tất cả các scope cho trước chưa
+func (c *OAuthConsent) Covers(scopes []string) bool {
+	granted := splitNonEmpty(c.Scope, " ")
+	for _, scope := range scopes {
+		if !containsString(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
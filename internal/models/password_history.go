@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PasswordHistory lưu hash của các mật khẩu user đã dùng, để chặn việc dùng lại mật khẩu cũ
+type PasswordHistory struct {
+	ID           uuid.UUID `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID       uuid.UUID `gorm:"type:char(36);index:idx_password_histories_user_created;not null" json:"user_id"`
+	User         User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	PasswordHash string    `gorm:"size:255;not null" json:"-"`
+	CreatedAt    time.Time `gorm:"index:idx_password_histories_user_created" json:"created_at"`
+}
+
+// BeforeCreate tự động tạo UUID trước khi tạo bản ghi mới
+func (h *PasswordHistory) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Mục đích sử dụng của PhoneOTP
+const (
+	OTPPurposePhoneVerification = "phone_verification"
+	OTPPurposePhoneLogin        = "phone_login"
+)
+
+// PhoneOTP là mã dùng một lần gửi qua SMS để xác minh số điện thoại hoặc đăng nhập.
+// Chỉ lưu hash của mã; mỗi user chỉ có một mã hiệu lực cho mỗi mục đích.
+type PhoneOTP struct {
+	ID        uuid.UUID `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID    uuid.UUID `gorm:"type:char(36);index;not null" json:"user_id"`
+	User      User      `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Purpose   string    `gorm:"size:32;not null" json:"purpose"`
+	Phone     string    `gorm:"size:20;not null" json:"phone"` // Số điện thoại nhận mã (E.164)
+	CodeHash  string    `gorm:"size:64;not null" json:"-"`
+	Attempts  int       `gorm:"not null;default:0" json:"attempts"` // Số lần nhập sai
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BeforeCreate tự động tạo UUID trước khi tạo bản ghi mới
+func (o *PhoneOTP) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// RateLimitEntry lưu trạng thái giới hạn request của một key khi dùng store database,
+// để các instance của ứng dụng dùng chung hạn mức
+type RateLimitEntry struct {
+	Key         string    `gorm:"size:191;primaryKey"`
+	WindowStart time.Time // Sliding window: đầu cửa sổ hiện tại
+	Count       int64     `gorm:"not null;default:0"`
+	PrevCount   int64     `gorm:"not null;default:0"`
+	Tokens      float64   `gorm:"not null;default:0"` // Token bucket: số token còn lại tại RefilledAt
+	RefilledAt  time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
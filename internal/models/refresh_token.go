@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshToken lưu refresh token (dạng hash) đã cấp cho người dùng.
+// Các token được sinh ra từ cùng một lần đăng nhập thuộc cùng một FamilyID,
+// nhờ đó có thể thu hồi cả chuỗi khi phát hiện token cũ bị dùng lại.
+// Refresh token cấp cho OAuth client có ClientID và Scope; FamilyID của chúng là một lần cấp quyền, không phải session.
+type RefreshToken struct {
+	ID           uuid.UUID  `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID       uuid.UUID  `gorm:"type:char(36);index;not null" json:"user_id"`
+	FamilyID     uuid.UUID  `gorm:"type:char(36);index;not null" json:"family_id"`
+	TokenHash    string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	ReplacedByID *uuid.UUID `gorm:"type:char(36)" json:"replaced_by_id,omitempty"`
+	ClientID     string     `gorm:"size:64;index" json:"client_id,omitempty"`
+	Scope        string     `gorm:"size:500" json:"scope,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// BeforeCreate tự động tạo UUID trước khi tạo bản ghi mới
+func (t *RefreshToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsExpired kiểm tra refresh token đã hết hạn chưa
+func (t *RefreshToken) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+// IsRevoked kiểm tra refresh token đã bị thu hồi (hoặc đã được xoay vòng) chưa
+func (t *RefreshToken) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
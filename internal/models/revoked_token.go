@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RevokedToken lưu jti của các access token đã bị thu hồi trước khi hết hạn.
+// Bản ghi chỉ cần giữ đến ExpiresAt, sau đó token tự hết hiệu lực.
+type RevokedToken struct {
+	JTI       string    `gorm:"size:64;primaryKey" json:"jti"`
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
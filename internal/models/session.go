@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session đại diện cho một lần đăng nhập của người dùng trên một thiết bị.
+// ID của session cũng là FamilyID của các refresh token được cấp cho lần đăng nhập đó.
+type Session struct {
+	ID         uuid.UUID  `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:char(36);index;not null" json:"user_id"`
+	UserAgent  string     `gorm:"size:255" json:"user_agent"`
+	IPAddress  string     `gorm:"size:45" json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at"` // Được gia hạn mỗi lần refresh token được xoay vòng
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// BeforeCreate tự động tạo UUID trước khi tạo bản ghi mới
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	if s.LastSeenAt.IsZero() {
+		s.LastSeenAt = time.Now()
+	}
+	return nil
+}
+
+// IsRevoked kiểm tra session đã bị thu hồi (đăng xuất) chưa
+func (s *Session) IsRevoked() bool {
+	return s.RevokedAt != nil
+}
+
+// IsExpired kiểm tra session đã hết hạn chưa. Session cũ chưa có ExpiresAt được coi là đã hết hạn.
+func (s *Session) IsExpired() bool {
+	return !time.Now().Before(s.ExpiresAt)
+}
+
+// SessionResponse là struct được sử dụng để trả về thông tin session cho người dùng
+type SessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // true nếu là session của token đang dùng
+}
+
+// ToSessionResponse chuyển đổi từ model Session sang SessionResponse
+func (s *Session) ToSessionResponse(currentSessionID uuid.UUID) SessionResponse {
+	return SessionResponse{
+		ID:         s.ID,
+		UserAgent:  s.UserAgent,
+		IPAddress:  s.IPAddress,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+		Current:    s.ID == currentSessionID,
+	}
+}
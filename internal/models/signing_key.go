@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Trạng thái của khóa ký JWT
+const (
+	SigningKeyActive  = "active"  // Đang dùng để ký token mới
+	SigningKeyVerify  = "verify"  // Chỉ dùng để xác thực token đã cấp
+	SigningKeyRetired = "retired" // Đã ngừng sử dụng hoàn toàn
+)
+
+// SigningKey lưu các khóa ký JWT để có thể xoay vòng khóa giữa nhiều instance
+type SigningKey struct {
+	ID            string     `gorm:"size:100;primaryKey" json:"kid"`
+	Algorithm     string     `gorm:"size:10;not null" json:"algorithm"`
+	PrivateKey    string     `gorm:"type:text;not null" json:"-"` // Không bao giờ trả về; được mã hóa bằng SIGNING_KEY_ENCRYPTION_KEY và bị xóa khi khóa bị retire
+	Status        string     `gorm:"size:20;index;not null" json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ActivatedAt   *time.Time `json:"activated_at,omitempty"`
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"` // Thời điểm khóa ngừng ký token mới
+	RetiredAt     *time.Time `json:"retired_at,omitempty"`
+}
@@ -3,8 +3,8 @@ package models
 import (
 	"time"
 
+	"github.com/Thanhdat-debug/demo_login/pkg/password"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -13,12 +13,36 @@ type User struct {
 	ID        uuid.UUID `gorm:"type:char(36);primaryKey" json:"id"`
 	Username  string    `gorm:"size:50;uniqueIndex;not null" json:"username"`
 	Email     string    `gorm:"size:100;uniqueIndex;not null" json:"email"`
-	Password  string    `gorm:"size:100;not null" json:"-"` // Không hiển thị password trong JSON response
+	Password  string    `gorm:"size:255;not null" json:"-"` // Không hiển thị password trong JSON response
 	FirstName string    `gorm:"size:50" json:"first_name"`
 	LastName  string    `gorm:"size:50" json:"last_name"`
 	Role      string    `gorm:"size:20;default:'user'" json:"role"` // 'admin' hoặc 'user'
+	Locale    string    `gorm:"size:10" json:"locale"`              // Ngôn ngữ của email gửi cho user ('vi', 'en'), rỗng = mặc định
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// Trạng thái xác minh email
+	EmailVerified   bool       `gorm:"not null;default:false" json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+
+	// Số điện thoại (E.164) đã xác minh bằng mã OTP qua SMS; NULL khi user chưa có số điện thoại
+	Phone           *string    `gorm:"size:20;uniqueIndex" json:"phone,omitempty"`
+	PhoneVerified   bool       `gorm:"not null;default:false" json:"phone_verified"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at,omitempty"`
+
+	// Thời điểm đổi mật khẩu gần nhất, dùng để tính tuổi mật khẩu (rỗng = thời điểm tạo tài khoản)
+	PasswordChangedAt *time.Time `json:"-"`
+	// Admin yêu cầu user đặt lại mật khẩu: lần đăng nhập bằng mật khẩu tiếp theo phải đổi mật khẩu
+	PasswordResetRequired bool `gorm:"not null;default:false" json:"-"`
+
+	// Chống dò mật khẩu: số lần đăng nhập sai liên tiếp và thời điểm hết khóa tài khoản
+	FailedLoginAttempts int        `gorm:"not null;default:0" json:"-"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"`
+
+	// Xác thực hai lớp bằng TOTP (RFC 6238)
+	TOTPSecret   string `gorm:"size:64" json:"-"` // Secret chỉ có hiệu lực khi TOTPEnabled = true
+	TOTPEnabled  bool   `gorm:"not null;default:false" json:"totp_enabled"`
+	TOTPLastStep int64  `gorm:"not null;default:0" json:"-"` // Bước thời gian của mã cuối cùng đã dùng, chống dùng lại mã
 }
 
 // BeforeCreate tự động tạo UUID trước khi tạo bản ghi mới
@@ -29,43 +53,88 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
-// HashPassword mã hóa password người dùng bằng bcrypt
+// HashPassword mã hóa password người dùng bằng thuật toán được cấu hình (bcrypt hoặc argon2id)
 func (u *User) HashPassword() error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	hashedPassword, err := password.Default().Hash(u.Password)
 	if err != nil {
 		return err
 	}
-	u.Password = string(hashedPassword)
+	u.Password = hashedPassword
 	return nil
 }
 
 // CheckPassword kiểm tra password cung cấp có trùng khớp với password đã hash không
-func (u *User) CheckPassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	return err == nil
+func (u *User) CheckPassword(plain string) bool {
+	ok, err := password.Default().Verify(plain, u.Password)
+	return err == nil && ok
+}
+
+// PasswordNeedsRehash kiểm tra password có được hash bằng thuật toán hoặc tham số cũ không
+func (u *User) PasswordNeedsRehash() bool {
+	return password.Default().NeedsRehash(u.Password)
+}
+
+// PasswordExpired kiểm tra mật khẩu đã dùng lâu hơn maxAge chưa (maxAge <= 0 nghĩa là không giới hạn)
+// hoặc đã bị admin yêu cầu đặt lại
+func (u *User) PasswordExpired(maxAge time.Duration, now time.Time) bool {
+	if u.PasswordResetRequired {
+		return true
+	}
+	if maxAge <= 0 {
+		return false
+	}
+	changedAt := u.CreatedAt
+	if u.PasswordChangedAt != nil {
+		changedAt = *u.PasswordChangedAt
+	}
+	return now.Sub(changedAt) > maxAge
+}
+
+// IsLocked kiểm tra tài khoản có đang bị khóa tạm thời không
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(now)
+}
+
+// MFAEnabled kiểm tra user có bật xác thực hai lớp không
+func (u *User) MFAEnabled() bool {
+	return u.TOTPEnabled
 }
 
 // UserResponse là struct được sử dụng để trả về thông tin người dùng
 // mà không bao gồm các trường nhạy cảm như password
 type UserResponse struct {
-	ID        uuid.UUID `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            uuid.UUID `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	FirstName     string    `json:"first_name"`
+	LastName      string    `json:"last_name"`
+	Role          string    `json:"role"`
+	Locale        string    `json:"locale"`
+	MFAEnabled    bool      `json:"mfa_enabled"`
+	EmailVerified bool      `json:"email_verified"`
+	Phone         string    `json:"phone,omitempty"`
+	PhoneVerified bool      `json:"phone_verified"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 // ToUserResponse chuyển đổi từ model User sang UserResponse
 func (u *User) ToUserResponse() UserResponse {
+	var phone string
+	if u.Phone != nil {
+		phone = *u.Phone
+	}
 	return UserResponse{
-		ID:        u.ID,
-		Username:  u.Username,
-		Email:     u.Email,
-		FirstName: u.FirstName,
-		LastName:  u.LastName,
-		Role:      u.Role,
-		CreatedAt: u.CreatedAt,
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		FirstName:     u.FirstName,
+		LastName:      u.LastName,
+		Role:          u.Role,
+		Locale:        u.Locale,
+		MFAEnabled:    u.MFAEnabled(),
+		EmailVerified: u.EmailVerified,
+		Phone:         phone,
+		PhoneVerified: u.PhoneVerified,
+		CreatedAt:     u.CreatedAt,
 	}
 }
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserIdentity liên kết tài khoản tại một identity provider bên ngoài (Google, GitHub...) với user.
+// Subject là ID ổn định của tài khoản tại provider; mỗi user liên kết tối đa một tài khoản của mỗi provider.
+type UserIdentity struct {
+	ID          uuid.UUID  `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:char(36);not null;uniqueIndex:idx_user_identities_user_provider" json:"user_id"`
+	User        User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Provider    string     `gorm:"size:50;not null;uniqueIndex:idx_user_identities_provider_subject;uniqueIndex:idx_user_identities_user_provider" json:"provider"`
+	Subject     string     `gorm:"size:255;not null;uniqueIndex:idx_user_identities_provider_subject" json:"-"`
+	Email       string     `gorm:"size:100" json:"email"` // Email tại provider ở lần đăng nhập gần nhất
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate tự động tạo UUID trước khi tạo bản ghi mới
+func (i *UserIdentity) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebAuthnCredential lưu một passkey/khóa bảo mật WebAuthn đã đăng ký của người dùng
+type WebAuthnCredential struct {
+	ID              uuid.UUID  `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID          uuid.UUID  `gorm:"type:char(36);index;not null" json:"user_id"`
+	User            User       `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Name            string     `gorm:"size:100" json:"name"`
+	CredentialID    []byte     `gorm:"type:varbinary(255);uniqueIndex;not null" json:"-"`
+	PublicKey       []byte     `gorm:"type:blob;not null" json:"-"`
+	AttestationType string     `gorm:"size:32" json:"attestation_type"`
+	Transports      string     `gorm:"size:255" json:"transports"` // Danh sách transport, phân tách bằng dấu phẩy
+	AAGUID          []byte     `gorm:"type:varbinary(16)" json:"-"`
+	SignCount       uint32     `gorm:"not null;default:0" json:"-"`
+	BackupEligible  bool       `gorm:"not null;default:false" json:"backup_eligible"`
+	BackupState     bool       `gorm:"not null;default:false" json:"backup_state"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty"`
+}
+
+// BeforeCreate tự động tạo UUID trước khi tạo bản ghi mới
+func (c *WebAuthnCredential) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// WebAuthnChallenge lưu dữ liệu của một nghi thức WebAuthn (đăng ký hoặc đăng nhập) đang diễn ra.
+// Bản ghi bị xóa ngay khi nghi thức kết thúc để challenge không thể bị dùng lại.
+type WebAuthnChallenge struct {
+	ID          uuid.UUID  `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID      *uuid.UUID `gorm:"type:char(36);index" json:"user_id,omitempty"` // Rỗng với đăng nhập bằng discoverable credential
+	Ceremony    string     `gorm:"size:20;not null" json:"ceremony"`
+	SessionData string     `gorm:"type:text;not null" json:"-"` // webauthn.SessionData dạng JSON
+	ExpiresAt   time.Time  `gorm:"index;not null" json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// BeforeCreate tự động tạo UUID trước khi tạo bản ghi mới
+func (c *WebAuthnChallenge) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+)
+
+// StartCleanup chạy một goroutine định kỳ xóa trạng thái của các key không còn hoạt động.
+// Hàm trả về một hàm stop để dừng goroutine khi tắt server.
+func StartCleanup(store Store, interval time.Duration, logger *logger.Logger) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := store.DeleteExpired(time.Now())
+				if err != nil {
+					logger.Errorf("Rate limit cleanup error: %v", err)
+					continue
+				}
+				if deleted > 0 {
+					logger.Infof("Rate limit cleanup removed %d entries", deleted)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// memoryStore lưu trạng thái trong bộ nhớ, chỉ phù hợp khi chạy một instance
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	state     state
+	expiresAt time.Time
+}
+
+// NewMemoryStore tạo Store lưu trong bộ nhớ
+func NewMemoryStore() Store {
+	return &memoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+// Allow kiểm tra và ghi nhận một request của key
+func (s *memoryStore) Allow(key string, policy Policy, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.entries[key]
+	if !exists {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	result, expiresAt := apply(policy, &entry.state, exists, now)
+	entry.expiresAt = expiresAt
+	return result, nil
+}
+
+// DeleteExpired xóa trạng thái của các key đã lâu không có request
+func (s *memoryStore) DeleteExpired(now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for key, entry := range s.entries {
+		if entry.expiresAt.Before(now) {
+			delete(s.entries, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,155 @@
+// Package ratelimit cài đặt giới hạn số request theo thuật toán token bucket
+// hoặc sliding window, với trạng thái lưu trong bộ nhớ hoặc database.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithm là thuật toán giới hạn
+type Algorithm string
+
+const (
+	// TokenBucket cho phép burst tới Limit request, token được nạp lại đều đặn Limit/Window
+	TokenBucket Algorithm = "token_bucket"
+	// SlidingWindow đếm request trong cửa sổ trượt (xấp xỉ bằng trọng số của cửa sổ trước)
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+// Policy là một chính sách giới hạn: tối đa Limit request trong Window
+type Policy struct {
+	Name      string
+	Limit     int
+	Window    time.Duration
+	Algorithm Algorithm
+}
+
+// Result là kết quả kiểm tra một request
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // Thời gian tới khi hạn mức được khôi phục hoàn toàn
+	RetryAfter time.Duration // Thời gian cần chờ nếu request bị từ chối
+}
+
+// Store lưu trạng thái giới hạn của các key
+type Store interface {
+	Allow(key string, policy Policy, now time.Time) (Result, error)
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+// ParsePolicy đọc chính sách dạng "<limit>/<window>", ví dụ "10/1m" hoặc "1000/1h"
+func ParsePolicy(name, spec string, algorithm Algorithm) (Policy, error) {
+	parts := strings.SplitN(spec, "/", 2)
+	if len(parts) != 2 {
+		return Policy{}, fmt.Errorf("invalid rate limit %q for %s: expected <limit>/<window>", spec, name)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit <= 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit %q for %s: limit must be a positive integer", spec, name)
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || window <= 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit %q for %s: invalid window", spec, name)
+	}
+	if algorithm != TokenBucket && algorithm != SlidingWindow {
+		return Policy{}, fmt.Errorf("unknown rate limit algorithm: %s", algorithm)
+	}
+	return Policy{Name: name, Limit: limit, Window: window, Algorithm: algorithm}, nil
+}
+
+// state là trạng thái của một key, dùng chung cho cả hai thuật toán
+type state struct {
+	// Sliding window
+	WindowStart time.Time
+	Count       int64
+	PrevCount   int64
+
+	// Token bucket
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// apply cập nhật trạng thái cho một request mới và trả về kết quả cùng thời điểm trạng thái hết ý nghĩa
+func apply(policy Policy, st *state, exists bool, now time.Time) (Result, time.Time) {
+	if policy.Algorithm == TokenBucket {
+		return applyTokenBucket(policy, st, exists, now)
+	}
+	return applySlidingWindow(policy, st, exists, now)
+}
+
+func applyTokenBucket(policy Policy, st *state, exists bool, now time.Time) (Result, time.Time) {
+	capacity := float64(policy.Limit)
+	rate := capacity / policy.Window.Seconds() // token mỗi giây
+
+	if !exists {
+		st.Tokens = capacity
+	} else if elapsed := now.Sub(st.UpdatedAt).Seconds(); elapsed > 0 {
+		st.Tokens = math.Min(capacity, st.Tokens+elapsed*rate)
+	}
+	st.UpdatedAt = now
+
+	result := Result{Limit: policy.Limit}
+	if st.Tokens >= 1 {
+		st.Tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - st.Tokens) / rate)
+	}
+	result.Remaining = int(math.Floor(st.Tokens))
+	result.Reset = seconds((capacity - st.Tokens) / rate)
+	return result, now.Add(result.Reset)
+}
+
+func applySlidingWindow(policy Policy, st *state, exists bool, now time.Time) (Result, time.Time) {
+	windowStart := now.Truncate(policy.Window)
+	switch {
+	case !exists || windowStart.Sub(st.WindowStart) >= 2*policy.Window:
+		st.PrevCount, st.Count = 0, 0
+	case windowStart.After(st.WindowStart):
+		st.PrevCount, st.Count = st.Count, 0
+	}
+	st.WindowStart = windowStart
+
+	// Số request ước tính trong cửa sổ trượt: phần còn lại của cửa sổ trước theo trọng số + cửa sổ hiện tại
+	elapsed := now.Sub(windowStart)
+	weight := float64(policy.Window-elapsed) / float64(policy.Window)
+	estimated := float64(st.PrevCount)*weight + float64(st.Count)
+
+	result := Result{Limit: policy.Limit, Reset: policy.Window - elapsed}
+	if estimated+1 <= float64(policy.Limit) {
+		st.Count++
+		estimated++
+		result.Allowed = true
+	} else {
+		result.RetryAfter = retryAfterSlidingWindow(policy, st, elapsed)
+	}
+	result.Remaining = int(math.Max(0, math.Floor(float64(policy.Limit)-estimated)))
+	return result, windowStart.Add(2 * policy.Window)
+}
+
+// retryAfterSlidingWindow tính thời gian tới khi ước lượng giảm đủ để nhận thêm một request
+func retryAfterSlidingWindow(policy Policy, st *state, elapsed time.Duration) time.Duration {
+	limit := float64(policy.Limit)
+	if float64(st.Count)+1 > limit || st.PrevCount == 0 {
+		// Cửa sổ hiện tại đã đầy: sang cửa sổ sau, Count trở thành PrevCount nên còn phải chờ
+		// tới khi Count*weight' + 1 <= limit, tức weight' = (limit-1)/Count
+		return policy.Window - elapsed + seconds((1-(limit-1)/float64(st.Count))*policy.Window.Seconds())
+	}
+	// Cần weight' sao cho PrevCount*weight' + Count + 1 <= limit
+	targetWeight := (limit - float64(st.Count) - 1) / float64(st.PrevCount)
+	wait := seconds((1-targetWeight)*policy.Window.Seconds()) - elapsed
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
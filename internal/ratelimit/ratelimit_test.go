@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// testEpoch nằm đúng đầu một cửa sổ phút để các mốc thời gian trong test dễ đọc
+var testEpoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func at(offset time.Duration) time.Time {
+	return testEpoch.Add(offset)
+}
+
+func mustPolicy(t *testing.T, spec string, algorithm Algorithm) Policy {
+	t.Helper()
+	policy, err := ParsePolicy("test", spec, algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+// allowN gửi n request của key tại cùng thời điểm, tất cả phải được chấp nhận
+func allowN(t *testing.T, store Store, policy Policy, n int, now time.Time) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		result, err := store.Allow("client", policy, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed {
+			t.Fatalf("request %d at %s rejected", i+1, now.Sub(testEpoch))
+		}
+	}
+}
+
+// assertRetryAfter kiểm tra request tại now bị từ chối với Retry-After bằng want,
+// request gửi lại sớm hơn một giây vẫn bị từ chối và request gửi lại đúng hạn được chấp nhận
+func assertRetryAfter(t *testing.T, store Store, policy Policy, now time.Time, want time.Duration) {
+	t.Helper()
+	result, err := store.Allow("client", policy, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed {
+		t.Fatalf("request at %s allowed, want rejected", now.Sub(testEpoch))
+	}
+	if result.RetryAfter != want {
+		t.Fatalf("RetryAfter = %s, want %s", result.RetryAfter, want)
+	}
+	if early, _ := store.Allow("client", policy, now.Add(result.RetryAfter-time.Second)); early.Allowed {
+		t.Fatalf("retry one second before Retry-After (%s) was allowed", result.RetryAfter)
+	}
+	if retry, _ := store.Allow("client", policy, now.Add(result.RetryAfter)); !retry.Allowed {
+		t.Fatalf("retry after %s rejected again, Retry-After was too short", result.RetryAfter)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy("login", " 10 / 1m ", SlidingWindow)
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	if policy.Limit != 10 || policy.Window != time.Minute || policy.Algorithm != SlidingWindow {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+
+	for _, spec := range []string{"10", "0/1m", "-1/1m", "x/1m", "10/0s", "10/soon"} {
+		if _, err := ParsePolicy("login", spec, SlidingWindow); err == nil {
+			t.Errorf("ParsePolicy(%q) succeeded, want error", spec)
+		}
+	}
+	if _, err := ParsePolicy("login", "10/1m", "leaky_bucket"); err == nil {
+		t.Error("unknown algorithm accepted")
+	}
+}
+
+func TestSlidingWindowFullWindowRetryAfter(t *testing.T) {
+	store := NewMemoryStore()
+	policy := mustPolicy(t, "5/1m", SlidingWindow)
+
+	// 5 request tại giây 10 làm đầy cửa sổ. Sang cửa sổ sau 5 request này vẫn được tính theo trọng số,
+	// nên phải chờ tới giây 72 (trọng số 0.8) chứ không phải giây 60
+	allowN(t, store, policy, 5, at(10*time.Second))
+	assertRetryAfter(t, store, policy, at(10*time.Second), 62*time.Second)
+}
+
+func TestSlidingWindowWeightedRetryAfter(t *testing.T) {
+	store := NewMemoryStore()
+	policy := mustPolicy(t, "5/1m", SlidingWindow)
+
+	// Cửa sổ trước có 5 request; tại giây 70 ước lượng là 5*50/60 + 1 > 5, tới giây 72 mới còn chỗ
+	allowN(t, store, policy, 5, at(10*time.Second))
+	assertRetryAfter(t, store, policy, at(70*time.Second), 2*time.Second)
+}
+
+func TestSlidingWindowRemainingAndExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	policy := mustPolicy(t, "3/1m", SlidingWindow)
+
+	result, _ := store.Allow("client", policy, at(15*time.Second))
+	if !result.Allowed || result.Remaining != 2 || result.Reset != 45*time.Second {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	// Sau hai cửa sổ không có request, trạng thái được bỏ qua như key mới
+	allowN(t, store, policy, 2, at(20*time.Second))
+	allowN(t, store, policy, 3, at(2*time.Minute+20*time.Second))
+
+	if deleted, _ := store.DeleteExpired(at(4 * time.Minute)); deleted != 0 {
+		t.Fatalf("deleted %d entries before they expire", deleted)
+	}
+	if deleted, _ := store.DeleteExpired(at(4*time.Minute + time.Second)); deleted != 1 {
+		t.Fatalf("deleted %d entries, want 1", deleted)
+	}
+}
+
+func TestTokenBucketRetryAfter(t *testing.T) {
+	store := NewMemoryStore()
+	policy := mustPolicy(t, "5/1m", TokenBucket)
+
+	// Burst tới 5 request, sau đó mỗi 12 giây được nạp lại một token
+	allowN(t, store, policy, 5, at(10*time.Second))
+	assertRetryAfter(t, store, policy, at(10*time.Second), 12*time.Second)
+
+	// Token vừa nạp đã được dùng bởi lần thử lại; 3 giây sau còn phải chờ thêm 9 giây
+	assertRetryAfter(t, store, policy, at(25*time.Second), 9*time.Second)
+}
+
+func TestTokenBucketRefillsToCapacity(t *testing.T) {
+	store := NewMemoryStore()
+	policy := mustPolicy(t, "5/1m", TokenBucket)
+
+	allowN(t, store, policy, 5, at(0))
+	result, _ := store.Allow("client", policy, at(0))
+	if result.Allowed || result.Remaining != 0 || result.Reset != time.Minute {
+		t.Fatalf("unexpected result for an empty bucket: %+v", result)
+	}
+
+	// Để trống lâu hơn Window, bucket chỉ đầy lại tới Limit chứ không tích lũy thêm
+	allowN(t, store, policy, 5, at(10*time.Minute))
+	if result, _ := store.Allow("client", policy, at(10*time.Minute)); result.Allowed {
+		t.Fatal("bucket refilled beyond its capacity")
+	}
+}
+
+func TestKeysAreLimitedIndependently(t *testing.T) {
+	for _, algorithm := range []Algorithm{SlidingWindow, TokenBucket} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			store := NewMemoryStore()
+			policy := mustPolicy(t, "1/1m", algorithm)
+
+			if result, _ := store.Allow("a", policy, at(0)); !result.Allowed {
+				t.Fatal("first request of a rejected")
+			}
+			if result, _ := store.Allow("b", policy, at(0)); !result.Allowed {
+				t.Fatal("b must not share the limit of a")
+			}
+			if result, _ := store.Allow("a", policy, at(0)); result.Allowed {
+				t.Fatal("second request of a allowed")
+			}
+		})
+	}
+}
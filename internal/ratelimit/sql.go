@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sqlStore lưu trạng thái trong database, dùng chung giữa nhiều instance.
+// Mỗi request khóa dòng của key (SELECT ... FOR UPDATE) trong một transaction,
+// dòng được chèn trước nếu key chưa có.
+type sqlStore struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewSQLStore tạo Store lưu trong database
+func NewSQLStore(db *gorm.DB, logger *logger.Logger) Store {
+	return &sqlStore{db: db, logger: logger}
+}
+
+// Allow kiểm tra và ghi nhận một request của key
+func (s *sqlStore) Allow(key string, policy Policy, now time.Time) (Result, error) {
+	var result Result
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Chèn trước một dòng rỗng cho key mới để luôn có dòng để khóa. Request đồng thời của cùng key
+		// chờ ở bước này tới khi transaction chèn dòng commit, sau đó đọc trạng thái đã được cập nhật
+		// thay vì cùng coi key là mới rồi ghi đè lên nhau.
+		placeholder := models.RateLimitEntry{Key: key, WindowStart: now, RefilledAt: now, ExpiresAt: now}
+		inserted := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&placeholder)
+		if inserted.Error != nil {
+			return inserted.Error
+		}
+		exists := inserted.RowsAffected == 0
+
+		var entry models.RateLimitEntry
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("`key` = ?", key).First(&entry).Error; err != nil {
+			return err
+		}
+
+		st := state{
+			WindowStart: entry.WindowStart,
+			Count:       entry.Count,
+			PrevCount:   entry.PrevCount,
+			Tokens:      entry.Tokens,
+			UpdatedAt:   entry.RefilledAt,
+		}
+		var expiresAt time.Time
+		result, expiresAt = apply(policy, &st, exists, now)
+
+		entry = models.RateLimitEntry{
+			Key:         key,
+			WindowStart: nonZero(st.WindowStart, now),
+			Count:       st.Count,
+			PrevCount:   st.PrevCount,
+			Tokens:      st.Tokens,
+			RefilledAt:  nonZero(st.UpdatedAt, now),
+			ExpiresAt:   expiresAt,
+		}
+		return tx.Save(&entry).Error
+	})
+	if err != nil {
+		s.logger.Errorf("Error applying rate limit: %v", err)
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// DeleteExpired xóa trạng thái của các key đã lâu không có request
+func (s *sqlStore) DeleteExpired(now time.Time) (int64, error) {
+	result := s.db.Where("expires_at < ?", now).Delete(&models.RateLimitEntry{})
+	if result.Error != nil {
+		s.logger.Errorf("Error deleting expired rate limit entries: %v", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// nonZero thay thời điểm rỗng (trường không dùng bởi thuật toán của policy) bằng now,
+// vì MySQL ở strict mode không chấp nhận giá trị 0000-00-00
+func nonZero(t, now time.Time) time.Time {
+	if t.IsZero() {
+		return now
+	}
+	return t
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIKeyRepository định nghĩa interface cho các phương thức thao tác với APIKey
+type APIKeyRepository interface {
+	Create(key *models.APIKey) error
+	FindByHash(tokenHash string) (*models.APIKey, error)
+	FindByID(id uuid.UUID) (*models.APIKey, error)
+	ListByUser(userID uuid.UUID) ([]models.APIKey, error)
+	Revoke(id uuid.UUID) error
+	UpdateLastUsed(id uuid.UUID, lastUsedAt time.Time) error
+}
+
+// apiKeyRepository struct triển khai APIKeyRepository interface
+type apiKeyRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewAPIKeyRepository tạo một instance mới của APIKeyRepository
+func NewAPIKeyRepository(db *gorm.DB, logger *logger.Logger) APIKeyRepository {
+	return &apiKeyRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create lưu một API key mới
+func (r *apiKeyRepository) Create(key *models.APIKey) error {
+	err := r.db.Omit("User").Create(key).Error
+	if err != nil {
+		r.logger.Errorf("Error creating api key: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindByHash tìm API key theo hash
+func (r *apiKeyRepository) FindByHash(tokenHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.Where("token_hash = ?", tokenHash).First(&key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding api key by hash: %v", err)
+		return nil, err
+	}
+	return &key, nil
+}
+
+// FindByID tìm API key theo ID
+func (r *apiKeyRepository) FindByID(id uuid.UUID) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.Where("id = ?", id).First(&key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding api key by ID: %v", err)
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListByUser lấy danh sách API key của user, mới nhất trước
+func (r *apiKeyRepository) ListByUser(userID uuid.UUID) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	if err != nil {
+		r.logger.Errorf("Error listing api keys: %v", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke đánh dấu API key đã bị thu hồi
+func (r *apiKeyRepository) Revoke(id uuid.UUID) error {
+	err := r.db.Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		r.logger.Errorf("Error revoking api key: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateLastUsed cập nhật thời điểm sử dụng gần nhất của API key
+func (r *apiKeyRepository) UpdateLastUsed(id uuid.UUID, lastUsedAt time.Time) error {
+	err := r.db.Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", lastUsedAt).Error
+	if err != nil {
+		r.logger.Errorf("Error updating api key last used: %v", err)
+		return err
+	}
+	return nil
+}
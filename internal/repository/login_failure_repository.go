@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// LoginFailureRepository định nghĩa interface cho các phương thức thao tác với LoginFailure
+type LoginFailureRepository interface {
+	Create(failure *models.LoginFailure) error
+	CountByIP(ipAddress string, since time.Time) (int64, time.Time, error)
+	DeleteBefore(before time.Time) (int64, error)
+}
+
+// loginFailureRepository struct triển khai LoginFailureRepository interface
+type loginFailureRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewLoginFailureRepository tạo một instance mới của LoginFailureRepository
+func NewLoginFailureRepository(db *gorm.DB, logger *logger.Logger) LoginFailureRepository {
+	return &loginFailureRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create ghi nhận một lần đăng nhập thất bại
+func (r *loginFailureRepository) Create(failure *models.LoginFailure) error {
+	err := r.db.Create(failure).Error
+	if err != nil {
+		r.logger.Errorf("Error creating login failure: %v", err)
+		return err
+	}
+	return nil
+}
+
+// CountByIP đếm số lần thất bại của một IP kể từ thời điểm since,
+// kèm thời điểm của lần thất bại cũ nhất trong khoảng đó
+func (r *loginFailureRepository) CountByIP(ipAddress string, since time.Time) (int64, time.Time, error) {
+	var result struct {
+		Count  int64
+		Oldest *time.Time
+	}
+	err := r.db.Model(&models.LoginFailure{}).
+		Select("COUNT(*) AS count, MIN(created_at) AS oldest").
+		Where("ip_address = ? AND created_at > ?", ipAddress, since).
+		Scan(&result).Error
+	if err != nil {
+		r.logger.Errorf("Error counting login failures: %v", err)
+		return 0, time.Time{}, err
+	}
+	if result.Oldest == nil {
+		return result.Count, time.Time{}, nil
+	}
+	return result.Count, *result.Oldest, nil
+}
+
+// DeleteBefore xóa các bản ghi cũ hơn thời điểm before
+func (r *loginFailureRepository) DeleteBefore(before time.Time) (int64, error) {
+	result := r.db.Where("created_at < ?", before).Delete(&models.LoginFailure{})
+	if result.Error != nil {
+		r.logger.Errorf("Error deleting login failures: %v", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
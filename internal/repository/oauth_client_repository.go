@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// OAuthClientRepository định nghĩa interface cho các phương thức thao tác với OAuthClient
+type OAuthClientRepository interface {
+	Create(client *models.OAuthClient) error
+	FindByClientID(clientID string) (*models.OAuthClient, error)
+	List() ([]models.OAuthClient, error)
+	Delete(clientID string) error
+}
+
+// oauthClientRepository struct triển khai OAuthClientRepository interface
+type oauthClientRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewOAuthClientRepository tạo một instance mới của OAuthClientRepository
+func NewOAuthClientRepository(db *gorm.DB, logger *logger.Logger) OAuthClientRepository {
+	return &oauthClientRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create lưu một client mới
+func (r *oauthClientRepository) Create(client *models.OAuthClient) error {
+	err := r.db.Create(client).Error
+	if err != nil {
+		r.logger.Errorf("Error creating oauth client: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindByClientID tìm client theo client_id
+func (r *oauthClientRepository) FindByClientID(clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := r.db.Where("client_id = ?", clientID).First(&client).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding oauth client: %v", err)
+		return nil, err
+	}
+	return &client, nil
+}
+
+// List lấy danh sách tất cả client
+func (r *oauthClientRepository) List() ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	err := r.db.Order("created_at").Find(&clients).Error
+	if err != nil {
+		r.logger.Errorf("Error listing oauth clients: %v", err)
+		return nil, err
+	}
+	return clients, nil
+}
+
+// Delete xóa client theo client_id
+func (r *oauthClientRepository) Delete(clientID string) error {
+	err := r.db.Where("client_id = ?", clientID).Delete(&models.OAuthClient{}).Error
+	if err != nil {
+		r.logger.Errorf("Error deleting oauth client: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrCodeAlreadyUsed được trả về khi authorization code đã được đổi lấy token trước đó
+var ErrCodeAlreadyUsed = errors.New("authorization code already used")
+
+// OAuthCodeRepository định nghĩa interface cho các phương thức thao tác với OAuthAuthorizationCode
+type OAuthCodeRepository interface {
+	Create(code *models.OAuthAuthorizationCode) error
+	Consume(codeHash string) (*models.OAuthAuthorizationCode, error)
+	SetFamily(id, familyID uuid.UUID) error
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+// oauthCodeRepository struct triển khai OAuthCodeRepository interface
+type oauthCodeRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewOAuthCodeRepository tạo một instance mới của OAuthCodeRepository
+func NewOAuthCodeRepository(db *gorm.DB, logger *logger.Logger) OAuthCodeRepository {
+	return &oauthCodeRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create lưu một authorization code mới
+func (r *oauthCodeRepository) Create(code *models.OAuthAuthorizationCode) error {
+	err := r.db.Omit("User").Create(code).Error
+	if err != nil {
+		r.logger.Errorf("Error creating authorization code: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Consume đánh dấu code đã được dùng và trả về code đó. Trả về nil nếu code không tồn tại
+// hoặc đã hết hạn; trả về code kèm ErrCodeAlreadyUsed nếu code đã được dùng trước đó.
+func (r *oauthCodeRepository) Consume(codeHash string) (*models.OAuthAuthorizationCode, error) {
+	var code models.OAuthAuthorizationCode
+	err := r.db.Where("code_hash = ?", codeHash).First(&code).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding authorization code: %v", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	if code.UsedAt != nil {
+		return &code, ErrCodeAlreadyUsed
+	}
+	if !code.ExpiresAt.After(now) {
+		return nil, nil
+	}
+
+	result := r.db.Model(&models.OAuthAuthorizationCode{}).
+		Where("id = ? AND used_at IS NULL", code.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		r.logger.Errorf("Error consuming authorization code: %v", result.Error)
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &code, ErrCodeAlreadyUsed
+	}
+	code.UsedAt = &now
+	return &code, nil
+}
+
+// SetFamily ghi lại family của refresh token được cấp từ code, để thu hồi khi code bị dùng lại
+func (r *oauthCodeRepository) SetFamily(id, familyID uuid.UUID) error {
+	err := r.db.Model(&models.OAuthAuthorizationCode{}).Where("id = ?", id).Update("family_id", familyID).Error
+	if err != nil {
+		r.logger.Errorf("Error updating authorization code family: %v", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteExpired xóa các code đã hết hạn trước thời điểm before
+func (r *oauthCodeRepository) DeleteExpired(before time.Time) (int64, error) {
+	result := r.db.Where("expires_at < ?", before).Delete(&models.OAuthAuthorizationCode{})
+	if result.Error != nil {
+		r.logger.Errorf("Error deleting expired authorization codes: %v", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
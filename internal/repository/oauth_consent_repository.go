@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OAuthConsentRepository định nghĩa interface cho các phương thức thao tác với OAuthConsent
+type OAuthConsentRepository interface {
+	Find(userID uuid.UUID, clientID string) (*models.OAuthConsent, error)
+	Save(consent *models.OAuthConsent) error
+}
+
+// oauthConsentRepository struct triển khai OAuthConsentRepository interface
+type oauthConsentRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewOAuthConsentRepository tạo một instance mới của OAuthConsentRepository
+func NewOAuthConsentRepository(db *gorm.DB, logger *logger.Logger) OAuthConsentRepository {
+	return &oauthConsentRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Find tìm consent của user cho một client
+func (r *oauthConsentRepository) Find(userID uuid.UUID, clientID string) (*models.OAuthConsent, error) {
+	var consent models.OAuthConsent
+	err := r.db.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding oauth consent: %v", err)
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// Save tạo mới hoặc cập nhật scope của consent (theo cặp user, client)
+func (r *oauthConsentRepository) Save(consent *models.OAuthConsent) error {
+	err := r.db.Omit("User").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scope", "updated_at"}),
+	}).Create(consent).Error
+	if err != nil {
+		r.logger.Errorf("Error saving oauth consent: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PasswordHistoryRepository định nghĩa interface cho các phương thức thao tác với PasswordHistory
+type PasswordHistoryRepository interface {
+	Create(entry *models.PasswordHistory) error
+	ListRecent(userID uuid.UUID, limit int) ([]models.PasswordHistory, error)
+	DeleteExceptRecent(userID uuid.UUID, keep int) error
+}
+
+// passwordHistoryRepository struct triển khai PasswordHistoryRepository interface
+type passwordHistoryRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewPasswordHistoryRepository tạo một instance mới của PasswordHistoryRepository
+func NewPasswordHistoryRepository(db *gorm.DB, logger *logger.Logger) PasswordHistoryRepository {
+	return &passwordHistoryRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create lưu hash của một mật khẩu vào lịch sử
+func (r *passwordHistoryRepository) Create(entry *models.PasswordHistory) error {
+	err := r.db.Omit("User").Create(entry).Error
+	if err != nil {
+		r.logger.Errorf("Error creating password history: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ListRecent lấy tối đa limit mật khẩu gần nhất của user, mới nhất trước
+func (r *passwordHistoryRepository) ListRecent(userID uuid.UUID, limit int) ([]models.PasswordHistory, error) {
+	var entries []models.PasswordHistory
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Limit(limit).Find(&entries).Error
+	if err != nil {
+		r.logger.Errorf("Error listing password history: %v", err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// DeleteExceptRecent chỉ giữ lại keep mật khẩu gần nhất của user
+func (r *passwordHistoryRepository) DeleteExceptRecent(userID uuid.UUID, keep int) error {
+	var ids []uuid.UUID
+	err := r.db.Model(&models.PasswordHistory{}).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Offset(keep).
+		Limit(1000).
+		Pluck("id", &ids).Error
+	if err != nil {
+		r.logger.Errorf("Error finding old password history: %v", err)
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := r.db.Where("id IN ?", ids).Delete(&models.PasswordHistory{}).Error; err != nil {
+		r.logger.Errorf("Error deleting old password history: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PhoneOTPRepository định nghĩa interface cho các phương thức thao tác với PhoneOTP
+type PhoneOTPRepository interface {
+	Create(otp *models.PhoneOTP) error
+	FindLatest(userID uuid.UUID, purpose string) (*models.PhoneOTP, error)
+	ReserveAttempt(id uuid.UUID, maxAttempts int) (bool, error)
+	Consume(id uuid.UUID) (bool, error)
+	DeleteByUser(userID uuid.UUID, purpose string) error
+}
+
+// phoneOTPRepository struct triển khai PhoneOTPRepository interface
+type phoneOTPRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewPhoneOTPRepository tạo một instance mới của PhoneOTPRepository
+func NewPhoneOTPRepository(db *gorm.DB, logger *logger.Logger) PhoneOTPRepository {
+	return &phoneOTPRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create lưu một mã mới
+func (r *phoneOTPRepository) Create(otp *models.PhoneOTP) error {
+	err := r.db.Omit("User").Create(otp).Error
+	if err != nil {
+		r.logger.Errorf("Error creating phone otp: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindLatest tìm mã mới nhất của user theo mục đích sử dụng, kể cả mã đã hết hạn
+func (r *phoneOTPRepository) FindLatest(userID uuid.UUID, purpose string) (*models.PhoneOTP, error) {
+	var otp models.PhoneOTP
+	err := r.db.Where("user_id = ? AND purpose = ?", userID, purpose).
+		Order("created_at DESC").
+		First(&otp).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding phone otp: %v", err)
+		return nil, err
+	}
+	return &otp, nil
+}
+
+// ReserveAttempt tính một lần thử cho mã trước khi so sánh. Trả về false nếu mã đã dùng hết maxAttempts
+// lần thử hoặc đã bị xóa; vì kiểm tra và tăng nằm trong cùng một câu UPDATE, các request đồng thời
+// không thể thử quá maxAttempts lần.
+func (r *phoneOTPRepository) ReserveAttempt(id uuid.UUID, maxAttempts int) (bool, error) {
+	result := r.db.Model(&models.PhoneOTP{}).
+		Where("id = ? AND attempts < ?", id, maxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		r.logger.Errorf("Error reserving phone otp attempt: %v", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Consume xóa mã sau khi dùng. Trả về false nếu mã đã bị xóa trước đó,
+// nhờ vậy hai request đồng thời không thể cùng dùng một mã.
+func (r *phoneOTPRepository) Consume(id uuid.UUID) (bool, error) {
+	result := r.db.Where("id = ?", id).Delete(&models.PhoneOTP{})
+	if result.Error != nil {
+		r.logger.Errorf("Error consuming phone otp: %v", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteByUser xóa các mã của user theo mục đích sử dụng
+func (r *phoneOTPRepository) DeleteByUser(userID uuid.UUID, purpose string) error {
+	err := r.db.Where("user_id = ? AND purpose = ?", userID, purpose).Delete(&models.PhoneOTP{}).Error
+	if err != nil {
+		r.logger.Errorf("Error deleting phone otps: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RecoveryCodeRepository định nghĩa interface cho các phương thức thao tác với RecoveryCode
+type RecoveryCodeRepository interface {
+	ReplaceForUser(userID uuid.UUID, codes []models.RecoveryCode) error
+	Consume(userID uuid.UUID, codeHash string) (bool, error)
+	DeleteByUser(userID uuid.UUID) error
+}
+
+// recoveryCodeRepository struct triển khai RecoveryCodeRepository interface
+type recoveryCodeRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewRecoveryCodeRepository tạo một instance mới của RecoveryCodeRepository
+func NewRecoveryCodeRepository(db *gorm.DB, logger *logger.Logger) RecoveryCodeRepository {
+	return &recoveryCodeRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// ReplaceForUser xóa các mã khôi phục cũ và lưu bộ mã mới của user
+func (r *recoveryCodeRepository) ReplaceForUser(userID uuid.UUID, codes []models.RecoveryCode) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			r.logger.Errorf("Error deleting recovery codes: %v", err)
+			return err
+		}
+		if err := tx.Create(&codes).Error; err != nil {
+			r.logger.Errorf("Error creating recovery codes: %v", err)
+			return err
+		}
+		return nil
+	})
+}
+
+// Consume đánh dấu mã khôi phục đã được dùng. Trả về false nếu mã không tồn tại hoặc đã dùng.
+func (r *recoveryCodeRepository) Consume(userID uuid.UUID, codeHash string) (bool, error) {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Limit(1).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		r.logger.Errorf("Error consuming recovery code: %v", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteByUser xóa tất cả mã khôi phục của user
+func (r *recoveryCodeRepository) DeleteByUser(userID uuid.UUID) error {
+	err := r.db.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	if err != nil {
+		r.logger.Errorf("Error deleting recovery codes: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrTokenAlreadyRotated được trả về khi refresh token đã bị xoay vòng bởi một request khác
+var ErrTokenAlreadyRotated = errors.New("refresh token already rotated")
+
+// RefreshTokenRepository định nghĩa interface cho các phương thức thao tác với RefreshToken
+type RefreshTokenRepository interface {
+	Create(token *models.RefreshToken) error
+	FindByHash(tokenHash string) (*models.RefreshToken, error)
+	Rotate(oldToken *models.RefreshToken, newToken *models.RefreshToken) error
+	RevokeFamily(familyID uuid.UUID) error
+	RevokeByUser(userID uuid.UUID) error
+	DeleteByUser(userID uuid.UUID) error
+}
+
+// refreshTokenRepository struct triển khai RefreshTokenRepository interface
+type refreshTokenRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewRefreshTokenRepository tạo một instance mới của RefreshTokenRepository
+func NewRefreshTokenRepository(db *gorm.DB, logger *logger.Logger) RefreshTokenRepository {
+	return &refreshTokenRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create lưu một refresh token mới
+func (r *refreshTokenRepository) Create(token *models.RefreshToken) error {
+	err := r.db.Create(token).Error
+	if err != nil {
+		r.logger.Errorf("Error creating refresh token: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindByHash tìm refresh token theo giá trị hash
+func (r *refreshTokenRepository) FindByHash(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding refresh token: %v", err)
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Rotate đánh dấu token cũ đã bị thay thế và lưu token mới trong cùng một transaction.
+// Nếu token cũ đã bị thu hồi bởi request khác thì trả về ErrTokenAlreadyRotated.
+func (r *refreshTokenRepository) Rotate(oldToken *models.RefreshToken, newToken *models.RefreshToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(newToken).Error; err != nil {
+			r.logger.Errorf("Error creating rotated refresh token: %v", err)
+			return err
+		}
+
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", oldToken.ID).
+			Updates(map[string]interface{}{
+				"revoked_at":     now,
+				"replaced_by_id": newToken.ID,
+			})
+		if result.Error != nil {
+			r.logger.Errorf("Error revoking rotated refresh token: %v", result.Error)
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTokenAlreadyRotated
+		}
+
+		oldToken.RevokedAt = &now
+		oldToken.ReplacedByID = &newToken.ID
+		return nil
+	})
+}
+
+// RevokeFamily thu hồi tất cả refresh token còn hiệu lực trong cùng một family
+func (r *refreshTokenRepository) RevokeFamily(familyID uuid.UUID) error {
+	err := r.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		r.logger.Errorf("Error revoking refresh token family: %v", err)
+		return err
+	}
+	return nil
+}
+
+// RevokeByUser thu hồi tất cả refresh token còn hiệu lực của một user
+func (r *refreshTokenRepository) RevokeByUser(userID uuid.UUID) error {
+	err := r.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		r.logger.Errorf("Error revoking refresh tokens of user: %v", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteByUser xóa tất cả refresh token của một user (kể cả token cấp cho OAuth client)
+func (r *refreshTokenRepository) DeleteByUser(userID uuid.UUID) error {
+	err := r.db.Where("user_id = ?", userID).Delete(&models.RefreshToken{}).Error
+	if err != nil {
+		r.logger.Errorf("Error deleting refresh tokens of user: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevocationStore định nghĩa interface lưu danh sách jti của các JWT đã bị thu hồi
+type RevocationStore interface {
+	Revoke(jti string, expiresAt time.Time) error
+	Consume(jti string, expiresAt time.Time) (bool, error)
+	IsRevoked(jti string) (bool, error)
+	DeleteExpired() (int64, error)
+}
+
+// dbRevocationStore lưu danh sách thu hồi trong database, dùng được khi chạy nhiều instance
+type dbRevocationStore struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewDBRevocationStore tạo một RevocationStore lưu trong database
+func NewDBRevocationStore(db *gorm.DB, logger *logger.Logger) RevocationStore {
+	return &dbRevocationStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Revoke thêm jti vào danh sách thu hồi
+func (s *dbRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	err := s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+	if err != nil {
+		s.logger.Errorf("Error revoking token: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Consume thêm jti vào danh sách thu hồi và trả về true nếu jti chưa có trong danh sách.
+// Dùng cho token chỉ dùng được một lần: trong các request đồng thời chỉ một request nhận được true.
+func (s *dbRevocationStore) Consume(jti string, expiresAt time.Time) (bool, error) {
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt})
+	if result.Error != nil {
+		s.logger.Errorf("Error consuming token: %v", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// IsRevoked kiểm tra jti có nằm trong danh sách thu hồi không
+func (s *dbRevocationStore) IsRevoked(jti string) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	if err != nil {
+		s.logger.Errorf("Error checking revoked token: %v", err)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// DeleteExpired xóa các bản ghi của token đã hết hạn
+func (s *dbRevocationStore) DeleteExpired() (int64, error) {
+	result := s.db.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{})
+	if result.Error != nil {
+		s.logger.Errorf("Error deleting expired revoked tokens: %v", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// memoryRevocationStore lưu danh sách thu hồi trong bộ nhớ, phù hợp khi chỉ chạy một instance
+type memoryRevocationStore struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+// NewMemoryRevocationStore tạo một RevocationStore lưu trong bộ nhớ
+func NewMemoryRevocationStore() RevocationStore {
+	return &memoryRevocationStore{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// Revoke thêm jti vào danh sách thu hồi
+func (s *memoryRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[jti] = expiresAt
+	return nil
+}
+
+// Consume thêm jti vào danh sách thu hồi và trả về true nếu jti chưa có trong danh sách
+func (s *memoryRevocationStore) Consume(jti string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.revoked[jti]; ok {
+		return false, nil
+	}
+	s.revoked[jti] = expiresAt
+	return true, nil
+}
+
+// IsRevoked kiểm tra jti có nằm trong danh sách thu hồi không
+func (s *memoryRevocationStore) IsRevoked(jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.revoked[jti]
+	return ok, nil
+}
+
+// DeleteExpired xóa các jti của token đã hết hạn
+func (s *memoryRevocationStore) DeleteExpired() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var deleted int64
+	for jti, expiresAt := range s.revoked {
+		if expiresAt.Before(now) {
+			delete(s.revoked, jti)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
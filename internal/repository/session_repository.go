@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SessionRepository định nghĩa interface cho các phương thức thao tác với Session
+type SessionRepository interface {
+	Create(session *models.Session) error
+	FindByID(id uuid.UUID) (*models.Session, error)
+	ListActiveByUser(userID uuid.UUID) ([]models.Session, error)
+	Revoke(id uuid.UUID) error
+	RevokeByUser(userID uuid.UUID) error
+	UpdateLastSeen(id uuid.UUID, lastSeenAt time.Time) error
+	Extend(id uuid.UUID, expiresAt time.Time) error
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+// sessionRepository struct triển khai SessionRepository interface
+type sessionRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewSessionRepository tạo một instance mới của SessionRepository
+func NewSessionRepository(db *gorm.DB, logger *logger.Logger) SessionRepository {
+	return &sessionRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create tạo một session mới
+func (r *sessionRepository) Create(session *models.Session) error {
+	err := r.db.Create(session).Error
+	if err != nil {
+		r.logger.Errorf("Error creating session: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindByID tìm session theo ID
+func (r *sessionRepository) FindByID(id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("id = ?", id).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding session by ID: %v", err)
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListActiveByUser lấy danh sách session chưa bị thu hồi và chưa hết hạn của user, mới nhất trước
+func (r *sessionRepository) ListActiveByUser(userID uuid.UUID) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		r.logger.Errorf("Error listing sessions: %v", err)
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Revoke đánh dấu session đã bị thu hồi
+func (r *sessionRepository) Revoke(id uuid.UUID) error {
+	err := r.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		r.logger.Errorf("Error revoking session: %v", err)
+		return err
+	}
+	return nil
+}
+
+// RevokeByUser thu hồi tất cả session còn hiệu lực của một user
+func (r *sessionRepository) RevokeByUser(userID uuid.UUID) error {
+	err := r.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		r.logger.Errorf("Error revoking sessions of user: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateLastSeen cập nhật thời điểm hoạt động gần nhất của session
+func (r *sessionRepository) UpdateLastSeen(id uuid.UUID, lastSeenAt time.Time) error {
+	err := r.db.Model(&models.Session{}).
+		Where("id = ?", id).
+		Update("last_seen_at", lastSeenAt).Error
+	if err != nil {
+		r.logger.Errorf("Error updating session last seen: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Extend gia hạn session còn hiệu lực đến thời điểm expiresAt
+func (r *sessionRepository) Extend(id uuid.UUID, expiresAt time.Time) error {
+	err := r.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("expires_at", expiresAt).Error
+	if err != nil {
+		r.logger.Errorf("Error extending session: %v", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteExpired xóa các session đã hết hạn trước thời điểm before, kể cả session cũ chưa có expires_at
+func (r *sessionRepository) DeleteExpired(before time.Time) (int64, error) {
+	result := r.db.Where("expires_at < ? OR expires_at IS NULL", before).Delete(&models.Session{})
+	if result.Error != nil {
+		r.logger.Errorf("Error deleting expired sessions: %v", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// SigningKeyRepository định nghĩa interface cho các phương thức thao tác với SigningKey
+type SigningKeyRepository interface {
+	Create(key *models.SigningKey) error
+	FindByID(kid string) (*models.SigningKey, error)
+	ListUsable() ([]models.SigningKey, error)
+	Update(key *models.SigningKey) error
+	UpdatePrivateKey(kid, privateKey string) error
+	WipeRetired() error
+	Promote(kid string) error
+}
+
+// signingKeyRepository struct triển khai SigningKeyRepository interface
+type signingKeyRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewSigningKeyRepository tạo một instance mới của SigningKeyRepository
+func NewSigningKeyRepository(db *gorm.DB, logger *logger.Logger) SigningKeyRepository {
+	return &signingKeyRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create lưu một khóa ký mới
+func (r *signingKeyRepository) Create(key *models.SigningKey) error {
+	err := r.db.Create(key).Error
+	if err != nil {
+		r.logger.Errorf("Error creating signing key: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindByID tìm khóa ký theo kid
+func (r *signingKeyRepository) FindByID(kid string) (*models.SigningKey, error) {
+	var key models.SigningKey
+	err := r.db.Where("id = ?", kid).First(&key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding signing key: %v", err)
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListUsable lấy các khóa chưa bị retire (đang hoạt động hoặc chỉ xác thực)
+func (r *signingKeyRepository) ListUsable() ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	err := r.db.Where("status <> ?", models.SigningKeyRetired).Order("created_at").Find(&keys).Error
+	if err != nil {
+		r.logger.Errorf("Error listing signing keys: %v", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Update cập nhật khóa ký
+func (r *signingKeyRepository) Update(key *models.SigningKey) error {
+	err := r.db.Save(key).Error
+	if err != nil {
+		r.logger.Errorf("Error updating signing key: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UpdatePrivateKey chỉ ghi đè phần bí mật của khóa, không động đến trạng thái
+// có thể vừa được instance khác thay đổi
+func (r *signingKeyRepository) UpdatePrivateKey(kid, privateKey string) error {
+	err := r.db.Model(&models.SigningKey{}).Where("id = ?", kid).Update("private_key", privateKey).Error
+	if err != nil {
+		r.logger.Errorf("Error updating signing key material: %v", err)
+		return err
+	}
+	return nil
+}
+
+// WipeRetired xóa phần bí mật của các khóa đã bị retire
+func (r *signingKeyRepository) WipeRetired() error {
+	err := r.db.Model(&models.SigningKey{}).
+		Where("status = ? AND private_key <> ?", models.SigningKeyRetired, "").
+		Update("private_key", "").Error
+	if err != nil {
+		r.logger.Errorf("Error wiping retired signing keys: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Promote chuyển khóa kid thành khóa ký đang hoạt động, khóa đang hoạt động trước đó
+// trở thành khóa chỉ xác thực. Hai thao tác được thực hiện trong cùng một transaction.
+func (r *signingKeyRepository) Promote(kid string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&models.SigningKey{}).
+			Where("status = ? AND id <> ?", models.SigningKeyActive, kid).
+			Updates(map[string]interface{}{
+				"status":         models.SigningKeyVerify,
+				"deactivated_at": now,
+			}).Error
+		if err != nil {
+			r.logger.Errorf("Error demoting active signing key: %v", err)
+			return err
+		}
+
+		err = tx.Model(&models.SigningKey{}).
+			Where("id = ?", kid).
+			Updates(map[string]interface{}{
+				"status":         models.SigningKeyActive,
+				"activated_at":   now,
+				"deactivated_at": nil,
+			}).Error
+		if err != nil {
+			r.logger.Errorf("Error promoting signing key: %v", err)
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserIdentityRepository định nghĩa interface cho các phương thức thao tác với UserIdentity
+type UserIdentityRepository interface {
+	Create(identity *models.UserIdentity) error
+	FindByProviderSubject(provider, subject string) (*models.UserIdentity, error)
+	FindByUserProvider(userID uuid.UUID, provider string) (*models.UserIdentity, error)
+	FindByID(id uuid.UUID) (*models.UserIdentity, error)
+	ListByUser(userID uuid.UUID) ([]models.UserIdentity, error)
+	UpdateLogin(id uuid.UUID, email string, loginAt time.Time) error
+	Delete(id uuid.UUID) error
+}
+
+// userIdentityRepository struct triển khai UserIdentityRepository interface
+type userIdentityRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewUserIdentityRepository tạo một instance mới của UserIdentityRepository
+func NewUserIdentityRepository(db *gorm.DB, logger *logger.Logger) UserIdentityRepository {
+	return &userIdentityRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create lưu một liên kết mới
+func (r *userIdentityRepository) Create(identity *models.UserIdentity) error {
+	err := r.db.Omit("User").Create(identity).Error
+	if err != nil {
+		r.logger.Errorf("Error creating user identity: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindByProviderSubject tìm liên kết theo provider và subject
+func (r *userIdentityRepository) FindByProviderSubject(provider, subject string) (*models.UserIdentity, error) {
+	return r.findOne("provider = ? AND subject = ?", provider, subject)
+}
+
+// FindByUserProvider tìm liên kết của user với provider
+func (r *userIdentityRepository) FindByUserProvider(userID uuid.UUID, provider string) (*models.UserIdentity, error) {
+	return r.findOne("user_id = ? AND provider = ?", userID, provider)
+}
+
+// FindByID tìm liên kết theo ID
+func (r *userIdentityRepository) FindByID(id uuid.UUID) (*models.UserIdentity, error) {
+	return r.findOne("id = ?", id)
+}
+
+// findOne tìm một liên kết theo điều kiện, trả về nil nếu không có
+func (r *userIdentityRepository) findOne(query string, args ...interface{}) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := r.db.Where(query, args...).First(&identity).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding user identity: %v", err)
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// ListByUser lấy danh sách liên kết của user
+func (r *userIdentityRepository) ListByUser(userID uuid.UUID) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error
+	if err != nil {
+		r.logger.Errorf("Error listing user identities: %v", err)
+		return nil, err
+	}
+	return identities, nil
+}
+
+// UpdateLogin ghi nhận lần đăng nhập gần nhất và email hiện tại tại provider
+func (r *userIdentityRepository) UpdateLogin(id uuid.UUID, email string, loginAt time.Time) error {
+	err := r.db.Model(&models.UserIdentity{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"email": email, "last_login_at": loginAt}).Error
+	if err != nil {
+		r.logger.Errorf("Error updating user identity: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Delete xóa một liên kết
+func (r *userIdentityRepository) Delete(id uuid.UUID) error {
+	err := r.db.Where("id = ?", id).Delete(&models.UserIdentity{}).Error
+	if err != nil {
+		r.logger.Errorf("Error deleting user identity: %v", err)
+		return err
+	}
+	return nil
+}
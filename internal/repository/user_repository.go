@@ -2,22 +2,38 @@ package repository
 
 import (
 	"errors"
+	"time"
 
 	"github.com/Thanhdat-debug/demo_login/internal/models"
 	"github.com/Thanhdat-debug/demo_login/pkg/logger"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrLastAdmin được trả về khi thao tác sẽ khiến hệ thống không còn admin nào
+var ErrLastAdmin = errors.New("cannot remove the last admin")
+
+// roleAdmin là role được bảo vệ để luôn còn ít nhất một user (giống services.RoleAdmin)
+const roleAdmin = "admin"
+
 // UserRepository định nghĩa interface cho các phương thức thao tác với User
 type UserRepository interface {
 	Create(user *models.User) error
 	FindByID(id uuid.UUID) (*models.User, error)
 	FindByUsername(username string) (*models.User, error)
 	FindByEmail(email string) (*models.User, error)
+	FindByPhone(phone string) (*models.User, error)
 	Update(user *models.User) error
+	UpdateTOTPLastStep(id uuid.UUID, step int64) (bool, error)
+	UpdatePassword(id uuid.UUID, hashedPassword string) error
+	IncrementFailedLogins(id uuid.UUID) (int, error)
+	SetLockedUntil(id uuid.UUID, lockedUntil *time.Time) error
+	ResetFailedLogins(id uuid.UUID) error
+	UpdateRole(id uuid.UUID, role string) error
 	Delete(id uuid.UUID) error
 	List(page, size int) ([]models.User, int64, error)
+	CountByRole(role string) (int64, error)
 }
 
 // userRepository struct triển khai UserRepository interface
@@ -86,6 +102,20 @@ func (r *userRepository) FindByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
+// FindByPhone tìm user theo số điện thoại (E.164)
+func (r *userRepository) FindByPhone(phone string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("phone = ?", phone).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding user by phone: %v", err)
+		return nil, err
+	}
+	return &user, nil
+}
+
 // Update cập nhật thông tin user
 func (r *userRepository) Update(user *models.User) error {
 	err := r.db.Save(user).Error
@@ -96,13 +126,122 @@ func (r *userRepository) Update(user *models.User) error {
 	return nil
 }
 
-// Delete xóa user theo ID
-func (r *userRepository) Delete(id uuid.UUID) error {
-	err := r.db.Delete(&models.User{}, id).Error
+// UpdateTOTPLastStep ghi nhận bước thời gian của mã TOTP vừa dùng.
+// Chỉ cập nhật khi step lớn hơn giá trị hiện tại, trả về false nếu mã đã được dùng trước đó.
+func (r *userRepository) UpdateTOTPLastStep(id uuid.UUID, step int64) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		r.logger.Errorf("Error updating TOTP last step: %v", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdatePassword chỉ cập nhật hash password của user
+func (r *userRepository) UpdatePassword(id uuid.UUID, hashedPassword string) error {
+	err := r.db.Model(&models.User{}).
+		Where("id = ?", id).
+		Update("password", hashedPassword).Error
+	if err != nil {
+		r.logger.Errorf("Error updating user password: %v", err)
+		return err
+	}
+	return nil
+}
+
+// IncrementFailedLogins tăng số lần đăng nhập sai liên tiếp của user và trả về giá trị mới
+func (r *userRepository) IncrementFailedLogins(id uuid.UUID) (int, error) {
+	var attempts int
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", id).
+			UpdateColumn("failed_login_attempts", gorm.Expr("failed_login_attempts + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ?", id).
+			Pluck("failed_login_attempts", &attempts).Error
+	})
+	if err != nil {
+		r.logger.Errorf("Error incrementing failed logins: %v", err)
+		return 0, err
+	}
+	return attempts, nil
+}
+
+// SetLockedUntil khóa tài khoản tới thời điểm lockedUntil (nil để mở khóa)
+func (r *userRepository) SetLockedUntil(id uuid.UUID, lockedUntil *time.Time) error {
+	err := r.db.Model(&models.User{}).
+		Where("id = ?", id).
+		UpdateColumn("locked_until", lockedUntil).Error
 	if err != nil {
+		r.logger.Errorf("Error updating user lock: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ResetFailedLogins xóa bộ đếm đăng nhập sai và mở khóa tài khoản
+func (r *userRepository) ResetFailedLogins(id uuid.UUID) error {
+	err := r.db.Model(&models.User{}).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{"failed_login_attempts": 0, "locked_until": nil}).Error
+	if err != nil {
+		r.logger.Errorf("Error resetting failed logins: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateRole đổi role của user. Trả về ErrLastAdmin nếu đó là lần hạ quyền admin cuối cùng.
+func (r *userRepository) UpdateRole(id uuid.UUID, role string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if role != roleAdmin {
+			if err := r.checkNotLastAdmin(tx, id); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ?", id).
+			UpdateColumn("role", role).Error
+	})
+	if err != nil && !errors.Is(err, ErrLastAdmin) {
+		r.logger.Errorf("Error updating user role: %v", err)
+	}
+	return err
+}
+
+// Delete xóa user theo ID. Trả về ErrLastAdmin nếu user là admin cuối cùng.
+func (r *userRepository) Delete(id uuid.UUID) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := r.checkNotLastAdmin(tx, id); err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, id).Error
+	})
+	if err != nil && !errors.Is(err, ErrLastAdmin) {
 		r.logger.Errorf("Error deleting user: %v", err)
+	}
+	return err
+}
+
+// checkNotLastAdmin khóa các bản ghi admin (SELECT ... FOR UPDATE) đến hết transaction rồi kiểm tra
+// user id không phải admin duy nhất, để hai yêu cầu đồng thời không thể cùng bỏ đi hai admin cuối cùng
+func (r *userRepository) checkNotLastAdmin(tx *gorm.DB, id uuid.UUID) error {
+	var adminIDs []string
+	if err := tx.Model(&models.User{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("role = ?", roleAdmin).
+		Pluck("id", &adminIDs).Error; err != nil {
 		return err
 	}
+	for _, adminID := range adminIDs {
+		if adminID == id.String() && len(adminIDs) <= 1 {
+			return ErrLastAdmin
+		}
+	}
 	return nil
 }
 
@@ -128,3 +267,14 @@ func (r *userRepository) List(page, size int) ([]models.User, int64, error) {
 
 	return users, total, nil
 }
+
+// CountByRole đếm số user có role cho trước
+func (r *userRepository) CountByRole(role string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).Where("role = ?", role).Count(&count).Error
+	if err != nil {
+		r.logger.Errorf("Error counting users by role: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
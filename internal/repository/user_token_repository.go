@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserTokenRepository định nghĩa interface cho các phương thức thao tác với UserToken
+type UserTokenRepository interface {
+	Create(token *models.UserToken) error
+	FindValid(tokenHash, purpose string) (*models.UserToken, error)
+	Consume(tokenHash, purpose string) (*models.UserToken, error)
+	DeleteByUser(userID uuid.UUID, purpose string) error
+}
+
+// userTokenRepository struct triển khai UserTokenRepository interface
+type userTokenRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewUserTokenRepository tạo một instance mới của UserTokenRepository
+func NewUserTokenRepository(db *gorm.DB, logger *logger.Logger) UserTokenRepository {
+	return &userTokenRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create lưu một token mới
+func (r *userTokenRepository) Create(token *models.UserToken) error {
+	err := r.db.Omit("User").Create(token).Error
+	if err != nil {
+		r.logger.Errorf("Error creating user token: %v", err)
+		return err
+	}
+	return nil
+}
+
+// FindValid tìm token chưa dùng và còn hạn mà không đánh dấu đã dùng
+func (r *userTokenRepository) FindValid(tokenHash, purpose string) (*models.UserToken, error) {
+	var token models.UserToken
+	err := r.db.Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", tokenHash, purpose, time.Now()).
+		First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding user token: %v", err)
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Consume đánh dấu token đã được dùng và trả về token đó. Trả về nil nếu token
+// không tồn tại, đã dùng hoặc đã hết hạn. Việc cập nhật có điều kiện đảm bảo
+// hai request đồng thời không thể cùng dùng một token.
+func (r *userTokenRepository) Consume(tokenHash, purpose string) (*models.UserToken, error) {
+	var token models.UserToken
+	err := r.db.Where("token_hash = ? AND purpose = ?", tokenHash, purpose).First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding user token: %v", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	result := r.db.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", token.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		r.logger.Errorf("Error consuming user token: %v", result.Error)
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	token.UsedAt = &now
+	return &token, nil
+}
+
+// DeleteByUser xóa các token của user theo mục đích sử dụng
+func (r *userTokenRepository) DeleteByUser(userID uuid.UUID, purpose string) error {
+	err := r.db.Where("user_id = ? AND purpose = ?", userID, purpose).Delete(&models.UserToken{}).Error
+	if err != nil {
+		r.logger.Errorf("Error deleting user tokens: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebAuthnRepository định nghĩa interface cho các phương thức thao tác với credential và challenge WebAuthn
+type WebAuthnRepository interface {
+	CreateCredential(credential *models.WebAuthnCredential) error
+	ListCredentialsByUser(userID uuid.UUID) ([]models.WebAuthnCredential, error)
+	FindCredentialByCredentialID(credentialID []byte) (*models.WebAuthnCredential, error)
+	UpdateCredential(credential *models.WebAuthnCredential) error
+	DeleteCredential(userID, id uuid.UUID) (bool, error)
+	CountCredentialsByUser(userID uuid.UUID) (int64, error)
+	CreateChallenge(challenge *models.WebAuthnChallenge) error
+	ConsumeChallenge(id uuid.UUID, ceremony string) (*models.WebAuthnChallenge, error)
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+// webAuthnRepository struct triển khai WebAuthnRepository interface
+type webAuthnRepository struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewWebAuthnRepository tạo một instance mới của WebAuthnRepository
+func NewWebAuthnRepository(db *gorm.DB, logger *logger.Logger) WebAuthnRepository {
+	return &webAuthnRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// CreateCredential lưu credential mới
+func (r *webAuthnRepository) CreateCredential(credential *models.WebAuthnCredential) error {
+	err := r.db.Omit("User").Create(credential).Error
+	if err != nil {
+		r.logger.Errorf("Error creating webauthn credential: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ListCredentialsByUser lấy các credential của user
+func (r *webAuthnRepository) ListCredentialsByUser(userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error
+	if err != nil {
+		r.logger.Errorf("Error listing webauthn credentials: %v", err)
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// FindCredentialByCredentialID tìm credential theo credential ID do authenticator sinh ra
+func (r *webAuthnRepository) FindCredentialByCredentialID(credentialID []byte) (*models.WebAuthnCredential, error) {
+	var credential models.WebAuthnCredential
+	err := r.db.Where("credential_id = ?", credentialID).First(&credential).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding webauthn credential: %v", err)
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// UpdateCredential cập nhật credential (sign count, cờ backup, lần dùng cuối)
+func (r *webAuthnRepository) UpdateCredential(credential *models.WebAuthnCredential) error {
+	err := r.db.Omit("User").Save(credential).Error
+	if err != nil {
+		r.logger.Errorf("Error updating webauthn credential: %v", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteCredential xóa credential của user, trả về false nếu không tìm thấy
+func (r *webAuthnRepository) DeleteCredential(userID, id uuid.UUID) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		r.logger.Errorf("Error deleting webauthn credential: %v", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountCredentialsByUser đếm số credential của user
+func (r *webAuthnRepository) CountCredentialsByUser(userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&count).Error
+	if err != nil {
+		r.logger.Errorf("Error counting webauthn credentials: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// CreateChallenge lưu dữ liệu của một nghi thức WebAuthn mới
+func (r *webAuthnRepository) CreateChallenge(challenge *models.WebAuthnChallenge) error {
+	err := r.db.Create(challenge).Error
+	if err != nil {
+		r.logger.Errorf("Error creating webauthn challenge: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ConsumeChallenge lấy và xóa challenge chưa hết hạn. Chỉ request đầu tiên xóa được
+// challenge nên mỗi challenge chỉ dùng được một lần.
+func (r *webAuthnRepository) ConsumeChallenge(id uuid.UUID, ceremony string) (*models.WebAuthnChallenge, error) {
+	var challenge models.WebAuthnChallenge
+	err := r.db.Where("id = ? AND ceremony = ?", id, ceremony).First(&challenge).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		r.logger.Errorf("Error finding webauthn challenge: %v", err)
+		return nil, err
+	}
+
+	result := r.db.Where("id = ?", id).Delete(&models.WebAuthnChallenge{})
+	if result.Error != nil {
+		r.logger.Errorf("Error deleting webauthn challenge: %v", result.Error)
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(challenge.ExpiresAt) {
+		return nil, nil
+	}
+	return &challenge, nil
+}
+
+// DeleteExpired xóa các challenge WebAuthn hết hạn trước thời điểm before (nghi thức bị bỏ dở)
+func (r *webAuthnRepository) DeleteExpired(before time.Time) (int64, error) {
+	result := r.db.Where("expires_at < ?", before).Delete(&models.WebAuthnChallenge{})
+	if result.Error != nil {
+		r.logger.Errorf("Error deleting expired webauthn challenges: %v", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
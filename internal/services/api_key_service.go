@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+	ErrInvalidScope   = errors.New("invalid scope")
+)
+
+// APIKeyPrefix là tiền tố của mọi API key, giúp phân biệt API key với JWT và dễ phát hiện khi bị lộ
+const APIKeyPrefix = "dlk_"
+
+// apiKeyDisplayLength là số ký tự đầu của key được lưu để user nhận diện key
+const apiKeyDisplayLength = 12
+
+// Các scope có thể cấp cho API key. Request xác thực bằng JWT có toàn quyền của user.
+const (
+	ScopeProfileRead    = "profile:read"
+	ScopeProfileWrite   = "profile:write"
+	ScopeSessionsRead   = "sessions:read"
+	ScopeSessionsWrite  = "sessions:write"
+	ScopeAdminUsersRead = "admin:users:read"
+)
+
+// Scopes là danh sách tất cả các scope hợp lệ
+var Scopes = []string{ScopeProfileRead, ScopeProfileWrite, ScopeSessionsRead, ScopeSessionsWrite, ScopeAdminUsersRead}
+
+// APIKeyService định nghĩa interface cho các phương thức quản lý API key
+type APIKeyService interface {
+	CreateKey(userID uuid.UUID, name string, scopes []string, expiresIn time.Duration) (*models.APIKeyResponse, string, error)
+	ListKeys(userID uuid.UUID) ([]models.APIKeyResponse, error)
+	RevokeKey(userID, keyID uuid.UUID) error
+	Authenticate(rawKey string) (*models.APIKey, *models.User, error)
+}
+
+// apiKeyService struct triển khai APIKeyService interface
+type apiKeyService struct {
+	apiKeyRepo repository.APIKeyRepository
+	userRepo   repository.UserRepository
+	logger     *logger.Logger
+}
+
+// NewAPIKeyService tạo một instance mới của APIKeyService
+func NewAPIKeyService(apiKeyRepo repository.APIKeyRepository, userRepo repository.UserRepository, logger *logger.Logger) APIKeyService {
+	return &apiKeyService{
+		apiKeyRepo: apiKeyRepo,
+		userRepo:   userRepo,
+		logger:     logger,
+	}
+}
+
+// CreateKey tạo API key mới với các scope cho trước; expiresIn = 0 nghĩa là không hết hạn.
+// Key gốc chỉ được trả về một lần duy nhất tại đây.
+func (s *apiKeyService) CreateKey(userID uuid.UUID, name string, scopes []string, expiresIn time.Duration) (*models.APIKeyResponse, string, error) {
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	rawKey := APIKeyPrefix + secret
+
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    rawKey[:apiKeyDisplayLength],
+		TokenHash: hashToken(rawKey),
+		Scopes:    strings.Join(scopes, ","),
+	}
+	if expiresIn > 0 {
+		expiresAt := time.Now().Add(expiresIn)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := s.apiKeyRepo.Create(key); err != nil {
+		return nil, "", err
+	}
+
+	response := key.ToAPIKeyResponse()
+	return &response, rawKey, nil
+}
+
+// ListKeys lấy danh sách API key của user (kể cả key đã thu hồi hoặc hết hạn)
+func (s *apiKeyService) ListKeys(userID uuid.UUID) ([]models.APIKeyResponse, error) {
+	keys, err := s.apiKeyRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.APIKeyResponse, len(keys))
+	for i, key := range keys {
+		responses[i] = key.ToAPIKeyResponse()
+	}
+	return responses, nil
+}
+
+// RevokeKey thu hồi một API key của user
+func (s *apiKeyService) RevokeKey(userID, keyID uuid.UUID) error {
+	key, err := s.apiKeyRepo.FindByID(keyID)
+	if err != nil {
+		return err
+	}
+	// Không cho biết key của user khác có tồn tại hay không
+	if key == nil || key.UserID != userID || key.RevokedAt != nil {
+		return ErrAPIKeyNotFound
+	}
+	return s.apiKeyRepo.Revoke(keyID)
+}
+
+// Authenticate kiểm tra API key gốc và trả về key cùng user sở hữu key
+func (s *apiKeyService) Authenticate(rawKey string) (*models.APIKey, *models.User, error) {
+	if !strings.HasPrefix(rawKey, APIKeyPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.apiKeyRepo.FindByHash(hashToken(rawKey))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if key == nil || !key.IsActive(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.userRepo.FindByID(key.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	// Chỉ ghi lại LastUsedAt khi đã đủ lâu để tránh ghi database ở mọi request
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastSeenUpdateInterval {
+		if err := s.apiKeyRepo.UpdateLastUsed(key.ID, now); err != nil {
+			s.logger.Errorf("Error updating last used of api key %s: %v", key.ID, err)
+		}
+		key.LastUsedAt = &now
+	}
+	return key, user, nil
+}
+
+// normalizeScopes kiểm tra các scope hợp lệ và loại bỏ scope trùng lặp
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	var result []string
+	for _, scope := range scopes {
+		if !isValidScope(scope) {
+			return nil, ErrInvalidScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result, nil
+}
+
+// isValidScope kiểm tra scope có trong danh sách Scopes không
+func isValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
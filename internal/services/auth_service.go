@@ -5,50 +5,149 @@ import (
 	"time"
 
 	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/keys"
 	"github.com/Thanhdat-debug/demo_login/internal/models"
 	"github.com/Thanhdat-debug/demo_login/internal/repository"
 	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 // Định nghĩa các lỗi
 var (
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrUserExists         = errors.New("user already exists")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrUserExists          = errors.New("user already exists")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrTokenRevoked        = errors.New("token revoked")
+	ErrUnknownSigningKey   = errors.New("unknown signing key")
+	ErrInvalidMFAToken     = errors.New("invalid mfa token")
+	ErrMFAMethodNotEnabled = errors.New("mfa method not enabled")
+	ErrEmailNotVerified    = errors.New("email not verified")
+	ErrManagedAccount      = errors.New("account must sign in through its organization identity provider")
+
+	ErrInvalidPasswordChangeToken = errors.New("invalid password change token")
+)
+
+// Các loại token được ghi trong claim token_type
+const (
+	TokenTypeAccess         = "access"
+	TokenTypeMFAChallenge   = "mfa_challenge"   // Chỉ dùng để đổi lấy token thật sau khi nhập mã MFA
+	TokenTypePasswordChange = "password_change" // Chỉ dùng để đổi mật khẩu đã hết hạn trước khi được cấp token thật
+	TokenTypeOAuthAccess    = "oauth_access"    // Access token cấp cho OAuth client, không dùng được với API của service này
+)
+
+// Các nguồn đăng nhập không phải identity provider, truyền cho LoginWithoutPassword
+const (
+	LoginSourcePasskey   = "passkey"
+	LoginSourceMagicLink = "magic_link"
+	LoginSourcePhone     = "phone"
+)
+
+// Các phương thức xác thực hai lớp
+const (
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
 )
 
 // AuthService định nghĩa interface cho các phương thức xác thực
 type AuthService interface {
-	Register(username, email, password, firstName, lastName string) (*models.UserResponse, error)
-	Login(usernameOrEmail, password string) (string, *models.UserResponse, error)
+	Register(username, email, password, firstName, lastName, locale string) (*models.UserResponse, error)
+	Login(usernameOrEmail, password string, client ClientInfo) (*LoginResult, error)
+	LoginSession(usernameOrEmail, password string, client ClientInfo) (*LoginResult, error)
+	VerifyMFA(mfaToken, code string, client ClientInfo) (*LoginResult, error)
+	VerifyMFASession(mfaToken, code string, client ClientInfo) (*LoginResult, error)
+	BeginMFAWebAuthn(mfaToken string) (*protocol.CredentialAssertion, uuid.UUID, error)
+	VerifyMFAWebAuthn(mfaToken string, challengeID uuid.UUID, response *protocol.ParsedCredentialAssertionData, client ClientInfo) (*LoginResult, error)
+	BeginPasskeyLogin(usernameOrEmail string) (*protocol.CredentialAssertion, uuid.UUID, error)
+	FinishPasskeyLogin(challengeID uuid.UUID, response *protocol.ParsedCredentialAssertionData, client ClientInfo) (*LoginResult, error)
+	ChangeExpiredPassword(passwordChangeToken, newPassword string, client ClientInfo) (*LoginResult, error)
+	ChangeExpiredPasswordSession(passwordChangeToken, newPassword string, client ClientInfo) (*LoginResult, error)
+	LoginWithoutPassword(user *models.User, source string, client ClientInfo) (*LoginResult, error)
+	Refresh(refreshToken string) (*TokenPair, error)
+	Logout(claims *Claims, refreshToken string) error
 	ValidateToken(tokenString string) (*jwt.Token, error)
+	IsTokenRevoked(claims *Claims) (bool, error)
+	JWKS() keys.JWKS
 }
 
 // authService struct triển khai AuthService interface
 type authService struct {
-	userRepo repository.UserRepository
-	config   *config.Config
-	logger   *logger.Logger
+	userRepo         repository.UserRepository
+	identityRepo     repository.UserIdentityRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	revocationStore  repository.RevocationStore
+	sessionService   SessionService
+	mfaService       MFAService
+	webAuthnService  WebAuthnService
+	emailVerifier    EmailVerificationService
+	mailService      MailService
+	lockoutService   LockoutService
+	passwordService  PasswordService
+	authenticators   []Authenticator
+	keyring          *keys.Keyring
+	config           *config.Config
+	logger           *logger.Logger
 }
 
 // NewAuthService tạo một instance mới của AuthService
-func NewAuthService(userRepo repository.UserRepository, config *config.Config, logger *logger.Logger) AuthService {
+func NewAuthService(userRepo repository.UserRepository, identityRepo repository.UserIdentityRepository, refreshTokenRepo repository.RefreshTokenRepository, revocationStore repository.RevocationStore, sessionService SessionService, mfaService MFAService, webAuthnService WebAuthnService, emailVerifier EmailVerificationService, mailService MailService, lockoutService LockoutService, passwordService PasswordService, authenticators []Authenticator, keyring *keys.Keyring, config *config.Config, logger *logger.Logger) AuthService {
 	return &authService{
-		userRepo: userRepo,
-		config:   config,
-		logger:   logger,
+		userRepo:         userRepo,
+		identityRepo:     identityRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		revocationStore:  revocationStore,
+		sessionService:   sessionService,
+		mfaService:       mfaService,
+		webAuthnService:  webAuthnService,
+		emailVerifier:    emailVerifier,
+		mailService:      mailService,
+		lockoutService:   lockoutService,
+		passwordService:  passwordService,
+		authenticators:   authenticators,
+		keyring:          keyring,
+		config:           config,
+		logger:           logger,
 	}
 }
 
 // Claims là custom claims cho JWT
 type Claims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
+	UserID    string `json:"user_id"`
+	Role      string `json:"role"`
+	TokenType string `json:"token_type"`
+	SessionID string `json:"sid,omitempty"`
+	ClientID  string `json:"client_id,omitempty"` // OAuth client được cấp token (chỉ có ở token OAuth)
+	Scope     string `json:"scope,omitempty"`     // Các scope OAuth phân tách bằng dấu cách
+	Password  bool   `json:"pwd,omitempty"`       // MFA challenge: bước đầu là mật khẩu cục bộ, áp dụng tuổi tối đa của mật khẩu
 	jwt.RegisteredClaims
 }
 
+// TokenPair chứa access token (JWT ngắn hạn) và refresh token (chuỗi ngẫu nhiên)
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // Số giây còn lại của access token
+}
+
+// LoginResult là kết quả của một bước đăng nhập. Nếu MFARequired = true thì Tokens rỗng
+// và client phải gửi MFAToken kèm mã xác thực tới VerifyMFA để hoàn tất đăng nhập.
+// Nếu PasswordChangeRequired = true thì mật khẩu đã hết hạn, client phải gửi PasswordChangeToken
+// kèm mật khẩu mới tới ChangeExpiredPassword để nhận token.
+type LoginResult struct {
+	Tokens                 *TokenPair // nil khi chỉ mở session (LoginSession...)
+	User                   *models.UserResponse
+	MFARequired            bool
+	MFAToken               string
+	MFAMethods             []string // Các phương thức MFA user có thể dùng ở bước thứ hai
+	PasswordChangeRequired bool
+	PasswordChangeToken    string
+	SessionID              uuid.UUID // Session được mở khi đăng nhập hoàn tất
+}
+
 // Register đăng ký user mới
-func (s *authService) Register(username, email, password, firstName, lastName string) (*models.UserResponse, error) {
+func (s *authService) Register(username, email, password, firstName, lastName, locale string) (*models.UserResponse, error) {
 	// Kiểm tra username đã tồn tại chưa
 	existingUser, err := s.userRepo.FindByUsername(username)
 	if err != nil {
@@ -68,16 +167,24 @@ func (s *authService) Register(username, email, password, firstName, lastName st
 	}
 
 	// Tạo user mới
+	now := time.Now()
 	user := &models.User{
-		Username:  username,
-		Email:     email,
-		Password:  password,
-		FirstName: firstName,
-		LastName:  lastName,
-		Role:      "user", // Mặc định là "user"
+		Username:          username,
+		Email:             email,
+		FirstName:         firstName,
+		LastName:          lastName,
+		Role:              "user", // Mặc định là "user"
+		Locale:            locale,
+		PasswordChangedAt: &now,
+	}
+
+	// Kiểm tra mật khẩu theo chính sách
+	if err := s.passwordService.CheckNewPassword(user, password); err != nil {
+		return nil, err
 	}
 
 	// Hash password
+	user.Password = password
 	if err := user.HashPassword(); err != nil {
 		return nil, err
 	}
@@ -86,73 +193,373 @@ func (s *authService) Register(username, email, password, firstName, lastName st
 	if err := s.userRepo.Create(user); err != nil {
 		return nil, err
 	}
+	if err := s.passwordService.RecordPassword(user); err != nil {
+		s.logger.Errorf("Failed to record password history of user %s: %v", user.ID, err)
+	}
+
+	// Gửi email xác minh; nếu gửi lỗi, user vẫn có thể yêu cầu gửi lại
+	if err := s.emailVerifier.SendVerification(user); err != nil {
+		s.logger.Errorf("Failed to send verification email to user %s: %v", user.ID, err)
+	}
 
 	// Trả về thông tin user đã đăng ký (không bao gồm password)
 	userResponse := user.ToUserResponse()
 	return &userResponse, nil
 }
 
-// Login xác thực người dùng và tạo JWT token
-func (s *authService) Login(usernameOrEmail, password string) (string, *models.UserResponse, error) {
+// Login xác thực người dùng bằng mật khẩu qua các nguồn xác thực đã cấu hình (database, LDAP).
+// Nếu user đã bật MFA, kết quả chỉ chứa MFA challenge token,
+// ngược lại một session mới được ghi nhận cùng cặp access token / refresh token.
+func (s *authService) Login(usernameOrEmail, password string, client ClientInfo) (*LoginResult, error) {
+	return s.login(usernameOrEmail, password, client, true)
+}
+
+// LoginSession giống Login nhưng khi đăng nhập hoàn tất chỉ mở session, không cấp access token / refresh token.
+// Dùng cho form đăng nhập của authorization server, nơi session được gắn vào cookie thay vì trả token.
+func (s *authService) LoginSession(usernameOrEmail, password string, client ClientInfo) (*LoginResult, error) {
+	return s.login(usernameOrEmail, password, client, false)
+}
+
+// login xác thực mật khẩu cho Login và LoginSession; withTokens cho biết có cấp token khi mở session không
+func (s *authService) login(usernameOrEmail, password string, client ClientInfo, withTokens bool) (*LoginResult, error) {
+	user, err := s.findUser(usernameOrEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	// Từ chối nếu IP hoặc tài khoản đang bị khóa do đăng nhập sai quá nhiều lần
+	if err := s.lockoutService.Check(user, client.IPAddress); err != nil {
+		return nil, err
+	}
+
+	// Kiểm tra thông tin đăng nhập với các nguồn xác thực (database, LDAP...)
+	authenticated, backend, err := s.authenticate(usernameOrEmail, password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrAuthBackendUnavailable) {
+			s.recordLoginFailure(user, client)
+		}
+		return nil, err
+	}
+
+	// User vừa được tạo từ LDAP hoặc khác user tìm theo tên đăng nhập: kiểm tra khóa tài khoản của user thật
+	if user == nil || user.ID != authenticated.ID {
+		if err := s.lockoutService.Check(authenticated, client.IPAddress); err != nil {
+			return nil, err
+		}
+	}
+	user = authenticated
+
+	if err := s.checkLoginAllowed(user, backend.Name()); err != nil {
+		return nil, err
+	}
+
+	// Mật khẩu do nguồn bên ngoài quản lý (LDAP) không áp dụng tuổi tối đa của mật khẩu cục bộ
+	localPassword := backend.Name() == AuthBackendLocal
+
+	// Bước thứ hai: yêu cầu mã MFA hoặc passkey trước khi cấp token
+	methods, err := s.mfaMethods(user)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) > 0 {
+		mfaToken, err := s.generateMFAChallenge(user, localPassword)
+		if err != nil {
+			return nil, err
+		}
+		userResponse := user.ToUserResponse()
+		return &LoginResult{User: &userResponse, MFARequired: true, MFAToken: mfaToken, MFAMethods: methods}, nil
+	}
+
+	if !localPassword {
+		return s.startSession(user, client, withTokens)
+	}
+	return s.completeLogin(user, client, withTokens)
+}
+
+// authenticate thử lần lượt các nguồn xác thực theo thứ tự cấu hình và dừng ở nguồn đầu tiên chấp nhận.
+// Nguồn không nhận ra thông tin đăng nhập hoặc không liên lạc được thì chuyển sang nguồn tiếp theo;
+// nếu không nguồn nào chấp nhận, lỗi không liên lạc được (nếu có) được ưu tiên trả về.
+func (s *authService) authenticate(usernameOrEmail, password string) (*models.User, Authenticator, error) {
+	var unavailableErr error
+	for _, authenticator := range s.authenticators {
+		user, err := authenticator.Authenticate(usernameOrEmail, password)
+		switch {
+		case err == nil:
+			return user, authenticator, nil
+		case errors.Is(err, ErrInvalidCredentials):
+		case errors.Is(err, ErrAuthBackendUnavailable):
+			s.logger.Errorf("Authenticator %s failed: %v", authenticator.Name(), err)
+			if unavailableErr == nil {
+				unavailableErr = err
+			}
+		default:
+			return nil, nil, err
+		}
+	}
+	if unavailableErr != nil {
+		return nil, nil, unavailableErr
+	}
+	return nil, nil, ErrInvalidCredentials
+}
+
+// VerifyMFA đổi MFA challenge token cùng mã TOTP (hoặc mã khôi phục) lấy cặp token đăng nhập
+func (s *authService) VerifyMFA(mfaToken, code string, client ClientInfo) (*LoginResult, error) {
+	return s.verifyMFA(mfaToken, code, client, true)
+}
+
+// VerifyMFASession hoàn tất bước MFA của LoginSession: chỉ mở session, không cấp token
+func (s *authService) VerifyMFASession(mfaToken, code string, client ClientInfo) (*LoginResult, error) {
+	return s.verifyMFA(mfaToken, code, client, false)
+}
+
+// verifyMFA kiểm tra mã MFA cho VerifyMFA và VerifyMFASession
+func (s *authService) verifyMFA(mfaToken, code string, client ClientInfo, withTokens bool) (*LoginResult, error) {
+	claims, user, err := s.parseMFAChallenge(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mã MFA sai cũng được tính vào số lần đăng nhập sai
+	if err := s.lockoutService.Check(user, client.IPAddress); err != nil {
+		return nil, err
+	}
+	if err := s.mfaService.VerifyCode(user, code); err != nil {
+		if errors.Is(err, ErrMFANotEnabled) {
+			return nil, ErrMFAMethodNotEnabled
+		}
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.recordLoginFailure(user, client)
+		}
+		return nil, err
+	}
+
+	return s.completeMFAChallenge(claims, user, client, withTokens)
+}
+
+// BeginMFAWebAuthn bắt đầu xác thực bằng passkey ở bước thứ hai của đăng nhập
+func (s *authService) BeginMFAWebAuthn(mfaToken string) (*protocol.CredentialAssertion, uuid.UUID, error) {
+	_, user, err := s.parseMFAChallenge(mfaToken)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	hasCredentials, err := s.webAuthnService.HasCredentials(user.ID)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	if !hasCredentials {
+		return nil, uuid.Nil, ErrMFAMethodNotEnabled
+	}
+	return s.webAuthnService.BeginLogin(user, false)
+}
+
+// VerifyMFAWebAuthn hoàn tất bước thứ hai của đăng nhập bằng passkey
+func (s *authService) VerifyMFAWebAuthn(mfaToken string, challengeID uuid.UUID, response *protocol.ParsedCredentialAssertionData, client ClientInfo) (*LoginResult, error) {
+	claims, user, err := s.parseMFAChallenge(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	verifiedUser, err := s.webAuthnService.FinishLogin(challengeID, response)
+	if err != nil {
+		return nil, err
+	}
+	// Passkey phải thuộc về chính user đã qua bước kiểm tra mật khẩu
+	if verifiedUser.ID != user.ID {
+		return nil, ErrWebAuthnFailed
+	}
+
+	return s.completeMFAChallenge(claims, user, client, true)
+}
+
+// BeginPasskeyLogin bắt đầu đăng nhập không mật khẩu bằng passkey. Nếu không chỉ định user
+// (hoặc user không tồn tại), trình duyệt tự chọn passkey phù hợp.
+func (s *authService) BeginPasskeyLogin(usernameOrEmail string) (*protocol.CredentialAssertion, uuid.UUID, error) {
 	var user *models.User
-	var err error
+	if usernameOrEmail != "" {
+		var err error
+		user, err = s.findUser(usernameOrEmail)
+		if err != nil {
+			return nil, uuid.Nil, err
+		}
+	}
+	// Đăng nhập không mật khẩu bắt buộc authenticator xác minh người dùng (PIN, vân tay...)
+	return s.webAuthnService.BeginLogin(user, true)
+}
 
-	// Kiểm tra nếu đầu vào là email
-	user, err = s.userRepo.FindByEmail(usernameOrEmail)
+// FinishPasskeyLogin hoàn tất đăng nhập bằng passkey. Passkey đã xác minh người dùng
+// nên được coi là đủ hai yếu tố, không yêu cầu thêm bước MFA.
+func (s *authService) FinishPasskeyLogin(challengeID uuid.UUID, response *protocol.ParsedCredentialAssertionData, client ClientInfo) (*LoginResult, error) {
+	user, err := s.webAuthnService.FinishLogin(challengeID, response)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
+	if err := s.checkLoginAllowed(user, LoginSourcePasskey); err != nil {
+		return nil, err
+	}
+	return s.completeLogin(user, client, true)
+}
 
-	// Nếu không tìm thấy bằng email, thử tìm bằng username
-	if user == nil {
-		user, err = s.userRepo.FindByUsername(usernameOrEmail)
+// LoginWithoutPassword đăng nhập cho user đã được xác thực bằng phương thức khác mật khẩu
+// (identity provider bên ngoài...); source là provider của liên kết hoặc một LoginSource*.
+// Khóa tài khoản và MFA vẫn được áp dụng như đăng nhập bằng mật khẩu, nhưng không yêu cầu đổi mật khẩu đã hết hạn.
+func (s *authService) LoginWithoutPassword(user *models.User, source string, client ClientInfo) (*LoginResult, error) {
+	if err := s.lockoutService.Check(user, client.IPAddress); err != nil {
+		return nil, err
+	}
+	if err := s.checkLoginAllowed(user, source); err != nil {
+		return nil, err
+	}
+
+	methods, err := s.mfaMethods(user)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) > 0 {
+		mfaToken, err := s.generateMFAChallenge(user, false)
 		if err != nil {
-			return "", nil, err
+			return nil, err
 		}
+		userResponse := user.ToUserResponse()
+		return &LoginResult{User: &userResponse, MFARequired: true, MFAToken: mfaToken, MFAMethods: methods}, nil
 	}
 
-	// Kiểm tra nếu user không tồn tại
+	return s.startSession(user, client, true)
+}
+
+// ChangeExpiredPassword đặt mật khẩu mới cho user có mật khẩu hết hạn bằng token đổi mật khẩu
+// nhận được khi đăng nhập, sau đó mở session đăng nhập
+func (s *authService) ChangeExpiredPassword(passwordChangeToken, newPassword string, client ClientInfo) (*LoginResult, error) {
+	return s.changeExpiredPassword(passwordChangeToken, newPassword, client, true)
+}
+
+// ChangeExpiredPasswordSession hoàn tất bước đổi mật khẩu của LoginSession: chỉ mở session, không cấp token
+func (s *authService) ChangeExpiredPasswordSession(passwordChangeToken, newPassword string, client ClientInfo) (*LoginResult, error) {
+	return s.changeExpiredPassword(passwordChangeToken, newPassword, client, false)
+}
+
+// changeExpiredPassword đổi mật khẩu cho ChangeExpiredPassword và ChangeExpiredPasswordSession
+func (s *authService) changeExpiredPassword(passwordChangeToken, newPassword string, client ClientInfo, withTokens bool) (*LoginResult, error) {
+	claims, user, err := s.parseChallengeToken(passwordChangeToken, TokenTypePasswordChange, ErrInvalidPasswordChangeToken)
+	if err != nil {
+		return nil, err
+	}
+	// Kiểm tra mật khẩu mới trước khi dùng token để user có thể thử lại với mật khẩu khác
+	if err := s.passwordService.CheckNewPassword(user, newPassword); err != nil {
+		return nil, err
+	}
+	if err := s.consumeChallengeToken(claims, ErrInvalidPasswordChangeToken); err != nil {
+		return nil, err
+	}
+	if err := s.passwordService.SetPassword(user, newPassword); err != nil {
+		return nil, err
+	}
+	return s.startSession(user, client, withTokens)
+}
+
+// Refresh đổi refresh token lấy cặp token mới (xoay vòng refresh token).
+// Nếu một refresh token đã được xoay vòng bị dùng lại, toàn bộ family bị thu hồi.
+func (s *authService) Refresh(refreshToken string) (*TokenPair, error) {
+	stored, err := s.refreshTokenRepo.FindByHash(hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Token đã bị thay thế mà vẫn được gửi lên => có khả năng bị đánh cắp
+	if stored.ReplacedByID != nil {
+		return nil, s.handleRefreshTokenReuse(stored)
+	}
+	// Refresh token cấp cho OAuth client chỉ dùng được tại /oauth/token
+	if stored.IsRevoked() || stored.IsExpired() || stored.ClientID != "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Session đã bị đăng xuất thì refresh token cũng không dùng được nữa
+	active, err := s.sessionService.CheckSession(stored.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.FindByID(stored.UserID)
+	if err != nil {
+		return nil, err
+	}
 	if user == nil {
-		return "", nil, ErrInvalidCredentials
+		return nil, ErrInvalidRefreshToken
 	}
 
-	// Kiểm tra password
-	if !user.CheckPassword(password) {
-		return "", nil, ErrInvalidCredentials
+	// Tạo refresh token mới trong cùng family và thu hồi token cũ
+	rawToken, newToken, err := s.newRefreshToken(user.ID, stored.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.refreshTokenRepo.Rotate(stored, newToken); err != nil {
+		if errors.Is(err, repository.ErrTokenAlreadyRotated) {
+			return nil, s.handleRefreshTokenReuse(stored)
+		}
+		return nil, err
+	}
+	// Session sống cùng refresh token mới nhất của nó
+	if err := s.sessionService.ExtendSession(stored.FamilyID); err != nil {
+		s.logger.Errorf("Failed to extend session %s: %v", stored.FamilyID, err)
 	}
 
-	// Tạo JWT token
-	claims := Claims{
-		UserID: user.ID.String(),
-		Role:   user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // Token hết hạn sau 24h
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
+	accessToken, err := s.generateAccessToken(user, stored.FamilyID)
+	if err != nil {
+		return nil, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(s.config.JWTSecret))
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: rawToken,
+		ExpiresIn:    int64(s.config.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// Logout thu hồi access token hiện tại (theo jti) cho đến khi nó hết hạn và đóng session của token.
+// Nếu client gửi kèm refresh token thì toàn bộ family của refresh token đó cũng bị thu hồi.
+func (s *authService) Logout(claims *Claims, refreshToken string) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return ErrTokenRevoked
+	}
+	if err := s.revocationStore.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
 	if err != nil {
-		s.logger.Errorf("Error signing token: %v", err)
-		return "", nil, err
+		return ErrTokenRevoked
+	}
+	if sessionID, err := uuid.Parse(claims.SessionID); err == nil {
+		if err := s.sessionService.RevokeSession(userID, sessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
 	}
 
-	// Trả về token và thông tin user
-	userResponse := user.ToUserResponse()
-	return tokenString, &userResponse, nil
+	if refreshToken == "" {
+		return nil
+	}
+
+	stored, err := s.refreshTokenRepo.FindByHash(hashToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	// Chỉ thu hồi refresh token thuộc về chính user đang đăng xuất
+	if stored == nil || stored.UserID != userID {
+		return ErrInvalidRefreshToken
+	}
+	return s.refreshTokenRepo.RevokeFamily(stored.FamilyID)
 }
 
 // ValidateToken kiểm tra JWT token có hợp lệ không
 func (s *authService) ValidateToken(tokenString string) (*jwt.Token, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Kiểm tra thuật toán ký
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(s.config.JWTSecret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, s.keyFunc)
 
 	if err != nil {
 		return nil, err
@@ -160,3 +567,331 @@ func (s *authService) ValidateToken(tokenString string) (*jwt.Token, error) {
 
 	return token, nil
 }
+
+// IsTokenRevoked kiểm tra access token đã bị thu hồi chưa, kể cả khi session của token bị đăng xuất.
+// Token không có jti hoặc session được coi như đã bị thu hồi vì không thể kiểm soát được.
+func (s *authService) IsTokenRevoked(claims *Claims) (bool, error) {
+	if claims.ID == "" {
+		return true, nil
+	}
+	revoked, err := s.revocationStore.IsRevoked(claims.ID)
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return true, nil
+	}
+	active, err := s.sessionService.CheckSession(sessionID)
+	if err != nil {
+		return false, err
+	}
+	return !active, nil
+}
+
+// JWKS trả về các khóa công khai dùng để xác thực token (khóa HMAC không được công khai)
+func (s *authService) JWKS() keys.JWKS {
+	return s.keyring.JWKS()
+}
+
+// keyFunc chọn khóa xác thực trong keyring theo kid trong header của token
+func (s *authService) keyFunc(token *jwt.Token) (interface{}, error) {
+	key, err := s.keyring.KeyFunc(token)
+	if errors.Is(err, keys.ErrUnknownKey) {
+		return nil, ErrUnknownSigningKey
+	}
+	return key, err
+}
+
+// findUser tìm user theo email, username hoặc số điện thoại đã xác minh
+func (s *authService) findUser(usernameOrEmail string) (*models.User, error) {
+	return findUserByLogin(s.userRepo, usernameOrEmail, s.config.PhoneDefaultCountryCode)
+}
+
+// checkLoginAllowed kiểm tra tài khoản có được phép đăng nhập qua source không (sau khi đã xác thực danh tính).
+// User đến từ LDAP/SAML chỉ đăng nhập qua chính nguồn đó (source là LDAP hoặc SAML), để tài khoản
+// bị khóa trong thư mục không còn đăng nhập được bằng passkey, identity provider khác...
+func (s *authService) checkLoginAllowed(user *models.User, source string) error {
+	if !managedIdentity(source) {
+		managed, err := hasManagedIdentity(s.identityRepo, user.ID)
+		if err != nil {
+			return err
+		}
+		if managed {
+			return ErrManagedAccount
+		}
+	}
+	if s.config.RequireEmailVerification && !user.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// mfaMethods trả về các phương thức MFA mà user đã bật
+func (s *authService) mfaMethods(user *models.User) ([]string, error) {
+	var methods []string
+	if user.TOTPEnabled {
+		methods = append(methods, MFAMethodTOTP)
+	}
+
+	hasCredentials, err := s.webAuthnService.HasCredentials(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if hasCredentials {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+	return methods, nil
+}
+
+// parseMFAChallenge kiểm tra MFA challenge token và lấy user tương ứng
+func (s *authService) parseMFAChallenge(mfaToken string) (*Claims, *models.User, error) {
+	return s.parseChallengeToken(mfaToken, TokenTypeMFAChallenge, ErrInvalidMFAToken)
+}
+
+// parseChallengeToken kiểm tra token ngắn hạn của một bước đăng nhập (loại tokenType) và lấy user tương ứng.
+// Trả về errInvalid nếu token không hợp lệ, sai loại hoặc đã được dùng.
+func (s *authService) parseChallengeToken(tokenString, tokenType string, errInvalid error) (*Claims, *models.User, error) {
+	token, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, nil, errInvalid
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid || claims.TokenType != tokenType {
+		return nil, nil, errInvalid
+	}
+
+	// Challenge token chỉ dùng được một lần (xem consumeChallengeToken)
+	revoked, err := s.revocationStore.IsRevoked(claims.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if revoked {
+		return nil, nil, errInvalid
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil, nil, errInvalid
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil {
+		return nil, nil, errInvalid
+	}
+	return claims, user, nil
+}
+
+// consumeChallengeToken vô hiệu hóa challenge token đã dùng. Trả về errInvalid nếu một request khác
+// đã dùng token trước, để các request đồng thời với cùng token chỉ hoàn tất được một lần.
+func (s *authService) consumeChallengeToken(claims *Claims, errInvalid error) error {
+	first, err := s.revocationStore.Consume(claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return err
+	}
+	if !first {
+		return errInvalid
+	}
+	return nil
+}
+
+// completeMFAChallenge vô hiệu hóa challenge token đã dùng và mở session đăng nhập
+func (s *authService) completeMFAChallenge(claims *Claims, user *models.User, client ClientInfo, withTokens bool) (*LoginResult, error) {
+	if err := s.consumeChallengeToken(claims, ErrInvalidMFAToken); err != nil {
+		return nil, err
+	}
+	if !claims.Password {
+		return s.startSession(user, client, withTokens)
+	}
+	return s.completeLogin(user, client, withTokens)
+}
+
+// completeLogin mở session cho user đã qua mọi bước xác thực, trừ khi mật khẩu đã quá tuổi tối đa:
+// khi đó chỉ cấp token đổi mật khẩu
+func (s *authService) completeLogin(user *models.User, client ClientInfo, withTokens bool) (*LoginResult, error) {
+	if user.PasswordExpired(s.config.PasswordMaxAge, time.Now()) {
+		token, err := s.generateChallengeToken(user, TokenTypePasswordChange, s.config.PasswordChangeTokenTTL)
+		if err != nil {
+			return nil, err
+		}
+		userResponse := user.ToUserResponse()
+		return &LoginResult{User: &userResponse, PasswordChangeRequired: true, PasswordChangeToken: token}, nil
+	}
+	return s.startSession(user, client, withTokens)
+}
+
+// startSession ghi nhận session mới cho user đã xác thực xong và cấp cặp token nếu withTokens.
+// Mỗi lần đăng nhập là một session mới, ID của session là family của refresh token.
+func (s *authService) startSession(user *models.User, client ClientInfo, withTokens bool) (*LoginResult, error) {
+	// Thiết bị mới: không có session nào đang hoạt động với cùng User-Agent
+	newDevice := false
+	if s.config.LoginAlerts {
+		var err error
+		newDevice, err = s.isNewDevice(user.ID, client)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	session, err := s.sessionService.CreateSession(user.ID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// Chỉ xóa bộ đếm đăng nhập sai khi đã hoàn tất mọi bước xác thực
+	if err := s.lockoutService.RecordSuccess(user); err != nil {
+		s.logger.Errorf("Failed to reset failed logins of user %s: %v", user.ID, err)
+	}
+
+	if newDevice {
+		if err := s.mailService.SendLoginAlert(user, session); err != nil {
+			s.logger.Errorf("Failed to send login alert to user %s: %v", user.ID, err)
+		}
+	}
+
+	userResponse := user.ToUserResponse()
+	if !withTokens {
+		return &LoginResult{User: &userResponse, SessionID: session.ID}, nil
+	}
+
+	tokens, err := s.issueTokens(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Trả về token và thông tin user
+	return &LoginResult{Tokens: tokens, User: &userResponse, SessionID: session.ID}, nil
+}
+
+// recordLoginFailure ghi nhận một lần đăng nhập sai; lỗi chỉ được ghi log để không thay đổi phản hồi cho client
+func (s *authService) recordLoginFailure(user *models.User, client ClientInfo) {
+	if err := s.lockoutService.RecordFailure(user, client.IPAddress); err != nil {
+		s.logger.Errorf("Failed to record login failure: %v", err)
+	}
+}
+
+// isNewDevice kiểm tra client có phải thiết bị user chưa từng đăng nhập (trong các session còn hiệu lực)
+func (s *authService) isNewDevice(userID uuid.UUID, client ClientInfo) (bool, error) {
+	sessions, err := s.sessionService.ListSessions(userID, uuid.Nil)
+	if err != nil {
+		return false, err
+	}
+	for _, session := range sessions {
+		if session.UserAgent == client.UserAgent {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// generateMFAChallenge tạo token ngắn hạn chứng minh user đã qua bước xác thực đầu tiên.
+// password = true nếu bước đầu là mật khẩu cục bộ, khi đó tuổi tối đa của mật khẩu được kiểm tra sau MFA.
+func (s *authService) generateMFAChallenge(user *models.User, password bool) (string, error) {
+	claims := s.challengeClaims(user, TokenTypeMFAChallenge, s.config.MFAChallengeTTL)
+	claims.Password = password
+	return s.signToken(claims)
+}
+
+// generateChallengeToken tạo token ngắn hạn loại tokenType, chỉ dùng được cho bước đăng nhập tương ứng
+func (s *authService) generateChallengeToken(user *models.User, tokenType string, ttl time.Duration) (string, error) {
+	return s.signToken(s.challengeClaims(user, tokenType, ttl))
+}
+
+// challengeClaims tạo claims của token ngắn hạn loại tokenType
+func (s *authService) challengeClaims(user *models.User, tokenType string, ttl time.Duration) Claims {
+	now := time.Now()
+	return Claims{
+		UserID:    user.ID.String(),
+		Role:      user.Role,
+		TokenType: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+}
+
+// issueTokens tạo access token và refresh token mới cho session (family) cho trước
+func (s *authService) issueTokens(user *models.User, sessionID uuid.UUID) (*TokenPair, error) {
+	accessToken, err := s.generateAccessToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	rawToken, refreshToken, err := s.newRefreshToken(user.ID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.refreshTokenRepo.Create(refreshToken); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: rawToken,
+		ExpiresIn:    int64(s.config.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// generateAccessToken tạo JWT access token ngắn hạn cho user, gắn với session đăng nhập
+func (s *authService) generateAccessToken(user *models.User, sessionID uuid.UUID) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		UserID:    user.ID.String(),
+		Role:      user.Role,
+		TokenType: TokenTypeAccess,
+		SessionID: sessionID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(), // jti, dùng để thu hồi token khi logout
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.config.AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	tokenString, err := s.signToken(claims)
+	if err != nil {
+		s.logger.Errorf("Error signing token: %v", err)
+		return "", err
+	}
+	return tokenString, nil
+}
+
+// signToken ký claims bằng khóa đang hoạt động trong keyring, ghi kid vào header
+func (s *authService) signToken(claims jwt.Claims) (string, error) {
+	return s.keyring.Sign(claims)
+}
+
+// newRefreshToken sinh refresh token ngẫu nhiên, trả về giá trị gốc (gửi cho client)
+// và bản ghi chỉ chứa hash (lưu vào database)
+func (s *authService) newRefreshToken(userID, familyID uuid.UUID) (string, *models.RefreshToken, error) {
+	rawToken, err := generateOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return rawToken, &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(rawToken),
+		ExpiresAt: time.Now().Add(s.config.RefreshTokenTTL),
+	}, nil
+}
+
+// handleRefreshTokenReuse thu hồi toàn bộ family (và session tương ứng) khi phát hiện refresh token bị dùng lại
+func (s *authService) handleRefreshTokenReuse(token *models.RefreshToken) error {
+	s.logger.Errorf("Refresh token reuse detected for user %s, revoking session %s", token.UserID, token.FamilyID)
+	if err := s.sessionService.RevokeSession(token.UserID, token.FamilyID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+	// Thu hồi family trực tiếp phòng khi session không còn tồn tại
+	if err := s.refreshTokenRepo.RevokeFamily(token.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/keys"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	testPassword = "correct horse battery staple"
+	testTOTPCode = "123456"
+)
+
+// fakeAuthenticator chấp nhận testPassword cho mọi user tìm được theo username
+type fakeAuthenticator struct {
+	users *fakeUserRepo
+}
+
+func (a *fakeAuthenticator) Name() string {
+	return AuthBackendLocal
+}
+
+func (a *fakeAuthenticator) Authenticate(usernameOrEmail, password string) (*models.User, error) {
+	user, _ := a.users.FindByUsername(usernameOrEmail)
+	if user == nil || password != testPassword {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// fakeLockoutService khóa mọi lần đăng nhập khi locked và đếm số lần đăng nhập sai, đăng nhập thành công
+type fakeLockoutService struct {
+	LockoutService
+
+	mu        sync.Mutex
+	locked    bool
+	failures  int
+	successes int
+}
+
+func (s *fakeLockoutService) Check(user *models.User, ipAddress string) error {
+	if s.locked {
+		return &LockoutError{Err: ErrAccountLocked, RetryAfter: time.Minute}
+	}
+	return nil
+}
+
+func (s *fakeLockoutService) RecordFailure(user *models.User, ipAddress string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures++
+	return nil
+}
+
+func (s *fakeLockoutService) RecordSuccess(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.successes++
+	return nil
+}
+
+// fakeSessionService tạo session trong bộ nhớ
+type fakeSessionService struct {
+	SessionService
+
+	mu       sync.Mutex
+	sessions []*models.Session
+}
+
+func (s *fakeSessionService) CreateSession(userID uuid.UUID, client ClientInfo) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session := &models.Session{ID: uuid.New(), UserID: userID, UserAgent: client.UserAgent, IPAddress: client.IPAddress}
+	s.sessions = append(s.sessions, session)
+	return session, nil
+}
+
+// fakeMFAService chấp nhận testTOTPCode
+type fakeMFAService struct {
+	MFAService
+}
+
+func (s *fakeMFAService) VerifyCode(user *models.User, code string) error {
+	if code != testTOTPCode {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// fakeWebAuthnService cho biết không user nào có passkey
+type fakeWebAuthnService struct {
+	WebAuthnService
+}
+
+func (s *fakeWebAuthnService) HasCredentials(userID uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+// fakePasswordService chấp nhận mọi mật khẩu mới
+type fakePasswordService struct {
+	PasswordService
+	users *fakeUserRepo
+}
+
+func (s *fakePasswordService) CheckNewPassword(user *models.User, newPassword string) error {
+	return nil
+}
+
+func (s *fakePasswordService) SetPassword(user *models.User, newPassword string) error {
+	user.PasswordResetRequired = false
+	return s.users.Update(user)
+}
+
+// fakeRefreshTokenRepo ghi nhận các refresh token được cấp
+type fakeRefreshTokenRepo struct {
+	repository.RefreshTokenRepository
+
+	mu     sync.Mutex
+	tokens []*models.RefreshToken
+}
+
+func (r *fakeRefreshTokenRepo) Create(token *models.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *fakeRefreshTokenRepo) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.tokens)
+}
+
+// authHarness gồm AuthService với các phụ thuộc trong bộ nhớ
+type authHarness struct {
+	service       AuthService
+	users         *fakeUserRepo
+	lockout       *fakeLockoutService
+	sessions      *fakeSessionService
+	refreshTokens *fakeRefreshTokenRepo
+}
+
+func newAuthHarness(t *testing.T) *authHarness {
+	t.Helper()
+	h := &authHarness{
+		users:         newFakeUserRepo(),
+		lockout:       &fakeLockoutService{},
+		sessions:      &fakeSessionService{},
+		refreshTokens: &fakeRefreshTokenRepo{},
+	}
+	cfg := &config.Config{
+		AccessTokenTTL:         15 * time.Minute,
+		RefreshTokenTTL:        time.Hour,
+		MFAChallengeTTL:        5 * time.Minute,
+		PasswordChangeTokenTTL: 10 * time.Minute,
+	}
+	keyring := keys.NewKeyring(keys.NewHMACKey([]byte("0123456789abcdef0123456789abcdef"), ""))
+	h.service = NewAuthService(h.users, &fakeIdentityRepo{}, h.refreshTokens, repository.NewMemoryRevocationStore(),
+		h.sessions, &fakeMFAService{}, &fakeWebAuthnService{}, nil, nil, h.lockout,
+		&fakePasswordService{users: h.users}, []Authenticator{&fakeAuthenticator{users: h.users}}, keyring, cfg, newTestLogger())
+	return h
+}
+
+var testClient = ClientInfo{UserAgent: "test-browser", IPAddress: "192.0.2.1"}
+
+// assertSessionOnly kiểm tra kết quả đăng nhập chỉ mở session, không có token nào được cấp
+func (h *authHarness) assertSessionOnly(t *testing.T, result *LoginResult, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if result.MFARequired || result.PasswordChangeRequired {
+		t.Fatalf("login not completed: %+v", result)
+	}
+	if result.Tokens != nil || h.refreshTokens.count() != 0 {
+		t.Fatalf("tokens issued (refresh tokens stored: %d), want a session only", h.refreshTokens.count())
+	}
+	if len(h.sessions.sessions) != 1 || result.SessionID != h.sessions.sessions[0].ID {
+		t.Fatalf("session %s not the one created (%d sessions)", result.SessionID, len(h.sessions.sessions))
+	}
+	if h.lockout.successes != 1 {
+		t.Fatalf("successful logins recorded: %d, want 1", h.lockout.successes)
+	}
+}
+
+func TestLoginSessionDoesNotIssueTokens(t *testing.T) {
+	h := newAuthHarness(t)
+	h.users.add(&models.User{Username: "ann", Email: "ann@example.com"})
+
+	result, err := h.service.LoginSession("ann", testPassword, testClient)
+	h.assertSessionOnly(t, result, err)
+
+	// Login của API vẫn cấp cặp token cho cùng session
+	result, err = h.service.Login("ann", testPassword, testClient)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if result.Tokens == nil || result.Tokens.RefreshToken == "" || h.refreshTokens.count() != 1 {
+		t.Fatalf("Login must issue a token pair, got %+v", result.Tokens)
+	}
+}
+
+func TestLoginSessionChecksCredentialsAndLockout(t *testing.T) {
+	h := newAuthHarness(t)
+	h.users.add(&models.User{Username: "ann", Email: "ann@example.com"})
+
+	if _, err := h.service.LoginSession("ann", "wrong", testClient); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want ErrInvalidCredentials", err)
+	}
+	if h.lockout.failures != 1 {
+		t.Fatalf("failures recorded: %d, want 1", h.lockout.failures)
+	}
+
+	h.lockout.locked = true
+	var lockoutErr *LockoutError
+	if _, err := h.service.LoginSession("ann", testPassword, testClient); !errors.As(err, &lockoutErr) {
+		t.Fatalf("got %v, want a LockoutError", err)
+	}
+	if len(h.sessions.sessions) != 0 {
+		t.Fatal("no session must be created for a rejected login")
+	}
+}
+
+func TestLoginSessionWithMFA(t *testing.T) {
+	h := newAuthHarness(t)
+	h.users.add(&models.User{Username: "ann", Email: "ann@example.com", TOTPEnabled: true})
+
+	result, err := h.service.LoginSession("ann", testPassword, testClient)
+	if err != nil {
+		t.Fatalf("LoginSession: %v", err)
+	}
+	if !result.MFARequired || len(h.sessions.sessions) != 0 {
+		t.Fatalf("want an MFA challenge before any session, got %+v", result)
+	}
+
+	if _, err := h.service.VerifyMFASession(result.MFAToken, "000000", testClient); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("got %v, want ErrInvalidMFACode", err)
+	}
+	if h.lockout.failures != 1 {
+		t.Fatalf("failures recorded: %d, want the wrong code to count", h.lockout.failures)
+	}
+
+	result, err = h.service.VerifyMFASession(result.MFAToken, testTOTPCode, testClient)
+	h.assertSessionOnly(t, result, err)
+}
+
+func TestLoginSessionWithExpiredPassword(t *testing.T) {
+	h := newAuthHarness(t)
+	h.users.add(&models.User{Username: "ann", Email: "ann@example.com", PasswordResetRequired: true})
+
+	result, err := h.service.LoginSession("ann", testPassword, testClient)
+	if err != nil {
+		t.Fatalf("LoginSession: %v", err)
+	}
+	if !result.PasswordChangeRequired || len(h.sessions.sessions) != 0 {
+		t.Fatalf("want a password change before any session, got %+v", result)
+	}
+
+	result, err = h.service.ChangeExpiredPasswordSession(result.PasswordChangeToken, "a new password", testClient)
+	h.assertSessionOnly(t, result, err)
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/ldapauth"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/Thanhdat-debug/demo_login/pkg/sms"
+)
+
+// Tên các nguồn xác thực trong AUTH_BACKENDS
+const (
+	AuthBackendLocal = "local"
+	AuthBackendLDAP  = "ldap"
+)
+
+// IdentityProviderLDAP là provider của liên kết user_identities giữa user và entry LDAP
+const IdentityProviderLDAP = "ldap"
+
+// Định nghĩa các lỗi
+var (
+	ErrAuthBackendUnavailable = errors.New("authentication backend unavailable")
+	ErrLDAPEmailRequired      = errors.New("ldap entry has no email address")
+	ErrLDAPAccountConflict    = errors.New("a local account with this email already exists")
+)
+
+// Authenticator kiểm tra username/email và mật khẩu với một nguồn danh tính và trả về user tương ứng
+// trong bảng users. Trả về ErrInvalidCredentials nếu nguồn không nhận ra thông tin đăng nhập,
+// ErrAuthBackendUnavailable nếu không liên lạc được với nguồn; khi đó authService thử nguồn tiếp theo.
+type Authenticator interface {
+	Name() string
+	Authenticate(usernameOrEmail, password string) (*models.User, error)
+}
+
+// localAuthenticator xác thực bằng mật khẩu lưu trong bảng users
+type localAuthenticator struct {
+	userRepo     repository.UserRepository
+	identityRepo repository.UserIdentityRepository
+	config       *config.Config
+	logger       *logger.Logger
+}
+
+// NewLocalAuthenticator tạo Authenticator dùng mật khẩu trong database
+func NewLocalAuthenticator(userRepo repository.UserRepository, identityRepo repository.UserIdentityRepository, config *config.Config, logger *logger.Logger) Authenticator {
+	return &localAuthenticator{
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		config:       config,
+		logger:       logger,
+	}
+}
+
+// Name trả về tên của nguồn xác thực
+func (a *localAuthenticator) Name() string {
+	return AuthBackendLocal
+}
+
+// Authenticate kiểm tra mật khẩu của user trong database
+func (a *localAuthenticator) Authenticate(usernameOrEmail, password string) (*models.User, error) {
+	user, err := findUserByLogin(a.userRepo, usernameOrEmail, a.config.PhoneDefaultCountryCode)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.CheckPassword(password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	// User đến từ LDAP/SAML chỉ đăng nhập qua nguồn đó: coi như không nhận ra để authService thử nguồn tiếp theo
+	managed, err := hasManagedIdentity(a.identityRepo, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if managed {
+		return nil, ErrInvalidCredentials
+	}
+
+	// Hash bằng thuật toán/tham số cũ: hash lại ngay khi còn biết password
+	if user.PasswordNeedsRehash() {
+		a.rehashPassword(user, password)
+	}
+	return user, nil
+}
+
+// rehashPassword hash lại password bằng cấu hình hiện tại; lỗi chỉ được ghi log để không làm hỏng lần đăng nhập
+func (a *localAuthenticator) rehashPassword(user *models.User, password string) {
+	rehashed := &models.User{Password: password}
+	if err := rehashed.HashPassword(); err != nil {
+		a.logger.Errorf("Failed to rehash password of user %s: %v", user.ID, err)
+		return
+	}
+	if err := a.userRepo.UpdatePassword(user.ID, rehashed.Password); err != nil {
+		a.logger.Errorf("Failed to save rehashed password of user %s: %v", user.ID, err)
+		return
+	}
+	user.Password = rehashed.Password
+}
+
+// ldapAuthenticator xác thực bằng LDAP/Active Directory và đồng bộ user vào bảng users
+type ldapAuthenticator struct {
+	client       *ldapauth.Client
+	userRepo     repository.UserRepository
+	identityRepo repository.UserIdentityRepository
+	config       *config.Config
+	logger       *logger.Logger
+}
+
+// NewLDAPAuthenticator tạo Authenticator dùng LDAP server trong cấu hình
+func NewLDAPAuthenticator(userRepo repository.UserRepository, identityRepo repository.UserIdentityRepository, config *config.Config, logger *logger.Logger) Authenticator {
+	client := ldapauth.New(ldapauth.Config{
+		URL:                config.LDAPURL,
+		StartTLS:           config.LDAPStartTLS,
+		InsecureSkipVerify: config.LDAPInsecureSkipVerify,
+		Timeout:            config.LDAPTimeout,
+		BindDN:             config.LDAPBindDN,
+		BindPassword:       config.LDAPBindPassword,
+		UserDNTemplates:    config.LDAPUserDNTemplates,
+		UserBaseDN:         config.LDAPUserBaseDN,
+		UserFilter:         config.LDAPUserFilter,
+		GroupBaseDN:        config.LDAPGroupBaseDN,
+		GroupFilter:        config.LDAPGroupFilter,
+		GroupAttribute:     config.LDAPGroupAttribute,
+		IDAttribute:        config.LDAPIDAttribute,
+		UsernameAttribute:  config.LDAPUsernameAttribute,
+		EmailAttribute:     config.LDAPEmailAttribute,
+		FirstNameAttribute: config.LDAPFirstNameAttribute,
+		LastNameAttribute:  config.LDAPLastNameAttribute,
+	})
+	return &ldapAuthenticator{
+		client:       client,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		config:       config,
+		logger:       logger,
+	}
+}
+
+// Name trả về tên của nguồn xác thực
+func (a *ldapAuthenticator) Name() string {
+	return AuthBackendLDAP
+}
+
+// Authenticate bind vào LDAP bằng thông tin đăng nhập, sau đó lấy (hoặc tạo) user tương ứng.
+// Liên kết giữa entry LDAP và user được lưu trong user_identities với provider "ldap".
+func (a *ldapAuthenticator) Authenticate(usernameOrEmail, password string) (*models.User, error) {
+	entry, err := a.client.Authenticate(usernameOrEmail, password)
+	if err != nil {
+		if errors.Is(err, ldapauth.ErrInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: %v", ErrAuthBackendUnavailable, err)
+	}
+
+	info := provisionedUser{
+		Username:      entry.Username,
+		Email:         entry.Email,
+		FirstName:     entry.FirstName,
+		LastName:      entry.LastName,
+		Role:          a.mapRole(entry.Groups),
+		EmailVerified: true, // Email do thư mục của tổ chức quản lý
+	}
+	now := time.Now()
+
+	identity, err := a.identityRepo.FindByProviderSubject(IdentityProviderLDAP, entry.ID)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		user, err := a.userRepo.FindByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, ErrInvalidCredentials
+		}
+		// Role chỉ được đồng bộ khi có LDAP_GROUP_ROLES, để role do admin gán không bị ghi đè
+		if err := syncProvisionedUser(a.userRepo, user, info, len(a.config.LDAPGroupRoles) > 0); err != nil {
+			return nil, err
+		}
+		if err := a.identityRepo.UpdateLogin(identity.ID, entry.Email, now); err != nil {
+			a.logger.Errorf("Failed to update identity %s: %v", identity.ID, err)
+		}
+		return user, nil
+	}
+
+	// Lần đăng nhập đầu tiên: tạo user (just-in-time). Không tự gắn vào tài khoản cục bộ có cùng email,
+	// vì tài khoản đó có thể đã được người khác đăng ký
+	if entry.Email == "" {
+		return nil, ErrLDAPEmailRequired
+	}
+	existing, err := a.userRepo.FindByEmail(entry.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrLDAPAccountConflict
+	}
+
+	user, err := provisionUser(a.userRepo, info)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.identityRepo.Create(&models.UserIdentity{
+		UserID:      user.ID,
+		Provider:    IdentityProviderLDAP,
+		Subject:     entry.ID,
+		Email:       entry.Email,
+		LastLoginAt: &now,
+	}); err != nil {
+		return nil, err
+	}
+	a.logger.Infof("Provisioned user %s from LDAP entry %s", user.ID, entry.DN)
+	return user, nil
+}
+
+// mapRole trả về role của mục LDAP_GROUP_ROLES đầu tiên có nhóm mà user là thành viên, hoặc role mặc định
+func (a *ldapAuthenticator) mapRole(groups []string) string {
+	for _, mapping := range a.config.LDAPGroupRoles {
+		for _, group := range groups {
+			if ldapauth.SameDN(mapping.GroupDN, group) {
+				return mapping.Role
+			}
+		}
+	}
+	return a.config.LDAPDefaultRole
+}
+
+// findUserByLogin tìm user theo email, nếu không có thì theo username,
+// sau cùng theo số điện thoại đã xác minh nếu chuỗi nhập vào là số điện thoại
+func findUserByLogin(userRepo repository.UserRepository, usernameOrEmail, defaultCountryCode string) (*models.User, error) {
+	user, err := userRepo.FindByEmail(usernameOrEmail)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		user, err = userRepo.FindByUsername(usernameOrEmail)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if user == nil {
+		phone, err := sms.NormalizePhone(usernameOrEmail, defaultCountryCode)
+		if err != nil {
+			return nil, nil
+		}
+		user, err = userRepo.FindByPhone(phone)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil && !user.PhoneVerified {
+			return nil, nil
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/ldapauth/ldaptest"
+)
+
+const (
+	testLDAPAdminsDN = "cn=admins,ou=groups,dc=example,dc=com"
+	testLDAPJohnDN   = "uid=jdoe,ou=people,dc=example,dc=com"
+)
+
+// ldapHarness gồm LDAP server trong tiến trình, các repository trong bộ nhớ và ldapAuthenticator dùng chúng
+type ldapHarness struct {
+	server       *ldaptest.Server
+	config       *config.Config
+	users        *fakeUserRepo
+	identities   *fakeIdentityRepo
+	authenticate func(login, password string) (*models.User, error)
+}
+
+// newLDAPHarness khởi động thư mục có user jdoe (thành viên nhóm admins) và user nomail không có email.
+// configure cho phép test chỉnh cấu hình trước khi tạo authenticator.
+func newLDAPHarness(t *testing.T, configure func(*config.Config)) *ldapHarness {
+	t.Helper()
+	server := ldaptest.NewServer(
+		ldaptest.Entry{DN: testLDAPJohnDN, Password: "john-secret", Attributes: map[string][]string{
+			"uid":       {"jdoe"},
+			"entryUUID": {"uuid-jdoe"},
+			"mail":      {"jdoe@example.com"},
+			"givenName": {"John"},
+			"sn":        {"Doe"},
+			"memberOf":  {testLDAPAdminsDN},
+		}},
+		ldaptest.Entry{DN: "uid=nomail,ou=people,dc=example,dc=com", Password: "nomail-secret", Attributes: map[string][]string{
+			"uid":       {"nomail"},
+			"entryUUID": {"uuid-nomail"},
+		}},
+	)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{
+		LDAPURL:                server.URL,
+		LDAPTimeout:            5 * time.Second,
+		LDAPUserDNTemplates:    []string{"uid={username},ou=people,dc=example,dc=com"},
+		LDAPGroupAttribute:     "memberOf",
+		LDAPIDAttribute:        "entryUUID",
+		LDAPUsernameAttribute:  "uid",
+		LDAPEmailAttribute:     "mail",
+		LDAPFirstNameAttribute: "givenName",
+		LDAPLastNameAttribute:  "sn",
+		LDAPDefaultRole:        RoleUser,
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	h := &ldapHarness{server: server, config: cfg, users: newFakeUserRepo(), identities: &fakeIdentityRepo{}}
+	h.authenticate = NewLDAPAuthenticator(h.users, h.identities, cfg, newTestLogger()).Authenticate
+	return h
+}
+
+// withAdminGroupRole ánh xạ nhóm admins sang role admin; DN viết khác hoa thường và khoảng trắng so với thư mục
+func withAdminGroupRole(cfg *config.Config) {
+	cfg.LDAPGroupRoles = []config.LDAPGroupRole{{GroupDN: "CN=Admins, OU=Groups, DC=example, DC=com", Role: RoleAdmin}}
+}
+
+func TestLDAPProvisionsUserOnFirstLogin(t *testing.T) {
+	h := newLDAPHarness(t, withAdminGroupRole)
+
+	user, err := h.authenticate("jdoe", "john-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Username != "jdoe" || user.Email != "jdoe@example.com" || user.FirstName != "John" || user.LastName != "Doe" {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if user.Role != RoleAdmin {
+		t.Fatalf("role = %q, want %q from LDAP_GROUP_ROLES", user.Role, RoleAdmin)
+	}
+	if !user.EmailVerified {
+		t.Fatal("email from the directory must be marked verified")
+	}
+
+	identity, _ := h.identities.FindByProviderSubject(IdentityProviderLDAP, "uuid-jdoe")
+	if identity == nil || identity.UserID != user.ID {
+		t.Fatalf("identity = %+v, want a link to user %s", identity, user.ID)
+	}
+
+	// Lần đăng nhập sau dùng lại user qua liên kết, không tạo user mới
+	again, err := h.authenticate("jdoe", "john-secret")
+	if err != nil {
+		t.Fatalf("second Authenticate: %v", err)
+	}
+	if again.ID != user.ID || h.users.count() != 1 {
+		t.Fatalf("second login returned user %s (users: %d), want the provisioned user %s", again.ID, h.users.count(), user.ID)
+	}
+}
+
+func TestLDAPDefaultRoleWithoutMatchingGroup(t *testing.T) {
+	h := newLDAPHarness(t, func(cfg *config.Config) {
+		cfg.LDAPGroupRoles = []config.LDAPGroupRole{{GroupDN: "cn=operators,ou=groups,dc=example,dc=com", Role: RoleAdmin}}
+	})
+
+	user, err := h.authenticate("jdoe", "john-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Role != RoleUser {
+		t.Fatalf("role = %q, want the default role %q", user.Role, RoleUser)
+	}
+}
+
+func TestLDAPSyncsRoleOfLinkedUser(t *testing.T) {
+	h := newLDAPHarness(t, withAdminGroupRole)
+	existing := h.users.add(&models.User{Username: "jdoe", Email: "jdoe@example.com", Role: RoleUser})
+	if err := h.identities.Create(&models.UserIdentity{UserID: existing.ID, Provider: IdentityProviderLDAP, Subject: "uuid-jdoe"}); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := h.authenticate("jdoe", "john-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	stored, _ := h.users.FindByID(existing.ID)
+	if user.ID != existing.ID || user.Role != RoleAdmin || stored.Role != RoleAdmin {
+		t.Fatalf("role = %q (stored %q), want %q from the group membership", user.Role, stored.Role, RoleAdmin)
+	}
+	if stored.FirstName != "John" || stored.LastName != "Doe" {
+		t.Fatalf("name not synced: %+v", stored)
+	}
+}
+
+func TestLDAPKeepsRoleWithoutGroupRoles(t *testing.T) {
+	h := newLDAPHarness(t, nil)
+	existing := h.users.add(&models.User{Username: "jdoe", Email: "jdoe@example.com", Role: RoleAdmin})
+	if err := h.identities.Create(&models.UserIdentity{UserID: existing.ID, Provider: IdentityProviderLDAP, Subject: "uuid-jdoe"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Không có LDAP_GROUP_ROLES: role do admin gán không bị ghi đè bằng role mặc định
+	if _, err := h.authenticate("jdoe", "john-secret"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if stored, _ := h.users.FindByID(existing.ID); stored.Role != RoleAdmin {
+		t.Fatalf("role = %q, want %q to be kept", stored.Role, RoleAdmin)
+	}
+}
+
+func TestLDAPAccountConflict(t *testing.T) {
+	h := newLDAPHarness(t, nil)
+	h.users.add(&models.User{Username: "john", Email: "jdoe@example.com"})
+
+	// Không tự gắn entry LDAP vào tài khoản cục bộ có cùng email
+	if _, err := h.authenticate("jdoe", "john-secret"); !errors.Is(err, ErrLDAPAccountConflict) {
+		t.Fatalf("got %v, want ErrLDAPAccountConflict", err)
+	}
+	if identity, _ := h.identities.FindByProviderSubject(IdentityProviderLDAP, "uuid-jdoe"); identity != nil {
+		t.Fatalf("identity %+v must not be created", identity)
+	}
+	if h.users.count() != 1 {
+		t.Fatalf("users = %d, no user must be provisioned", h.users.count())
+	}
+}
+
+func TestLDAPRequiresEmail(t *testing.T) {
+	h := newLDAPHarness(t, nil)
+
+	if _, err := h.authenticate("nomail", "nomail-secret"); !errors.Is(err, ErrLDAPEmailRequired) {
+		t.Fatalf("got %v, want ErrLDAPEmailRequired", err)
+	}
+}
+
+func TestLDAPInvalidCredentials(t *testing.T) {
+	h := newLDAPHarness(t, nil)
+
+	if _, err := h.authenticate("jdoe", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want ErrInvalidCredentials", err)
+	}
+	if h.users.count() != 0 {
+		t.Fatal("no user must be provisioned for a failed login")
+	}
+}
+
+func TestLDAPServerUnavailable(t *testing.T) {
+	h := newLDAPHarness(t, nil)
+	h.server.Close()
+
+	// authService thử nguồn tiếp theo khi nhận ErrAuthBackendUnavailable
+	if _, err := h.authenticate("jdoe", "john-secret"); !errors.Is(err, ErrAuthBackendUnavailable) {
+		t.Fatalf("got %v, want ErrAuthBackendUnavailable", err)
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+)
+
+// EmailVerificationService định nghĩa interface cho các phương thức xác minh email
+type EmailVerificationService interface {
+	SendVerification(user *models.User) error
+	ResendVerification(email string) error
+	VerifyEmail(token string) (*models.UserResponse, error)
+}
+
+// emailVerificationService struct triển khai EmailVerificationService interface
+type emailVerificationService struct {
+	userRepo      repository.UserRepository
+	userTokenRepo repository.UserTokenRepository
+	mailService   MailService
+	config        *config.Config
+	logger        *logger.Logger
+}
+
+// NewEmailVerificationService tạo một instance mới của EmailVerificationService
+func NewEmailVerificationService(userRepo repository.UserRepository, userTokenRepo repository.UserTokenRepository, mailService MailService, config *config.Config, logger *logger.Logger) EmailVerificationService {
+	return &emailVerificationService{
+		userRepo:      userRepo,
+		userTokenRepo: userTokenRepo,
+		mailService:   mailService,
+		config:        config,
+		logger:        logger,
+	}
+}
+
+// SendVerification sinh token xác minh mới (vô hiệu hóa các token cũ) và gửi email cho user
+func (s *emailVerificationService) SendVerification(user *models.User) error {
+	if err := s.userTokenRepo.DeleteByUser(user.ID, models.TokenPurposeEmailVerification); err != nil {
+		return err
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	record := &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeEmailVerification,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.config.EmailVerificationTTL),
+	}
+	if err := s.userTokenRepo.Create(record); err != nil {
+		return err
+	}
+
+	return s.mailService.SendVerification(user, token)
+}
+
+// ResendVerification gửi lại email xác minh. Không trả về lỗi khi email không tồn tại
+// hoặc đã xác minh để không thể dùng endpoint này dò tìm tài khoản.
+func (s *emailVerificationService) ResendVerification(email string) error {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.EmailVerified {
+		return nil
+	}
+	return s.SendVerification(user)
+}
+
+// VerifyEmail đánh dấu email của user đã được xác minh bằng token trong email
+func (s *emailVerificationService) VerifyEmail(token string) (*models.UserResponse, error) {
+	record, err := s.userTokenRepo.Consume(hashToken(token), models.TokenPurposeEmailVerification)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	user, err := s.userRepo.FindByID(record.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if !user.EmailVerified {
+		now := time.Now()
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+		if err := s.userRepo.Update(user); err != nil {
+			return nil, err
+		}
+	}
+
+	userResponse := user.ToUserResponse()
+	return &userResponse, nil
+}
@@ -0,0 +1,455 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Các repository trong bộ nhớ dùng cho test. Mỗi fake nhúng interface tương ứng, nên gọi tới
+// phương thức chưa được cài đặt sẽ panic và lộ ra ngay trong test.
+
+// newTestLogger tạo logger bỏ qua mọi output
+func newTestLogger() *logger.Logger {
+	discard := log.New(io.Discard, "", 0)
+	return &logger.Logger{InfoLogger: discard, ErrorLogger: discard, DebugLogger: discard}
+}
+
+// fakeUserRepo lưu user trong map theo ID
+type fakeUserRepo struct {
+	repository.UserRepository
+
+	mu    sync.Mutex
+	users map[uuid.UUID]*models.User
+}
+
+func newFakeUserRepo() *fakeUserRepo {
+	return &fakeUserRepo{users: map[uuid.UUID]*models.User{}}
+}
+
+// add lưu user có sẵn, tự tạo ID nếu chưa có
+func (r *fakeUserRepo) add(user *models.User) *models.User {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user.ID == uuid.Nil {
+		user.ID = uuid.New()
+	}
+	if user.Role == "" {
+		user.Role = RoleUser
+	}
+	stored := *user
+	r.users[user.ID] = &stored
+	return user
+}
+
+func (r *fakeUserRepo) Create(user *models.User) error {
+	r.add(user)
+	return nil
+}
+
+func (r *fakeUserRepo) find(match func(*models.User) bool) *models.User {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if match(user) {
+			found := *user
+			return &found
+		}
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) FindByID(id uuid.UUID) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.ID == id }), nil
+}
+
+func (r *fakeUserRepo) FindByUsername(username string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.Username == username }), nil
+}
+
+func (r *fakeUserRepo) FindByEmail(email string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return strings.EqualFold(u.Email, email) }), nil
+}
+
+func (r *fakeUserRepo) FindByPhone(phone string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.Phone != nil && *u.Phone == phone }), nil
+}
+
+func (r *fakeUserRepo) Update(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *user
+	r.users[user.ID] = &stored
+	return nil
+}
+
+func (r *fakeUserRepo) UpdateRole(id uuid.UUID, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user, ok := r.users[id]; ok {
+		user.Role = role
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.users)
+}
+
+// fakeIdentityRepo lưu liên kết user_identities trong slice
+type fakeIdentityRepo struct {
+	repository.UserIdentityRepository
+
+	mu         sync.Mutex
+	identities []*models.UserIdentity
+}
+
+func (r *fakeIdentityRepo) Create(identity *models.UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && (existing.Subject == identity.Subject || existing.UserID == identity.UserID) {
+			return errors.New("duplicate user identity")
+		}
+	}
+	if identity.ID == uuid.Nil {
+		identity.ID = uuid.New()
+	}
+	stored := *identity
+	r.identities = append(r.identities, &stored)
+	return nil
+}
+
+func (r *fakeIdentityRepo) FindByProviderSubject(provider, subject string) (*models.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			found := *identity
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeIdentityRepo) FindByUserProvider(userID uuid.UUID, provider string) (*models.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, identity := range r.identities {
+		if identity.UserID == userID && identity.Provider == provider {
+			found := *identity
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeIdentityRepo) ListByUser(userID uuid.UUID) ([]models.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var identities []models.UserIdentity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, *identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r *fakeIdentityRepo) UpdateLogin(id uuid.UUID, email string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, identity := range r.identities {
+		if identity.ID == id {
+			identity.Email = email
+			identity.LastLoginAt = &at
+		}
+	}
+	return nil
+}
+
+// fakeWebAuthnRepo lưu credential và challenge WebAuthn trong bộ nhớ, với cùng ngữ nghĩa
+// dùng một lần và hết hạn như repository thật
+type fakeWebAuthnRepo struct {
+	repository.WebAuthnRepository
+
+	mu          sync.Mutex
+	credentials []*models.WebAuthnCredential
+	challenges  map[uuid.UUID]*models.WebAuthnChallenge
+}
+
+func newFakeWebAuthnRepo() *fakeWebAuthnRepo {
+	return &fakeWebAuthnRepo{challenges: map[uuid.UUID]*models.WebAuthnChallenge{}}
+}
+
+func (r *fakeWebAuthnRepo) CreateCredential(credential *models.WebAuthnCredential) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if credential.ID == uuid.Nil {
+		credential.ID = uuid.New()
+	}
+	stored := *credential
+	r.credentials = append(r.credentials, &stored)
+	return nil
+}
+
+func (r *fakeWebAuthnRepo) ListCredentialsByUser(userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var credentials []models.WebAuthnCredential
+	for _, credential := range r.credentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, *credential)
+		}
+	}
+	return credentials, nil
+}
+
+func (r *fakeWebAuthnRepo) FindCredentialByCredentialID(credentialID []byte) (*models.WebAuthnCredential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, credential := range r.credentials {
+		if bytes.Equal(credential.CredentialID, credentialID) {
+			found := *credential
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeWebAuthnRepo) UpdateCredential(credential *models.WebAuthnCredential) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.credentials {
+		if existing.ID == credential.ID {
+			stored := *credential
+			r.credentials[i] = &stored
+		}
+	}
+	return nil
+}
+
+func (r *fakeWebAuthnRepo) CreateChallenge(challenge *models.WebAuthnChallenge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if challenge.ID == uuid.Nil {
+		challenge.ID = uuid.New()
+	}
+	stored := *challenge
+	r.challenges[challenge.ID] = &stored
+	return nil
+}
+
+func (r *fakeWebAuthnRepo) ConsumeChallenge(id uuid.UUID, ceremony string) (*models.WebAuthnChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	challenge, ok := r.challenges[id]
+	if !ok || challenge.Ceremony != ceremony {
+		return nil, nil
+	}
+	delete(r.challenges, id)
+	if time.Now().After(challenge.ExpiresAt) {
+		return nil, nil
+	}
+	return challenge, nil
+}
+
+func (r *fakeWebAuthnRepo) DeleteExpired(before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for id, challenge := range r.challenges {
+		if challenge.ExpiresAt.Before(before) {
+			delete(r.challenges, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// expireChallenge đẩy thời điểm hết hạn của challenge về quá khứ
+func (r *fakeWebAuthnRepo) expireChallenge(id uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if challenge, ok := r.challenges[id]; ok {
+		challenge.ExpiresAt = time.Now().Add(-time.Second)
+	}
+}
+
+func (r *fakeWebAuthnRepo) challengeCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.challenges)
+}
+
+// fakeOAuthCodeRepo lưu authorization code theo hash, mỗi code chỉ dùng được một lần
+type fakeOAuthCodeRepo struct {
+	repository.OAuthCodeRepository
+
+	mu    sync.Mutex
+	codes map[string]*models.OAuthAuthorizationCode
+}
+
+func newFakeOAuthCodeRepo() *fakeOAuthCodeRepo {
+	return &fakeOAuthCodeRepo{codes: map[string]*models.OAuthAuthorizationCode{}}
+}
+
+func (r *fakeOAuthCodeRepo) Create(code *models.OAuthAuthorizationCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if code.ID == uuid.Nil {
+		code.ID = uuid.New()
+	}
+	stored := *code
+	r.codes[code.CodeHash] = &stored
+	return nil
+}
+
+func (r *fakeOAuthCodeRepo) Consume(codeHash string) (*models.OAuthAuthorizationCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code, ok := r.codes[codeHash]
+	if !ok {
+		return nil, nil
+	}
+	found := *code
+	if code.UsedAt != nil {
+		return &found, repository.ErrCodeAlreadyUsed
+	}
+	if !code.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	now := time.Now()
+	code.UsedAt = &now
+	found.UsedAt = &now
+	return &found, nil
+}
+
+func (r *fakeOAuthCodeRepo) SetFamily(id, familyID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, code := range r.codes {
+		if code.ID == id {
+			code.FamilyID = &familyID
+		}
+	}
+	return nil
+}
+
+// fakeSigningKeyRepo lưu khóa ký theo kid, giữ thứ tự tạo như ListUsable của repository thật
+type fakeSigningKeyRepo struct {
+	repository.SigningKeyRepository
+
+	mu   sync.Mutex
+	keys []*models.SigningKey
+}
+
+func (r *fakeSigningKeyRepo) Create(key *models.SigningKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *key
+	stored.CreatedAt = time.Now()
+	r.keys = append(r.keys, &stored)
+	return nil
+}
+
+func (r *fakeSigningKeyRepo) find(kid string) *models.SigningKey {
+	for _, key := range r.keys {
+		if key.ID == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+func (r *fakeSigningKeyRepo) FindByID(kid string) (*models.SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := r.find(kid)
+	if key == nil {
+		return nil, nil
+	}
+	found := *key
+	return &found, nil
+}
+
+func (r *fakeSigningKeyRepo) ListUsable() ([]models.SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var usable []models.SigningKey
+	for _, key := range r.keys {
+		if key.Status != models.SigningKeyRetired {
+			usable = append(usable, *key)
+		}
+	}
+	return usable, nil
+}
+
+func (r *fakeSigningKeyRepo) Update(key *models.SigningKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored := r.find(key.ID); stored != nil {
+		*stored = *key
+	}
+	return nil
+}
+
+func (r *fakeSigningKeyRepo) UpdatePrivateKey(kid, privateKey string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored := r.find(kid); stored != nil {
+		stored.PrivateKey = privateKey
+	}
+	return nil
+}
+
+func (r *fakeSigningKeyRepo) WipeRetired() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range r.keys {
+		if key.Status == models.SigningKeyRetired {
+			key.PrivateKey = ""
+		}
+	}
+	return nil
+}
+
+func (r *fakeSigningKeyRepo) Promote(kid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, key := range r.keys {
+		switch {
+		case key.ID == kid:
+			key.Status = models.SigningKeyActive
+			key.ActivatedAt = &now
+			key.DeactivatedAt = nil
+		case key.Status == models.SigningKeyActive:
+			key.Status = models.SigningKeyVerify
+			key.DeactivatedAt = &now
+		}
+	}
+	return nil
+}
+
+// privateKeys trả về phần bí mật đang lưu của mọi khóa, kể cả khóa đã retire
+func (r *fakeSigningKeyRepo) privateKeys() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := map[string]string{}
+	for _, key := range r.keys {
+		stored[key.ID] = key.PrivateKey
+	}
+	return stored
+}
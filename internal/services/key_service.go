@@ -0,0 +1,286 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/keys"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrKeyNotFound   = errors.New("signing key not found")
+	ErrKeyActive     = errors.New("signing key is active")
+	ErrKeyStillInUse = errors.New("signing key may still verify unexpired tokens")
+	ErrNoActiveKey   = errors.New("no active signing key")
+)
+
+// KeyService định nghĩa interface cho các phương thức quản lý và xoay vòng khóa ký JWT
+type KeyService interface {
+	Bootstrap(configKey *keys.Key) error
+	Reload() error
+	ListKeys() ([]models.SigningKey, error)
+	GenerateKey(algorithm string) (*models.SigningKey, error)
+	PromoteKey(kid string) error
+	RetireKey(kid string) error
+}
+
+// keyService struct triển khai KeyService interface
+type keyService struct {
+	keyRepo   repository.SigningKeyRepository
+	keyring   *keys.Keyring
+	encrypter *keys.Encrypter
+	config    *config.Config
+	logger    *logger.Logger
+}
+
+// NewKeyService tạo một instance mới của KeyService, keyring được dùng chung với AuthService.
+// encrypter mã hóa phần bí mật của khóa trước khi lưu vào database.
+func NewKeyService(keyRepo repository.SigningKeyRepository, keyring *keys.Keyring, encrypter *keys.Encrypter, config *config.Config, logger *logger.Logger) KeyService {
+	return &keyService{
+		keyRepo:   keyRepo,
+		keyring:   keyring,
+		encrypter: encrypter,
+		config:    config,
+		logger:    logger,
+	}
+}
+
+// Bootstrap đưa khóa cấu hình trong .env vào database nếu chưa có rồi nạp keyring.
+// Khóa cấu hình trở thành khóa ký khi chưa có khóa nào đang hoạt động,
+// ngược lại nó chỉ được thêm vào như một khóa xác thực chờ được promote.
+// Các khóa được lưu dạng rõ bởi phiên bản trước được mã hóa lại tại đây.
+func (s *keyService) Bootstrap(configKey *keys.Key) error {
+	if err := s.sealPlaintextKeys(); err != nil {
+		return err
+	}
+
+	existing, err := s.keyRepo.FindByID(configKey.ID)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		usable, err := s.keyRepo.ListUsable()
+		if err != nil {
+			return err
+		}
+		hasActive := false
+		for _, key := range usable {
+			if key.Status == models.SigningKeyActive {
+				hasActive = true
+				break
+			}
+		}
+
+		if err := s.storeKey(configKey, models.SigningKeyVerify); err != nil {
+			return err
+		}
+		if !hasActive {
+			if err := s.keyRepo.Promote(configKey.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.Reload()
+}
+
+// Reload nạp lại keyring từ database, được gọi định kỳ để đồng bộ giữa các instance
+func (s *keyService) Reload() error {
+	stored, err := s.keyRepo.ListUsable()
+	if err != nil {
+		return err
+	}
+
+	var active *keys.Key
+	var verifyOnly []*keys.Key
+	for _, storedKey := range stored {
+		key, err := s.loadKey(&storedKey)
+		if err != nil {
+			s.logger.Errorf("Error loading signing key %s: %v", storedKey.ID, err)
+			continue
+		}
+		if storedKey.Status == models.SigningKeyActive {
+			active = key
+		} else {
+			verifyOnly = append(verifyOnly, key)
+		}
+	}
+
+	if active == nil {
+		return ErrNoActiveKey
+	}
+	s.keyring.Replace(active, verifyOnly)
+	return nil
+}
+
+// ListKeys lấy danh sách các khóa chưa bị retire
+func (s *keyService) ListKeys() ([]models.SigningKey, error) {
+	return s.keyRepo.ListUsable()
+}
+
+// GenerateKey sinh khóa mới ở trạng thái chỉ xác thực. Khóa được công khai qua JWKS ngay,
+// nên nên chờ các service khác cập nhật JWKS trước khi promote khóa này.
+func (s *keyService) GenerateKey(algorithm string) (*models.SigningKey, error) {
+	key, err := keys.Generate(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storeKey(key, models.SigningKeyVerify); err != nil {
+		return nil, err
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s.keyRepo.FindByID(key.ID)
+}
+
+// PromoteKey chuyển một khóa thành khóa ký, khóa ký cũ trở thành khóa chỉ xác thực
+func (s *keyService) PromoteKey(kid string) error {
+	key, err := s.keyRepo.FindByID(kid)
+	if err != nil {
+		return err
+	}
+	if key == nil || key.Status == models.SigningKeyRetired {
+		return ErrKeyNotFound
+	}
+	if key.Status == models.SigningKeyActive {
+		return nil
+	}
+
+	if err := s.keyRepo.Promote(kid); err != nil {
+		return err
+	}
+	s.logger.Infof("Signing key %s promoted", kid)
+	return s.Reload()
+}
+
+// RetireKey loại bỏ hẳn một khóa chỉ xác thực sau khi mọi token ký bằng nó đã hết hạn
+func (s *keyService) RetireKey(kid string) error {
+	key, err := s.keyRepo.FindByID(kid)
+	if err != nil {
+		return err
+	}
+	if key == nil || key.Status == models.SigningKeyRetired {
+		return ErrKeyNotFound
+	}
+	if key.Status == models.SigningKeyActive {
+		return ErrKeyActive
+	}
+
+	// Token ký bằng khóa này có thể còn hiệu lực đến DeactivatedAt + thời gian sống dài nhất của các token được ký
+	if key.DeactivatedAt != nil && time.Since(*key.DeactivatedAt) < s.maxSignedTokenTTL() {
+		return ErrKeyStillInUse
+	}
+
+	// Khóa đã retire không bao giờ được nạp lại, không cần giữ phần bí mật
+	now := time.Now()
+	key.Status = models.SigningKeyRetired
+	key.RetiredAt = &now
+	key.PrivateKey = ""
+	if err := s.keyRepo.Update(key); err != nil {
+		return err
+	}
+	s.logger.Infof("Signing key %s retired", kid)
+	return s.Reload()
+}
+
+// maxSignedTokenTTL trả về thời gian sống dài nhất trong các loại token và cookie được ký bằng keyring
+func (s *keyService) maxSignedTokenTTL() time.Duration {
+	ttls := []time.Duration{
+		s.config.AccessTokenTTL,
+		s.config.MFAChallengeTTL,
+		s.config.PasswordChangeTokenTTL,
+		s.config.MagicLinkTTL,
+		s.config.OAuthAccessTokenTTL, // Access token và ID token cấp cho OAuth client
+		s.config.OAuthSessionTTL,
+		s.config.SocialStateTTL,
+		s.config.SAMLRequestTTL,
+		authorizeRequestTTL,
+	}
+	var longest time.Duration
+	for _, ttl := range ttls {
+		if ttl > longest {
+			longest = ttl
+		}
+	}
+	return longest
+}
+
+// storeKey mã hóa khóa và lưu vào database với trạng thái cho trước
+func (s *keyService) storeKey(key *keys.Key, status string) error {
+	privateKey, err := keys.MarshalPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	sealed, err := s.encrypter.Seal(key.ID, privateKey)
+	if err != nil {
+		return err
+	}
+	return s.keyRepo.Create(&models.SigningKey{
+		ID:         key.ID,
+		Algorithm:  key.Algorithm(),
+		PrivateKey: sealed,
+		Status:     status,
+	})
+}
+
+// loadKey giải mã khóa đã lưu trong database
+func (s *keyService) loadKey(storedKey *models.SigningKey) (*keys.Key, error) {
+	privateKey, err := s.encrypter.Open(storedKey.ID, storedKey.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return keys.UnmarshalPrivateKey(storedKey.Algorithm, privateKey, storedKey.ID)
+}
+
+// sealPlaintextKeys mã hóa các khóa còn dùng được nhưng đang lưu dạng rõ
+// và xóa phần bí mật còn sót lại của các khóa đã retire
+func (s *keyService) sealPlaintextKeys() error {
+	stored, err := s.keyRepo.ListUsable()
+	if err != nil {
+		return err
+	}
+	for _, storedKey := range stored {
+		if keys.IsSealed(storedKey.PrivateKey) {
+			continue
+		}
+		sealed, err := s.encrypter.Seal(storedKey.ID, storedKey.PrivateKey)
+		if err != nil {
+			return err
+		}
+		if err := s.keyRepo.UpdatePrivateKey(storedKey.ID, sealed); err != nil {
+			return err
+		}
+		s.logger.Infof("Signing key %s encrypted at rest", storedKey.ID)
+	}
+	return s.keyRepo.WipeRetired()
+}
+
+// StartKeyringReload chạy một goroutine định kỳ nạp lại keyring từ database.
+// Hàm trả về một hàm stop để dừng goroutine khi tắt server.
+func StartKeyringReload(keyService KeyService, interval time.Duration, logger *logger.Logger) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := keyService.Reload(); err != nil {
+					logger.Errorf("Keyring reload error: %v", err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/keys"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+)
+
+const testJWTSecret = "jwt-secret-that-must-never-reach-the-database"
+
+// newTestEncrypter tạo Encrypter với KEK ngẫu nhiên
+func newTestEncrypter(t *testing.T) *keys.Encrypter {
+	t.Helper()
+	kek := make([]byte, 32)
+	if _, err := rand.Read(kek); err != nil {
+		t.Fatal(err)
+	}
+	encrypter, err := keys.NewEncrypter(base64.StdEncoding.EncodeToString(kek))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encrypter
+}
+
+// newTestKeyService tạo KeyService với keyring riêng, mô phỏng một instance của server
+func newTestKeyService(repo *fakeSigningKeyRepo, encrypter *keys.Encrypter, configKey *keys.Key) (KeyService, *keys.Keyring) {
+	keyring := keys.NewKeyring(configKey)
+	return NewKeyService(repo, keyring, encrypter, &config.Config{}, newTestLogger()), keyring
+}
+
+// assertNoPlaintext kiểm tra không khóa nào trong database chứa phần bí mật dạng rõ
+func assertNoPlaintext(t *testing.T, repo *fakeSigningKeyRepo, secrets ...string) {
+	t.Helper()
+	for kid, stored := range repo.privateKeys() {
+		if stored == "" {
+			continue
+		}
+		if !keys.IsSealed(stored) {
+			t.Fatalf("key %s is stored unencrypted: %q", kid, stored)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(stored, secret) {
+				t.Fatalf("key %s leaks its private key", kid)
+			}
+		}
+	}
+}
+
+func TestSigningKeysAreEncryptedAtRest(t *testing.T) {
+	repo := &fakeSigningKeyRepo{}
+	encrypter := newTestEncrypter(t)
+	configKey := keys.NewHMACKey([]byte(testJWTSecret), "")
+	service, _ := newTestKeyService(repo, encrypter, configKey)
+
+	if err := service.Bootstrap(configKey); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	generated, err := service.GenerateKey(keys.AlgES256)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	assertNoPlaintext(t, repo, testJWTSecret, base64.StdEncoding.EncodeToString([]byte(testJWTSecret)), "PRIVATE KEY")
+
+	// Instance khác cùng KEK nạp được cả hai khóa từ database
+	other, keyring := newTestKeyService(repo, encrypter, keys.NewHMACKey([]byte("other"), ""))
+	if err := other.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	active := keyring.Active()
+	if active.ID != configKey.ID || !bytes.Equal(active.SignKey.([]byte), []byte(testJWTSecret)) {
+		t.Fatalf("active key = %s, want the decrypted config key %s", active.ID, configKey.ID)
+	}
+	if _, ok := keyring.Lookup(generated.ID); !ok {
+		t.Fatalf("generated key %s not loaded", generated.ID)
+	}
+}
+
+func TestReloadWithWrongEncryptionKey(t *testing.T) {
+	repo := &fakeSigningKeyRepo{}
+	configKey := keys.NewHMACKey([]byte(testJWTSecret), "")
+	service, _ := newTestKeyService(repo, newTestEncrypter(t), configKey)
+	if err := service.Bootstrap(configKey); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+
+	// KEK khác không giải mã được khóa nào, không có khóa ký để dùng
+	other, _ := newTestKeyService(repo, newTestEncrypter(t), configKey)
+	if err := other.Reload(); !errors.Is(err, ErrNoActiveKey) {
+		t.Fatalf("got %v, want ErrNoActiveKey", err)
+	}
+}
+
+func TestBootstrapEncryptsPlaintextKeys(t *testing.T) {
+	// Dữ liệu do phiên bản trước lưu: khóa đang ký và khóa đã retire đều ở dạng rõ
+	legacy, err := keys.Generate(keys.AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retired, err := keys.Generate(keys.AlgRS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyPEM, _ := keys.MarshalPrivateKey(legacy)
+	retiredPEM, _ := keys.MarshalPrivateKey(retired)
+	repo := &fakeSigningKeyRepo{}
+	repo.Create(&models.SigningKey{ID: legacy.ID, Algorithm: legacy.Algorithm(), PrivateKey: legacyPEM, Status: models.SigningKeyActive})
+	repo.Create(&models.SigningKey{ID: retired.ID, Algorithm: retired.Algorithm(), PrivateKey: retiredPEM, Status: models.SigningKeyRetired})
+
+	configKey := keys.NewHMACKey([]byte(testJWTSecret), "")
+	service, keyring := newTestKeyService(repo, newTestEncrypter(t), configKey)
+	if err := service.Bootstrap(configKey); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+
+	assertNoPlaintext(t, repo, legacyPEM, testJWTSecret)
+	if stored := repo.privateKeys()[retired.ID]; stored != "" {
+		t.Fatal("retired key material must be wiped")
+	}
+	// Khóa cũ vẫn là khóa ký sau khi được mã hóa lại
+	if keyring.Active().ID != legacy.ID {
+		t.Fatalf("active key = %s, want %s", keyring.Active().ID, legacy.ID)
+	}
+}
+
+func TestRetireKeyWipesPrivateKey(t *testing.T) {
+	repo := &fakeSigningKeyRepo{}
+	configKey := keys.NewHMACKey([]byte(testJWTSecret), "")
+	service, keyring := newTestKeyService(repo, newTestEncrypter(t), configKey)
+	if err := service.Bootstrap(configKey); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	generated, err := service.GenerateKey(keys.AlgES256)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	if err := service.RetireKey(generated.ID); err != nil {
+		t.Fatalf("RetireKey: %v", err)
+	}
+	if stored := repo.privateKeys()[generated.ID]; stored != "" {
+		t.Fatalf("retired key still stores %q", stored)
+	}
+	if _, ok := keyring.Lookup(generated.ID); ok {
+		t.Fatal("retired key must be removed from the keyring")
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrAccountLocked        = errors.New("account is temporarily locked")
+	ErrTooManyLoginAttempts = errors.New("too many failed login attempts")
+)
+
+// LockoutError cho biết đăng nhập bị từ chối tạm thời và thời gian cần chờ.
+// errors.Is(err, ErrAccountLocked) hoặc errors.Is(err, ErrTooManyLoginAttempts) cho biết nguyên nhân.
+type LockoutError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string { return e.Err.Error() }
+func (e *LockoutError) Unwrap() error { return e.Err }
+
+// LockoutService định nghĩa interface cho các phương thức chống dò mật khẩu
+type LockoutService interface {
+	Check(user *models.User, ipAddress string) error
+	RecordFailure(user *models.User, ipAddress string) error
+	RecordSuccess(user *models.User) error
+	Unlock(userID uuid.UUID) error
+}
+
+// lockoutService struct triển khai LockoutService interface
+type lockoutService struct {
+	userRepo         repository.UserRepository
+	loginFailureRepo repository.LoginFailureRepository
+	config           *config.Config
+	logger           *logger.Logger
+}
+
+// NewLockoutService tạo một instance mới của LockoutService
+func NewLockoutService(userRepo repository.UserRepository, loginFailureRepo repository.LoginFailureRepository, config *config.Config, logger *logger.Logger) LockoutService {
+	return &lockoutService{
+		userRepo:         userRepo,
+		loginFailureRepo: loginFailureRepo,
+		config:           config,
+		logger:           logger,
+	}
+}
+
+// Check kiểm tra IP và tài khoản (nếu có) có đang bị chặn đăng nhập không
+func (s *lockoutService) Check(user *models.User, ipAddress string) error {
+	now := time.Now()
+
+	// Giới hạn theo IP trong một cửa sổ thời gian trượt
+	count, oldest, err := s.loginFailureRepo.CountByIP(ipAddress, now.Add(-s.config.LoginIPWindow))
+	if err != nil {
+		return err
+	}
+	if count >= int64(s.config.LoginIPMaxFailures) {
+		return &LockoutError{Err: ErrTooManyLoginAttempts, RetryAfter: oldest.Add(s.config.LoginIPWindow).Sub(now)}
+	}
+
+	if user != nil && user.IsLocked(now) {
+		return &LockoutError{Err: ErrAccountLocked, RetryAfter: user.LockedUntil.Sub(now)}
+	}
+	return nil
+}
+
+// RecordFailure ghi nhận một lần đăng nhập sai. Khi số lần sai liên tiếp của tài khoản đạt ngưỡng,
+// tài khoản bị khóa tạm thời; mỗi lần sai tiếp theo sau đó thời gian khóa tăng gấp đôi.
+func (s *lockoutService) RecordFailure(user *models.User, ipAddress string) error {
+	failure := &models.LoginFailure{IPAddress: ipAddress}
+	if user != nil {
+		failure.UserID = &user.ID
+	}
+	if err := s.loginFailureRepo.Create(failure); err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	attempts, err := s.userRepo.IncrementFailedLogins(user.ID)
+	if err != nil {
+		return err
+	}
+	if attempts < s.config.LoginMaxFailures {
+		return nil
+	}
+
+	lockedUntil := time.Now().Add(s.lockDuration(attempts))
+	s.logger.Infof("Locking user %s until %s after %d failed login attempts", user.ID, lockedUntil.Format(time.RFC3339), attempts)
+	return s.userRepo.SetLockedUntil(user.ID, &lockedUntil)
+}
+
+// RecordSuccess xóa bộ đếm đăng nhập sai sau khi user đăng nhập thành công
+func (s *lockoutService) RecordSuccess(user *models.User) error {
+	if user.FailedLoginAttempts == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	return s.userRepo.ResetFailedLogins(user.ID)
+}
+
+// Unlock mở khóa tài khoản (dùng bởi admin)
+func (s *lockoutService) Unlock(userID uuid.UUID) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	return s.userRepo.ResetFailedLogins(userID)
+}
+
+// lockDuration tính thời gian khóa: LoginLockoutDuration ở lần đạt ngưỡng,
+// gấp đôi sau mỗi lần sai tiếp theo, tối đa LoginLockoutMaxDuration
+func (s *lockoutService) lockDuration(attempts int) time.Duration {
+	duration := s.config.LoginLockoutDuration
+	for i := s.config.LoginMaxFailures; i < attempts; i++ {
+		duration *= 2
+		if duration >= s.config.LoginLockoutMaxDuration {
+			return s.config.LoginLockoutMaxDuration
+		}
+	}
+	return duration
+}
+
+// StartLoginFailureCleanup chạy một goroutine định kỳ xóa các bản ghi đăng nhập thất bại
+// đã nằm ngoài cửa sổ đếm theo IP. Hàm trả về một hàm stop để dừng goroutine khi tắt server.
+func StartLoginFailureCleanup(repo repository.LoginFailureRepository, interval, window time.Duration, logger *logger.Logger) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := repo.DeleteBefore(time.Now().Add(-window))
+				if err != nil {
+					logger.Errorf("Login failure cleanup error: %v", err)
+					continue
+				}
+				if deleted > 0 {
+					logger.Infof("Login failure cleanup removed %d entries", deleted)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
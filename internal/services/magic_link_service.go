@@ -0,0 +1,167 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/keys"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrMagicLinkDisabled = errors.New("magic link login is disabled")
+	ErrInvalidMagicLink  = errors.New("invalid or expired magic link")
+)
+
+// tokenTypeMagicLink là token_type của token trong link đăng nhập
+const tokenTypeMagicLink = "magic_link"
+
+// magicLinkClaims là claims của token trong link đăng nhập. Token được ký nên không cần lưu trong database;
+// jti được đưa vào danh sách thu hồi khi dùng để link chỉ dùng được một lần.
+type magicLinkClaims struct {
+	Email     string `json:"email"`           // Link mất hiệu lực nếu user đổi email sau khi link được gửi
+	NonceHash string `json:"nonce,omitempty"` // SHA-256 của nonce trong cookie của trình duyệt đã yêu cầu link
+	TokenType string `json:"token_type"`
+	jwt.RegisteredClaims
+}
+
+// MagicLinkService định nghĩa interface cho đăng nhập không mật khẩu bằng link gửi qua email
+type MagicLinkService interface {
+	RequestLink(email string) (nonce string, err error)
+	Consume(token, nonce string, client ClientInfo) (*LoginResult, error)
+}
+
+// magicLinkService struct triển khai MagicLinkService interface
+type magicLinkService struct {
+	userRepo        repository.UserRepository
+	identityRepo    repository.UserIdentityRepository
+	revocationStore repository.RevocationStore
+	mailService     MailService
+	authService     AuthService
+	keyring         *keys.Keyring
+	config          *config.Config
+	logger          *logger.Logger
+}
+
+// NewMagicLinkService tạo một instance mới của MagicLinkService
+func NewMagicLinkService(userRepo repository.UserRepository, identityRepo repository.UserIdentityRepository, revocationStore repository.RevocationStore, mailService MailService, authService AuthService, keyring *keys.Keyring, config *config.Config, logger *logger.Logger) MagicLinkService {
+	return &magicLinkService{
+		userRepo:        userRepo,
+		identityRepo:    identityRepo,
+		revocationStore: revocationStore,
+		mailService:     mailService,
+		authService:     authService,
+		keyring:         keyring,
+		config:          config,
+		logger:          logger,
+	}
+}
+
+// RequestLink gửi link đăng nhập tới email và trả về nonce cần lưu trong cookie của trình duyệt đã yêu cầu.
+// Nonce luôn được trả về, kể cả khi email không tồn tại, để không thể dùng chức năng này dò tìm tài khoản.
+func (s *magicLinkService) RequestLink(email string) (string, error) {
+	if !s.config.MagicLinkEnabled {
+		return "", ErrMagicLinkDisabled
+	}
+
+	nonce, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return nonce, nil
+	}
+	// User đến từ LDAP/SAML chỉ đăng nhập qua nguồn đó
+	managed, err := hasManagedIdentity(s.identityRepo, user.ID)
+	if err != nil {
+		return "", err
+	}
+	if managed {
+		return nonce, nil
+	}
+
+	now := time.Now()
+	claims := magicLinkClaims{
+		Email:     user.Email,
+		TokenType: tokenTypeMagicLink,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.String(),
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.config.MagicLinkTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if s.config.MagicLinkBindBrowser {
+		claims.NonceHash = hashToken(nonce)
+	}
+	token, err := s.keyring.Sign(claims)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.mailService.SendMagicLink(user, token); err != nil {
+		return "", err
+	}
+	return nonce, nil
+}
+
+// Consume kiểm tra token trong link và nonce trong cookie, đánh dấu link đã dùng rồi đăng nhập user.
+// Khóa tài khoản và MFA vẫn được áp dụng như đăng nhập bằng mật khẩu.
+func (s *magicLinkService) Consume(token, nonce string, client ClientInfo) (*LoginResult, error) {
+	if !s.config.MagicLinkEnabled {
+		return nil, ErrMagicLinkDisabled
+	}
+
+	var claims magicLinkClaims
+	parsed, err := jwt.ParseWithClaims(token, &claims, s.keyring.KeyFunc)
+	if err != nil || !parsed.Valid || claims.TokenType != tokenTypeMagicLink || claims.ID == "" {
+		return nil, ErrInvalidMagicLink
+	}
+	if claims.NonceHash != "" && subtle.ConstantTimeCompare([]byte(claims.NonceHash), []byte(hashToken(nonce))) != 1 {
+		return nil, ErrInvalidMagicLink
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Email != claims.Email {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// Link chỉ dùng được một lần, kể cả khi được mở đồng thời nhiều lần
+	first, err := s.revocationStore.Consume(claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// Nhận được link qua email cũng chứng minh user sở hữu địa chỉ email
+	if !user.EmailVerified {
+		now := time.Now()
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+		if err := s.userRepo.Update(user); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.authService.LoginWithoutPassword(user, LoginSourceMagicLink, client)
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/Thanhdat-debug/demo_login/pkg/mailer"
+)
+
+// MailService định nghĩa interface cho các email gửi tới người dùng
+type MailService interface {
+	SendVerification(user *models.User, token string) error
+	SendPasswordReset(user *models.User, token string) error
+	SendMagicLink(user *models.User, token string) error
+	SendLoginAlert(user *models.User, session *models.Session) error
+	SendInvitation(email, locale, inviterName, token string, expiresIn time.Duration) error
+}
+
+// mailService struct triển khai MailService interface
+type mailService struct {
+	renderer *mailer.Renderer
+	sender   mailer.Sender
+	config   *config.Config
+	logger   *logger.Logger
+}
+
+// NewMailService tạo một instance mới của MailService
+func NewMailService(renderer *mailer.Renderer, sender mailer.Sender, config *config.Config, logger *logger.Logger) MailService {
+	return &mailService{
+		renderer: renderer,
+		sender:   sender,
+		config:   config,
+		logger:   logger,
+	}
+}
+
+// SendVerification gửi link xác minh email
+func (s *mailService) SendVerification(user *models.User, token string) error {
+	return s.send(mailer.TemplateVerification, user.Locale, user.Email, map[string]interface{}{
+		"Name":      displayName(user),
+		"Link":      s.link("/verify-email", token),
+		"ExpiresIn": s.config.EmailVerificationTTL,
+	})
+}
+
+// SendPasswordReset gửi link đặt lại mật khẩu
+func (s *mailService) SendPasswordReset(user *models.User, token string) error {
+	return s.send(mailer.TemplatePasswordReset, user.Locale, user.Email, map[string]interface{}{
+		"Name":      displayName(user),
+		"Link":      s.link("/reset-password", token),
+		"ExpiresIn": s.config.PasswordResetTTL,
+	})
+}
+
+// SendMagicLink gửi link đăng nhập không cần mật khẩu
+func (s *mailService) SendMagicLink(user *models.User, token string) error {
+	return s.send(mailer.TemplateMagicLink, user.Locale, user.Email, map[string]interface{}{
+		"Name":      displayName(user),
+		"Link":      s.link("/magic-link", token),
+		"ExpiresIn": s.config.MagicLinkTTL,
+	})
+}
+
+// SendLoginAlert thông báo cho user khi tài khoản được đăng nhập từ thiết bị mới
+func (s *mailService) SendLoginAlert(user *models.User, session *models.Session) error {
+	return s.send(mailer.TemplateLoginAlert, user.Locale, user.Email, map[string]interface{}{
+		"Name":      displayName(user),
+		"Time":      session.CreatedAt,
+		"IPAddress": session.IPAddress,
+		"UserAgent": session.UserAgent,
+	})
+}
+
+// SendInvitation gửi lời mời tạo tài khoản
+func (s *mailService) SendInvitation(email, locale, inviterName, token string, expiresIn time.Duration) error {
+	return s.send(mailer.TemplateInvitation, locale, email, map[string]interface{}{
+		"InviterName": inviterName,
+		"Link":        s.link("/accept-invitation", token),
+		"ExpiresIn":   expiresIn,
+	})
+}
+
+// send tạo nội dung email từ template và đưa vào sender (thường là hàng đợi gửi bất đồng bộ)
+func (s *mailService) send(template, locale, to string, data map[string]interface{}) error {
+	msg, err := s.renderer.Render(template, locale, to, data)
+	if err != nil {
+		return err
+	}
+	return s.sender.Send(msg)
+}
+
+// link tạo link tới trang của ứng dụng web kèm token
+func (s *mailService) link(path, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", s.config.AppBaseURL, path, url.QueryEscape(token))
+}
+
+// displayName trả về tên dùng để chào user trong email
+func displayName(user *models.User) string {
+	if user.FirstName != "" {
+		return user.FirstName
+	}
+	return user.Username
+}
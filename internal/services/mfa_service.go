@@ -0,0 +1,232 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/Thanhdat-debug/demo_login/pkg/totp"
+	"github.com/google/uuid"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+	ErrMFANotEnabled     = errors.New("mfa not enabled")
+	ErrMFASetupRequired  = errors.New("mfa setup required")
+	ErrInvalidMFACode    = errors.New("invalid mfa code")
+)
+
+// Số lượng và độ dài mã khôi phục sinh ra khi bật MFA
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+// recoveryCodeAlphabet gồm 32 ký tự (không bị lệch phân phối khi lấy modulo một byte),
+// bỏ các ký tự dễ nhầm lẫn i, l, o, 1
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz023456789"
+
+// TOTPSetup chứa thông tin để người dùng thêm tài khoản vào ứng dụng xác thực
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// MFAService định nghĩa interface cho các phương thức quản lý xác thực hai lớp
+type MFAService interface {
+	SetupTOTP(userID uuid.UUID) (*TOTPSetup, error)
+	ConfirmTOTP(userID uuid.UUID, code string) ([]string, error)
+	DisableTOTP(userID uuid.UUID, code string) error
+	VerifyCode(user *models.User, code string) error
+}
+
+// mfaService struct triển khai MFAService interface
+type mfaService struct {
+	userRepo         repository.UserRepository
+	recoveryCodeRepo repository.RecoveryCodeRepository
+	config           *config.Config
+	logger           *logger.Logger
+}
+
+// NewMFAService tạo một instance mới của MFAService
+func NewMFAService(userRepo repository.UserRepository, recoveryCodeRepo repository.RecoveryCodeRepository, config *config.Config, logger *logger.Logger) MFAService {
+	return &mfaService{
+		userRepo:         userRepo,
+		recoveryCodeRepo: recoveryCodeRepo,
+		config:           config,
+		logger:           logger,
+	}
+}
+
+// SetupTOTP sinh secret TOTP mới cho user. MFA chỉ được bật sau khi ConfirmTOTP thành công.
+func (s *mfaService) SetupTOTP(userID uuid.UUID) (*TOTPSetup, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPSecret = secret
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	return &TOTPSetup{
+		Secret: secret,
+		URI:    totp.URI(s.config.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP kiểm tra mã đầu tiên từ ứng dụng xác thực, bật MFA và trả về bộ mã khôi phục.
+// Mã khôi phục chỉ được trả về duy nhất một lần này.
+func (s *mfaService) ConfirmTOTP(userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFASetupRequired
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	recoveryCodes, err := s.generateRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// DisableTOTP tắt MFA sau khi kiểm tra mã TOTP hoặc mã khôi phục
+func (s *mfaService) DisableTOTP(userID uuid.UUID, code string) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	if !user.TOTPEnabled {
+		return ErrMFANotEnabled
+	}
+
+	if err := s.VerifyCode(user, code); err != nil {
+		return err
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+	return s.recoveryCodeRepo.DeleteByUser(user.ID)
+}
+
+// VerifyCode kiểm tra mã TOTP (mỗi mã chỉ dùng được một lần) hoặc mã khôi phục của user
+func (s *mfaService) VerifyCode(user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrMFANotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := totp.Validate(user.TOTPSecret, code, time.Now()); ok {
+		fresh, err := s.userRepo.UpdateTOTPLastStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidMFACode
+		}
+		user.TOTPLastStep = step
+		return nil
+	}
+
+	// Không phải mã TOTP, thử như mã khôi phục
+	consumed, err := s.recoveryCodeRepo.Consume(user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrInvalidMFACode
+	}
+	s.logger.Infof("Recovery code used by user %s", user.ID)
+	return nil
+}
+
+// generateRecoveryCodes sinh bộ mã khôi phục mới, lưu hash và trả về các mã gốc
+func (s *mfaService) generateRecoveryCodes(userID uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+
+	for i := range codes {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		records[i] = models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: hashToken(normalizeRecoveryCode(code)),
+		}
+	}
+
+	if err := s.recoveryCodeRepo.ReplaceForUser(userID, records); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// randomRecoveryCode sinh một mã khôi phục dạng "xxxxx-xxxxx"
+func randomRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for i, v := range b {
+		if i == recoveryCodeLength/2 {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(recoveryCodeAlphabet[int(v)%len(recoveryCodeAlphabet)])
+	}
+	return sb.String(), nil
+}
+
+// normalizeRecoveryCode bỏ dấu gạch và khoảng trắng, chuyển về chữ thường trước khi hash
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	ErrInvalidClient       = errors.New("invalid client credentials")
+	ErrInvalidRedirectURI  = errors.New("invalid redirect uri")
+	ErrInvalidGrantType    = errors.New("invalid grant type")
+)
+
+// OAuthClientService định nghĩa interface cho các phương thức quản lý OAuth client
+type OAuthClientService interface {
+	CreateClient(name string, redirectURIs, grantTypes, scopes []string, public bool) (*models.OAuthClientResponse, string, error)
+	ListClients() ([]models.OAuthClientResponse, error)
+	DeleteClient(clientID string) error
+	GetClient(clientID string) (*models.OAuthClient, error)
+	AuthenticateClient(clientID, clientSecret string) (*models.OAuthClient, error)
+}
+
+// oauthClientService struct triển khai OAuthClientService interface
+type oauthClientService struct {
+	clientRepo repository.OAuthClientRepository
+	logger     *logger.Logger
+}
+
+// NewOAuthClientService tạo một instance mới của OAuthClientService
+func NewOAuthClientService(clientRepo repository.OAuthClientRepository, logger *logger.Logger) OAuthClientService {
+	return &oauthClientService{
+		clientRepo: clientRepo,
+		logger:     logger,
+	}
+}
+
+// CreateClient đăng ký client mới. Client confidential nhận client secret, secret chỉ được trả về một lần tại đây.
+// Mặc định client dùng authorization_code và refresh_token.
+func (s *oauthClientService) CreateClient(name string, redirectURIs, grantTypes, scopes []string, public bool) (*models.OAuthClientResponse, string, error) {
+	if len(grantTypes) == 0 {
+		grantTypes = []string{models.GrantTypeAuthorizationCode, models.GrantTypeRefreshToken}
+	}
+	for _, grantType := range grantTypes {
+		switch grantType {
+		case models.GrantTypeAuthorizationCode, models.GrantTypeRefreshToken:
+		case models.GrantTypeClientCredentials:
+			// Client public không giữ được secret nên không thể tự xác thực
+			if public {
+				return nil, "", ErrInvalidGrantType
+			}
+		default:
+			return nil, "", ErrInvalidGrantType
+		}
+	}
+
+	for _, uri := range redirectURIs {
+		if !validRedirectURI(uri) {
+			return nil, "", ErrInvalidRedirectURI
+		}
+	}
+	if containsString(grantTypes, models.GrantTypeAuthorizationCode) && len(redirectURIs) == 0 {
+		return nil, "", ErrInvalidRedirectURI
+	}
+
+	for _, scope := range scopes {
+		if !validScopeToken(scope) {
+			return nil, "", ErrInvalidScope
+		}
+	}
+
+	clientID, err := generateClientID()
+	if err != nil {
+		return nil, "", err
+	}
+	client := &models.OAuthClient{
+		ClientID:     clientID,
+		Name:         name,
+		RedirectURIs: strings.Join(redirectURIs, "\n"),
+		GrantTypes:   strings.Join(grantTypes, " "),
+		Scopes:       strings.Join(scopes, " "),
+		Public:       public,
+	}
+
+	var secret string
+	if !public {
+		secret, err = generateOpaqueToken()
+		if err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = hashToken(secret)
+	}
+
+	if err := s.clientRepo.Create(client); err != nil {
+		return nil, "", err
+	}
+
+	response := client.ToOAuthClientResponse()
+	return &response, secret, nil
+}
+
+// ListClients lấy danh sách client đã đăng ký
+func (s *oauthClientService) ListClients() ([]models.OAuthClientResponse, error) {
+	clients, err := s.clientRepo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.OAuthClientResponse, len(clients))
+	for i, client := range clients {
+		responses[i] = client.ToOAuthClientResponse()
+	}
+	return responses, nil
+}
+
+// DeleteClient xóa client theo client_id
+func (s *oauthClientService) DeleteClient(clientID string) error {
+	client, err := s.clientRepo.FindByClientID(clientID)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return ErrOAuthClientNotFound
+	}
+	return s.clientRepo.Delete(clientID)
+}
+
+// GetClient tìm client theo client_id
+func (s *oauthClientService) GetClient(clientID string) (*models.OAuthClient, error) {
+	client, err := s.clientRepo.FindByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, ErrOAuthClientNotFound
+	}
+	return client, nil
+}
+
+// AuthenticateClient xác thực client bằng client_id và client_secret.
+// Client public chỉ cần client_id và không được gửi secret.
+func (s *oauthClientService) AuthenticateClient(clientID, clientSecret string) (*models.OAuthClient, error) {
+	if clientID == "" {
+		return nil, ErrInvalidClient
+	}
+	client, err := s.clientRepo.FindByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, ErrInvalidClient
+	}
+
+	if client.Public {
+		if clientSecret != "" {
+			return nil, ErrInvalidClient
+		}
+		return client, nil
+	}
+	if clientSecret == "" || subtle.ConstantTimeCompare([]byte(hashToken(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// generateClientID sinh client_id ngẫu nhiên (16 byte, mã hóa hex)
+func generateClientID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validRedirectURI kiểm tra redirect URI được phép đăng ký: URI tuyệt đối, không có fragment;
+// http chỉ dùng cho địa chỉ loopback, scheme riêng của ứng dụng native phải có dạng tên miền đảo ngược (RFC 8252)
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" || strings.Contains(uri, "#") {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	default:
+		return strings.Contains(u.Scheme, ".")
+	}
+}
+
+// validScopeToken kiểm tra scope chỉ gồm các ký tự được phép theo RFC 6749 mục 3.3
+func validScopeToken(scope string) bool {
+	if scope == "" {
+		return false
+	}
+	for _, r := range scope {
+		if r < 0x21 || r > 0x7E || r == '"' || r == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// containsString kiểm tra slice có chứa chuỗi s không
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// removeString trả về slice mới không còn chuỗi s
+func removeString(items []string, s string) []string {
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
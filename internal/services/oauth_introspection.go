@@ -0,0 +1,182 @@
+package services
+
+import (
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Các giá trị của tham số token_type_hint (RFC 7009 mục 2.1)
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// IntrospectionResponse là response của /oauth/introspect (RFC 7662 mục 2.2).
+// Token không hợp lệ, hết hạn hoặc đã bị thu hồi chỉ có active = false.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+// inactiveToken là response cho mọi token không còn hiệu lực, không tiết lộ lý do
+var inactiveToken = &IntrospectionResponse{Active: false}
+
+// Introspect trả về trạng thái và thông tin của token cho client confidential (thường là resource server).
+// Access token (của service này hoặc cấp cho OAuth client) được kiểm tra với mọi client;
+// refresh token chỉ được kiểm tra bởi chính client được cấp.
+func (s *oauthService) Introspect(client *models.OAuthClient, token, tokenTypeHint string) (*IntrospectionResponse, error) {
+	if client.Public {
+		return nil, newOAuthError(OAuthErrUnauthorizedClient, "public clients cannot introspect tokens")
+	}
+	if token == "" {
+		return nil, newOAuthError(OAuthErrInvalidRequest, "token is required")
+	}
+
+	lookups := []func(*models.OAuthClient, string) (*IntrospectionResponse, error){s.introspectAccessToken, s.introspectRefreshToken}
+	if tokenTypeHint == TokenTypeHintRefreshToken {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+	for _, lookup := range lookups {
+		response, err := lookup(client, token)
+		if err != nil || response != nil {
+			return response, err
+		}
+	}
+	return inactiveToken, nil
+}
+
+// introspectAccessToken kiểm tra token là access token JWT; trả về nil nếu không phải
+func (s *oauthService) introspectAccessToken(client *models.OAuthClient, token string) (*IntrospectionResponse, error) {
+	var claims Claims
+	parsed, err := jwt.ParseWithClaims(token, &claims, s.keyring.KeyFunc)
+	if err != nil || !parsed.Valid {
+		return nil, nil
+	}
+
+	switch claims.TokenType {
+	case TokenTypeAccess:
+		revoked, err := s.authService.IsTokenRevoked(&claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return inactiveToken, nil
+		}
+		return accessTokenIntrospection(&claims, claims.UserID), nil
+	case TokenTypeOAuthAccess:
+		if claims.Issuer != s.config.OAuthIssuer {
+			return inactiveToken, nil
+		}
+		revoked, err := s.isAccessTokenRevoked(&claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return inactiveToken, nil
+		}
+		return accessTokenIntrospection(&claims, claims.Subject), nil
+	default:
+		// MFA token, token đổi mật khẩu... không phải access token
+		return inactiveToken, nil
+	}
+}
+
+// introspectRefreshToken kiểm tra token là refresh token cấp cho client; trả về nil nếu không tìm thấy
+func (s *oauthService) introspectRefreshToken(client *models.OAuthClient, token string) (*IntrospectionResponse, error) {
+	stored, err := s.refreshTokenRepo.FindByHash(hashToken(token))
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	if stored.ClientID != client.ClientID || stored.IsRevoked() || stored.IsExpired() {
+		return inactiveToken, nil
+	}
+
+	user, err := s.userRepo.FindByID(stored.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return inactiveToken, nil
+	}
+
+	return &IntrospectionResponse{
+		Active:   true,
+		Scope:    stored.Scope,
+		ClientID: stored.ClientID,
+		Exp:      stored.ExpiresAt.Unix(),
+		Iat:      stored.CreatedAt.Unix(),
+		Sub:      user.ID.String(),
+		Iss:      s.config.OAuthIssuer,
+		Role:     user.Role,
+	}, nil
+}
+
+// accessTokenIntrospection tạo response cho access token còn hiệu lực
+func accessTokenIntrospection(claims *Claims, subject string) *IntrospectionResponse {
+	response := &IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		TokenType: "Bearer",
+		Sub:       subject,
+		Iss:       claims.Issuer,
+		Jti:       claims.ID,
+		Role:      claims.Role,
+	}
+	if claims.ExpiresAt != nil {
+		response.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		response.Iat = claims.IssuedAt.Unix()
+	}
+	return response
+}
+
+// Revoke thu hồi access token hoặc refresh token của client (RFC 7009). Token không hợp lệ
+// hoặc đã hết hạn được bỏ qua; token cấp cho client khác bị từ chối.
+// Thu hồi refresh token sẽ thu hồi cả chuỗi refresh token của lần cấp quyền đó.
+func (s *oauthService) Revoke(client *models.OAuthClient, token, tokenTypeHint string) error {
+	if token == "" {
+		return newOAuthError(OAuthErrInvalidRequest, "token is required")
+	}
+
+	if tokenTypeHint != TokenTypeHintAccessToken {
+		stored, err := s.refreshTokenRepo.FindByHash(hashToken(token))
+		if err != nil {
+			return err
+		}
+		if stored != nil {
+			if stored.ClientID != client.ClientID {
+				return newOAuthError(OAuthErrUnauthorizedClient, "the token was not issued to this client")
+			}
+			return s.refreshTokenRepo.RevokeFamily(stored.FamilyID)
+		}
+	}
+
+	// Access token phải được kiểm tra chữ ký trước khi ghi jti vào danh sách thu hồi
+	var claims Claims
+	parsed, err := jwt.ParseWithClaims(token, &claims, s.keyring.KeyFunc)
+	if err != nil || !parsed.Valid || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	if claims.TokenType != TokenTypeOAuthAccess || claims.ClientID != client.ClientID {
+		return newOAuthError(OAuthErrUnauthorizedClient, "the token was not issued to this client")
+	}
+	return s.revocationStore.Revoke(claims.ID, claims.ExpiresAt.Time)
+}
+
+// isAccessTokenRevoked kiểm tra access token cấp cho OAuth client đã bị thu hồi qua /oauth/revoke chưa
+func (s *oauthService) isAccessTokenRevoked(claims *Claims) (bool, error) {
+	if claims.ID == "" {
+		return true, nil
+	}
+	return s.revocationStore.IsRevoked(claims.ID)
+}
@@ -0,0 +1,725 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/keys"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Mã lỗi OAuth 2.0 (RFC 6749 mục 4.1.2.1 và 5.2)
+const (
+	OAuthErrInvalidRequest          = "invalid_request"
+	OAuthErrInvalidClient           = "invalid_client"
+	OAuthErrInvalidGrant            = "invalid_grant"
+	OAuthErrUnauthorizedClient      = "unauthorized_client"
+	OAuthErrUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthErrUnsupportedResponseType = "unsupported_response_type"
+	OAuthErrInvalidScope            = "invalid_scope"
+	OAuthErrAccessDenied            = "access_denied"
+	OAuthErrLoginRequired           = "login_required"   // OpenID Connect, prompt=none
+	OAuthErrConsentRequired         = "consent_required" // OpenID Connect, prompt=none
+)
+
+// OAuthError là lỗi trả về cho client theo định dạng của OAuth 2.0
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// newOAuthError tạo OAuthError với mã lỗi và mô tả
+func newOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// Định nghĩa các lỗi
+var (
+	ErrInvalidAuthorizeRequest = errors.New("invalid or expired authorization request")
+)
+
+// Các loại token của authorization server, ghi trong claim token_type
+const (
+	tokenTypeOAuthSession   = "oauth_session"   // Cookie phiên đăng nhập trên trang /oauth/authorize
+	tokenTypeOAuthAuthorize = "oauth_authorize" // Tham số của authorization request được ký, gửi kèm form đăng nhập/consent
+)
+
+// authorizeRequestTTL là thời gian user có để đăng nhập và đồng ý trên trang /oauth/authorize
+const authorizeRequestTTL = 10 * time.Minute
+
+// codeChallengeMethodS256 là phương thức PKCE duy nhất được hỗ trợ
+const codeChallengeMethodS256 = "S256"
+
+// Các giá trị của tham số prompt (OpenID Connect Core mục 3.1.2.1)
+const (
+	PromptNone    = "none"
+	PromptLogin   = "login"
+	PromptConsent = "consent"
+)
+
+// AuthorizeRequest là các tham số của authorization request (RFC 6749 mục 4.1.1, RFC 7636, OpenID Connect Core mục 3.1.2.1)
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state,omitempty"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Nonce               string `json:"nonce,omitempty"`
+	Prompt              string `json:"prompt,omitempty"`
+	MaxAge              string `json:"max_age,omitempty"` // Số giây tối đa kể từ lần xác thực gần nhất
+}
+
+// HasPrompt kiểm tra request có giá trị prompt cho trước không
+func (r *AuthorizeRequest) HasPrompt(value string) bool {
+	return containsString(strings.Fields(r.Prompt), value)
+}
+
+// authorizeRequestClaims là claims của token chứa authorization request đang chờ user đăng nhập/đồng ý
+type authorizeRequestClaims struct {
+	AuthorizeRequest
+	SessionID string `json:"sid,omitempty"` // Session được phép đồng ý cho request này (chống CSRF ở form consent)
+	TokenType string `json:"token_type"`
+	jwt.RegisteredClaims
+}
+
+// OAuthSession là phiên đăng nhập của user trên authorization server
+type OAuthSession struct {
+	User      *models.User
+	SessionID uuid.UUID
+	AuthTime  time.Time
+}
+
+// TokenRequest là các tham số gửi tới /oauth/token
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+}
+
+// OAuthTokenResponse là response thành công của /oauth/token (RFC 6749 mục 5.1)
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// OAuthService định nghĩa interface cho authorization endpoint và token endpoint của OAuth 2.0
+type OAuthService interface {
+	ValidateAuthorizeRequest(req *AuthorizeRequest) (*models.OAuthClient, error)
+	EncodeAuthorizeRequest(req *AuthorizeRequest, sessionID uuid.UUID) (string, error)
+	DecodeAuthorizeRequest(token string) (*AuthorizeRequest, uuid.UUID, error)
+	CreateSession(userID, sessionID uuid.UUID) (string, error)
+	GetSession(sessionToken string) (*OAuthSession, error)
+	RequiresLogin(req *AuthorizeRequest, session *OAuthSession) bool
+	NeedsConsent(userID uuid.UUID, req *AuthorizeRequest) (bool, error)
+	Authorize(req *AuthorizeRequest, session *OAuthSession, consented bool) (string, error)
+	ErrorRedirect(req *AuthorizeRequest, oauthErr *OAuthError) string
+	Token(client *models.OAuthClient, req TokenRequest) (*OAuthTokenResponse, error)
+	UserInfo(accessToken string) (*UserInfo, error)
+	Introspect(client *models.OAuthClient, token, tokenTypeHint string) (*IntrospectionResponse, error)
+	Revoke(client *models.OAuthClient, token, tokenTypeHint string) error
+	Discovery() (*DiscoveryDocument, error)
+}
+
+// oauthService struct triển khai OAuthService interface
+type oauthService struct {
+	clientService    OAuthClientService
+	codeRepo         repository.OAuthCodeRepository
+	consentRepo      repository.OAuthConsentRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	userRepo         repository.UserRepository
+	revocationStore  repository.RevocationStore
+	sessionService   SessionService
+	authService      AuthService
+	keyring          *keys.Keyring
+	config           *config.Config
+	logger           *logger.Logger
+}
+
+// NewOAuthService tạo một instance mới của OAuthService
+func NewOAuthService(clientService OAuthClientService, codeRepo repository.OAuthCodeRepository, consentRepo repository.OAuthConsentRepository, refreshTokenRepo repository.RefreshTokenRepository, userRepo repository.UserRepository, revocationStore repository.RevocationStore, sessionService SessionService, authService AuthService, keyring *keys.Keyring, config *config.Config, logger *logger.Logger) OAuthService {
+	return &oauthService{
+		clientService:    clientService,
+		codeRepo:         codeRepo,
+		consentRepo:      consentRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		userRepo:         userRepo,
+		revocationStore:  revocationStore,
+		sessionService:   sessionService,
+		authService:      authService,
+		keyring:          keyring,
+		config:           config,
+		logger:           logger,
+	}
+}
+
+// ValidateAuthorizeRequest kiểm tra authorization request và chuẩn hóa scope (rỗng = mọi scope của client).
+// Trả về ErrOAuthClientNotFound hoặc ErrInvalidRedirectURI khi không thể redirect về client một cách an toàn;
+// các lỗi khác là *OAuthError và được gửi về redirect_uri.
+func (s *oauthService) ValidateAuthorizeRequest(req *AuthorizeRequest) (*models.OAuthClient, error) {
+	client, err := s.clientService.GetClient(req.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	// redirect_uri bắt buộc và phải trùng khớp chính xác với một URI đã đăng ký
+	if req.RedirectURI == "" || !client.HasRedirectURI(req.RedirectURI) {
+		return nil, ErrInvalidRedirectURI
+	}
+
+	if req.ResponseType != "code" {
+		return nil, newOAuthError(OAuthErrUnsupportedResponseType, "only response_type=code is supported")
+	}
+	if !client.AllowsGrantType(models.GrantTypeAuthorizationCode) {
+		return nil, newOAuthError(OAuthErrUnauthorizedClient, "client is not allowed to use the authorization code grant")
+	}
+
+	scopes, err := s.resolveScopes(client, req.Scope, client.ScopeList())
+	if err != nil {
+		return nil, err
+	}
+	// Không cấp được ID token: bỏ openid khỏi scope mặc định, từ chối nếu client yêu cầu rõ ràng
+	if req.Scope == "" && !s.oidcAvailable() {
+		scopes = removeString(scopes, OIDCScopeOpenID)
+	}
+	req.Scope = strings.Join(scopes, " ")
+	if err := s.checkOIDCScope(req.Scope); err != nil {
+		return nil, err
+	}
+
+	if req.CodeChallenge == "" {
+		return nil, newOAuthError(OAuthErrInvalidRequest, "code_challenge is required")
+	}
+	if req.CodeChallengeMethod != codeChallengeMethodS256 {
+		return nil, newOAuthError(OAuthErrInvalidRequest, "code_challenge_method must be S256")
+	}
+	if len(req.CodeChallenge) != 43 {
+		return nil, newOAuthError(OAuthErrInvalidRequest, "invalid code_challenge")
+	}
+
+	if err := validateOIDCParams(req); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// EncodeAuthorizeRequest ký authorization request để gửi kèm form đăng nhập/consent.
+// sessionID khác uuid.Nil giới hạn việc đồng ý chỉ cho phiên đăng nhập đó.
+func (s *oauthService) EncodeAuthorizeRequest(req *AuthorizeRequest, sessionID uuid.UUID) (string, error) {
+	now := time.Now()
+	claims := authorizeRequestClaims{
+		AuthorizeRequest: *req,
+		TokenType:        tokenTypeOAuthAuthorize,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(authorizeRequestTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
+	}
+	return s.keyring.Sign(claims)
+}
+
+// DecodeAuthorizeRequest kiểm tra chữ ký và lấy lại authorization request từ form
+func (s *oauthService) DecodeAuthorizeRequest(token string) (*AuthorizeRequest, uuid.UUID, error) {
+	var claims authorizeRequestClaims
+	parsed, err := jwt.ParseWithClaims(token, &claims, s.keyring.KeyFunc)
+	if err != nil || !parsed.Valid || claims.TokenType != tokenTypeOAuthAuthorize {
+		return nil, uuid.Nil, ErrInvalidAuthorizeRequest
+	}
+
+	sessionID := uuid.Nil
+	if claims.SessionID != "" {
+		if sessionID, err = uuid.Parse(claims.SessionID); err != nil {
+			return nil, uuid.Nil, ErrInvalidAuthorizeRequest
+		}
+	}
+	return &claims.AuthorizeRequest, sessionID, nil
+}
+
+// CreateSession tạo giá trị cookie phiên đăng nhập trên authorization server cho session vừa mở
+func (s *oauthService) CreateSession(userID, sessionID uuid.UUID) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		UserID:    userID.String(),
+		TokenType: tokenTypeOAuthSession,
+		SessionID: sessionID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.config.OAuthSessionTTL)),
+			IssuedAt:  jwt.NewNumericDate(now), // Thời điểm xác thực (auth_time)
+		},
+	}
+	return s.keyring.Sign(claims)
+}
+
+// GetSession kiểm tra cookie phiên đăng nhập. Trả về nil nếu cookie không hợp lệ,
+// hết hạn, hoặc session tương ứng đã bị đăng xuất.
+func (s *oauthService) GetSession(sessionToken string) (*OAuthSession, error) {
+	if sessionToken == "" {
+		return nil, nil
+	}
+	var claims Claims
+	parsed, err := jwt.ParseWithClaims(sessionToken, &claims, s.keyring.KeyFunc)
+	if err != nil || !parsed.Valid || claims.TokenType != tokenTypeOAuthSession || claims.IssuedAt == nil {
+		return nil, nil
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil, nil
+	}
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return nil, nil
+	}
+
+	active, err := s.sessionService.CheckSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, nil
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, nil
+	}
+	return &OAuthSession{User: user, SessionID: sessionID, AuthTime: claims.IssuedAt.Time}, nil
+}
+
+// RequiresLogin kiểm tra user có phải đăng nhập lại dù đang có phiên: prompt=login,
+// hoặc lần xác thực gần nhất đã quá max_age
+func (s *oauthService) RequiresLogin(req *AuthorizeRequest, session *OAuthSession) bool {
+	if req.HasPrompt(PromptLogin) {
+		return true
+	}
+	if req.MaxAge == "" {
+		return false
+	}
+	maxAge, _ := strconv.ParseInt(req.MaxAge, 10, 64) // Đã được kiểm tra trong ValidateAuthorizeRequest
+	return time.Since(session.AuthTime) > time.Duration(maxAge)*time.Second
+}
+
+// NeedsConsent kiểm tra user đã đồng ý cấp các scope của request cho client chưa; prompt=consent luôn yêu cầu đồng ý lại
+func (s *oauthService) NeedsConsent(userID uuid.UUID, req *AuthorizeRequest) (bool, error) {
+	if req.HasPrompt(PromptConsent) {
+		return true, nil
+	}
+	consent, err := s.consentRepo.Find(userID, req.ClientID)
+	if err != nil {
+		return false, err
+	}
+	return consent == nil || !consent.Covers(strings.Fields(req.Scope)), nil
+}
+
+// Authorize cấp authorization code cho request đã được user đồng ý và trả về URL redirect về client.
+// consented = true nghĩa là user vừa đồng ý trên trang consent, các scope được ghi nhớ cho lần sau.
+func (s *oauthService) Authorize(req *AuthorizeRequest, session *OAuthSession, consented bool) (string, error) {
+	if consented {
+		scopes := strings.Fields(req.Scope)
+		existing, err := s.consentRepo.Find(session.User.ID, req.ClientID)
+		if err != nil {
+			return "", err
+		}
+		if existing != nil {
+			for _, scope := range strings.Fields(existing.Scope) {
+				if !containsString(scopes, scope) {
+					scopes = append(scopes, scope)
+				}
+			}
+		}
+		consent := &models.OAuthConsent{UserID: session.User.ID, ClientID: req.ClientID, Scope: strings.Join(scopes, " ")}
+		if err := s.consentRepo.Save(consent); err != nil {
+			return "", err
+		}
+	}
+
+	code, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	record := &models.OAuthAuthorizationCode{
+		CodeHash:            hashToken(code),
+		ClientID:            req.ClientID,
+		UserID:              session.User.ID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		AuthTime:            session.AuthTime,
+		Nonce:               req.Nonce,
+		ExpiresAt:           time.Now().Add(s.config.OAuthCodeTTL),
+	}
+	if err := s.codeRepo.Create(record); err != nil {
+		return "", err
+	}
+
+	return s.redirectURL(req, url.Values{"code": {code}}), nil
+}
+
+// ErrorRedirect trả về URL redirect về client kèm lỗi (RFC 6749 mục 4.1.2.1)
+func (s *oauthService) ErrorRedirect(req *AuthorizeRequest, oauthErr *OAuthError) string {
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	return s.redirectURL(req, params)
+}
+
+// redirectURL thêm params, state và iss (RFC 9207) vào redirect_uri của request
+func (s *oauthService) redirectURL(req *AuthorizeRequest, params url.Values) string {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return req.RedirectURI
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("iss", s.config.OAuthIssuer)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Token xử lý token request của client đã được xác thực
+func (s *oauthService) Token(client *models.OAuthClient, req TokenRequest) (*OAuthTokenResponse, error) {
+	switch req.GrantType {
+	case models.GrantTypeAuthorizationCode:
+		return s.exchangeCode(client, req)
+	case models.GrantTypeRefreshToken:
+		return s.refresh(client, req)
+	case models.GrantTypeClientCredentials:
+		return s.clientCredentials(client, req)
+	case "":
+		return nil, newOAuthError(OAuthErrInvalidRequest, "grant_type is required")
+	default:
+		return nil, newOAuthError(OAuthErrUnsupportedGrantType, "unsupported grant_type")
+	}
+}
+
+// exchangeCode đổi authorization code lấy token (RFC 6749 mục 4.1.3), kiểm tra PKCE (RFC 7636)
+func (s *oauthService) exchangeCode(client *models.OAuthClient, req TokenRequest) (*OAuthTokenResponse, error) {
+	if !client.AllowsGrantType(models.GrantTypeAuthorizationCode) {
+		return nil, newOAuthError(OAuthErrUnauthorizedClient, "client is not allowed to use the authorization code grant")
+	}
+	if req.Code == "" || req.RedirectURI == "" || req.CodeVerifier == "" {
+		return nil, newOAuthError(OAuthErrInvalidRequest, "code, redirect_uri and code_verifier are required")
+	}
+
+	code, err := s.codeRepo.Consume(hashToken(req.Code))
+	if errors.Is(err, repository.ErrCodeAlreadyUsed) {
+		// Code bị dùng lại: thu hồi các token đã cấp từ code này (RFC 6749 mục 4.1.2)
+		if code.FamilyID != nil {
+			if err := s.refreshTokenRepo.RevokeFamily(*code.FamilyID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, newOAuthError(OAuthErrInvalidGrant, "authorization code already used")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if code == nil || code.ClientID != client.ClientID || code.RedirectURI != req.RedirectURI {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "invalid authorization code")
+	}
+	if !verifyCodeChallenge(req.CodeVerifier, code.CodeChallenge) {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "invalid code_verifier")
+	}
+
+	user, err := s.userRepo.FindByID(code.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "invalid authorization code")
+	}
+	// Khóa ký có thể đã được đổi sang HMAC sau khi code được cấp
+	if err := s.checkOIDCScope(code.Scope); err != nil {
+		return nil, err
+	}
+
+	response, familyID, err := s.issueTokens(client, user, code.Scope, uuid.Nil)
+	if err != nil {
+		return nil, err
+	}
+	if hasScope(code.Scope, OIDCScopeOpenID) {
+		authTime := code.AuthTime
+		if response.IDToken, err = s.generateIDToken(client, user, code.Scope, code.Nonce, &authTime, response.AccessToken); err != nil {
+			return nil, err
+		}
+	}
+	if familyID != uuid.Nil {
+		if err := s.codeRepo.SetFamily(code.ID, familyID); err != nil {
+			s.logger.Errorf("Failed to record token family of authorization code %s: %v", code.ID, err)
+		}
+	}
+	return response, nil
+}
+
+// refresh đổi refresh token của client lấy token mới (RFC 6749 mục 6), xoay vòng refresh token
+func (s *oauthService) refresh(client *models.OAuthClient, req TokenRequest) (*OAuthTokenResponse, error) {
+	if !client.AllowsGrantType(models.GrantTypeRefreshToken) {
+		return nil, newOAuthError(OAuthErrUnauthorizedClient, "client is not allowed to use the refresh token grant")
+	}
+	if req.RefreshToken == "" {
+		return nil, newOAuthError(OAuthErrInvalidRequest, "refresh_token is required")
+	}
+
+	stored, err := s.refreshTokenRepo.FindByHash(hashToken(req.RefreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.ClientID != client.ClientID {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "invalid refresh token")
+	}
+	if stored.ReplacedByID != nil {
+		s.logger.Errorf("OAuth refresh token reuse detected for client %s, revoking family %s", client.ClientID, stored.FamilyID)
+		if err := s.refreshTokenRepo.RevokeFamily(stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, newOAuthError(OAuthErrInvalidGrant, "refresh token already used")
+	}
+	if stored.IsRevoked() || stored.IsExpired() {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "invalid refresh token")
+	}
+
+	// Scope mới không được rộng hơn scope đã được cấp
+	granted := strings.Fields(stored.Scope)
+	scope := stored.Scope
+	if req.Scope != "" {
+		for _, requested := range strings.Fields(req.Scope) {
+			if !containsString(granted, requested) {
+				return nil, newOAuthError(OAuthErrInvalidScope, "requested scope exceeds the granted scope")
+			}
+		}
+		scope = strings.Join(strings.Fields(req.Scope), " ")
+	}
+	if err := s.checkOIDCScope(scope); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(stored.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, newOAuthError(OAuthErrInvalidGrant, "invalid refresh token")
+	}
+
+	rawToken, newToken, err := s.newRefreshToken(client, user, stored.Scope, stored.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.refreshTokenRepo.Rotate(stored, newToken); err != nil {
+		if errors.Is(err, repository.ErrTokenAlreadyRotated) {
+			if err := s.refreshTokenRepo.RevokeFamily(stored.FamilyID); err != nil {
+				return nil, err
+			}
+			return nil, newOAuthError(OAuthErrInvalidGrant, "refresh token already used")
+		}
+		return nil, err
+	}
+
+	accessToken, err := s.generateAccessToken(client, user, scope)
+	if err != nil {
+		return nil, err
+	}
+	response := &OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.config.OAuthAccessTokenTTL.Seconds()),
+		RefreshToken: rawToken,
+		Scope:        scope,
+	}
+	// ID token cấp lại khi refresh không có nonce và auth_time (OpenID Connect Core mục 12.2)
+	if hasScope(scope, OIDCScopeOpenID) {
+		if response.IDToken, err = s.generateIDToken(client, user, scope, "", nil, accessToken); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// clientCredentials cấp access token cho chính client (RFC 6749 mục 4.4), không có refresh token
+func (s *oauthService) clientCredentials(client *models.OAuthClient, req TokenRequest) (*OAuthTokenResponse, error) {
+	if client.Public || !client.AllowsGrantType(models.GrantTypeClientCredentials) {
+		return nil, newOAuthError(OAuthErrUnauthorizedClient, "client is not allowed to use the client credentials grant")
+	}
+
+	scopes, err := s.resolveScopes(client, req.Scope, client.ScopeList())
+	if err != nil {
+		return nil, err
+	}
+	scope := strings.Join(scopes, " ")
+
+	accessToken, err := s.generateAccessToken(client, nil, scope)
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.config.OAuthAccessTokenTTL.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// resolveScopes kiểm tra các scope được yêu cầu đều được phép với client; rỗng thì dùng defaults
+func (s *oauthService) resolveScopes(client *models.OAuthClient, requested string, defaults []string) ([]string, error) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return defaults, nil
+	}
+
+	var result []string
+	for _, scope := range scopes {
+		if !client.AllowsScope(scope) {
+			return nil, newOAuthError(OAuthErrInvalidScope, "scope "+scope+" is not allowed for this client")
+		}
+		if !containsString(result, scope) {
+			result = append(result, scope)
+		}
+	}
+	return result, nil
+}
+
+// issueTokens cấp access token và (nếu client dùng refresh_token) refresh token trong family mới,
+// trả về kèm family để liên kết với authorization code
+func (s *oauthService) issueTokens(client *models.OAuthClient, user *models.User, scope string, familyID uuid.UUID) (*OAuthTokenResponse, uuid.UUID, error) {
+	accessToken, err := s.generateAccessToken(client, user, scope)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	response := &OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.config.OAuthAccessTokenTTL.Seconds()),
+		Scope:       scope,
+	}
+
+	if !client.AllowsGrantType(models.GrantTypeRefreshToken) {
+		return response, uuid.Nil, nil
+	}
+	if familyID == uuid.Nil {
+		familyID = uuid.New()
+	}
+	rawToken, refreshToken, err := s.newRefreshToken(client, user, scope, familyID)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	if err := s.refreshTokenRepo.Create(refreshToken); err != nil {
+		return nil, uuid.Nil, err
+	}
+	response.RefreshToken = rawToken
+	return response, familyID, nil
+}
+
+// generateAccessToken tạo access token cho client; user = nil với client_credentials (sub là client_id)
+func (s *oauthService) generateAccessToken(client *models.OAuthClient, user *models.User, scope string) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		TokenType: TokenTypeOAuthAccess,
+		ClientID:  client.ClientID,
+		Scope:     scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    s.config.OAuthIssuer,
+			Subject:   client.ClientID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.config.OAuthAccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+	if user != nil {
+		claims.UserID = user.ID.String()
+		claims.Role = user.Role
+		claims.Subject = user.ID.String()
+	}
+	return s.keyring.Sign(claims)
+}
+
+// newRefreshToken sinh refresh token cho client, trả về giá trị gốc và bản ghi chỉ chứa hash
+func (s *oauthService) newRefreshToken(client *models.OAuthClient, user *models.User, scope string, familyID uuid.UUID) (string, *models.RefreshToken, error) {
+	rawToken, err := generateOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return rawToken, &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(rawToken),
+		ExpiresAt: time.Now().Add(s.config.OAuthRefreshTokenTTL),
+		ClientID:  client.ClientID,
+		Scope:     scope,
+	}, nil
+}
+
+// verifyCodeChallenge kiểm tra code_verifier với code_challenge theo phương thức S256
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// StartOAuthCodeCleanup chạy một goroutine định kỳ xóa các authorization code đã hết hạn.
+// Hàm trả về một hàm stop để dừng goroutine khi tắt server.
+func StartOAuthCodeCleanup(repo repository.OAuthCodeRepository, interval time.Duration, logger *logger.Logger) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := repo.DeleteExpired(time.Now())
+				if err != nil {
+					logger.Errorf("Authorization code cleanup error: %v", err)
+					continue
+				}
+				if deleted > 0 {
+					logger.Infof("Authorization code cleanup removed %d expired codes", deleted)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Các scope của OpenID Connect (OpenID Connect Core mục 5.4)
+const (
+	OIDCScopeOpenID  = "openid"
+	OIDCScopeProfile = "profile" // preferred_username, given_name, family_name
+	OIDCScopeEmail   = "email"   // email, email_verified
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrInvalidAccessToken = errors.New("invalid access token")
+	ErrInsufficientScope  = errors.New("insufficient scope")
+	ErrOIDCUnavailable    = errors.New("openid connect requires an asymmetric signing key")
+)
+
+// userClaims là các claim thông tin user, được cấp theo scope
+type userClaims struct {
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	GivenName         string `json:"given_name,omitempty"`
+	FamilyName        string `json:"family_name,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+}
+
+// UserInfo là response của /userinfo (OpenID Connect Core mục 5.3)
+type UserInfo struct {
+	Subject string `json:"sub"`
+	userClaims
+}
+
+// idTokenClaims là claims của ID token (OpenID Connect Core mục 2)
+type idTokenClaims struct {
+	Nonce           string           `json:"nonce,omitempty"`
+	AuthTime        *jwt.NumericDate `json:"auth_time,omitempty"`
+	AuthorizedParty string           `json:"azp,omitempty"`
+	AccessTokenHash string           `json:"at_hash,omitempty"`
+	userClaims
+	jwt.RegisteredClaims
+}
+
+// DiscoveryDocument là metadata của OpenID provider (OpenID Connect Discovery mục 3)
+type DiscoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	ResponseModesSupported            []string `json:"response_modes_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	PromptValuesSupported             []string `json:"prompt_values_supported"`
+	AuthorizationResponseISSParameter bool     `json:"authorization_response_iss_parameter_supported"`
+	RequestURIParameterSupported      bool     `json:"request_uri_parameter_supported"` // Mặc định là true nếu bỏ trống
+}
+
+// validateOIDCParams kiểm tra các tham số prompt và max_age của authorization request
+func validateOIDCParams(req *AuthorizeRequest) error {
+	prompts := strings.Fields(req.Prompt)
+	for _, prompt := range prompts {
+		switch prompt {
+		case PromptNone, PromptLogin, PromptConsent, "select_account":
+		default:
+			return newOAuthError(OAuthErrInvalidRequest, "unsupported prompt value "+prompt)
+		}
+	}
+	if req.HasPrompt(PromptNone) && len(prompts) > 1 {
+		return newOAuthError(OAuthErrInvalidRequest, "prompt=none must not be combined with other values")
+	}
+
+	if req.MaxAge != "" {
+		if maxAge, err := strconv.ParseInt(req.MaxAge, 10, 64); err != nil || maxAge < 0 {
+			return newOAuthError(OAuthErrInvalidRequest, "max_age must be a non-negative integer")
+		}
+	}
+	return nil
+}
+
+// UserInfo trả về các claim của user sở hữu access token, theo scope đã được cấp
+func (s *oauthService) UserInfo(accessToken string) (*UserInfo, error) {
+	claims, err := s.parseAccessToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID == "" {
+		// Token của client_credentials không đại diện cho user nào
+		return nil, ErrInvalidAccessToken
+	}
+	if !hasScope(claims.Scope, OIDCScopeOpenID) {
+		return nil, ErrInsufficientScope
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidAccessToken
+	}
+
+	return &UserInfo{Subject: user.ID.String(), userClaims: claimsForScope(user, claims.Scope)}, nil
+}
+
+// oidcAvailable kiểm tra có cấp được ID token hay không. Client xác thực ID token HS256 bằng client_secret
+// của chính nó (OpenID Connect Core mục 10.1), nhưng secret chỉ được lưu dạng hash và khóa HMAC của keyring
+// là bí mật của server, nên OpenID Connect chỉ được bật khi khóa ký hiện tại là khóa bất đối xứng có trong JWKS.
+func (s *oauthService) oidcAvailable() bool {
+	return !s.keyring.Active().IsSymmetric()
+}
+
+// checkOIDCScope từ chối scope openid khi không cấp được ID token
+func (s *oauthService) checkOIDCScope(scope string) error {
+	if hasScope(scope, OIDCScopeOpenID) && !s.oidcAvailable() {
+		return newOAuthError(OAuthErrInvalidScope, "openid is not supported while the signing key is symmetric")
+	}
+	return nil
+}
+
+// Discovery trả về discovery document của OpenID provider, hoặc ErrOIDCUnavailable khi khóa ký là khóa HMAC
+func (s *oauthService) Discovery() (*DiscoveryDocument, error) {
+	if !s.oidcAvailable() {
+		return nil, ErrOIDCUnavailable
+	}
+	issuer := s.config.OAuthIssuer
+	return &DiscoveryDocument{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   []string{OIDCScopeOpenID, OIDCScopeProfile, OIDCScopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		ResponseModesSupported:            []string{"query"},
+		GrantTypesSupported:               []string{models.GrantTypeAuthorizationCode, models.GrantTypeRefreshToken, models.GrantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{s.keyring.Active().Algorithm()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "azp", "at_hash", "preferred_username", "given_name", "family_name", "email", "email_verified"},
+		CodeChallengeMethodsSupported:     []string{codeChallengeMethodS256},
+		PromptValuesSupported:             []string{PromptNone, PromptLogin, PromptConsent},
+		AuthorizationResponseISSParameter: true,
+		RequestURIParameterSupported:      false,
+	}, nil
+}
+
+// parseAccessToken kiểm tra chữ ký, thời hạn, issuer và trạng thái thu hồi của access token cấp cho OAuth client
+func (s *oauthService) parseAccessToken(accessToken string) (*Claims, error) {
+	var claims Claims
+	parsed, err := jwt.ParseWithClaims(accessToken, &claims, s.keyring.KeyFunc, jwt.WithIssuer(s.config.OAuthIssuer))
+	if err != nil || !parsed.Valid || claims.TokenType != TokenTypeOAuthAccess {
+		return nil, ErrInvalidAccessToken
+	}
+	revoked, err := s.isAccessTokenRevoked(&claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidAccessToken
+	}
+	return &claims, nil
+}
+
+// generateIDToken tạo ID token cho client. authTime = nil khi cấp lại bằng refresh token.
+func (s *oauthService) generateIDToken(client *models.OAuthClient, user *models.User, scope, nonce string, authTime *time.Time, accessToken string) (string, error) {
+	now := time.Now()
+	claims := idTokenClaims{
+		Nonce:           nonce,
+		AuthorizedParty: client.ClientID,
+		AccessTokenHash: accessTokenHash(accessToken, s.keyring.Active().Algorithm()),
+		userClaims:      claimsForScope(user, scope),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.config.OAuthIssuer,
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{client.ClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.config.OAuthAccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if authTime != nil {
+		claims.AuthTime = jwt.NewNumericDate(*authTime)
+	}
+	return s.keyring.Sign(claims)
+}
+
+// claimsForScope lấy các claim của user theo scope profile và email
+func claimsForScope(user *models.User, scope string) userClaims {
+	var claims userClaims
+	if hasScope(scope, OIDCScopeProfile) {
+		claims.PreferredUsername = user.Username
+		claims.GivenName = user.FirstName
+		claims.FamilyName = user.LastName
+	}
+	if hasScope(scope, OIDCScopeEmail) {
+		emailVerified := user.EmailVerified
+		claims.Email = user.Email
+		claims.EmailVerified = &emailVerified
+	}
+	return claims
+}
+
+// accessTokenHash tính at_hash: nửa trái của hash access token, hàm hash theo thuật toán ký của ID token
+func accessTokenHash(accessToken, alg string) string {
+	var h hash.Hash
+	switch alg {
+	case "EdDSA":
+		h = sha512.New()
+	default:
+		h = sha256.New()
+	}
+	h.Write([]byte(accessToken))
+	sum := h.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// hasScope kiểm tra chuỗi scope (phân tách bằng dấu cách) có chứa scope cho trước không
+func hasScope(scopes, scope string) bool {
+	return containsString(strings.Fields(scopes), scope)
+}
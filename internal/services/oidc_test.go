@@ -0,0 +1,259 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/keys"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	testOAuthIssuer      = "https://auth.example.com"
+	testOAuthClientID    = "app"
+	testOAuthRedirectURI = "https://app.example.com/callback"
+	testCodeVerifier     = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// fakeOAuthClientService trả về client đã đăng ký trong test
+type fakeOAuthClientService struct {
+	OAuthClientService
+	client *models.OAuthClient
+}
+
+func (s *fakeOAuthClientService) GetClient(clientID string) (*models.OAuthClient, error) {
+	if clientID != s.client.ClientID {
+		return nil, ErrOAuthClientNotFound
+	}
+	return s.client, nil
+}
+
+// oidcHarness gồm OAuthService với một client public được phép dùng scope openid, profile, email
+type oidcHarness struct {
+	service OAuthService
+	keyring *keys.Keyring
+	client  *models.OAuthClient
+	user    *models.User
+}
+
+func newOIDCHarness(t *testing.T, key *keys.Key) *oidcHarness {
+	t.Helper()
+	users := newFakeUserRepo()
+	h := &oidcHarness{
+		keyring: keys.NewKeyring(key),
+		client: &models.OAuthClient{
+			ClientID:     testOAuthClientID,
+			RedirectURIs: testOAuthRedirectURI,
+			GrantTypes:   models.GrantTypeAuthorizationCode,
+			Scopes:       "openid profile email",
+			Public:       true,
+		},
+		user: users.add(&models.User{Username: "ann", Email: "ann@example.com", EmailVerified: true}),
+	}
+	cfg := &config.Config{
+		OAuthIssuer:         testOAuthIssuer,
+		OAuthAccessTokenTTL: 5 * time.Minute,
+		OAuthCodeTTL:        time.Minute,
+	}
+	h.service = NewOAuthService(&fakeOAuthClientService{client: h.client}, newFakeOAuthCodeRepo(), nil, nil, users, nil, nil, nil, h.keyring, cfg, newTestLogger())
+	return h
+}
+
+// authorize kiểm tra authorization request với scope cho trước và cấp code như sau khi user đồng ý
+func (h *oidcHarness) authorize(t *testing.T, scope string) (code string, err error) {
+	t.Helper()
+	challenge := sha256.Sum256([]byte(testCodeVerifier))
+	req := &AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            testOAuthClientID,
+		RedirectURI:         testOAuthRedirectURI,
+		Scope:               scope,
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(challenge[:]),
+		CodeChallengeMethod: codeChallengeMethodS256,
+		Nonce:               "n-0S6_WzA2Mj",
+	}
+	if _, err := h.service.ValidateAuthorizeRequest(req); err != nil {
+		return "", err
+	}
+	redirect, err := h.service.Authorize(req, &OAuthSession{User: h.user, SessionID: uuid.New(), AuthTime: time.Now()}, false)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	u, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("code"), nil
+}
+
+func (h *oidcHarness) exchange(code string) (*OAuthTokenResponse, error) {
+	return h.service.Token(h.client, TokenRequest{
+		GrantType:    models.GrantTypeAuthorizationCode,
+		Code:         code,
+		RedirectURI:  testOAuthRedirectURI,
+		CodeVerifier: testCodeVerifier,
+	})
+}
+
+// publicKeyFromJWK dựng khóa công khai từ JWK như thư viện phía client
+func publicKeyFromJWK(t *testing.T, jwk keys.JWK) interface{} {
+	t.Helper()
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("decode JWK member: %v", err)
+		}
+		return b
+	}
+	switch jwk.Kty {
+	case "RSA":
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(decode(jwk.N)), E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64())}
+	case "EC":
+		if jwk.Crv != "P-256" {
+			t.Fatalf("unexpected curve %q", jwk.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(decode(jwk.X)), Y: new(big.Int).SetBytes(decode(jwk.Y))}
+	case "OKP":
+		return ed25519.PublicKey(decode(jwk.X))
+	default:
+		t.Fatalf("unexpected key type %q", jwk.Kty)
+		return nil
+	}
+}
+
+func TestIDTokenVerifiesWithDiscoveryAndJWKS(t *testing.T) {
+	for _, alg := range []string{keys.AlgRS256, keys.AlgES256, keys.AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := keys.Generate(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := newOIDCHarness(t, key)
+
+			code, err := h.authorize(t, "openid email")
+			if err != nil {
+				t.Fatalf("ValidateAuthorizeRequest: %v", err)
+			}
+			response, err := h.exchange(code)
+			if err != nil {
+				t.Fatalf("Token: %v", err)
+			}
+
+			// Client chỉ biết những gì được công khai: discovery document và JWKS ở jwks_uri, dạng JSON
+			document, err := h.service.Discovery()
+			if err != nil {
+				t.Fatalf("Discovery: %v", err)
+			}
+			var discovery struct {
+				Issuer  string   `json:"issuer"`
+				JWKSURI string   `json:"jwks_uri"`
+				Algs    []string `json:"id_token_signing_alg_values_supported"`
+			}
+			roundTripJSON(t, document, &discovery)
+			if discovery.JWKSURI != testOAuthIssuer+"/.well-known/jwks.json" {
+				t.Fatalf("jwks_uri = %q", discovery.JWKSURI)
+			}
+			var jwks keys.JWKS
+			roundTripJSON(t, h.keyring.JWKS(), &jwks)
+
+			claims := jwt.MapClaims{}
+			_, err = jwt.ParseWithClaims(response.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+				kid, _ := token.Header["kid"].(string)
+				for _, jwk := range jwks.Keys {
+					if jwk.Kid == kid {
+						return publicKeyFromJWK(t, jwk), nil
+					}
+				}
+				return nil, errors.New("kid not found in JWKS")
+			},
+				jwt.WithValidMethods(discovery.Algs),
+				jwt.WithIssuer(discovery.Issuer),
+				jwt.WithAudience(testOAuthClientID),
+				jwt.WithExpirationRequired(),
+			)
+			if err != nil {
+				t.Fatalf("ID token does not verify with the published keys: %v", err)
+			}
+			if claims["sub"] != h.user.ID.String() || claims["nonce"] != "n-0S6_WzA2Mj" || claims["email"] != "ann@example.com" {
+				t.Fatalf("unexpected claims: %v", claims)
+			}
+		})
+	}
+}
+
+// roundTripJSON mã hóa v thành JSON rồi giải mã vào out, như khi client nhận qua HTTP
+func roundTripJSON(t *testing.T, v, out interface{}) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOIDCUnavailableWithSymmetricKey(t *testing.T) {
+	h := newOIDCHarness(t, keys.NewHMACKey([]byte("0123456789abcdef0123456789abcdef"), ""))
+
+	if _, err := h.service.Discovery(); !errors.Is(err, ErrOIDCUnavailable) {
+		t.Fatalf("Discovery: got %v, want ErrOIDCUnavailable", err)
+	}
+	if len(h.keyring.JWKS().Keys) != 0 {
+		t.Fatal("HMAC key must not be published")
+	}
+
+	// Client yêu cầu rõ scope openid: từ chối
+	_, err := h.authorize(t, "openid profile")
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != OAuthErrInvalidScope {
+		t.Fatalf("got %v, want invalid_scope", err)
+	}
+
+	// Không gửi scope: openid bị bỏ khỏi scope mặc định của client, OAuth 2.0 vẫn hoạt động
+	code, err := h.authorize(t, "")
+	if err != nil {
+		t.Fatalf("default scope: %v", err)
+	}
+	response, err := h.exchange(code)
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if response.IDToken != "" || hasScope(response.Scope, OIDCScopeOpenID) {
+		t.Fatalf("scope = %q, id_token issued = %v; want no openid", response.Scope, response.IDToken != "")
+	}
+}
+
+func TestOIDCCodeRejectedAfterSwitchToSymmetricKey(t *testing.T) {
+	key, err := keys.Generate(keys.AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newOIDCHarness(t, key)
+	code, err := h.authorize(t, "openid")
+	if err != nil {
+		t.Fatalf("ValidateAuthorizeRequest: %v", err)
+	}
+
+	// Khóa ký được đổi sang HMAC giữa lúc cấp code và lúc đổi code
+	h.keyring.Replace(keys.NewHMACKey([]byte("0123456789abcdef0123456789abcdef"), ""), []*keys.Key{key})
+
+	_, err = h.exchange(code)
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != OAuthErrInvalidScope {
+		t.Fatalf("got %v, want invalid_scope", err)
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrInvalidResetToken      = errors.New("invalid or expired password reset token")
+	ErrInvalidInvitationToken = errors.New("invalid or expired invitation token")
+)
+
+// PasswordResetService định nghĩa interface cho các phương thức đặt lại mật khẩu
+type PasswordResetService interface {
+	RequestReset(email string) error
+	ResetPassword(token, newPassword string) error
+	SendInvitation(user *models.User, inviterName string) error
+	AcceptInvitation(token, newPassword string) error
+}
+
+// passwordResetService struct triển khai PasswordResetService interface
+type passwordResetService struct {
+	userRepo        repository.UserRepository
+	userTokenRepo   repository.UserTokenRepository
+	sessionService  SessionService
+	mailService     MailService
+	passwordService PasswordService
+	config          *config.Config
+	logger          *logger.Logger
+}
+
+// NewPasswordResetService tạo một instance mới của PasswordResetService
+func NewPasswordResetService(userRepo repository.UserRepository, userTokenRepo repository.UserTokenRepository, sessionService SessionService, mailService MailService, passwordService PasswordService, config *config.Config, logger *logger.Logger) PasswordResetService {
+	return &passwordResetService{
+		userRepo:        userRepo,
+		userTokenRepo:   userTokenRepo,
+		sessionService:  sessionService,
+		mailService:     mailService,
+		passwordService: passwordService,
+		config:          config,
+		logger:          logger,
+	}
+}
+
+// RequestReset gửi link đặt lại mật khẩu tới email. Không trả về lỗi khi email
+// không tồn tại để không thể dùng chức năng này dò tìm tài khoản.
+func (s *passwordResetService) RequestReset(email string) error {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	// Chỉ link mới nhất có hiệu lực
+	if err := s.userTokenRepo.DeleteByUser(user.ID, models.TokenPurposePasswordReset); err != nil {
+		return err
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	record := &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposePasswordReset,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.config.PasswordResetTTL),
+	}
+	if err := s.userTokenRepo.Create(record); err != nil {
+		return err
+	}
+
+	return s.mailService.SendPasswordReset(user, token)
+}
+
+// ResetPassword đặt mật khẩu mới bằng token trong email, sau đó thu hồi tất cả
+// session và refresh token hiện có của user
+func (s *passwordResetService) ResetPassword(token, newPassword string) error {
+	return s.setPasswordWithToken(token, models.TokenPurposePasswordReset, newPassword, ErrInvalidResetToken)
+}
+
+// SendInvitation gửi lời mời kèm link để user do admin tạo tự đặt mật khẩu đầu tiên
+func (s *passwordResetService) SendInvitation(user *models.User, inviterName string) error {
+	// Chỉ lời mời mới nhất có hiệu lực
+	if err := s.userTokenRepo.DeleteByUser(user.ID, models.TokenPurposeInvitation); err != nil {
+		return err
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	record := &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeInvitation,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.config.InvitationTTL),
+	}
+	if err := s.userTokenRepo.Create(record); err != nil {
+		return err
+	}
+
+	return s.mailService.SendInvitation(user.Email, user.Locale, inviterName, token, s.config.InvitationTTL)
+}
+
+// AcceptInvitation đặt mật khẩu đầu tiên bằng token trong lời mời
+func (s *passwordResetService) AcceptInvitation(token, newPassword string) error {
+	return s.setPasswordWithToken(token, models.TokenPurposeInvitation, newPassword, ErrInvalidInvitationToken)
+}
+
+// setPasswordWithToken đặt mật khẩu mới bằng token dùng một lần gửi qua email, đánh dấu email đã xác minh
+// và thu hồi tất cả session và refresh token hiện có của user. Token không hợp lệ trả về errInvalid.
+func (s *passwordResetService) setPasswordWithToken(token, purpose, newPassword string, errInvalid error) error {
+	record, err := s.userTokenRepo.FindValid(hashToken(token), purpose)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return errInvalid
+	}
+
+	user, err := s.userRepo.FindByID(record.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errInvalid
+	}
+
+	// Kiểm tra mật khẩu mới trước khi dùng token để user có thể thử lại với mật khẩu khác
+	if err := s.passwordService.CheckNewPassword(user, newPassword); err != nil {
+		return err
+	}
+
+	record, err = s.userTokenRepo.Consume(record.TokenHash, purpose)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return errInvalid
+	}
+
+	// Đặt lại mật khẩu thành công cũng mở khóa tài khoản bị khóa do đăng nhập sai
+	user.FailedLoginAttempts = 0
+	user.LockedUntil = nil
+	// Nhận được link qua email cũng chứng minh user sở hữu địa chỉ email
+	if !user.EmailVerified {
+		now := time.Now()
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+	}
+	if err := s.passwordService.SetPassword(user, newPassword); err != nil {
+		return err
+	}
+
+	return s.sessionService.RevokeAllSessions(user.ID)
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/Thanhdat-debug/demo_login/pkg/password"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrPasswordReused = errors.New("password was used recently")
+)
+
+// PasswordService định nghĩa interface cho việc đặt mật khẩu mới theo chính sách và lịch sử mật khẩu
+type PasswordService interface {
+	CheckNewPassword(user *models.User, newPassword string) error
+	SetPassword(user *models.User, newPassword string) error
+	RecordPassword(user *models.User) error
+}
+
+// passwordService struct triển khai PasswordService interface
+type passwordService struct {
+	userRepo    repository.UserRepository
+	historyRepo repository.PasswordHistoryRepository
+	policy      *password.Policy
+	config      *config.Config
+	logger      *logger.Logger
+}
+
+// NewPasswordService tạo một instance mới của PasswordService
+func NewPasswordService(userRepo repository.UserRepository, historyRepo repository.PasswordHistoryRepository, policy *password.Policy, config *config.Config, logger *logger.Logger) PasswordService {
+	return &passwordService{
+		userRepo:    userRepo,
+		historyRepo: historyRepo,
+		policy:      policy,
+		config:      config,
+		logger:      logger,
+	}
+}
+
+// CheckNewPassword kiểm tra mật khẩu mới theo chính sách mật khẩu và không trùng
+// với mật khẩu hiện tại hay PASSWORD_HISTORY_SIZE mật khẩu gần nhất của user
+func (s *passwordService) CheckNewPassword(user *models.User, newPassword string) error {
+	if err := s.policy.Validate(newPassword, user.Username, user.Email); err != nil {
+		return err
+	}
+
+	// Tài khoản chưa có lịch sử (tạo trước khi có tính năng này) vẫn được so với mật khẩu hiện tại
+	if user.Password != "" && user.CheckPassword(newPassword) {
+		return ErrPasswordReused
+	}
+
+	history, err := s.historyRepo.ListRecent(user.ID, s.config.PasswordHistorySize)
+	if err != nil {
+		return err
+	}
+	for _, entry := range history {
+		ok, err := password.Default().Verify(newPassword, entry.PasswordHash)
+		if err != nil {
+			s.logger.Errorf("Failed to verify password history entry %s: %v", entry.ID, err)
+			continue
+		}
+		if ok {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// SetPassword kiểm tra, băm và lưu mật khẩu mới của user (cùng các thay đổi khác trên user), rồi ghi vào lịch sử
+func (s *passwordService) SetPassword(user *models.User, newPassword string) error {
+	if err := s.CheckNewPassword(user, newPassword); err != nil {
+		return err
+	}
+
+	user.Password = newPassword
+	if err := user.HashPassword(); err != nil {
+		return err
+	}
+	now := time.Now()
+	user.PasswordChangedAt = &now
+	user.PasswordResetRequired = false
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	if err := s.RecordPassword(user); err != nil {
+		s.logger.Errorf("Failed to record password history of user %s: %v", user.ID, err)
+	}
+	return nil
+}
+
+// RecordPassword ghi hash mật khẩu hiện tại của user vào lịch sử và xóa các mật khẩu cũ hơn giới hạn
+func (s *passwordService) RecordPassword(user *models.User) error {
+	entry := &models.PasswordHistory{
+		UserID:       user.ID,
+		PasswordHash: user.Password,
+	}
+	if err := s.historyRepo.Create(entry); err != nil {
+		return err
+	}
+	return s.historyRepo.DeleteExceptRecent(user.ID, s.config.PasswordHistorySize)
+}
@@ -0,0 +1,361 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/Thanhdat-debug/demo_login/pkg/sms"
+	"github.com/google/uuid"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrInvalidPhone        = errors.New("invalid phone number")
+	ErrPhoneInUse          = errors.New("phone number is already used by another account")
+	ErrPhoneNotSet         = errors.New("user has no phone number")
+	ErrPhoneLoginDisabled  = errors.New("phone login is disabled")
+	ErrInvalidOTP          = errors.New("invalid or expired code")
+	ErrOTPAttemptsExceeded = errors.New("too many invalid codes, request a new code")
+	ErrOTPRequestTooSoon   = errors.New("a code was sent recently")
+)
+
+// OTPThrottleError cho biết mã mới chưa được gửi vì mã trước vừa được gửi, kèm thời gian cần chờ.
+// errors.Is(err, ErrOTPRequestTooSoon) trả về true.
+type OTPThrottleError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OTPThrottleError) Error() string { return ErrOTPRequestTooSoon.Error() }
+func (e *OTPThrottleError) Unwrap() error { return ErrOTPRequestTooSoon }
+
+// otpMessages là nội dung tin nhắn chứa mã theo ngôn ngữ của user
+var otpMessages = map[string]string{
+	"vi": "Ma xac thuc cua ban la %s, co hieu luc trong %d phut. Khong chia se ma nay voi bat ky ai.",
+	"en": "Your verification code is %s. It expires in %d minutes. Do not share this code with anyone.",
+}
+
+// PhoneService định nghĩa interface cho số điện thoại của user và đăng nhập bằng mã OTP qua SMS
+type PhoneService interface {
+	RequestVerification(userID uuid.UUID, phone string) error
+	ConfirmVerification(userID uuid.UUID, code string) (*models.UserResponse, error)
+	RemovePhone(userID uuid.UUID) error
+	RequestLoginCode(phone string) error
+	LoginWithCode(phone, code string, client ClientInfo) (*LoginResult, error)
+}
+
+// phoneService struct triển khai PhoneService interface
+type phoneService struct {
+	userRepo       repository.UserRepository
+	otpRepo        repository.PhoneOTPRepository
+	identityRepo   repository.UserIdentityRepository
+	lockoutService LockoutService
+	authService    AuthService
+	sender         sms.Sender
+	config         *config.Config
+	logger         *logger.Logger
+}
+
+// NewPhoneService tạo một instance mới của PhoneService
+func NewPhoneService(userRepo repository.UserRepository, otpRepo repository.PhoneOTPRepository, identityRepo repository.UserIdentityRepository, lockoutService LockoutService, authService AuthService, sender sms.Sender, config *config.Config, logger *logger.Logger) PhoneService {
+	return &phoneService{
+		userRepo:       userRepo,
+		otpRepo:        otpRepo,
+		identityRepo:   identityRepo,
+		lockoutService: lockoutService,
+		authService:    authService,
+		sender:         sender,
+		config:         config,
+		logger:         logger,
+	}
+}
+
+// RequestVerification gửi mã xác minh tới số điện thoại mới của user.
+// Số điện thoại chỉ được lưu vào tài khoản sau khi user nhập đúng mã.
+func (s *phoneService) RequestVerification(userID uuid.UUID, phone string) error {
+	phone, err := s.normalize(phone)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	owner, err := s.userRepo.FindByPhone(phone)
+	if err != nil {
+		return err
+	}
+	if owner != nil && owner.ID != user.ID {
+		return ErrPhoneInUse
+	}
+
+	return s.sendCode(user, phone, models.OTPPurposePhoneVerification)
+}
+
+// ConfirmVerification kiểm tra mã xác minh và lưu số điện thoại đã xác minh vào tài khoản
+func (s *phoneService) ConfirmVerification(userID uuid.UUID, code string) (*models.UserResponse, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	otp, err := s.checkCode(user.ID, models.OTPPurposePhoneVerification, code)
+	if err != nil {
+		return nil, err
+	}
+
+	// Số điện thoại có thể đã được tài khoản khác xác minh trong lúc chờ mã
+	owner, err := s.userRepo.FindByPhone(otp.Phone)
+	if err != nil {
+		return nil, err
+	}
+	if owner != nil && owner.ID != user.ID {
+		return nil, ErrPhoneInUse
+	}
+
+	now := time.Now()
+	phone := otp.Phone
+	user.Phone = &phone
+	user.PhoneVerified = true
+	user.PhoneVerifiedAt = &now
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	response := user.ToUserResponse()
+	return &response, nil
+}
+
+// RemovePhone xóa số điện thoại khỏi tài khoản
+func (s *phoneService) RemovePhone(userID uuid.UUID) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	if user.Phone == nil {
+		return ErrPhoneNotSet
+	}
+
+	user.Phone = nil
+	user.PhoneVerified = false
+	user.PhoneVerifiedAt = nil
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+	return s.otpRepo.DeleteByUser(user.ID, models.OTPPurposePhoneLogin)
+}
+
+// RequestLoginCode gửi mã đăng nhập tới số điện thoại đã xác minh. Không trả về lỗi khi số điện thoại
+// không thuộc tài khoản nào (hoặc vừa được gửi mã) để không thể dùng chức năng này dò tìm tài khoản.
+func (s *phoneService) RequestLoginCode(phone string) error {
+	if !s.config.PhoneLoginEnabled {
+		return ErrPhoneLoginDisabled
+	}
+	phone, err := s.normalize(phone)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.loginUser(phone)
+	if err != nil || user == nil {
+		return err
+	}
+
+	err = s.sendCode(user, phone, models.OTPPurposePhoneLogin)
+	if errors.Is(err, ErrOTPRequestTooSoon) {
+		return nil
+	}
+	return err
+}
+
+// LoginWithCode đăng nhập bằng số điện thoại và mã OTP. Khóa tài khoản và MFA vẫn được áp dụng;
+// mỗi mã sai được tính như một lần đăng nhập sai.
+func (s *phoneService) LoginWithCode(phone, code string, client ClientInfo) (*LoginResult, error) {
+	if !s.config.PhoneLoginEnabled {
+		return nil, ErrPhoneLoginDisabled
+	}
+	phone, err := s.normalize(phone)
+	if err != nil {
+		return nil, ErrInvalidOTP
+	}
+
+	user, err := s.loginUser(phone)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.lockoutService.Check(user, client.IPAddress); err != nil {
+		return nil, err
+	}
+	if user == nil {
+		if err := s.lockoutService.RecordFailure(nil, client.IPAddress); err != nil {
+			s.logger.Errorf("Failed to record login failure: %v", err)
+		}
+		return nil, ErrInvalidOTP
+	}
+
+	otp, err := s.checkCode(user.ID, models.OTPPurposePhoneLogin, code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidOTP) || errors.Is(err, ErrOTPAttemptsExceeded) {
+			if err := s.lockoutService.RecordFailure(user, client.IPAddress); err != nil {
+				s.logger.Errorf("Failed to record login failure: %v", err)
+			}
+		}
+		return nil, err
+	}
+	// Số điện thoại có thể đã bị xóa hoặc đổi sau khi mã được gửi
+	if otp.Phone != phone {
+		return nil, ErrInvalidOTP
+	}
+
+	return s.authService.LoginWithoutPassword(user, LoginSourcePhone, client)
+}
+
+// loginUser tìm user có số điện thoại đã xác minh; user đến từ LDAP/SAML chỉ đăng nhập qua nguồn đó
+func (s *phoneService) loginUser(phone string) (*models.User, error) {
+	user, err := s.userRepo.FindByPhone(phone)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.PhoneVerified {
+		return nil, nil
+	}
+
+	managed, err := hasManagedIdentity(s.identityRepo, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if managed {
+		return nil, nil
+	}
+	return user, nil
+}
+
+// sendCode tạo mã mới (thay cho mã cũ cùng mục đích) và gửi qua SMS
+func (s *phoneService) sendCode(user *models.User, phone, purpose string) error {
+	now := time.Now()
+	latest, err := s.otpRepo.FindLatest(user.ID, purpose)
+	if err != nil {
+		return err
+	}
+	if latest != nil {
+		if wait := latest.CreatedAt.Add(s.config.PhoneOTPResendInterval).Sub(now); wait > 0 {
+			return &OTPThrottleError{RetryAfter: wait}
+		}
+	}
+	if err := s.otpRepo.DeleteByUser(user.ID, purpose); err != nil {
+		return err
+	}
+
+	code, err := randomOTP(s.config.PhoneOTPLength)
+	if err != nil {
+		return err
+	}
+	if err := s.otpRepo.Create(&models.PhoneOTP{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Phone:     phone,
+		CodeHash:  hashToken(code),
+		ExpiresAt: now.Add(s.config.PhoneOTPTTL),
+	}); err != nil {
+		return err
+	}
+
+	return s.sender.Send(sms.Message{To: phone, Body: s.otpMessage(user.Locale, code)})
+}
+
+// checkCode kiểm tra mã mới nhất của user và dùng mã nếu đúng. Sau PhoneOTPMaxAttempts lần nhập sai
+// mã bị hủy, user phải yêu cầu mã mới.
+func (s *phoneService) checkCode(userID uuid.UUID, purpose, code string) (*models.PhoneOTP, error) {
+	otp, err := s.otpRepo.FindLatest(userID, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if otp == nil || !otp.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidOTP
+	}
+
+	// Giữ chỗ một lần thử trước khi so sánh để các request đồng thời không vượt quá PHONE_OTP_MAX_ATTEMPTS
+	reserved, err := s.otpRepo.ReserveAttempt(otp.ID, s.config.PhoneOTPMaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if !reserved {
+		return nil, ErrOTPAttemptsExceeded
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(strings.TrimSpace(code))), []byte(otp.CodeHash)) != 1 {
+		// Vừa dùng lần thử cuối cùng (otp.Attempts là giá trị trước khi giữ chỗ): hủy mã
+		if otp.Attempts+1 >= s.config.PhoneOTPMaxAttempts {
+			if _, err := s.otpRepo.Consume(otp.ID); err != nil {
+				return nil, err
+			}
+			return nil, ErrOTPAttemptsExceeded
+		}
+		return nil, ErrInvalidOTP
+	}
+
+	consumed, err := s.otpRepo.Consume(otp.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, ErrInvalidOTP
+	}
+	return otp, nil
+}
+
+// normalize chuyển số điện thoại về dạng E.164
+func (s *phoneService) normalize(phone string) (string, error) {
+	normalized, err := sms.NormalizePhone(phone, s.config.PhoneDefaultCountryCode)
+	if err != nil {
+		return "", ErrInvalidPhone
+	}
+	return normalized, nil
+}
+
+// otpMessage tạo nội dung tin nhắn theo ngôn ngữ của user (tin nhắn không dấu để vừa một SMS)
+func (s *phoneService) otpMessage(locale, code string) string {
+	format, ok := otpMessages[locale]
+	if !ok {
+		format, ok = otpMessages[s.config.MailDefaultLocale]
+	}
+	if !ok {
+		format = otpMessages["en"]
+	}
+	minutes := int(s.config.PhoneOTPTTL.Round(time.Minute) / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	}
+	return fmt.Sprintf(format, code, minutes)
+}
+
+// randomOTP sinh mã gồm length chữ số ngẫu nhiên
+func randomOTP(length int) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(byte('0' + n.Int64()))
+	}
+	return sb.String(), nil
+}
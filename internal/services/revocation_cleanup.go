@@ -0,0 +1,36 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+)
+
+// StartRevocationCleanup chạy một goroutine định kỳ xóa các bản ghi thu hồi đã hết hạn.
+// Hàm trả về một hàm stop để dừng goroutine khi tắt server.
+func StartRevocationCleanup(store repository.RevocationStore, interval time.Duration, logger *logger.Logger) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := store.DeleteExpired()
+				if err != nil {
+					logger.Errorf("Revocation cleanup error: %v", err)
+					continue
+				}
+				if deleted > 0 {
+					logger.Infof("Revocation cleanup removed %d expired entries", deleted)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
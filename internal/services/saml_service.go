@@ -0,0 +1,468 @@
+package services
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/keys"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/crewjam/saml"
+	"github.com/golang-jwt/jwt/v5"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrSAMLProviderNotFound = errors.New("saml provider not found")
+	ErrInvalidSAMLRequest   = errors.New("invalid or expired saml request")
+	ErrInvalidSAMLResponse  = errors.New("invalid saml response")
+	ErrSAMLEmailRequired    = errors.New("saml assertion has no email address")
+	ErrSAMLAccountConflict  = errors.New("a local account with this email already exists")
+)
+
+// tokenTypeSAMLRequest là token_type của cookie giữ ID của AuthnRequest đang chờ phản hồi
+const tokenTypeSAMLRequest = "saml_request"
+
+// samlIdentityPrefix là tiền tố provider của liên kết user_identities với IdP SAML ("saml:<tên>")
+const samlIdentityPrefix = "saml:"
+
+// maxSAMLMetadataSize giới hạn kích thước metadata tải về từ IdP
+const maxSAMLMetadataSize = 1 << 20
+
+// samlRequestClaims là claims của cookie request: response từ IdP phải trả lời đúng AuthnRequest
+// được tạo cho trình duyệt này (InResponseTo), không chấp nhận assertion do IdP tự gửi tới
+type samlRequestClaims struct {
+	Provider  string `json:"provider"`
+	RequestID string `json:"request_id"`
+	TokenType string `json:"token_type"`
+	jwt.RegisteredClaims
+}
+
+// SAMLService định nghĩa interface cho đăng nhập bằng SAML 2.0 (service này là service provider)
+type SAMLService interface {
+	Providers() []string
+	Metadata(providerName string) ([]byte, error)
+	Begin(providerName string) (redirectURL, requestCookie string, err error)
+	ACS(providerName, samlResponse, requestCookie string, client ClientInfo) (*LoginResult, error)
+}
+
+// samlProvider là service provider ứng với một IdP
+type samlProvider struct {
+	sp     *saml.ServiceProvider
+	config config.SAMLProvider
+}
+
+// samlService struct triển khai SAMLService interface
+type samlService struct {
+	providers       map[string]*samlProvider
+	identityRepo    repository.UserIdentityRepository
+	userRepo        repository.UserRepository
+	revocationStore repository.RevocationStore
+	authService     AuthService
+	keyring         *keys.Keyring
+	config          *config.Config
+	logger          *logger.Logger
+}
+
+// NewSAMLService tạo một instance mới của SAMLService, nạp khóa của SP và metadata của các IdP trong cấu hình.
+// Entity ID của SP ứng với IdP <tên> là <OAUTH_ISSUER>/api/auth/saml/<tên>/metadata.
+func NewSAMLService(identityRepo repository.UserIdentityRepository, userRepo repository.UserRepository, revocationStore repository.RevocationStore, authService AuthService, keyring *keys.Keyring, httpClient *http.Client, config *config.Config, logger *logger.Logger) (SAMLService, error) {
+	s := &samlService{
+		providers:       make(map[string]*samlProvider),
+		identityRepo:    identityRepo,
+		userRepo:        userRepo,
+		revocationStore: revocationStore,
+		authService:     authService,
+		keyring:         keyring,
+		config:          config,
+		logger:          logger,
+	}
+	if len(config.SAMLProviders) == 0 {
+		return s, nil
+	}
+
+	key, cert, err := loadSAMLKeyPair(config.SAMLSPKeyFile, config.SAMLSPCertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range config.SAMLProviders {
+		idpMetadata, err := loadSAMLMetadata(p, httpClient)
+		if err != nil {
+			return nil, fmt.Errorf("saml provider %s: %w", p.Name, err)
+		}
+
+		base := config.OAuthIssuer + "/api/auth/saml/" + p.Name
+		metadataURL, err := url.Parse(base + "/metadata")
+		if err != nil {
+			return nil, err
+		}
+		acsURL, err := url.Parse(base + "/acs")
+		if err != nil {
+			return nil, err
+		}
+
+		sp := &saml.ServiceProvider{
+			EntityID:          metadataURL.String(),
+			Key:               key,
+			Certificate:       cert,
+			HTTPClient:        httpClient,
+			MetadataURL:       *metadataURL,
+			AcsURL:            *acsURL,
+			IDPMetadata:       idpMetadata,
+			AuthnNameIDFormat: saml.NameIDFormat(p.NameIDFormat),
+		}
+		if config.SAMLSignRequests {
+			sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+		}
+		if sp.GetSSOBindingLocation(saml.HTTPRedirectBinding) == "" {
+			return nil, fmt.Errorf("saml provider %s: idp has no HTTP-Redirect single sign-on service", p.Name)
+		}
+
+		s.providers[p.Name] = &samlProvider{sp: sp, config: p}
+	}
+	return s, nil
+}
+
+// loadSAMLKeyPair đọc khóa RSA và chứng chỉ của SP (PEM)
+func loadSAMLKeyPair(keyFile, certFile string) (*rsa.PrivateKey, *x509.Certificate, error) {
+	if keyFile == "" || certFile == "" {
+		return nil, nil, errors.New("SAML_SP_KEY_FILE and SAML_SP_CERT_FILE are required when SAML_PROVIDERS is set")
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("saml sp key must be an RSA key")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, cert, nil
+}
+
+// loadSAMLMetadata đọc metadata của IdP từ file hoặc URL. Với metadata chứa nhiều entity (EntitiesDescriptor),
+// entity đầu tiên có IDPSSODescriptor được dùng.
+func loadSAMLMetadata(p config.SAMLProvider, httpClient *http.Client) (*saml.EntityDescriptor, error) {
+	var data []byte
+	switch {
+	case p.MetadataFile != "":
+		var err error
+		data, err = os.ReadFile(p.MetadataFile)
+		if err != nil {
+			return nil, err
+		}
+	case p.MetadataURL != "":
+		resp, err := httpClient.Get(p.MetadataURL)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching idp metadata: unexpected status %d", resp.StatusCode)
+		}
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxSAMLMetadataSize))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("metadata url or file is required")
+	}
+
+	var entity saml.EntityDescriptor
+	if err := xml.Unmarshal(data, &entity); err == nil && len(entity.IDPSSODescriptors) > 0 {
+		return &entity, nil
+	}
+	var entities saml.EntitiesDescriptor
+	if err := xml.Unmarshal(data, &entities); err != nil {
+		return nil, fmt.Errorf("parsing idp metadata: %w", err)
+	}
+	for i := range entities.EntityDescriptors {
+		if len(entities.EntityDescriptors[i].IDPSSODescriptors) > 0 {
+			return &entities.EntityDescriptors[i], nil
+		}
+	}
+	return nil, errors.New("idp metadata has no IDPSSODescriptor")
+}
+
+// Providers trả về tên các IdP đã cấu hình
+func (s *samlService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Metadata trả về metadata XML của SP để đăng ký với IdP
+func (s *samlService) Metadata(providerName string) ([]byte, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrSAMLProviderNotFound
+	}
+
+	metadata := provider.sp.Metadata()
+	// Chỉ nhận response qua HTTP-POST; không hỗ trợ artifact binding
+	for i := range metadata.SPSSODescriptors {
+		var services []saml.IndexedEndpoint
+		for _, acs := range metadata.SPSSODescriptors[i].AssertionConsumerServices {
+			if acs.Binding == saml.HTTPPostBinding {
+				services = append(services, acs)
+			}
+		}
+		metadata.SPSSODescriptors[i].AssertionConsumerServices = services
+	}
+
+	data, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// Begin tạo AuthnRequest, trả về URL chuyển trình duyệt tới IdP (HTTP-Redirect binding)
+// và giá trị cookie giữ ID của request
+func (s *samlService) Begin(providerName string) (string, string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrSAMLProviderNotFound
+	}
+
+	sp := provider.sp
+	req, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", err
+	}
+	redirectURL, err := req.Redirect("", sp)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	requestCookie, err := s.keyring.Sign(samlRequestClaims{
+		Provider:  providerName,
+		RequestID: req.ID,
+		TokenType: tokenTypeSAMLRequest,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.config.SAMLRequestTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return redirectURL.String(), requestCookie, nil
+}
+
+// ACS xử lý SAMLResponse IdP gửi về: kiểm tra chữ ký, audience, thời hạn và InResponseTo của assertion,
+// lấy (hoặc tạo) user theo NameID và các thuộc tính, sau đó đăng nhập như thường (MFA vẫn áp dụng)
+func (s *samlService) ACS(providerName, samlResponse, requestCookie string, client ClientInfo) (*LoginResult, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrSAMLProviderNotFound
+	}
+
+	var claims samlRequestClaims
+	parsed, err := jwt.ParseWithClaims(requestCookie, &claims, s.keyring.KeyFunc)
+	if err != nil || !parsed.Valid || claims.TokenType != tokenTypeSAMLRequest || claims.Provider != providerName {
+		return nil, ErrInvalidSAMLRequest
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return nil, ErrInvalidSAMLResponse
+	}
+	assertion, err := provider.sp.ParseXMLResponse(raw, []string{claims.RequestID})
+	if err != nil {
+		var responseErr *saml.InvalidResponseError
+		if errors.As(err, &responseErr) {
+			err = responseErr.PrivateErr
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLResponse, err)
+	}
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		return nil, fmt.Errorf("%w: assertion has no NameID", ErrInvalidSAMLResponse)
+	}
+
+	// Mỗi assertion chỉ dùng được một lần
+	if err := s.consumeAssertion(assertion); err != nil {
+		return nil, err
+	}
+
+	user, err := s.resolveUser(provider, assertion)
+	if err != nil {
+		return nil, err
+	}
+	return s.authService.LoginWithoutPassword(user, samlIdentityPrefix+provider.config.Name, client)
+}
+
+// consumeAssertion đánh dấu assertion đã dùng trong danh sách thu hồi, tới khi assertion hết hạn.
+// ID của assertion do IdP đặt, có độ dài tùy ý, nên được băm cùng issuer cho vừa cột jti.
+func (s *samlService) consumeAssertion(assertion *saml.Assertion) error {
+	sum := sha256.Sum256([]byte(assertion.Issuer.Value + "\x00" + assertion.ID))
+	id := samlIdentityPrefix + base64.RawURLEncoding.EncodeToString(sum[:])
+
+	expiresAt := time.Now().Add(s.config.SAMLRequestTTL)
+	if assertion.Conditions != nil && !assertion.Conditions.NotOnOrAfter.IsZero() {
+		expiresAt = assertion.Conditions.NotOnOrAfter.Add(saml.MaxClockSkew)
+	}
+	first, err := s.revocationStore.Consume(id, expiresAt)
+	if err != nil {
+		return err
+	}
+	if !first {
+		return fmt.Errorf("%w: assertion already used", ErrInvalidSAMLResponse)
+	}
+	return nil
+}
+
+// resolveUser tìm user đã liên kết với NameID, đồng bộ thông tin theo assertion;
+// lần đăng nhập đầu tiên thì tạo user mới (just-in-time)
+func (s *samlService) resolveUser(provider *samlProvider, assertion *saml.Assertion) (*models.User, error) {
+	attributes := samlAttributes(assertion)
+	nameID := assertion.Subject.NameID.Value
+	p := provider.config
+
+	info := provisionedUser{
+		Username:      nameID,
+		Email:         attributes.first(p.EmailAttr),
+		FirstName:     attributes.first(p.FirstNameAttr),
+		LastName:      attributes.first(p.LastNameAttr),
+		Role:          mapSAMLRole(p, attributes.values(p.RoleAttr)),
+		EmailVerified: true, // Email do IdP của tổ chức quản lý
+	}
+	if p.UsernameAttr != "" {
+		if username := attributes.first(p.UsernameAttr); username != "" {
+			info.Username = username
+		}
+	}
+	// NameID dạng email dùng được làm email khi IdP không gửi thuộc tính email
+	if info.Email == "" && strings.Contains(nameID, "@") {
+		info.Email = nameID
+	}
+
+	identityProvider := samlIdentityPrefix + p.Name
+	now := time.Now()
+
+	identity, err := s.identityRepo.FindByProviderSubject(identityProvider, nameID)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		user, err := s.userRepo.FindByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, ErrInvalidSAMLResponse
+		}
+		// Role chỉ được đồng bộ khi IdP gửi thuộc tính role, để role do admin gán không bị ghi đè
+		if err := syncProvisionedUser(s.userRepo, user, info, p.RoleAttr != ""); err != nil {
+			return nil, err
+		}
+		if err := s.identityRepo.UpdateLogin(identity.ID, info.Email, now); err != nil {
+			s.logger.Errorf("Failed to update identity %s: %v", identity.ID, err)
+		}
+		return user, nil
+	}
+
+	// Không tự gắn vào tài khoản cục bộ có cùng email, vì tài khoản đó có thể đã được người khác đăng ký
+	if info.Email == "" {
+		return nil, ErrSAMLEmailRequired
+	}
+	existing, err := s.userRepo.FindByEmail(info.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrSAMLAccountConflict
+	}
+
+	user, err := provisionUser(s.userRepo, info)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.identityRepo.Create(&models.UserIdentity{
+		UserID:      user.ID,
+		Provider:    identityProvider,
+		Subject:     nameID,
+		Email:       info.Email,
+		LastLoginAt: &now,
+	}); err != nil {
+		return nil, err
+	}
+	s.logger.Infof("Provisioned user %s from SAML provider %s", user.ID, p.Name)
+	return user, nil
+}
+
+// samlAttributeValues là các thuộc tính của assertion, tra theo Name hoặc FriendlyName
+type samlAttributeValues map[string][]string
+
+// samlAttributes gom các thuộc tính trong mọi AttributeStatement của assertion
+func samlAttributes(assertion *saml.Assertion) samlAttributeValues {
+	attributes := make(samlAttributeValues)
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			var values []string
+			for _, value := range attribute.Values {
+				if v := strings.TrimSpace(value.Value); v != "" {
+					values = append(values, v)
+				}
+			}
+			for _, name := range []string{attribute.Name, attribute.FriendlyName} {
+				if name != "" {
+					attributes[name] = append(attributes[name], values...)
+				}
+			}
+		}
+	}
+	return attributes
+}
+
+// values trả về các giá trị của thuộc tính
+func (a samlAttributeValues) values(name string) []string {
+	if name == "" {
+		return nil
+	}
+	return a[name]
+}
+
+// first trả về giá trị đầu tiên của thuộc tính, rỗng nếu không có
+func (a samlAttributeValues) first(name string) string {
+	if values := a.values(name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// mapSAMLRole trả về role của mục ROLE_MAPPING đầu tiên khớp một giá trị của thuộc tính role, hoặc role mặc định
+func mapSAMLRole(p config.SAMLProvider, values []string) string {
+	for _, mapping := range p.RoleMappings {
+		for _, value := range values {
+			if strings.EqualFold(mapping.Value, value) {
+				return mapping.Role
+			}
+		}
+	}
+	return p.DefaultRole
+}
@@ -0,0 +1,444 @@
+package services
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/keys"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/beevik/etree"
+	"github.com/crewjam/saml"
+	"github.com/google/uuid"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	testIdPEntityID = "https://idp.example.com/metadata"
+	testSAMLBaseURL = "http://localhost:8080/api/auth/saml/corp"
+)
+
+// samlKeyPair là khóa RSA và chứng chỉ tự ký của SP hoặc IdP
+type samlKeyPair struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+// Sinh khóa RSA chậm nên các khóa được tạo một lần cho cả package
+var (
+	samlKeysOnce                          sync.Once
+	testSPKeys, testIdPKeys, testEvilKeys samlKeyPair
+)
+
+func samlTestKeys(t *testing.T) {
+	t.Helper()
+	samlKeysOnce.Do(func() {
+		testSPKeys = newSAMLKeyPair(t, "sp.example.com")
+		testIdPKeys = newSAMLKeyPair(t, "idp.example.com")
+		testEvilKeys = newSAMLKeyPair(t, "idp.example.com")
+	})
+}
+
+func newSAMLKeyPair(t *testing.T, commonName string) samlKeyPair {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return samlKeyPair{key: key, cert: cert}
+}
+
+// samlHarness gồm SAMLService với IdP "corp" (metadata chứa chứng chỉ ký của testIdPKeys)
+// cùng các repository trong bộ nhớ
+type samlHarness struct {
+	service    SAMLService
+	users      *fakeUserRepo
+	identities *fakeIdentityRepo
+	auth       *fakeAuthService
+}
+
+func newSAMLHarness(t *testing.T) *samlHarness {
+	t.Helper()
+	samlTestKeys(t)
+	dir := t.TempDir()
+
+	keyFile := filepath.Join(dir, "sp.key")
+	certFile := filepath.Join(dir, "sp.crt")
+	writePEM(t, keyFile, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(testSPKeys.key))
+	writePEM(t, certFile, "CERTIFICATE", testSPKeys.cert.Raw)
+
+	metadataFile := filepath.Join(dir, "idp.xml")
+	metadata := fmt.Sprintf(`<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="%s">
+  <IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <KeyDescriptor use="signing">
+      <KeyInfo xmlns="http://www.w3.org/2000/09/xmldsig#"><X509Data><X509Certificate>%s</X509Certificate></X509Data></KeyInfo>
+    </KeyDescriptor>
+    <SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso"/>
+  </IDPSSODescriptor>
+</EntityDescriptor>`, testIdPEntityID, base64.StdEncoding.EncodeToString(testIdPKeys.cert.Raw))
+	if err := os.WriteFile(metadataFile, []byte(metadata), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		OAuthIssuer:    "http://localhost:8080",
+		SAMLSPKeyFile:  keyFile,
+		SAMLSPCertFile: certFile,
+		SAMLRequestTTL: 10 * time.Minute,
+		SAMLProviders: []config.SAMLProvider{{
+			Name:          "corp",
+			MetadataFile:  metadataFile,
+			EmailAttr:     "email",
+			FirstNameAttr: "givenName",
+			LastNameAttr:  "sn",
+			RoleAttr:      "groups",
+			RoleMappings:  []config.SAMLRoleMapping{{Value: "Admins", Role: RoleAdmin}},
+			DefaultRole:   RoleUser,
+		}},
+	}
+
+	h := &samlHarness{users: newFakeUserRepo(), identities: &fakeIdentityRepo{}, auth: &fakeAuthService{}}
+	keyring := keys.NewKeyring(keys.NewHMACKey([]byte("0123456789abcdef0123456789abcdef"), "test"))
+	service, err := NewSAMLService(h.identities, h.users, repository.NewMemoryRevocationStore(), h.auth, keyring, http.DefaultClient, cfg, newTestLogger())
+	if err != nil {
+		t.Fatalf("NewSAMLService: %v", err)
+	}
+	h.service = service
+	return h
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// begin bắt đầu đăng nhập và đọc ID của AuthnRequest từ URL chuyển hướng, như IdP sẽ làm
+func (h *samlHarness) begin(t *testing.T) (requestID, requestCookie string) {
+	t.Helper()
+	redirectURL, requestCookie, err := h.service.Begin("corp")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request saml.AuthnRequest
+	if err := xml.Unmarshal(raw, &request); err != nil {
+		t.Fatal(err)
+	}
+	return request.ID, requestCookie
+}
+
+// newAssertion tạo assertion hợp lệ (chưa ký) cho user ann@example.com, trả lời request có ID cho trước
+func newAssertion(requestID string, groups ...string) *saml.Assertion {
+	now := time.Now()
+	attribute := func(name string, values ...string) saml.Attribute {
+		attr := saml.Attribute{Name: name, NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"}
+		for _, value := range values {
+			attr.Values = append(attr.Values, saml.AttributeValue{Type: "xs:string", Value: value})
+		}
+		return attr
+	}
+	return &saml.Assertion{
+		ID:           "id-" + uuid.NewString(),
+		IssueInstant: now,
+		Version:      "2.0",
+		Issuer:       saml.Issuer{Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity", Value: testIdPEntityID},
+		Subject: &saml.Subject{
+			NameID: &saml.NameID{Format: string(saml.EmailAddressNameIDFormat), Value: "ann@example.com"},
+			SubjectConfirmations: []saml.SubjectConfirmation{{
+				Method: "urn:oasis:names:tc:SAML:2.0:cm:bearer",
+				SubjectConfirmationData: &saml.SubjectConfirmationData{
+					InResponseTo: requestID,
+					NotOnOrAfter: now.Add(5 * time.Minute),
+					Recipient:    testSAMLBaseURL + "/acs",
+				},
+			}},
+		},
+		Conditions: &saml.Conditions{
+			NotBefore:            now.Add(-time.Minute),
+			NotOnOrAfter:         now.Add(5 * time.Minute),
+			AudienceRestrictions: []saml.AudienceRestriction{{Audience: saml.Audience{Value: testSAMLBaseURL + "/metadata"}}},
+		},
+		AttributeStatements: []saml.AttributeStatement{{Attributes: []saml.Attribute{
+			attribute("email", "ann@example.com"),
+			attribute("givenName", "Ann"),
+			attribute("sn", "Lee"),
+			attribute("groups", groups...),
+		}}},
+	}
+}
+
+// signAssertion ký assertion (enveloped signature) bằng khóa cho trước, như IdP
+func signAssertion(t *testing.T, keys samlKeyPair, assertion *saml.Assertion) {
+	t.Helper()
+	ctx := dsig.NewDefaultSigningContext(dsig.TLSCertKeyStore(tls.Certificate{
+		Certificate: [][]byte{keys.cert.Raw},
+		PrivateKey:  keys.key,
+	}))
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	if err := ctx.SetSignatureMethod(dsig.RSASHA256SignatureMethod); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := ctx.SignEnveloped(assertion.Element())
+	if err != nil {
+		t.Fatal(err)
+	}
+	children := signed.ChildElements()
+	assertion.Signature = children[len(children)-1]
+}
+
+// encodeResponse đóng gói assertion trong Response gửi tới ACS, mã hóa base64 như form HTTP-POST
+func encodeResponse(t *testing.T, inResponseTo string, assertion *saml.Assertion) string {
+	t.Helper()
+	response := &saml.Response{
+		ID:           "id-" + uuid.NewString(),
+		InResponseTo: inResponseTo,
+		Version:      "2.0",
+		IssueInstant: time.Now(),
+		Destination:  testSAMLBaseURL + "/acs",
+		Issuer:       &saml.Issuer{Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity", Value: testIdPEntityID},
+		Status:       saml.Status{StatusCode: saml.StatusCode{Value: saml.StatusSuccess}},
+		Assertion:    assertion,
+	}
+	doc := etree.NewDocument()
+	doc.SetRoot(response.Element())
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestSAMLAcceptsSignedAssertion(t *testing.T) {
+	h := newSAMLHarness(t)
+	requestID, cookie := h.begin(t)
+	assertion := newAssertion(requestID, "Staff")
+	signAssertion(t, testIdPKeys, assertion)
+
+	result, err := h.service.ACS("corp", encodeResponse(t, requestID, assertion), cookie, ClientInfo{})
+	if err != nil {
+		t.Fatalf("ACS: %v", err)
+	}
+	if result.User.Email != "ann@example.com" || result.User.FirstName != "Ann" || result.User.LastName != "Lee" {
+		t.Fatalf("unexpected user: %+v", result.User)
+	}
+	identity, _ := h.identities.FindByProviderSubject(samlIdentityPrefix+"corp", "ann@example.com")
+	if identity == nil || identity.UserID != result.User.ID {
+		t.Fatalf("identity = %+v, want a link to user %s", identity, result.User.ID)
+	}
+	if len(h.auth.logins) != 1 {
+		t.Fatalf("logins = %d, want 1", len(h.auth.logins))
+	}
+}
+
+func TestSAMLRoleMapping(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []string
+		want   string
+	}{
+		{"mapped group", []string{"Staff", "Admins"}, RoleAdmin},
+		{"mapping is case-insensitive", []string{"admins"}, RoleAdmin},
+		{"unmapped group", []string{"Staff"}, RoleUser},
+		{"no group", nil, RoleUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newSAMLHarness(t)
+			requestID, cookie := h.begin(t)
+			assertion := newAssertion(requestID, tt.groups...)
+			signAssertion(t, testIdPKeys, assertion)
+
+			result, err := h.service.ACS("corp", encodeResponse(t, requestID, assertion), cookie, ClientInfo{})
+			if err != nil {
+				t.Fatalf("ACS: %v", err)
+			}
+			if result.User.Role != tt.want {
+				t.Fatalf("role = %q, want %q", result.User.Role, tt.want)
+			}
+		})
+	}
+}
+
+func TestSAMLSyncsRoleOfLinkedUser(t *testing.T) {
+	h := newSAMLHarness(t)
+	existing := h.users.add(&models.User{Username: "ann", Email: "ann@example.com", Role: RoleAdmin})
+	if err := h.identities.Create(&models.UserIdentity{UserID: existing.ID, Provider: samlIdentityPrefix + "corp", Subject: "ann@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	h.users.add(&models.User{Username: "root", Email: "root@example.com", Role: RoleAdmin})
+
+	// User bị gỡ khỏi nhóm Admins tại IdP thì mất quyền admin ở lần đăng nhập sau
+	requestID, cookie := h.begin(t)
+	assertion := newAssertion(requestID, "Staff")
+	signAssertion(t, testIdPKeys, assertion)
+	if _, err := h.service.ACS("corp", encodeResponse(t, requestID, assertion), cookie, ClientInfo{}); err != nil {
+		t.Fatalf("ACS: %v", err)
+	}
+	if stored, _ := h.users.FindByID(existing.ID); stored.Role != RoleUser {
+		t.Fatalf("role = %q, want %q", stored.Role, RoleUser)
+	}
+}
+
+func TestSAMLRejectsInvalidSignature(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, assertion *saml.Assertion)
+	}{
+		{"unsigned", func(t *testing.T, assertion *saml.Assertion) {}},
+		{"signed by another key", func(t *testing.T, assertion *saml.Assertion) {
+			signAssertion(t, testEvilKeys, assertion)
+		}},
+		{"attribute changed after signing", func(t *testing.T, assertion *saml.Assertion) {
+			signAssertion(t, testIdPKeys, assertion)
+			groups := &assertion.AttributeStatements[0].Attributes[3]
+			groups.Values = append(groups.Values, saml.AttributeValue{Type: "xs:string", Value: "Admins"})
+		}},
+		{"subject changed after signing", func(t *testing.T, assertion *saml.Assertion) {
+			signAssertion(t, testIdPKeys, assertion)
+			assertion.Subject.NameID.Value = "root@example.com"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newSAMLHarness(t)
+			requestID, cookie := h.begin(t)
+			assertion := newAssertion(requestID, "Staff")
+			tt.modify(t, assertion)
+
+			_, err := h.service.ACS("corp", encodeResponse(t, requestID, assertion), cookie, ClientInfo{})
+			if !errors.Is(err, ErrInvalidSAMLResponse) {
+				t.Fatalf("got %v, want ErrInvalidSAMLResponse", err)
+			}
+			if h.users.count() != 0 || len(h.auth.logins) != 0 {
+				t.Fatal("no user must be provisioned or logged in")
+			}
+		})
+	}
+}
+
+func TestSAMLRejectsWrongAudience(t *testing.T) {
+	h := newSAMLHarness(t)
+	requestID, cookie := h.begin(t)
+	assertion := newAssertion(requestID)
+	// Assertion IdP cấp cho một service provider khác
+	assertion.Conditions.AudienceRestrictions[0].Audience.Value = "https://other-sp.example.com/metadata"
+	signAssertion(t, testIdPKeys, assertion)
+
+	if _, err := h.service.ACS("corp", encodeResponse(t, requestID, assertion), cookie, ClientInfo{}); !errors.Is(err, ErrInvalidSAMLResponse) {
+		t.Fatalf("got %v, want ErrInvalidSAMLResponse", err)
+	}
+}
+
+func TestSAMLRejectsResponseToAnotherRequest(t *testing.T) {
+	h := newSAMLHarness(t)
+	_, cookie := h.begin(t)
+	// Response hợp lệ nhưng trả lời AuthnRequest của trình duyệt khác
+	otherRequestID, _ := h.begin(t)
+	assertion := newAssertion(otherRequestID)
+	signAssertion(t, testIdPKeys, assertion)
+
+	if _, err := h.service.ACS("corp", encodeResponse(t, otherRequestID, assertion), cookie, ClientInfo{}); !errors.Is(err, ErrInvalidSAMLResponse) {
+		t.Fatalf("got %v, want ErrInvalidSAMLResponse", err)
+	}
+}
+
+func TestSAMLRejectsUnsolicitedResponse(t *testing.T) {
+	h := newSAMLHarness(t)
+	_, cookie := h.begin(t)
+	// Assertion do IdP tự gửi tới (IdP-initiated), không trả lời request nào
+	assertion := newAssertion("")
+	signAssertion(t, testIdPKeys, assertion)
+
+	if _, err := h.service.ACS("corp", encodeResponse(t, "", assertion), cookie, ClientInfo{}); !errors.Is(err, ErrInvalidSAMLResponse) {
+		t.Fatalf("got %v, want ErrInvalidSAMLResponse", err)
+	}
+}
+
+func TestSAMLRejectsReplayedAssertion(t *testing.T) {
+	h := newSAMLHarness(t)
+	requestID, cookie := h.begin(t)
+	assertion := newAssertion(requestID)
+	signAssertion(t, testIdPKeys, assertion)
+	response := encodeResponse(t, requestID, assertion)
+
+	if _, err := h.service.ACS("corp", response, cookie, ClientInfo{}); err != nil {
+		t.Fatalf("first ACS: %v", err)
+	}
+	if _, err := h.service.ACS("corp", response, cookie, ClientInfo{}); !errors.Is(err, ErrInvalidSAMLResponse) {
+		t.Fatalf("replay: got %v, want ErrInvalidSAMLResponse", err)
+	}
+	if len(h.auth.logins) != 1 {
+		t.Fatalf("logins = %d, want 1", len(h.auth.logins))
+	}
+}
+
+func TestSAMLRejectsInvalidRequestCookie(t *testing.T) {
+	h := newSAMLHarness(t)
+	requestID, _ := h.begin(t)
+	assertion := newAssertion(requestID)
+	signAssertion(t, testIdPKeys, assertion)
+
+	if _, err := h.service.ACS("corp", encodeResponse(t, requestID, assertion), "", ClientInfo{}); !errors.Is(err, ErrInvalidSAMLRequest) {
+		t.Fatalf("got %v, want ErrInvalidSAMLRequest", err)
+	}
+}
+
+func TestSAMLAccountConflict(t *testing.T) {
+	h := newSAMLHarness(t)
+	h.users.add(&models.User{Username: "ann", Email: "ann@example.com"})
+	requestID, cookie := h.begin(t)
+	assertion := newAssertion(requestID)
+	signAssertion(t, testIdPKeys, assertion)
+
+	// Không tự gắn NameID vào tài khoản cục bộ có cùng email
+	if _, err := h.service.ACS("corp", encodeResponse(t, requestID, assertion), cookie, ClientInfo{}); !errors.Is(err, ErrSAMLAccountConflict) {
+		t.Fatalf("got %v, want ErrSAMLAccountConflict", err)
+	}
+}
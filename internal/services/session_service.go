@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// lastSeenUpdateInterval giới hạn số lần ghi LastSeenAt vào database
+const lastSeenUpdateInterval = time.Minute
+
+// ClientInfo chứa thông tin thiết bị của client khi đăng nhập
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// SessionService định nghĩa interface cho các phương thức quản lý session đăng nhập
+type SessionService interface {
+	CreateSession(userID uuid.UUID, client ClientInfo) (*models.Session, error)
+	CheckSession(sessionID uuid.UUID) (bool, error)
+	ExtendSession(sessionID uuid.UUID) error
+	ListSessions(userID, currentSessionID uuid.UUID) ([]models.SessionResponse, error)
+	RevokeSession(userID, sessionID uuid.UUID) error
+	RevokeOtherSessions(userID, currentSessionID uuid.UUID) error
+	RevokeAllSessions(userID uuid.UUID) error
+}
+
+// sessionService struct triển khai SessionService interface
+type sessionService struct {
+	sessionRepo      repository.SessionRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	config           *config.Config
+	logger           *logger.Logger
+}
+
+// NewSessionService tạo một instance mới của SessionService
+func NewSessionService(sessionRepo repository.SessionRepository, refreshTokenRepo repository.RefreshTokenRepository, config *config.Config, logger *logger.Logger) SessionService {
+	return &sessionService{
+		sessionRepo:      sessionRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		config:           config,
+		logger:           logger,
+	}
+}
+
+// CreateSession ghi nhận một session mới cho lần đăng nhập, hết hạn cùng refresh token đầu tiên của session
+func (s *sessionService) CreateSession(userID uuid.UUID, client ClientInfo) (*models.Session, error) {
+	userAgent := client.UserAgent
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	session := &models.Session{
+		UserID:    userID,
+		UserAgent: userAgent,
+		IPAddress: client.IPAddress,
+		ExpiresAt: time.Now().Add(s.config.RefreshTokenTTL),
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// CheckSession kiểm tra session còn hiệu lực không và cập nhật thời điểm hoạt động gần nhất
+func (s *sessionService) CheckSession(sessionID uuid.UUID) (bool, error) {
+	session, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil {
+		return false, err
+	}
+	if session == nil || session.IsRevoked() || session.IsExpired() {
+		return false, nil
+	}
+
+	// Chỉ ghi lại LastSeenAt khi đã đủ lâu để tránh ghi database ở mọi request
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) > lastSeenUpdateInterval {
+		if err := s.sessionRepo.UpdateLastSeen(sessionID, now); err != nil {
+			s.logger.Errorf("Error touching session %s: %v", sessionID, err)
+		}
+	}
+	return true, nil
+}
+
+// ExtendSession gia hạn session thêm REFRESH_TOKEN_TTL khi refresh token của session được xoay vòng
+func (s *sessionService) ExtendSession(sessionID uuid.UUID) error {
+	return s.sessionRepo.Extend(sessionID, time.Now().Add(s.config.RefreshTokenTTL))
+}
+
+// ListSessions lấy danh sách session đang hoạt động của user
+func (s *sessionService) ListSessions(userID, currentSessionID uuid.UUID) ([]models.SessionResponse, error) {
+	sessions, err := s.sessionRepo.ListActiveByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionResponses := make([]models.SessionResponse, len(sessions))
+	for i, session := range sessions {
+		sessionResponses[i] = session.ToSessionResponse(currentSessionID)
+	}
+	return sessionResponses, nil
+}
+
+// RevokeSession thu hồi một session của user cùng với các refresh token của session đó
+func (s *sessionService) RevokeSession(userID, sessionID uuid.UUID) error {
+	session, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil {
+		return err
+	}
+	// Không cho phép thu hồi session của user khác
+	if session == nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	if err := s.sessionRepo.Revoke(sessionID); err != nil {
+		return err
+	}
+	return s.refreshTokenRepo.RevokeFamily(sessionID)
+}
+
+// RevokeOtherSessions thu hồi tất cả session của user trừ session hiện tại
+func (s *sessionService) RevokeOtherSessions(userID, currentSessionID uuid.UUID) error {
+	sessions, err := s.sessionRepo.ListActiveByUser(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID == currentSessionID {
+			continue
+		}
+		if err := s.RevokeSession(userID, session.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RevokeAllSessions thu hồi tất cả session và refresh token của user (đăng xuất khỏi mọi thiết bị)
+func (s *sessionService) RevokeAllSessions(userID uuid.UUID) error {
+	if err := s.sessionRepo.RevokeByUser(userID); err != nil {
+		return err
+	}
+	return s.refreshTokenRepo.RevokeByUser(userID)
+}
+
+// StartSessionCleanup chạy một goroutine định kỳ xóa các session đã hết hạn.
+// Hàm trả về một hàm stop để dừng goroutine khi tắt server.
+func StartSessionCleanup(repo repository.SessionRepository, interval time.Duration, logger *logger.Logger) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := repo.DeleteExpired(time.Now())
+				if err != nil {
+					logger.Errorf("Session cleanup error: %v", err)
+					continue
+				}
+				if deleted > 0 {
+					logger.Infof("Session cleanup removed %d expired sessions", deleted)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
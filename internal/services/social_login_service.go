@@ -0,0 +1,410 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/keys"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/Thanhdat-debug/demo_login/pkg/oauth2client"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrSocialProviderNotFound = errors.New("social login provider not found")
+	ErrInvalidSocialState     = errors.New("invalid or expired social login state")
+	ErrSocialLoginFailed      = errors.New("social login failed")
+	ErrSocialEmailRequired    = errors.New("identity provider did not return an email address")
+	ErrSocialEmailConflict    = errors.New("an account with this email already exists")
+	ErrSocialAccountNotFound  = errors.New("no account is linked to this identity")
+	ErrIdentityAlreadyLinked  = errors.New("identity is already linked")
+	ErrIdentityNotFound       = errors.New("identity not found")
+)
+
+// tokenTypeSocialState là token_type của cookie giữ state, nonce và PKCE verifier của một lần đăng nhập
+const tokenTypeSocialState = "social_state"
+
+// socialProviderTimeout giới hạn thời gian gọi tới identity provider trong một callback
+const socialProviderTimeout = 15 * time.Second
+
+// socialStateClaims là claims của cookie state. Cookie chỉ nằm trong trình duyệt đã bắt đầu đăng nhập,
+// nên callback với state của người khác (login CSRF) bị từ chối.
+type socialStateClaims struct {
+	Provider   string `json:"provider"`
+	State      string `json:"state"`
+	Nonce      string `json:"nonce"`
+	Verifier   string `json:"verifier"`
+	LinkUserID string `json:"link_user_id,omitempty"` // Có giá trị khi user đã đăng nhập liên kết thêm provider
+	TokenType  string `json:"token_type"`
+	jwt.RegisteredClaims
+}
+
+// SocialLoginResult là kết quả của callback: kết quả đăng nhập, hoặc liên kết vừa tạo khi user liên kết thêm provider
+type SocialLoginResult struct {
+	Login    *LoginResult
+	Identity *models.UserIdentity
+}
+
+// SocialLoginService định nghĩa interface cho đăng nhập bằng identity provider bên ngoài
+type SocialLoginService interface {
+	Providers() []string
+	Begin(providerName string, linkUserID uuid.UUID) (authURL, stateCookie string, err error)
+	Callback(providerName, state, code, stateCookie string, client ClientInfo) (*SocialLoginResult, error)
+	ListIdentities(userID uuid.UUID) ([]models.UserIdentity, error)
+	Unlink(userID, identityID uuid.UUID) error
+}
+
+// socialLoginService struct triển khai SocialLoginService interface
+type socialLoginService struct {
+	providers    map[string]*oauth2client.Provider
+	identityRepo repository.UserIdentityRepository
+	userRepo     repository.UserRepository
+	authService  AuthService
+	keyring      *keys.Keyring
+	config       *config.Config
+	logger       *logger.Logger
+}
+
+// NewSocialLoginService tạo một instance mới của SocialLoginService
+func NewSocialLoginService(providers []*oauth2client.Provider, identityRepo repository.UserIdentityRepository, userRepo repository.UserRepository, authService AuthService, keyring *keys.Keyring, config *config.Config, logger *logger.Logger) SocialLoginService {
+	byName := make(map[string]*oauth2client.Provider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+	return &socialLoginService{
+		providers:    byName,
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		authService:  authService,
+		keyring:      keyring,
+		config:       config,
+		logger:       logger,
+	}
+}
+
+// NewSocialProviders tạo client cho các provider trong cấu hình. Provider google và github dùng cấu hình sẵn,
+// các trường được khai báo trong .env sẽ ghi đè. Callback URL là <OAUTH_ISSUER>/api/auth/social/<tên>/callback.
+func NewSocialProviders(cfg *config.Config, httpClient *http.Client) ([]*oauth2client.Provider, error) {
+	var providers []*oauth2client.Provider
+	for _, p := range cfg.SocialProviders {
+		if managedIdentity(p.Name) {
+			return nil, fmt.Errorf("social provider name %s is reserved", p.Name)
+		}
+		providerConfig, preset := oauth2client.Preset(p.Name)
+		providerConfig.Name = p.Name
+		providerConfig.ClientID = p.ClientID
+		providerConfig.ClientSecret = p.ClientSecret
+		providerConfig.RedirectURL = cfg.OAuthIssuer + "/api/auth/social/" + p.Name + "/callback"
+		overrideString(&providerConfig.Type, p.Type)
+		overrideString(&providerConfig.Issuer, p.Issuer)
+		overrideString(&providerConfig.AuthURL, p.AuthURL)
+		overrideString(&providerConfig.TokenURL, p.TokenURL)
+		overrideString(&providerConfig.UserInfoURL, p.UserInfoURL)
+		overrideString(&providerConfig.EmailsURL, p.EmailsURL)
+		if len(p.Scopes) > 0 {
+			providerConfig.Scopes = p.Scopes
+		}
+
+		if !preset {
+			providerConfig.Fields = oauth2client.DefaultFields
+		}
+		overrideString(&providerConfig.Fields.Subject, p.SubjectField)
+		overrideString(&providerConfig.Fields.Username, p.UsernameField)
+		overrideString(&providerConfig.Fields.Email, p.EmailField)
+		overrideString(&providerConfig.Fields.EmailVerified, p.EmailVerifiedField)
+		overrideString(&providerConfig.Fields.GivenName, p.GivenNameField)
+		overrideString(&providerConfig.Fields.FamilyName, p.FamilyNameField)
+
+		if providerConfig.Type == "" {
+			providerConfig.Type = oauth2client.TypeOIDC
+		}
+		if providerConfig.ClientID == "" {
+			return nil, fmt.Errorf("social provider %s: client id is required", p.Name)
+		}
+		switch providerConfig.Type {
+		case oauth2client.TypeOIDC:
+			if providerConfig.Issuer == "" && (providerConfig.AuthURL == "" || providerConfig.TokenURL == "") {
+				return nil, fmt.Errorf("social provider %s: issuer or auth/token urls are required", p.Name)
+			}
+			if len(providerConfig.Scopes) == 0 {
+				providerConfig.Scopes = []string{OIDCScopeOpenID, OIDCScopeEmail, OIDCScopeProfile}
+			}
+		case oauth2client.TypeOAuth2:
+			if providerConfig.AuthURL == "" || providerConfig.TokenURL == "" || providerConfig.UserInfoURL == "" {
+				return nil, fmt.Errorf("social provider %s: auth, token and userinfo urls are required", p.Name)
+			}
+		default:
+			return nil, fmt.Errorf("social provider %s: unknown type %s", p.Name, providerConfig.Type)
+		}
+
+		providers = append(providers, oauth2client.NewProvider(providerConfig, httpClient))
+	}
+	return providers, nil
+}
+
+// overrideString gán value vào target nếu value khác rỗng
+func overrideString(target *string, value string) {
+	if value != "" {
+		*target = value
+	}
+}
+
+// Providers trả về tên các provider đã cấu hình
+func (s *socialLoginService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Begin tạo URL chuyển user tới provider và giá trị cookie state cho trình duyệt.
+// linkUserID khác uuid.Nil nghĩa là user đang đăng nhập muốn liên kết thêm provider.
+func (s *socialLoginService) Begin(providerName string, linkUserID uuid.UUID) (string, string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrSocialProviderNotFound
+	}
+
+	state, err := generateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := generateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := generateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	ctx, cancel := context.WithTimeout(context.Background(), socialProviderTimeout)
+	defer cancel()
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrSocialLoginFailed, err)
+	}
+
+	now := time.Now()
+	claims := socialStateClaims{
+		Provider:  providerName,
+		State:     state,
+		Nonce:     nonce,
+		Verifier:  verifier,
+		TokenType: tokenTypeSocialState,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.config.SocialStateTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if linkUserID != uuid.Nil {
+		claims.LinkUserID = linkUserID.String()
+	}
+	stateCookie, err := s.keyring.Sign(claims)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, stateCookie, nil
+}
+
+// Callback xử lý redirect từ provider: kiểm tra state, đổi code lấy danh tính của user tại provider,
+// sau đó đăng nhập (hoặc liên kết provider với user đang đăng nhập)
+func (s *socialLoginService) Callback(providerName, state, code, stateCookie string, client ClientInfo) (*SocialLoginResult, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrSocialProviderNotFound
+	}
+
+	var claims socialStateClaims
+	parsed, err := jwt.ParseWithClaims(stateCookie, &claims, s.keyring.KeyFunc)
+	if err != nil || !parsed.Valid || claims.TokenType != tokenTypeSocialState || claims.Provider != providerName ||
+		state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(claims.State)) != 1 {
+		return nil, ErrInvalidSocialState
+	}
+	if code == "" {
+		return nil, ErrSocialLoginFailed
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), socialProviderTimeout)
+	defer cancel()
+	token, err := provider.Exchange(ctx, code, claims.Verifier)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSocialLoginFailed, err)
+	}
+	identity, err := provider.Identity(ctx, token, claims.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSocialLoginFailed, err)
+	}
+
+	existing, err := s.identityRepo.FindByProviderSubject(providerName, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.LinkUserID != "" {
+		linkUserID, err := uuid.Parse(claims.LinkUserID)
+		if err != nil {
+			return nil, ErrInvalidSocialState
+		}
+		linked, err := s.link(linkUserID, providerName, identity, existing)
+		if err != nil {
+			return nil, err
+		}
+		return &SocialLoginResult{Identity: linked}, nil
+	}
+
+	user, err := s.resolveUser(providerName, identity, existing)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.authService.LoginWithoutPassword(user, providerName, client)
+	if err != nil {
+		return nil, err
+	}
+	return &SocialLoginResult{Login: result}, nil
+}
+
+// link liên kết danh tính tại provider với user đang đăng nhập
+func (s *socialLoginService) link(userID uuid.UUID, providerName string, identity *oauth2client.Identity, existing *models.UserIdentity) (*models.UserIdentity, error) {
+	if existing != nil {
+		if existing.UserID != userID {
+			return nil, ErrIdentityAlreadyLinked
+		}
+		return existing, nil
+	}
+
+	current, err := s.identityRepo.FindByUserProvider(userID, providerName)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		// User đã liên kết một tài khoản khác của cùng provider
+		return nil, ErrIdentityAlreadyLinked
+	}
+
+	return s.createIdentity(userID, providerName, identity)
+}
+
+// resolveUser tìm user ứng với danh tính tại provider:
+//  1. Danh tính đã được liên kết: dùng user đã liên kết
+//  2. Provider xác nhận email và SOCIAL_LINK_BY_EMAIL bật: liên kết với user có cùng email đã xác minh
+//  3. Chưa có user với email đó và SOCIAL_AUTO_PROVISION bật: tạo user mới
+//
+// Tài khoản có cùng email nhưng không thể tự liên kết phải đăng nhập bằng cách khác rồi liên kết thủ công.
+func (s *socialLoginService) resolveUser(providerName string, identity *oauth2client.Identity, existing *models.UserIdentity) (*models.User, error) {
+	now := time.Now()
+	if existing != nil {
+		user, err := s.userRepo.FindByID(existing.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, ErrSocialAccountNotFound
+		}
+		if err := s.identityRepo.UpdateLogin(existing.ID, identity.Email, now); err != nil {
+			s.logger.Errorf("Failed to update identity %s: %v", existing.ID, err)
+		}
+		return user, nil
+	}
+
+	if identity.Email == "" {
+		return nil, ErrSocialEmailRequired
+	}
+	user, err := s.userRepo.FindByEmail(identity.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user != nil {
+		// Chỉ tự liên kết khi cả provider và service này đều đã xác minh email, tránh chiếm tài khoản
+		// bằng một tài khoản tại provider (hoặc tại đây) đăng ký với email của người khác
+		if !s.config.SocialLinkByEmail || !identity.EmailVerified || !user.EmailVerified {
+			return nil, ErrSocialEmailConflict
+		}
+		// User đến từ LDAP/SAML chỉ đăng nhập qua nguồn đó, không tự liên kết thêm provider
+		managed, err := hasManagedIdentity(s.identityRepo, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if managed {
+			return nil, ErrManagedAccount
+		}
+		current, err := s.identityRepo.FindByUserProvider(user.ID, providerName)
+		if err != nil {
+			return nil, err
+		}
+		if current != nil {
+			return nil, ErrSocialEmailConflict
+		}
+	} else {
+		if !s.config.SocialAutoProvision {
+			return nil, ErrSocialAccountNotFound
+		}
+		user, err = provisionUser(s.userRepo, provisionedUser{
+			Username:      identity.Username,
+			Email:         identity.Email,
+			FirstName:     identity.GivenName,
+			LastName:      identity.FamilyName,
+			EmailVerified: identity.EmailVerified,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.logger.Infof("Provisioned user %s from %s login", user.ID, providerName)
+	}
+
+	if _, err := s.createIdentity(user.ID, providerName, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// createIdentity lưu liên kết mới
+func (s *socialLoginService) createIdentity(userID uuid.UUID, providerName string, identity *oauth2client.Identity) (*models.UserIdentity, error) {
+	now := time.Now()
+	linked := &models.UserIdentity{
+		UserID:      userID,
+		Provider:    providerName,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		LastLoginAt: &now,
+	}
+	if err := s.identityRepo.Create(linked); err != nil {
+		return nil, err
+	}
+	return linked, nil
+}
+
+// ListIdentities lấy danh sách provider user đã liên kết
+func (s *socialLoginService) ListIdentities(userID uuid.UUID) ([]models.UserIdentity, error) {
+	return s.identityRepo.ListByUser(userID)
+}
+
+// Unlink hủy liên kết một provider của user. User vẫn đăng nhập được bằng mật khẩu
+// (hoặc đặt mật khẩu qua chức năng quên mật khẩu nếu user được tạo tự động).
+func (s *socialLoginService) Unlink(userID, identityID uuid.UUID) error {
+	identity, err := s.identityRepo.FindByID(identityID)
+	if err != nil {
+		return err
+	}
+	// Liên kết LDAP/SAML do tổ chức quản lý, không hủy được từ phía user
+	if identity == nil || identity.UserID != userID || managedIdentity(identity.Provider) {
+		return ErrIdentityNotFound
+	}
+	return s.identityRepo.Delete(identityID)
+}
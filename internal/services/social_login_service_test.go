@@ -0,0 +1,525 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/keys"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	testOIDCClientID   = "corp-client"
+	testGitHubClientID = "github-client"
+)
+
+// idpAccount là tài khoản của user tại identity provider giả lập
+type idpAccount struct {
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	// Emails là danh sách trả về từ /user/emails kiểu GitHub
+	Emails []idpEmail
+}
+
+type idpEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// idpGrant là một authorization code đã cấp, cùng các tham số của request authorize
+type idpGrant struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+// testIdP là identity provider chạy trên httptest: discovery, authorize (giả lập user đồng ý),
+// token, userinfo kiểu OIDC, /user và /user/emails kiểu GitHub
+type testIdP struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu      sync.Mutex
+	account idpAccount
+	grants  map[string]idpGrant
+	tokens  map[string]idpGrant
+
+	// Các giá trị ghi đè để giả lập ID token sai
+	audience string
+	nonce    *string
+}
+
+func newTestIdP(t *testing.T, account idpAccount) *testIdP {
+	t.Helper()
+	idp := &testIdP{t: t, account: account, grants: map[string]idpGrant{}, tokens: map[string]idpGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"userinfo_endpoint":      idp.server.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", idp.handleToken)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := idp.grantForRequest(r); !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		account := idp.currentAccount()
+		writeTestJSON(w, map[string]interface{}{
+			"sub":                account.Subject,
+			"preferred_username": account.Username,
+			"email":              account.Email,
+			"email_verified":     account.EmailVerified,
+			"given_name":         account.GivenName,
+		})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := idp.grantForRequest(r); !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// GitHub trả id dạng số và email công khai có thể rỗng
+		account := idp.currentAccount()
+		writeTestJSON(w, map[string]interface{}{
+			"id":    json.Number(account.Subject),
+			"login": account.Username,
+			"email": nil,
+		})
+	})
+	mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := idp.grantForRequest(r); !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeTestJSON(w, idp.currentAccount().Emails)
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize giả lập user đăng nhập và đồng ý tại provider: kiểm tra URL authorize và trả về code, state
+func (idp *testIdP) authorize(authURL string) (code, state string) {
+	idp.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatalf("parse auth url: %v", err)
+	}
+	query := u.Query()
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		idp.t.Fatalf("authorize request must use the code flow with PKCE S256: %s", authURL)
+	}
+
+	code = randomTestString(idp.t)
+	idp.mu.Lock()
+	idp.grants[code] = idpGrant{
+		clientID:      query.Get("client_id"),
+		redirectURI:   query.Get("redirect_uri"),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	idp.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (idp *testIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	idp.mu.Lock()
+	grant, ok := idp.grants[r.PostForm.Get("code")]
+	delete(idp.grants, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || grant.clientID != r.PostForm.Get("client_id") || grant.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.codeChallenge {
+		w.WriteHeader(http.StatusBadRequest)
+		writeTestJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	accessToken := randomTestString(idp.t)
+	idp.mu.Lock()
+	idp.tokens[accessToken] = grant
+	idp.mu.Unlock()
+	writeTestJSON(w, map[string]string{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"id_token":     idp.idToken(grant),
+	})
+}
+
+// idToken tạo ID token cho grant; chữ ký không được kiểm tra vì token nhận trực tiếp từ token endpoint
+func (idp *testIdP) idToken(grant idpGrant) string {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	audience := grant.clientID
+	if idp.audience != "" {
+		audience = idp.audience
+	}
+	nonce := grant.nonce
+	if idp.nonce != nil {
+		nonce = *idp.nonce
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            audience,
+		"sub":            idp.account.Subject,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          idp.account.Email,
+		"email_verified": idp.account.EmailVerified,
+	}).SignedString([]byte("idp-signing-key"))
+	if err != nil {
+		idp.t.Fatalf("sign id token: %v", err)
+	}
+	return token
+}
+
+func (idp *testIdP) grantForRequest(r *http.Request) (idpGrant, bool) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	grant, ok := idp.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+	return grant, ok
+}
+
+func (idp *testIdP) currentAccount() idpAccount {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	return idp.account
+}
+
+func writeTestJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomTestString(t *testing.T) string {
+	t.Helper()
+	s, err := generateOpaqueToken()
+	if err != nil {
+		t.Fatalf("generate random string: %v", err)
+	}
+	return s
+}
+
+// fakeAuthService ghi nhận các lần đăng nhập không mật khẩu thay vì cấp token
+type fakeAuthService struct {
+	AuthService
+
+	mu     sync.Mutex
+	logins []*models.User
+}
+
+func (s *fakeAuthService) LoginWithoutPassword(user *models.User, source string, client ClientInfo) (*LoginResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logins = append(s.logins, user)
+	response := user.ToUserResponse()
+	return &LoginResult{User: &response}, nil
+}
+
+// socialHarness gồm SocialLoginService với provider OIDC "corp" và provider kiểu GitHub "github"
+// cùng trỏ tới một testIdP
+type socialHarness struct {
+	idp        *testIdP
+	service    SocialLoginService
+	users      *fakeUserRepo
+	identities *fakeIdentityRepo
+	auth       *fakeAuthService
+	config     *config.Config
+}
+
+func newSocialHarness(t *testing.T, account idpAccount) *socialHarness {
+	t.Helper()
+	idp := newTestIdP(t, account)
+	cfg := &config.Config{
+		OAuthIssuer:         "http://localhost:8080",
+		SocialAutoProvision: true,
+		SocialLinkByEmail:   true,
+		SocialStateTTL:      time.Minute,
+		SocialProviders: []config.SocialProvider{
+			{Name: "corp", ClientID: testOIDCClientID, ClientSecret: "secret", Issuer: idp.server.URL},
+			{
+				Name:         "github",
+				ClientID:     testGitHubClientID,
+				ClientSecret: "secret",
+				AuthURL:      idp.server.URL + "/authorize",
+				TokenURL:     idp.server.URL + "/token",
+				UserInfoURL:  idp.server.URL + "/user",
+				EmailsURL:    idp.server.URL + "/user/emails",
+			},
+		},
+	}
+	providers, err := NewSocialProviders(cfg, idp.server.Client())
+	if err != nil {
+		t.Fatalf("NewSocialProviders: %v", err)
+	}
+
+	h := &socialHarness{
+		idp:        idp,
+		users:      newFakeUserRepo(),
+		identities: &fakeIdentityRepo{},
+		auth:       &fakeAuthService{},
+		config:     cfg,
+	}
+	keyring := keys.NewKeyring(keys.NewHMACKey([]byte("0123456789abcdef0123456789abcdef"), "test"))
+	h.service = NewSocialLoginService(providers, h.identities, h.users, h.auth, keyring, cfg, newTestLogger())
+	return h
+}
+
+// login chạy trọn luồng: Begin, user đồng ý tại provider, Callback với state và cookie của cùng trình duyệt
+func (h *socialHarness) login(t *testing.T, provider string, linkUserID uuid.UUID) (*SocialLoginResult, error) {
+	t.Helper()
+	authURL, stateCookie, err := h.service.Begin(provider, linkUserID)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, state := h.idp.authorize(authURL)
+	return h.service.Callback(provider, state, code, stateCookie, ClientInfo{})
+}
+
+func TestSocialLoginAutoProvisionsUser(t *testing.T) {
+	h := newSocialHarness(t, idpAccount{Subject: "corp-42", Username: "Bob.Smith", Email: "bob@example.com", EmailVerified: true, GivenName: "Bob"})
+
+	result, err := h.login(t, "corp", uuid.Nil)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	user, _ := h.users.FindByEmail("bob@example.com")
+	if user == nil {
+		t.Fatal("user was not provisioned")
+	}
+	if result.Login == nil || result.Login.User.ID != user.ID {
+		t.Fatalf("login result does not belong to the provisioned user: %+v", result)
+	}
+	if user.Username != "bob.smith" || user.FirstName != "Bob" || !user.EmailVerified || user.Role != RoleUser {
+		t.Fatalf("unexpected provisioned user: %+v", user)
+	}
+	identity, _ := h.identities.FindByProviderSubject("corp", "corp-42")
+	if identity == nil || identity.UserID != user.ID {
+		t.Fatalf("identity not linked to the provisioned user: %+v", identity)
+	}
+
+	// Lần đăng nhập sau dùng lại liên kết đã có
+	if _, err := h.login(t, "corp", uuid.Nil); err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if h.users.count() != 1 {
+		t.Fatalf("second login must not create another user, have %d", h.users.count())
+	}
+}
+
+func TestSocialLoginAutoProvisionDisabled(t *testing.T) {
+	h := newSocialHarness(t, idpAccount{Subject: "corp-42", Email: "bob@example.com", EmailVerified: true})
+	h.config.SocialAutoProvision = false
+
+	if _, err := h.login(t, "corp", uuid.Nil); !errors.Is(err, ErrSocialAccountNotFound) {
+		t.Fatalf("got %v, want ErrSocialAccountNotFound", err)
+	}
+	if h.users.count() != 0 {
+		t.Fatal("no user must be created when auto provisioning is disabled")
+	}
+}
+
+func TestSocialLoginGitHubUsesVerifiedEmail(t *testing.T) {
+	h := newSocialHarness(t, idpAccount{
+		Subject:  "1234567",
+		Username: "octocat",
+		Emails: []idpEmail{
+			{Email: "old@example.com", Verified: false},
+			{Email: "octo@example.com", Primary: true, Verified: true},
+		},
+	})
+
+	if _, err := h.login(t, "github", uuid.Nil); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	user, _ := h.users.FindByEmail("octo@example.com")
+	if user == nil || !user.EmailVerified || user.Username != "octocat" {
+		t.Fatalf("user not provisioned from the primary verified email: %+v", user)
+	}
+	if identity, _ := h.identities.FindByProviderSubject("github", "1234567"); identity == nil {
+		t.Fatal("numeric GitHub id was not used as the subject")
+	}
+}
+
+func TestSocialLoginRejectsStateMismatch(t *testing.T) {
+	h := newSocialHarness(t, idpAccount{Subject: "corp-42", Email: "bob@example.com", EmailVerified: true})
+
+	authURL, stateCookie, err := h.service.Begin("corp", uuid.Nil)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, state := h.idp.authorize(authURL)
+
+	// Callback với state của một lần đăng nhập khác (login CSRF), hoặc thiếu cookie của trình duyệt
+	if _, err := h.service.Callback("corp", state+"x", code, stateCookie, ClientInfo{}); !errors.Is(err, ErrInvalidSocialState) {
+		t.Fatalf("wrong state: got %v, want ErrInvalidSocialState", err)
+	}
+	if _, err := h.service.Callback("corp", state, code, "", ClientInfo{}); !errors.Is(err, ErrInvalidSocialState) {
+		t.Fatalf("missing cookie: got %v, want ErrInvalidSocialState", err)
+	}
+	// Cookie của provider này không dùng được cho provider khác
+	if _, err := h.service.Callback("github", state, code, stateCookie, ClientInfo{}); !errors.Is(err, ErrInvalidSocialState) {
+		t.Fatalf("cookie of another provider: got %v, want ErrInvalidSocialState", err)
+	}
+	if len(h.auth.logins) != 0 {
+		t.Fatal("rejected callbacks must not log anyone in")
+	}
+}
+
+func TestSocialLoginRejectsNonceMismatch(t *testing.T) {
+	h := newSocialHarness(t, idpAccount{Subject: "corp-42", Email: "bob@example.com", EmailVerified: true})
+	replayed := "nonce-of-another-login"
+	h.idp.nonce = &replayed
+
+	if _, err := h.login(t, "corp", uuid.Nil); !errors.Is(err, ErrSocialLoginFailed) {
+		t.Fatalf("got %v, want ErrSocialLoginFailed", err)
+	}
+	if h.users.count() != 0 || len(h.auth.logins) != 0 {
+		t.Fatal("an ID token with a foreign nonce must not log anyone in")
+	}
+}
+
+func TestSocialLoginRejectsAudienceMismatch(t *testing.T) {
+	h := newSocialHarness(t, idpAccount{Subject: "corp-42", Email: "bob@example.com", EmailVerified: true})
+	h.idp.audience = "another-client"
+
+	if _, err := h.login(t, "corp", uuid.Nil); !errors.Is(err, ErrSocialLoginFailed) {
+		t.Fatalf("got %v, want ErrSocialLoginFailed", err)
+	}
+	if h.users.count() != 0 || len(h.auth.logins) != 0 {
+		t.Fatal("an ID token issued to another client must not log anyone in")
+	}
+}
+
+func TestSocialLoginLinksByVerifiedEmail(t *testing.T) {
+	h := newSocialHarness(t, idpAccount{Subject: "corp-42", Email: "carol@example.com", EmailVerified: true})
+	existing := h.users.add(&models.User{Username: "carol", Email: "carol@example.com", EmailVerified: true})
+
+	result, err := h.login(t, "corp", uuid.Nil)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if result.Login.User.ID != existing.ID || h.users.count() != 1 {
+		t.Fatalf("identity was not linked to the existing account")
+	}
+}
+
+func TestSocialLoginRefusesLinkByEmailWhenUnverified(t *testing.T) {
+	tests := []struct {
+		name             string
+		providerVerified bool
+		localVerified    bool
+	}{
+		{"provider email unverified", false, true},
+		{"local email unverified", true, false},
+		{"both unverified", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newSocialHarness(t, idpAccount{Subject: "corp-42", Email: "carol@example.com", EmailVerified: tt.providerVerified})
+			existing := h.users.add(&models.User{Username: "carol", Email: "carol@example.com", EmailVerified: tt.localVerified})
+
+			if _, err := h.login(t, "corp", uuid.Nil); !errors.Is(err, ErrSocialEmailConflict) {
+				t.Fatalf("got %v, want ErrSocialEmailConflict", err)
+			}
+			if identities, _ := h.identities.ListByUser(existing.ID); len(identities) != 0 {
+				t.Fatalf("identity must not be linked, got %+v", identities)
+			}
+		})
+	}
+}
+
+func TestSocialLoginRefusesLinkByEmailWhenDisabled(t *testing.T) {
+	h := newSocialHarness(t, idpAccount{Subject: "corp-42", Email: "carol@example.com", EmailVerified: true})
+	h.config.SocialLinkByEmail = false
+	h.users.add(&models.User{Username: "carol", Email: "carol@example.com", EmailVerified: true})
+
+	if _, err := h.login(t, "corp", uuid.Nil); !errors.Is(err, ErrSocialEmailConflict) {
+		t.Fatalf("got %v, want ErrSocialEmailConflict", err)
+	}
+}
+
+func TestSocialLoginRefusesLinkToManagedAccount(t *testing.T) {
+	h := newSocialHarness(t, idpAccount{Subject: "corp-42", Email: "dave@example.com", EmailVerified: true})
+	managed := h.users.add(&models.User{Username: "dave", Email: "dave@example.com", EmailVerified: true})
+	if err := h.identities.Create(&models.UserIdentity{UserID: managed.ID, Provider: IdentityProviderLDAP, Subject: "dave-guid"}); err != nil {
+		t.Fatalf("create identity: %v", err)
+	}
+
+	if _, err := h.login(t, "corp", uuid.Nil); !errors.Is(err, ErrManagedAccount) {
+		t.Fatalf("got %v, want ErrManagedAccount", err)
+	}
+}
+
+func TestSocialLinkIdentity(t *testing.T) {
+	h := newSocialHarness(t, idpAccount{Subject: "corp-42", Email: "erin@other.example", EmailVerified: true})
+	user := h.users.add(&models.User{Username: "erin", Email: "erin@example.com"})
+
+	result, err := h.login(t, "corp", user.ID)
+	if err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	if result.Identity == nil || result.Identity.UserID != user.ID || result.Login != nil {
+		t.Fatalf("unexpected link result: %+v", result)
+	}
+	// Liên kết lại cùng danh tính với cùng user không lỗi
+	if _, err := h.login(t, "corp", user.ID); err != nil {
+		t.Fatalf("relink: %v", err)
+	}
+}
+
+func TestSocialLinkRejectsIdentityLinkedToAnotherUser(t *testing.T) {
+	h := newSocialHarness(t, idpAccount{Subject: "corp-42", Email: "frank@example.com", EmailVerified: true})
+	owner := h.users.add(&models.User{Username: "frank", Email: "frank@example.com"})
+	other := h.users.add(&models.User{Username: "grace", Email: "grace@example.com"})
+
+	if _, err := h.login(t, "corp", owner.ID); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	if _, err := h.login(t, "corp", other.ID); !errors.Is(err, ErrIdentityAlreadyLinked) {
+		t.Fatalf("got %v, want ErrIdentityAlreadyLinked", err)
+	}
+}
+
+func TestSocialLinkRejectsSecondAccountOfSameProvider(t *testing.T) {
+	h := newSocialHarness(t, idpAccount{Subject: "corp-42", Email: "heidi@example.com", EmailVerified: true})
+	user := h.users.add(&models.User{Username: "heidi", Email: "heidi@example.com"})
+	if _, err := h.login(t, "corp", user.ID); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+
+	// Cùng user liên kết một tài khoản khác của cùng provider
+	h.idp.mu.Lock()
+	h.idp.account.Subject = "corp-43"
+	h.idp.mu.Unlock()
+	if _, err := h.login(t, "corp", user.ID); !errors.Is(err, ErrIdentityAlreadyLinked) {
+		t.Fatalf("got %v, want ErrIdentityAlreadyLinked", err)
+	}
+}
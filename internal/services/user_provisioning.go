@@ -0,0 +1,181 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Giới hạn độ dài username, giống ràng buộc khi đăng ký
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 50
+)
+
+// usernameAttempts là số lần thử thêm hậu tố ngẫu nhiên khi username đã tồn tại
+const usernameAttempts = 5
+
+// provisionedUser là thông tin của user được tạo tự động từ nguồn xác thực bên ngoài
+type provisionedUser struct {
+	Username      string // Username mong muốn; được chuẩn hóa và thêm hậu tố nếu đã tồn tại
+	Email         string
+	FirstName     string
+	LastName      string
+	Role          string
+	EmailVerified bool
+}
+
+// provisionUser tạo user mới cho người dùng đã được xác thực bởi nguồn bên ngoài (identity provider...).
+// User nhận một mật khẩu ngẫu nhiên không ai biết; có thể đặt mật khẩu riêng bằng chức năng quên mật khẩu.
+func provisionUser(userRepo repository.UserRepository, info provisionedUser) (*models.User, error) {
+	username, err := availableUsername(userRepo, info.Username, info.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	role := info.Role
+	if role == "" {
+		role = "user"
+	}
+	user := &models.User{
+		Username:      username,
+		Email:         info.Email,
+		FirstName:     truncate(info.FirstName, 50),
+		LastName:      truncate(info.LastName, 50),
+		Role:          role,
+		Password:      secret,
+		EmailVerified: info.EmailVerified,
+	}
+	if info.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if err := user.HashPassword(); err != nil {
+		return nil, err
+	}
+
+	if err := userRepo.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// syncProvisionedUser cập nhật tên, email và (nếu syncRole) role của user theo nguồn bên ngoài.
+// Email mới đã thuộc về tài khoản khác thì giữ email cũ; admin cuối cùng thì không bị hạ quyền.
+func syncProvisionedUser(userRepo repository.UserRepository, user *models.User, info provisionedUser, syncRole bool) error {
+	if syncRole && info.Role != "" && info.Role != user.Role {
+		err := userRepo.UpdateRole(user.ID, info.Role)
+		switch {
+		case err == nil:
+			user.Role = info.Role
+		case !errors.Is(err, repository.ErrLastAdmin):
+			return err
+		}
+	}
+
+	changed := false
+	sync := func(field *string, value string) {
+		if value != "" && *field != value {
+			*field = value
+			changed = true
+		}
+	}
+	sync(&user.FirstName, truncate(info.FirstName, 50))
+	sync(&user.LastName, truncate(info.LastName, 50))
+	if info.Email != "" && info.Email != user.Email {
+		existing, err := userRepo.FindByEmail(info.Email)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			sync(&user.Email, info.Email)
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return userRepo.Update(user)
+}
+
+// managedIdentity kiểm tra liên kết có do nguồn danh tính của tổ chức (LDAP, SAML) quản lý không.
+// User có liên kết loại này chỉ đăng nhập qua nguồn đó và không tự hủy liên kết được.
+func managedIdentity(provider string) bool {
+	return provider == IdentityProviderLDAP || strings.HasPrefix(provider, samlIdentityPrefix)
+}
+
+// hasManagedIdentity kiểm tra user có liên kết với nguồn danh tính của tổ chức không
+func hasManagedIdentity(identityRepo repository.UserIdentityRepository, userID uuid.UUID) (bool, error) {
+	identities, err := identityRepo.ListByUser(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, identity := range identities {
+		if managedIdentity(identity.Provider) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// availableUsername chuẩn hóa username mong muốn (hoặc phần trước @ của email) và tìm một username chưa được dùng
+func availableUsername(userRepo repository.UserRepository, preferred, email string) (string, error) {
+	base := sanitizeUsername(preferred)
+	if len(base) < minUsernameLength {
+		base = sanitizeUsername(strings.SplitN(email, "@", 2)[0])
+	}
+	for len(base) < minUsernameLength {
+		base += "_"
+	}
+
+	candidate := base
+	for attempt := 0; attempt <= usernameAttempts; attempt++ {
+		existing, err := userRepo.FindByUsername(candidate)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+
+		n, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		suffix := fmt.Sprintf("%04d", n.Int64())
+		candidate = truncate(base, maxUsernameLength-len(suffix)) + suffix
+	}
+	return "", ErrUserExists
+}
+
+// sanitizeUsername chỉ giữ lại chữ, số và các ký tự . _ -
+func sanitizeUsername(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			b.WriteRune(r)
+		}
+	}
+	return truncate(b.String(), maxUsernameLength)
+}
+
+// truncate cắt chuỗi về tối đa n ký tự (rune)
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"time"
 
 	"github.com/Thanhdat-debug/demo_login/internal/models"
 	"github.com/Thanhdat-debug/demo_login/internal/repository"
@@ -11,9 +12,28 @@ import (
 
 // Định nghĩa các lỗi
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrInvalidRole           = errors.New("invalid role")
+	ErrLastAdmin             = errors.New("cannot remove the last admin")
+	ErrExternallyManagedUser = errors.New("password is managed by an external identity provider")
 )
 
+// Các role của user
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// AdminUserUpdate chứa các thông tin admin cập nhật cho user; trường nil được giữ nguyên
+type AdminUserUpdate struct {
+	Username      *string
+	Email         *string
+	FirstName     *string
+	LastName      *string
+	Locale        *string
+	EmailVerified *bool
+}
+
 // UserService định nghĩa interface cho các phương thức quản lý user
 type UserService interface {
 	GetUserByID(id uuid.UUID) (*models.UserResponse, error)
@@ -21,19 +41,37 @@ type UserService interface {
 	ChangePassword(id uuid.UUID, oldPassword, newPassword string) error
 	DeleteUser(id uuid.UUID) error
 	ListUsers(page, size int) ([]models.UserResponse, int64, error)
+
+	// Quản lý user bởi admin
+	CreateUser(inviterID uuid.UUID, username, email, password, firstName, lastName, role, locale string, emailVerified bool) (*models.UserResponse, error)
+	AdminUpdateUser(id uuid.UUID, update AdminUserUpdate) (*models.UserResponse, error)
+	ChangeRole(id uuid.UUID, role string) (*models.UserResponse, error)
+	ForcePasswordReset(id uuid.UUID, temporaryPassword string) error
 }
 
 // userService struct triển khai UserService interface
 type userService struct {
-	userRepo repository.UserRepository
-	logger   *logger.Logger
+	userRepo             repository.UserRepository
+	identityRepo         repository.UserIdentityRepository
+	refreshTokenRepo     repository.RefreshTokenRepository
+	userTokenRepo        repository.UserTokenRepository
+	passwordService      PasswordService
+	passwordResetService PasswordResetService
+	sessionService       SessionService
+	logger               *logger.Logger
 }
 
 // NewUserService tạo một instance mới của UserService
-func NewUserService(userRepo repository.UserRepository, logger *logger.Logger) UserService {
+func NewUserService(userRepo repository.UserRepository, identityRepo repository.UserIdentityRepository, refreshTokenRepo repository.RefreshTokenRepository, userTokenRepo repository.UserTokenRepository, passwordService PasswordService, passwordResetService PasswordResetService, sessionService SessionService, logger *logger.Logger) UserService {
 	return &userService{
-		userRepo: userRepo,
-		logger:   logger,
+		userRepo:             userRepo,
+		identityRepo:         identityRepo,
+		refreshTokenRepo:     refreshTokenRepo,
+		userTokenRepo:        userTokenRepo,
+		passwordService:      passwordService,
+		passwordResetService: passwordResetService,
+		sessionService:       sessionService,
+		logger:               logger,
 	}
 }
 
@@ -93,17 +131,12 @@ func (s *userService) ChangePassword(id uuid.UUID, oldPassword, newPassword stri
 		return ErrInvalidCredentials
 	}
 
-	// Cập nhật mật khẩu mới
-	user.Password = newPassword
-	if err := user.HashPassword(); err != nil {
-		return err
-	}
-
-	// Lưu vào database
-	return s.userRepo.Update(user)
+	// Kiểm tra mật khẩu mới theo chính sách và lịch sử, sau đó lưu vào database
+	return s.passwordService.SetPassword(user, newPassword)
 }
 
-// DeleteUser xóa user theo ID
+// DeleteUser xóa user theo ID; không cho phép xóa admin cuối cùng.
+// Session và refresh token không bị xóa theo user nên được thu hồi trước, để access token đã cấp mất hiệu lực ngay.
 func (s *userService) DeleteUser(id uuid.UUID) error {
 	user, err := s.userRepo.FindByID(id)
 	if err != nil {
@@ -113,7 +146,23 @@ func (s *userService) DeleteUser(id uuid.UUID) error {
 		return ErrUserNotFound
 	}
 
-	return s.userRepo.Delete(id)
+	if err := s.checkNotLastAdmin(user); err != nil {
+		return err
+	}
+	if err := s.sessionService.RevokeAllSessions(id); err != nil {
+		return err
+	}
+	if err := s.refreshTokenRepo.DeleteByUser(id); err != nil {
+		return err
+	}
+	// Kiểm tra lại trong transaction của repository: một admin khác có thể vừa bị xóa/hạ quyền đồng thời
+	if err := s.userRepo.Delete(id); err != nil {
+		if errors.Is(err, repository.ErrLastAdmin) {
+			return ErrLastAdmin
+		}
+		return err
+	}
+	return nil
 }
 
 // ListUsers lấy danh sách users với phân trang
@@ -138,3 +187,259 @@ func (s *userService) ListUsers(page, size int) ([]models.UserResponse, int64, e
 
 	return userResponses, total, nil
 }
+
+// CreateUser tạo user mới với role cho trước. Nếu password rỗng, user được tạo với mật khẩu ngẫu nhiên
+// và nhận lời mời từ admin inviterID kèm link để tự đặt mật khẩu của mình.
+func (s *userService) CreateUser(inviterID uuid.UUID, username, email, password, firstName, lastName, role, locale string, emailVerified bool) (*models.UserResponse, error) {
+	if role == "" {
+		role = RoleUser
+	}
+	if !validRole(role) {
+		return nil, ErrInvalidRole
+	}
+	if err := s.checkAvailable(uuid.Nil, username, email); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := &models.User{
+		Username:          username,
+		Email:             email,
+		FirstName:         firstName,
+		LastName:          lastName,
+		Role:              role,
+		Locale:            locale,
+		PasswordChangedAt: &now,
+	}
+	if emailVerified {
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+	}
+
+	invite := password == ""
+	if invite {
+		// Không ai biết mật khẩu này; user đặt mật khẩu qua link trong email
+		random, err := generateOpaqueToken()
+		if err != nil {
+			return nil, err
+		}
+		password = random
+	} else if err := s.passwordService.CheckNewPassword(user, password); err != nil {
+		return nil, err
+	}
+
+	user.Password = password
+	if err := user.HashPassword(); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+	if !invite {
+		if err := s.passwordService.RecordPassword(user); err != nil {
+			s.logger.Errorf("Failed to record password history of user %s: %v", user.ID, err)
+		}
+	} else if err := s.sendInvitation(user, inviterID); err != nil {
+		// User vẫn có thể tự yêu cầu đặt lại mật khẩu
+		s.logger.Errorf("Failed to send invitation to user %s: %v", user.ID, err)
+	}
+
+	userResponse := user.ToUserResponse()
+	return &userResponse, nil
+}
+
+// sendInvitation gửi lời mời cho user vừa tạo, ký tên bằng tên của admin đã tạo user
+func (s *userService) sendInvitation(user *models.User, inviterID uuid.UUID) error {
+	inviter, err := s.userRepo.FindByID(inviterID)
+	if err != nil {
+		return err
+	}
+	inviterName := "An administrator"
+	if inviter != nil {
+		inviterName = displayName(inviter)
+	}
+	return s.passwordResetService.SendInvitation(user, inviterName)
+}
+
+// AdminUpdateUser cập nhật thông tin user theo yêu cầu của admin.
+// Đổi email mà không chỉ định EmailVerified thì email mới được coi là chưa xác minh.
+func (s *userService) AdminUpdateUser(id uuid.UUID, update AdminUserUpdate) (*models.UserResponse, error) {
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	username, email := "", ""
+	if update.Username != nil && *update.Username != user.Username {
+		username = *update.Username
+	}
+	if update.Email != nil && *update.Email != user.Email {
+		email = *update.Email
+	}
+	if err := s.checkAvailable(user.ID, username, email); err != nil {
+		return nil, err
+	}
+
+	if username != "" {
+		user.Username = username
+	}
+	if email != "" {
+		// Link xác minh/đặt lại mật khẩu/lời mời đã gửi tới địa chỉ cũ không được xác minh địa chỉ mới
+		for _, purpose := range []string{models.TokenPurposeEmailVerification, models.TokenPurposePasswordReset, models.TokenPurposeInvitation} {
+			if err := s.userTokenRepo.DeleteByUser(user.ID, purpose); err != nil {
+				return nil, err
+			}
+		}
+		user.Email = email
+		user.EmailVerified = false
+		user.EmailVerifiedAt = nil
+	}
+	if update.FirstName != nil {
+		user.FirstName = *update.FirstName
+	}
+	if update.LastName != nil {
+		user.LastName = *update.LastName
+	}
+	if update.Locale != nil {
+		user.Locale = *update.Locale
+	}
+	if update.EmailVerified != nil && *update.EmailVerified != user.EmailVerified {
+		user.EmailVerified = *update.EmailVerified
+		user.EmailVerifiedAt = nil
+		if user.EmailVerified {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+		}
+	}
+
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	userResponse := user.ToUserResponse()
+	return &userResponse, nil
+}
+
+// ChangeRole đổi role của user; không cho phép hạ quyền admin cuối cùng.
+// Khi bị hạ quyền, mọi session của user bị thu hồi để access token mang role cũ không còn dùng được.
+func (s *userService) ChangeRole(id uuid.UUID, role string) (*models.UserResponse, error) {
+	if !validRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.Role == role {
+		userResponse := user.ToUserResponse()
+		return &userResponse, nil
+	}
+
+	// Role được ghi riêng trong transaction khóa các bản ghi admin để không hạ quyền admin cuối cùng
+	demoted := user.Role == RoleAdmin
+	if err := s.userRepo.UpdateRole(user.ID, role); err != nil {
+		if errors.Is(err, repository.ErrLastAdmin) {
+			return nil, ErrLastAdmin
+		}
+		return nil, err
+	}
+	user.Role = role
+	if demoted {
+		if err := s.sessionService.RevokeAllSessions(user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	userResponse := user.ToUserResponse()
+	return &userResponse, nil
+}
+
+// ForcePasswordReset buộc user đặt lại mật khẩu: mọi session bị thu hồi và lần đăng nhập bằng mật khẩu
+// tiếp theo phải đổi mật khẩu. Nếu admin cấp mật khẩu tạm thời, user đăng nhập bằng mật khẩu đó;
+// ngược lại user nhận email đặt lại mật khẩu.
+func (s *userService) ForcePasswordReset(id uuid.UUID, temporaryPassword string) error {
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	// Mật khẩu của user đến từ LDAP/SAML do nguồn đó quản lý
+	managed, err := hasManagedIdentity(s.identityRepo, user.ID)
+	if err != nil {
+		return err
+	}
+	if managed {
+		return ErrExternallyManagedUser
+	}
+
+	if temporaryPassword != "" {
+		if err := s.passwordService.SetPassword(user, temporaryPassword); err != nil {
+			return err
+		}
+	}
+	user.PasswordResetRequired = true
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	if err := s.sessionService.RevokeAllSessions(user.ID); err != nil {
+		return err
+	}
+	if temporaryPassword == "" {
+		return s.passwordResetService.RequestReset(user.Email)
+	}
+	return nil
+}
+
+// checkAvailable kiểm tra username và email (nếu khác rỗng) chưa được user khác sử dụng
+func (s *userService) checkAvailable(id uuid.UUID, username, email string) error {
+	if username != "" {
+		existing, err := s.userRepo.FindByUsername(username)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.ID != id {
+			return ErrUserExists
+		}
+	}
+	if email != "" {
+		existing, err := s.userRepo.FindByEmail(email)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.ID != id {
+			return ErrUserExists
+		}
+	}
+	return nil
+}
+
+// checkNotLastAdmin trả về ErrLastAdmin nếu user là admin duy nhất còn lại
+func (s *userService) checkNotLastAdmin(user *models.User) error {
+	if user.Role != RoleAdmin {
+		return nil
+	}
+	admins, err := s.userRepo.CountByRole(RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// validRole kiểm tra role có được hỗ trợ không
+func validRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
@@ -0,0 +1,434 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/Thanhdat-debug/demo_login/internal/repository"
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrCredentialNotFound = errors.New("webauthn credential not found")
+	ErrInvalidChallenge   = errors.New("invalid or expired webauthn challenge")
+	ErrWebAuthnFailed     = errors.New("webauthn verification failed")
+)
+
+// Loại nghi thức WebAuthn được lưu cùng challenge
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+// webAuthnTimeout là thời gian tối đa để hoàn tất một nghi thức WebAuthn
+const webAuthnTimeout = 5 * time.Minute
+
+// WebAuthnService định nghĩa interface cho các nghi thức đăng ký và xác thực passkey
+type WebAuthnService interface {
+	BeginRegistration(userID uuid.UUID) (*protocol.CredentialCreation, uuid.UUID, error)
+	FinishRegistration(userID, challengeID uuid.UUID, name string, response *protocol.ParsedCredentialCreationData) (*models.WebAuthnCredential, error)
+	ListCredentials(userID uuid.UUID) ([]models.WebAuthnCredential, error)
+	DeleteCredential(userID, credentialID uuid.UUID) error
+	HasCredentials(userID uuid.UUID) (bool, error)
+	BeginLogin(user *models.User, requireUserVerification bool) (*protocol.CredentialAssertion, uuid.UUID, error)
+	FinishLogin(challengeID uuid.UUID, response *protocol.ParsedCredentialAssertionData) (*models.User, error)
+}
+
+// webAuthnService struct triển khai WebAuthnService interface
+type webAuthnService struct {
+	webAuthn     *webauthn.WebAuthn
+	userRepo     repository.UserRepository
+	webAuthnRepo repository.WebAuthnRepository
+	logger       *logger.Logger
+}
+
+// NewWebAuthnService tạo một instance mới của WebAuthnService từ cấu hình relying party
+func NewWebAuthnService(userRepo repository.UserRepository, webAuthnRepo repository.WebAuthnRepository, config *config.Config, logger *logger.Logger) (WebAuthnService, error) {
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          config.WebAuthnRPID,
+		RPDisplayName: config.WebAuthnRPName,
+		RPOrigins:     config.WebAuthnRPOrigins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnTimeout, TimeoutUVD: webAuthnTimeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnTimeout, TimeoutUVD: webAuthnTimeout},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &webAuthnService{
+		webAuthn:     wa,
+		userRepo:     userRepo,
+		webAuthnRepo: webAuthnRepo,
+		logger:       logger,
+	}, nil
+}
+
+// webAuthnUser điều chỉnh models.User theo interface webauthn.User của thư viện
+type webAuthnUser struct {
+	user        *models.User
+	credentials []models.WebAuthnCredential
+}
+
+// WebAuthnID trả về user handle: 16 byte của UUID user
+func (u *webAuthnUser) WebAuthnID() []byte {
+	id := u.user.ID
+	return id[:]
+}
+
+// WebAuthnName trả về tên tài khoản hiển thị trong trình chọn passkey
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+// WebAuthnDisplayName trả về tên đầy đủ của user (hoặc username nếu chưa có)
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	name := strings.TrimSpace(u.user.FirstName + " " + u.user.LastName)
+	if name == "" {
+		return u.user.Username
+	}
+	return name
+}
+
+// WebAuthnCredentials chuyển các credential đã lưu sang kiểu của thư viện
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.credentials))
+	for i, c := range u.credentials {
+		var transports []protocol.AuthenticatorTransport
+		for _, t := range strings.Split(c.Transports, ",") {
+			if t != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(t))
+			}
+		}
+
+		credentials[i] = webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		}
+	}
+	return credentials
+}
+
+// BeginRegistration bắt đầu đăng ký passkey mới cho user
+func (s *webAuthnService) BeginRegistration(userID uuid.UUID) (*protocol.CredentialCreation, uuid.UUID, error) {
+	waUser, err := s.loadUser(userID)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	if waUser == nil {
+		return nil, uuid.Nil, ErrUserNotFound
+	}
+
+	// Không cho đăng ký lại authenticator đã có
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(waUser.credentials))
+	for _, credential := range waUser.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := s.webAuthn.BeginRegistration(waUser, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	challengeID, err := s.saveChallenge(&userID, ceremonyRegistration, session)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	return creation, challengeID, nil
+}
+
+// FinishRegistration kiểm tra phản hồi của authenticator và lưu credential mới
+func (s *webAuthnService) FinishRegistration(userID, challengeID uuid.UUID, name string, response *protocol.ParsedCredentialCreationData) (*models.WebAuthnCredential, error) {
+	session, challenge, err := s.consumeChallenge(challengeID, ceremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.UserID == nil || *challenge.UserID != userID {
+		return nil, ErrInvalidChallenge
+	}
+
+	waUser, err := s.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if waUser == nil {
+		return nil, ErrUserNotFound
+	}
+
+	credential, err := s.webAuthn.CreateCredential(waUser, *session, response)
+	if err != nil {
+		s.logger.Errorf("WebAuthn registration failed for user %s: %v", userID, err)
+		return nil, ErrWebAuthnFailed
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, t := range credential.Transport {
+		transports[i] = string(t)
+	}
+	if name == "" {
+		name = "Passkey"
+	}
+
+	record := &models.WebAuthnCredential{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := s.webAuthnRepo.CreateCredential(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// ListCredentials lấy danh sách passkey của user
+func (s *webAuthnService) ListCredentials(userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	return s.webAuthnRepo.ListCredentialsByUser(userID)
+}
+
+// DeleteCredential xóa một passkey của user
+func (s *webAuthnService) DeleteCredential(userID, credentialID uuid.UUID) error {
+	deleted, err := s.webAuthnRepo.DeleteCredential(userID, credentialID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+// HasCredentials kiểm tra user đã đăng ký passkey nào chưa
+func (s *webAuthnService) HasCredentials(userID uuid.UUID) (bool, error) {
+	count, err := s.webAuthnRepo.CountCredentialsByUser(userID)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// BeginLogin bắt đầu nghi thức xác thực. Nếu user rỗng (hoặc chưa có passkey), trình duyệt
+// được phép chọn bất kỳ discoverable credential nào của relying party.
+func (s *webAuthnService) BeginLogin(user *models.User, requireUserVerification bool) (*protocol.CredentialAssertion, uuid.UUID, error) {
+	verification := protocol.VerificationPreferred
+	if requireUserVerification {
+		verification = protocol.VerificationRequired
+	}
+
+	var waUser *webAuthnUser
+	if user != nil {
+		credentials, err := s.webAuthnRepo.ListCredentialsByUser(user.ID)
+		if err != nil {
+			return nil, uuid.Nil, err
+		}
+		if len(credentials) > 0 {
+			waUser = &webAuthnUser{user: user, credentials: credentials}
+		}
+	}
+
+	var (
+		assertion *protocol.CredentialAssertion
+		session   *webauthn.SessionData
+		userID    *uuid.UUID
+		err       error
+	)
+	if waUser != nil {
+		assertion, session, err = s.webAuthn.BeginLogin(waUser, webauthn.WithUserVerification(verification))
+		userID = &waUser.user.ID
+	} else {
+		assertion, session, err = s.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(verification))
+	}
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	challengeID, err := s.saveChallenge(userID, ceremonyLogin, session)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	return assertion, challengeID, nil
+}
+
+// FinishLogin kiểm tra chữ ký của authenticator, cập nhật credential và trả về user đã xác thực
+func (s *webAuthnService) FinishLogin(challengeID uuid.UUID, response *protocol.ParsedCredentialAssertionData) (*models.User, error) {
+	session, challenge, err := s.consumeChallenge(challengeID, ceremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		waUser     *webAuthnUser
+		credential *webauthn.Credential
+	)
+	if challenge.UserID != nil {
+		waUser, err = s.loadUser(*challenge.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if waUser == nil {
+			return nil, ErrWebAuthnFailed
+		}
+		credential, err = s.webAuthn.ValidateLogin(waUser, *session, response)
+	} else {
+		// Discoverable login: tìm user theo user handle do authenticator trả về
+		var user webauthn.User
+		user, credential, err = s.webAuthn.ValidatePasskeyLogin(s.discoverUser, *session, response)
+		if err == nil {
+			waUser = user.(*webAuthnUser)
+		}
+	}
+	if err != nil {
+		s.logger.Errorf("WebAuthn login failed: %v", err)
+		return nil, ErrWebAuthnFailed
+	}
+
+	// Sign count không tăng => authenticator có thể đã bị sao chép
+	if credential.Authenticator.CloneWarning {
+		s.logger.Errorf("WebAuthn clone warning for user %s", waUser.user.ID)
+		return nil, ErrWebAuthnFailed
+	}
+
+	if err := s.recordUsage(credential); err != nil {
+		return nil, err
+	}
+	return waUser.user, nil
+}
+
+// discoverUser tìm user theo user handle (UUID của user) trong discoverable login
+func (s *webAuthnService) discoverUser(rawID, userHandle []byte) (webauthn.User, error) {
+	userID, err := uuid.FromBytes(userHandle)
+	if err != nil {
+		return nil, err
+	}
+	waUser, err := s.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if waUser == nil {
+		return nil, ErrUserNotFound
+	}
+	return waUser, nil
+}
+
+// recordUsage lưu sign count, cờ backup và thời điểm sử dụng mới nhất của credential
+func (s *webAuthnService) recordUsage(credential *webauthn.Credential) error {
+	record, err := s.webAuthnRepo.FindCredentialByCredentialID(credential.ID)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrCredentialNotFound
+	}
+
+	now := time.Now()
+	record.SignCount = credential.Authenticator.SignCount
+	record.BackupState = credential.Flags.BackupState
+	record.LastUsedAt = &now
+	return s.webAuthnRepo.UpdateCredential(record)
+}
+
+// loadUser lấy user cùng các credential của user đó
+func (s *webAuthnService) loadUser(userID uuid.UUID) (*webAuthnUser, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	credentials, err := s.webAuthnRepo.ListCredentialsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+// saveChallenge lưu session data của nghi thức vào database, trả về ID cho client gửi lại khi hoàn tất
+func (s *webAuthnService) saveChallenge(userID *uuid.UUID, ceremony string, session *webauthn.SessionData) (uuid.UUID, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	challenge := &models.WebAuthnChallenge{
+		UserID:      userID,
+		Ceremony:    ceremony,
+		SessionData: string(data),
+		ExpiresAt:   time.Now().Add(webAuthnTimeout),
+	}
+	if err := s.webAuthnRepo.CreateChallenge(challenge); err != nil {
+		return uuid.Nil, err
+	}
+	return challenge.ID, nil
+}
+
+// consumeChallenge lấy (và xóa) challenge, giải mã session data đã lưu
+func (s *webAuthnService) consumeChallenge(challengeID uuid.UUID, ceremony string) (*webauthn.SessionData, *models.WebAuthnChallenge, error) {
+	challenge, err := s.webAuthnRepo.ConsumeChallenge(challengeID, ceremony)
+	if err != nil {
+		return nil, nil, err
+	}
+	if challenge == nil {
+		return nil, nil, ErrInvalidChallenge
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(challenge.SessionData), &session); err != nil {
+		return nil, nil, err
+	}
+	return &session, challenge, nil
+}
+
+// StartWebAuthnChallengeCleanup chạy một goroutine định kỳ xóa các challenge WebAuthn đã hết hạn.
+// Hàm trả về một hàm stop để dừng goroutine khi tắt server.
+func StartWebAuthnChallengeCleanup(repo repository.WebAuthnRepository, interval time.Duration, logger *logger.Logger) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := repo.DeleteExpired(time.Now())
+				if err != nil {
+					logger.Errorf("WebAuthn challenge cleanup error: %v", err)
+					continue
+				}
+				if deleted > 0 {
+					logger.Infof("WebAuthn challenge cleanup removed %d expired challenges", deleted)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,404 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/internal/config"
+	"github.com/Thanhdat-debug/demo_login/internal/models"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/google/uuid"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+)
+
+// Cờ trong authenticator data (WebAuthn §6.1)
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// softAuthenticator là authenticator phần mềm: giữ một khóa ES256 và bộ đếm chữ ký
+// để tạo phản hồi đăng ký (attestation "none") và phản hồi xác thực
+type softAuthenticator struct {
+	t            *testing.T
+	credentialID []byte
+	key          *ecdsa.PrivateKey
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	credentialID := make([]byte, 32)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatalf("generate credential id: %v", err)
+	}
+	return &softAuthenticator{t: t, credentialID: credentialID, key: key}
+}
+
+// register tạo phản hồi cho navigator.credentials.create()
+func (a *softAuthenticator) register(creation *protocol.CredentialCreation) *protocol.ParsedCredentialCreationData {
+	a.t.Helper()
+	a.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatalf("marshal public key: %v", err)
+	}
+
+	authData := a.authData(flagUserPresent|flagUserVerified|flagAttestedData, 0)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		a.t.Fatalf("marshal attestation: %v", err)
+	}
+
+	body := a.credentialJSON(map[string]interface{}{
+		"clientDataJSON":    b64(a.clientData("webauthn.create", creation.Response.Challenge.String())),
+		"attestationObject": b64(attestation),
+		"transports":        []string{"internal"},
+	})
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(body)
+	if err != nil {
+		a.t.Fatalf("parse creation response: %v", err)
+	}
+	return parsed
+}
+
+// assert tạo phản hồi cho navigator.credentials.get() với bộ đếm chữ ký cho trước
+func (a *softAuthenticator) assert(assertion *protocol.CredentialAssertion, signCount uint32) *protocol.ParsedCredentialAssertionData {
+	a.t.Helper()
+	clientData := a.clientData("webauthn.get", assertion.Response.Challenge.String())
+	authData := a.authData(flagUserPresent|flagUserVerified, signCount)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("sign assertion: %v", err)
+	}
+
+	body := a.credentialJSON(map[string]interface{}{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(a.userHandle),
+	})
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(body)
+	if err != nil {
+		a.t.Fatalf("parse assertion response: %v", err)
+	}
+	return parsed
+}
+
+// next tạo phản hồi xác thực với bộ đếm chữ ký tăng dần như authenticator thật
+func (a *softAuthenticator) next(assertion *protocol.CredentialAssertion) *protocol.ParsedCredentialAssertionData {
+	a.signCount++
+	return a.assert(assertion, a.signCount)
+}
+
+func (a *softAuthenticator) authData(flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+func (a *softAuthenticator) clientData(ceremony, challenge string) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		a.t.Fatalf("marshal client data: %v", err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) credentialJSON(response map[string]interface{}) []byte {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatalf("marshal credential: %v", err)
+	}
+	return body
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// newTestWebAuthnService tạo WebAuthnService dùng repository trong bộ nhớ và một user có sẵn
+func newTestWebAuthnService(t *testing.T) (WebAuthnService, *fakeWebAuthnRepo, *models.User) {
+	t.Helper()
+	users := newFakeUserRepo()
+	user := users.add(&models.User{Username: "alice", Email: "alice@example.com"})
+	repo := newFakeWebAuthnRepo()
+
+	service, err := NewWebAuthnService(users, repo, &config.Config{
+		WebAuthnRPID:      testRPID,
+		WebAuthnRPName:    "Demo Login",
+		WebAuthnRPOrigins: []string{testOrigin},
+	}, newTestLogger())
+	if err != nil {
+		t.Fatalf("NewWebAuthnService: %v", err)
+	}
+	return service, repo, user
+}
+
+// registerPasskey chạy trọn nghi thức đăng ký với authenticator phần mềm
+func registerPasskey(t *testing.T, service WebAuthnService, user *models.User) *softAuthenticator {
+	t.Helper()
+	creation, challengeID, err := service.BeginRegistration(user.ID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	authenticator := newSoftAuthenticator(t)
+	if _, err := service.FinishRegistration(user.ID, challengeID, "Laptop", authenticator.register(creation)); err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	return authenticator
+}
+
+func TestWebAuthnRegisterThenSecondFactorLogin(t *testing.T) {
+	service, repo, user := newTestWebAuthnService(t)
+	authenticator := registerPasskey(t, service, user)
+
+	credentials, _ := repo.ListCredentialsByUser(user.ID)
+	if len(credentials) != 1 || credentials[0].Name != "Laptop" || credentials[0].AttestationType != "none" {
+		t.Fatalf("unexpected stored credentials: %+v", credentials)
+	}
+
+	// Bước thứ hai sau mật khẩu: challenge gắn với user, chỉ chấp nhận credential của user đó
+	assertion, challengeID, err := service.BeginLogin(user, false)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	if len(assertion.Response.AllowedCredentials) != 1 {
+		t.Fatalf("expected the registered credential to be allowed, got %d", len(assertion.Response.AllowedCredentials))
+	}
+
+	loggedIn, err := service.FinishLogin(challengeID, authenticator.next(assertion))
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if loggedIn.ID != user.ID {
+		t.Fatalf("logged in as %s, want %s", loggedIn.ID, user.ID)
+	}
+
+	stored, _ := repo.FindCredentialByCredentialID(authenticator.credentialID)
+	if stored.SignCount != authenticator.signCount || stored.LastUsedAt == nil {
+		t.Fatalf("credential usage not recorded: sign count %d, last used %v", stored.SignCount, stored.LastUsedAt)
+	}
+}
+
+func TestWebAuthnRegisterThenPasswordlessLogin(t *testing.T) {
+	service, _, user := newTestWebAuthnService(t)
+	authenticator := registerPasskey(t, service, user)
+
+	// Không biết user trước: trình duyệt chọn discoverable credential, user được tìm theo user handle
+	assertion, challengeID, err := service.BeginLogin(nil, true)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	if len(assertion.Response.AllowedCredentials) != 0 {
+		t.Fatalf("discoverable login must not list credentials, got %d", len(assertion.Response.AllowedCredentials))
+	}
+	if assertion.Response.UserVerification != protocol.VerificationRequired {
+		t.Fatalf("passwordless login must require user verification, got %q", assertion.Response.UserVerification)
+	}
+
+	loggedIn, err := service.FinishLogin(challengeID, authenticator.next(assertion))
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if loggedIn.ID != user.ID {
+		t.Fatalf("logged in as %s, want %s", loggedIn.ID, user.ID)
+	}
+}
+
+func TestWebAuthnReplayedChallengeRejected(t *testing.T) {
+	service, _, user := newTestWebAuthnService(t)
+	authenticator := registerPasskey(t, service, user)
+
+	assertion, challengeID, err := service.BeginLogin(user, false)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	response := authenticator.next(assertion)
+	if _, err := service.FinishLogin(challengeID, response); err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+
+	// Gửi lại đúng phản hồi đã dùng, và một phản hồi mới ký trên cùng challenge
+	if _, err := service.FinishLogin(challengeID, response); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("replayed response: got %v, want ErrInvalidChallenge", err)
+	}
+	if _, err := service.FinishLogin(challengeID, authenticator.next(assertion)); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("reused challenge: got %v, want ErrInvalidChallenge", err)
+	}
+}
+
+func TestWebAuthnRegistrationChallengeSingleUse(t *testing.T) {
+	service, _, user := newTestWebAuthnService(t)
+	creation, challengeID, err := service.BeginRegistration(user.ID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	authenticator := newSoftAuthenticator(t)
+	response := authenticator.register(creation)
+	if _, err := service.FinishRegistration(user.ID, challengeID, "", response); err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	if _, err := service.FinishRegistration(user.ID, challengeID, "", response); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("replayed registration: got %v, want ErrInvalidChallenge", err)
+	}
+}
+
+func TestWebAuthnChallengeOfAnotherCeremonyRejected(t *testing.T) {
+	service, _, user := newTestWebAuthnService(t)
+	authenticator := registerPasskey(t, service, user)
+
+	_, registrationID, err := service.BeginRegistration(user.ID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	assertion, _, err := service.BeginLogin(user, false)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	if _, err := service.FinishLogin(registrationID, authenticator.next(assertion)); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("registration challenge used for login: got %v, want ErrInvalidChallenge", err)
+	}
+}
+
+func TestWebAuthnExpiredChallengeRejected(t *testing.T) {
+	service, repo, user := newTestWebAuthnService(t)
+	authenticator := registerPasskey(t, service, user)
+
+	assertion, challengeID, err := service.BeginLogin(user, false)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	repo.expireChallenge(challengeID)
+
+	if _, err := service.FinishLogin(challengeID, authenticator.next(assertion)); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("expired challenge: got %v, want ErrInvalidChallenge", err)
+	}
+	if _, err := service.FinishLogin(uuid.New(), authenticator.next(assertion)); !errors.Is(err, ErrInvalidChallenge) {
+		t.Fatalf("unknown challenge: got %v, want ErrInvalidChallenge", err)
+	}
+}
+
+func TestWebAuthnSignCountRegressionRejected(t *testing.T) {
+	service, repo, user := newTestWebAuthnService(t)
+	authenticator := registerPasskey(t, service, user)
+
+	login := func(signCount uint32) error {
+		assertion, challengeID, err := service.BeginLogin(user, false)
+		if err != nil {
+			t.Fatalf("BeginLogin: %v", err)
+		}
+		_, err = service.FinishLogin(challengeID, authenticator.assert(assertion, signCount))
+		return err
+	}
+
+	if err := login(5); err != nil {
+		t.Fatalf("login with sign count 5: %v", err)
+	}
+	// Bộ đếm không tăng (hoặc giảm) cho thấy khóa có thể đã bị sao chép sang authenticator khác
+	if err := login(5); !errors.Is(err, ErrWebAuthnFailed) {
+		t.Fatalf("repeated sign count: got %v, want ErrWebAuthnFailed", err)
+	}
+	if err := login(3); !errors.Is(err, ErrWebAuthnFailed) {
+		t.Fatalf("decreased sign count: got %v, want ErrWebAuthnFailed", err)
+	}
+
+	stored, _ := repo.FindCredentialByCredentialID(authenticator.credentialID)
+	if stored.SignCount != 5 {
+		t.Fatalf("rejected logins must not update the sign count, got %d", stored.SignCount)
+	}
+	if err := login(6); err != nil {
+		t.Fatalf("login with increased sign count: %v", err)
+	}
+}
+
+func TestWebAuthnForgedSignatureRejected(t *testing.T) {
+	service, _, user := newTestWebAuthnService(t)
+	authenticator := registerPasskey(t, service, user)
+
+	assertion, challengeID, err := service.BeginLogin(user, false)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	// Ký bằng khóa khác với khóa đã đăng ký
+	forger := newSoftAuthenticator(t)
+	forger.credentialID = authenticator.credentialID
+	forger.userHandle = authenticator.userHandle
+	if _, err := service.FinishLogin(challengeID, forger.next(assertion)); !errors.Is(err, ErrWebAuthnFailed) {
+		t.Fatalf("forged signature: got %v, want ErrWebAuthnFailed", err)
+	}
+}
+
+func TestWebAuthnChallengeCleanup(t *testing.T) {
+	service, repo, user := newTestWebAuthnService(t)
+	_, expiredID, err := service.BeginLogin(user, false)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	if _, _, err := service.BeginLogin(user, false); err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	repo.expireChallenge(expiredID)
+
+	stop := StartWebAuthnChallengeCleanup(repo, 10*time.Millisecond, newTestLogger())
+	defer stop()
+
+	deadline := time.Now().Add(time.Second)
+	for repo.challengeCount() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expired challenge not purged, %d challenges left", repo.challengeCount())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,304 @@
+// Package ldapauth xác thực user bằng LDAP/Active Directory: bind trực tiếp theo mẫu DN
+// hoặc tìm user bằng tài khoản dịch vụ rồi bind lại bằng DN tìm được, sau đó đọc thuộc tính và nhóm của user.
+package ldapauth
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrInvalidCredentials được trả về khi user không tồn tại trong thư mục hoặc mật khẩu sai
+var ErrInvalidCredentials = errors.New("ldap: invalid credentials")
+
+// Các placeholder trong mẫu DN và filter
+const (
+	placeholderUsername = "{username}"
+	placeholderDN       = "{dn}"
+)
+
+// Config là cấu hình kết nối và tìm kiếm
+type Config struct {
+	URL                string // ldap://host:389 hoặc ldaps://host:636
+	StartTLS           bool
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+
+	// Tài khoản dịch vụ dùng để tìm user và nhóm (rỗng = bind ẩn danh)
+	BindDN       string
+	BindPassword string
+
+	// UserDNTemplates là các mẫu tên dùng để bind trực tiếp bằng mật khẩu của user, thử lần lượt,
+	// ví dụ "uid={username},ou=people,dc=example,dc=com" hoặc "{username}@corp.example.com" (AD).
+	// Rỗng = tìm DN của user bằng UserBaseDN và UserFilter rồi bind.
+	UserDNTemplates []string
+	UserBaseDN      string
+	UserFilter      string // Ví dụ "(uid={username})" hoặc "(sAMAccountName={username})"
+
+	// Nhóm của user được lấy từ GroupAttribute của user (memberOf) và,
+	// nếu GroupBaseDN khác rỗng, từ các nhóm khớp GroupFilter, ví dụ "(member={dn})"
+	GroupBaseDN    string
+	GroupFilter    string
+	GroupAttribute string
+
+	// Tên các thuộc tính của user. IDAttribute rỗng = dùng DN làm định danh
+	IDAttribute        string
+	UsernameAttribute  string
+	EmailAttribute     string
+	FirstNameAttribute string
+	LastNameAttribute  string
+}
+
+// Entry là thông tin của user đọc từ thư mục
+type Entry struct {
+	DN        string
+	ID        string // Định danh ổn định của user (entryUUID, objectGUID...) hoặc DN
+	Username  string
+	Email     string
+	FirstName string
+	LastName  string
+	Groups    []string // DN của các nhóm user là thành viên
+}
+
+// Client xác thực user với một LDAP server. Mỗi lần xác thực mở một kết nối mới.
+type Client struct {
+	config Config
+}
+
+// New tạo Client với cấu hình cho trước
+func New(config Config) *Client {
+	return &Client{config: config}
+}
+
+// Authenticate kiểm tra username và mật khẩu với LDAP server và trả về thông tin user
+func (c *Client) Authenticate(username, password string) (*Entry, error) {
+	// Bind với mật khẩu rỗng là "unauthenticated bind" và luôn thành công trên nhiều server
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var entry *ldap.Entry
+	if len(c.config.UserDNTemplates) > 0 {
+		bindName, err := c.bindTemplates(conn, username, password)
+		if err != nil {
+			return nil, err
+		}
+		entry, err = c.readBoundUser(conn, bindName, username)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if err := c.bindServiceAccount(conn); err != nil {
+			return nil, err
+		}
+		entry, err = c.searchUser(conn, username)
+		if err != nil {
+			return nil, err
+		}
+		if err := bindUser(conn, entry.DN, password); err != nil {
+			return nil, err
+		}
+		// Tìm nhóm bằng quyền của tài khoản dịch vụ, user thường không được đọc thư mục
+		if err := c.bindServiceAccount(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	groups, err := c.groups(conn, entry, username)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Entry{
+		DN:        entry.DN,
+		ID:        c.entryID(entry),
+		Username:  entry.GetEqualFoldAttributeValue(c.config.UsernameAttribute),
+		Email:     entry.GetEqualFoldAttributeValue(c.config.EmailAttribute),
+		FirstName: entry.GetEqualFoldAttributeValue(c.config.FirstNameAttribute),
+		LastName:  entry.GetEqualFoldAttributeValue(c.config.LastNameAttribute),
+		Groups:    groups,
+	}
+	if result.Username == "" {
+		result.Username = username
+	}
+	return result, nil
+}
+
+// dial mở kết nối (và StartTLS nếu được cấu hình)
+func (c *Client) dial() (*ldap.Conn, error) {
+	u, err := url.Parse(c.config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid url: %w", err)
+	}
+	tlsConfig := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: c.config.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(c.config.URL, ldap.DialWithDialer(&net.Dialer{Timeout: c.config.Timeout}), ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(c.config.Timeout)
+
+	if c.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// bindTemplates bind bằng mật khẩu của user với lần lượt các mẫu DN, trả về tên đã bind thành công
+func (c *Client) bindTemplates(conn *ldap.Conn, username, password string) (string, error) {
+	for _, template := range c.config.UserDNTemplates {
+		value := username
+		if isDN(template) {
+			value = ldap.EscapeDN(username)
+		}
+		bindName := strings.ReplaceAll(template, placeholderUsername, value)
+
+		err := bindUser(conn, bindName, password)
+		if err == nil {
+			return bindName, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			return "", err
+		}
+	}
+	return "", ErrInvalidCredentials
+}
+
+// readBoundUser đọc entry của user vừa bind: đọc trực tiếp nếu tên bind là DN,
+// ngược lại (UPN của AD) tìm theo UserBaseDN và UserFilter
+func (c *Client) readBoundUser(conn *ldap.Conn, bindName, username string) (*ldap.Entry, error) {
+	if isDN(bindName) {
+		result, err := conn.Search(ldap.NewSearchRequest(
+			bindName, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+			"(objectClass=*)", c.userAttributes(), nil,
+		))
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Entries) != 1 {
+			return nil, ErrInvalidCredentials
+		}
+		return result.Entries[0], nil
+	}
+	return c.searchUser(conn, username)
+}
+
+// searchUser tìm đúng một user khớp UserFilter dưới UserBaseDN
+func (c *Client) searchUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	filter := strings.ReplaceAll(c.config.UserFilter, placeholderUsername, ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		c.config.UserBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		filter, c.userAttributes(), nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+	// Không tìm thấy hoặc filter khớp nhiều user: không thể biết user nào đang đăng nhập
+	if result == nil || len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return result.Entries[0], nil
+}
+
+// groups lấy DN các nhóm của user từ thuộc tính memberOf và từ tìm kiếm nhóm
+func (c *Client) groups(conn *ldap.Conn, entry *ldap.Entry, username string) ([]string, error) {
+	var groups []string
+	if c.config.GroupAttribute != "" {
+		groups = append(groups, entry.GetEqualFoldAttributeValues(c.config.GroupAttribute)...)
+	}
+	if c.config.GroupBaseDN == "" || c.config.GroupFilter == "" {
+		return groups, nil
+	}
+
+	filter := strings.NewReplacer(
+		placeholderDN, ldap.EscapeFilter(entry.DN),
+		placeholderUsername, ldap.EscapeFilter(username),
+	).Replace(c.config.GroupFilter)
+	result, err := conn.Search(ldap.NewSearchRequest(
+		c.config.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter, []string{"dn"}, nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range result.Entries {
+		groups = append(groups, group.DN)
+	}
+	return groups, nil
+}
+
+// bindServiceAccount bind bằng tài khoản dịch vụ, hoặc bỏ qua để tìm kiếm ẩn danh
+func (c *Client) bindServiceAccount(conn *ldap.Conn) error {
+	if c.config.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(c.config.BindDN, c.config.BindPassword); err != nil {
+		return fmt.Errorf("ldap: service account bind failed: %w", err)
+	}
+	return nil
+}
+
+// userAttributes là các thuộc tính cần đọc của user
+func (c *Client) userAttributes() []string {
+	var attributes []string
+	for _, attribute := range []string{c.config.IDAttribute, c.config.UsernameAttribute, c.config.EmailAttribute, c.config.FirstNameAttribute, c.config.LastNameAttribute, c.config.GroupAttribute} {
+		if attribute != "" {
+			attributes = append(attributes, attribute)
+		}
+	}
+	return attributes
+}
+
+// entryID lấy định danh ổn định của user; giá trị nhị phân (objectGUID của AD) được mã hóa hex
+func (c *Client) entryID(entry *ldap.Entry) string {
+	if c.config.IDAttribute != "" {
+		if raw := entry.GetEqualFoldRawAttributeValue(c.config.IDAttribute); len(raw) > 0 {
+			if utf8.Valid(raw) {
+				return string(raw)
+			}
+			return hex.EncodeToString(raw)
+		}
+	}
+	return strings.ToLower(entry.DN)
+}
+
+// bindUser bind bằng tên và mật khẩu của user, chuyển lỗi sai mật khẩu thành ErrInvalidCredentials
+func bindUser(conn *ldap.Conn, name, password string) error {
+	err := conn.Bind(name, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
+// isDN kiểm tra chuỗi có phải DN (vd "uid=a,dc=example") thay vì UPN ("a@example.com")
+func isDN(s string) bool {
+	return strings.Contains(s, "=")
+}
+
+// SameDN so sánh hai DN không phân biệt hoa thường và khoảng trắng giữa các thành phần
+func SameDN(a, b string) bool {
+	dnA, errA := ldap.ParseDN(a)
+	dnB, errB := ldap.ParseDN(b)
+	if errA != nil || errB != nil {
+		return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+	}
+	return dnA.EqualFold(dnB)
+}
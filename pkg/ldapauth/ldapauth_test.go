@@ -0,0 +1,256 @@
+package ldapauth
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/pkg/ldapauth/ldaptest"
+)
+
+const (
+	testPeopleDN  = "ou=people,dc=example,dc=com"
+	testGroupsDN  = "ou=groups,dc=example,dc=com"
+	testServiceDN = "uid=svc,ou=services,dc=example,dc=com"
+	testJohnDN    = "uid=jdoe,ou=people,dc=example,dc=com"
+	testJaneDN    = `uid=doe\,jane,ou=people,dc=example,dc=com`
+)
+
+// newTestDirectory khởi động LDAP server với hai user (một user có dấu phẩy trong uid),
+// tài khoản dịch vụ và hai nhóm
+func newTestDirectory(t *testing.T) *ldaptest.Server {
+	t.Helper()
+	s := ldaptest.NewServer(
+		ldaptest.Entry{DN: testServiceDN, Password: "svc-secret"},
+		ldaptest.Entry{DN: testJohnDN, Password: "john-secret", Attributes: map[string][]string{
+			"uid":               {"jdoe"},
+			"entryUUID":         {"uuid-jdoe"},
+			"mail":              {"jdoe@example.com"},
+			"givenName":         {"John"},
+			"sn":                {"Doe"},
+			"userPrincipalName": {"jdoe@corp.example.com"},
+			"memberOf":          {"cn=admins," + testGroupsDN},
+		}},
+		ldaptest.Entry{DN: testJaneDN, Password: "jane-secret", Attributes: map[string][]string{
+			"uid":  {"doe,jane"},
+			"mail": {"jane@example.com"},
+			"sn":   {"Doe"},
+		}},
+		ldaptest.Entry{DN: "cn=developers," + testGroupsDN, Attributes: map[string][]string{
+			"member": {testJohnDN, testJaneDN},
+		}},
+		ldaptest.Entry{DN: "cn=admins," + testGroupsDN, Attributes: map[string][]string{
+			"member": {testJohnDN},
+		}},
+	)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// templateConfig cấu hình bind trực tiếp theo mẫu DN
+func templateConfig(s *ldaptest.Server, templates ...string) Config {
+	return Config{
+		URL:                s.URL,
+		Timeout:            5 * time.Second,
+		UserDNTemplates:    templates,
+		UserBaseDN:         testPeopleDN,
+		UserFilter:         "(uid={username})",
+		GroupBaseDN:        testGroupsDN,
+		GroupFilter:        "(member={dn})",
+		GroupAttribute:     "memberOf",
+		IDAttribute:        "entryUUID",
+		UsernameAttribute:  "uid",
+		EmailAttribute:     "mail",
+		FirstNameAttribute: "givenName",
+		LastNameAttribute:  "sn",
+	}
+}
+
+// searchConfig cấu hình tìm user bằng tài khoản dịch vụ rồi bind lại
+func searchConfig(s *ldaptest.Server) Config {
+	config := templateConfig(s)
+	config.BindDN = testServiceDN
+	config.BindPassword = "svc-secret"
+	return config
+}
+
+func TestAuthenticateWithDNTemplate(t *testing.T) {
+	s := newTestDirectory(t)
+	client := New(templateConfig(s, "uid={username},"+testPeopleDN))
+
+	entry, err := client.Authenticate("jdoe", "john-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	want := &Entry{
+		DN:        testJohnDN,
+		ID:        "uuid-jdoe",
+		Username:  "jdoe",
+		Email:     "jdoe@example.com",
+		FirstName: "John",
+		LastName:  "Doe",
+		// memberOf trước, sau đó các nhóm tìm được bằng GroupFilter
+		Groups: []string{"cn=admins," + testGroupsDN, "cn=developers," + testGroupsDN, "cn=admins," + testGroupsDN},
+	}
+	if !reflect.DeepEqual(entry, want) {
+		t.Fatalf("entry = %+v, want %+v", entry, want)
+	}
+}
+
+func TestDNTemplatesAreTriedInOrder(t *testing.T) {
+	s := newTestDirectory(t)
+	client := New(templateConfig(s, "uid={username},ou=staff,dc=example,dc=com", "uid={username},"+testPeopleDN))
+
+	entry, err := client.Authenticate("jdoe", "john-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if entry.DN != testJohnDN {
+		t.Fatalf("DN = %q, want %q", entry.DN, testJohnDN)
+	}
+	want := []string{"uid=jdoe,ou=staff,dc=example,dc=com", testJohnDN}
+	if got := s.Binds(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("binds = %q, want %q", got, want)
+	}
+}
+
+func TestDNTemplateEscapesUsername(t *testing.T) {
+	s := newTestDirectory(t)
+	client := New(templateConfig(s, "uid={username},"+testPeopleDN))
+
+	entry, err := client.Authenticate("doe,jane", "jane-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if entry.DN != testJaneDN || entry.Username != "doe,jane" {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+	// Dấu phẩy trong username phải được escape, nếu không DN bind sẽ có thêm một RDN "jane"
+	if got := s.Binds(); len(got) != 1 || got[0] != testJaneDN {
+		t.Fatalf("binds = %q, want [%q]", got, testJaneDN)
+	}
+	// DN của user được escape khi đưa vào filter tìm nhóm
+	if got := s.Filters(); got[len(got)-1] != `(member=uid=doe\5c,jane,ou=people,dc=example,dc=com)` {
+		t.Fatalf("group filter = %q", got[len(got)-1])
+	}
+	if len(entry.Groups) != 1 || entry.Groups[0] != "cn=developers,"+testGroupsDN {
+		t.Fatalf("groups = %q", entry.Groups)
+	}
+}
+
+func TestUPNTemplateSearchesUser(t *testing.T) {
+	s := newTestDirectory(t)
+	client := New(templateConfig(s, "{username}@corp.example.com"))
+
+	entry, err := client.Authenticate("jdoe", "john-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if entry.DN != testJohnDN {
+		t.Fatalf("DN = %q, want %q", entry.DN, testJohnDN)
+	}
+	if got := s.Binds(); len(got) != 1 || got[0] != "jdoe@corp.example.com" {
+		t.Fatalf("binds = %q, want the UPN", got)
+	}
+}
+
+func TestAuthenticateSearchThenBind(t *testing.T) {
+	s := newTestDirectory(t)
+	client := New(searchConfig(s))
+
+	entry, err := client.Authenticate("jdoe", "john-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if entry.DN != testJohnDN || entry.ID != "uuid-jdoe" || entry.Email != "jdoe@example.com" {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+	// Tìm bằng tài khoản dịch vụ, bind bằng DN tìm được, rồi quay lại tài khoản dịch vụ để đọc nhóm
+	want := []string{testServiceDN, testJohnDN, testServiceDN}
+	if got := s.Binds(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("binds = %q, want %q", got, want)
+	}
+}
+
+func TestSearchEscapesFilter(t *testing.T) {
+	s := newTestDirectory(t)
+	client := New(searchConfig(s))
+
+	if _, err := client.Authenticate("*)(", "john-secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want ErrInvalidCredentials", err)
+	}
+	if got := s.Filters(); len(got) != 1 || got[0] != `(uid=\2a\29\28)` {
+		t.Fatalf("filters = %q, want the username escaped as an equality value", got)
+	}
+}
+
+func TestSearchMatchingSeveralUsers(t *testing.T) {
+	s := newTestDirectory(t)
+	config := searchConfig(s)
+	config.UserFilter = "(sn={username})"
+
+	// Hai user cùng họ "Doe": không biết user nào đang đăng nhập
+	if _, err := New(config).Authenticate("Doe", "john-secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestAuthenticateRejectsWrongPassword(t *testing.T) {
+	s := newTestDirectory(t)
+	configs := map[string]Config{
+		"template": templateConfig(s, "uid={username},"+testPeopleDN),
+		"search":   searchConfig(s),
+	}
+	for name, config := range configs {
+		t.Run(name, func(t *testing.T) {
+			client := New(config)
+			if _, err := client.Authenticate("jdoe", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("got %v, want ErrInvalidCredentials", err)
+			}
+			if _, err := client.Authenticate("nobody", "john-secret"); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("unknown user: got %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRejectsEmptyPassword(t *testing.T) {
+	s := newTestDirectory(t)
+	client := New(templateConfig(s, "uid={username},"+testPeopleDN))
+
+	if _, err := client.Authenticate("jdoe", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want ErrInvalidCredentials", err)
+	}
+	if got := s.Binds(); len(got) != 0 {
+		t.Fatalf("binds = %q, an empty password must not reach the server", got)
+	}
+}
+
+func TestServiceAccountBindFailure(t *testing.T) {
+	s := newTestDirectory(t)
+	config := searchConfig(s)
+	config.BindPassword = "wrong"
+
+	_, err := New(config).Authenticate("jdoe", "john-secret")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want a configuration error distinct from invalid credentials", err)
+	}
+}
+
+func TestSameDN(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"cn=Admins,ou=Groups,dc=example,dc=com", "cn=admins, ou=groups, dc=example, dc=com", true},
+		{"cn=admins,ou=groups,dc=example,dc=com", "cn=developers,ou=groups,dc=example,dc=com", false},
+		{`uid=doe\,jane,dc=example`, `UID=Doe\2cJane,DC=Example`, true},
+		{"not a dn", " NOT A DN ", true},
+	}
+	for _, tt := range tests {
+		if got := SameDN(tt.a, tt.b); got != tt.want {
+			t.Errorf("SameDN(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+// Package ldaptest cung cấp LDAP server chạy trong tiến trình để kiểm thử, tương tự net/http/httptest.
+// Server chỉ hỗ trợ simple bind, search (filter and, or, not, equality, substrings, present) và unbind
+// trên một danh sách entry cố định, đủ để kiểm tra ldapauth mà không cần directory server thật.
+package ldaptest
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Entry là một entry trong thư mục
+type Entry struct {
+	DN         string
+	Password   string // Mật khẩu cho simple bind; rỗng = không bind được bằng entry này
+	Attributes map[string][]string
+}
+
+// Server là LDAP server lắng nghe trên cổng ngẫu nhiên của 127.0.0.1
+type Server struct {
+	URL string // ldap://127.0.0.1:<port>
+
+	listener net.Listener
+	entries  []Entry
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	binds   []string
+	filters []string
+}
+
+// NewServer khởi động server với các entry cho trước. Gọi Close khi kết thúc test.
+func NewServer(entries ...Entry) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("ldaptest: failed to listen: " + err.Error())
+	}
+	s := &Server{
+		URL:      "ldap://" + listener.Addr().String(),
+		listener: listener,
+		entries:  entries,
+		conns:    map[net.Conn]struct{}{},
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Close dừng server và đóng mọi kết nối đang mở
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Binds trả về tên của các lần bind (kể cả thất bại) theo thứ tự nhận được
+func (s *Server) Binds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+// Filters trả về filter của các lần search theo thứ tự nhận được, ở dạng chuỗi
+func (s *Server) Filters() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.filters...)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// handle xử lý lần lượt các request của một kết nối cho tới khi client unbind hoặc đóng kết nối
+func (s *Server) handle(conn net.Conn) {
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := s.bind(op)
+			writeResult(conn, messageID, ldap.ApplicationBindResponse, code)
+		case ldap.ApplicationSearchRequest:
+			s.search(conn, messageID, op)
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			writeResult(conn, messageID, ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform)
+		}
+	}
+}
+
+// bind kiểm tra simple bind: tên là DN của entry hoặc userPrincipalName (kiểu Active Directory)
+func (s *Server) bind(op *ber.Packet) uint16 {
+	if len(op.Children) < 3 || op.Children[2].Tag != 0 {
+		return ldap.LDAPResultAuthMethodNotSupported
+	}
+	name := stringValue(op.Children[1])
+	password := stringValue(op.Children[2])
+
+	s.mu.Lock()
+	s.binds = append(s.binds, name)
+	s.mu.Unlock()
+
+	if name == "" {
+		return ldap.LDAPResultSuccess // Bind ẩn danh
+	}
+	if password == "" {
+		return ldap.LDAPResultUnwillingToPerform // Không chấp nhận "unauthenticated bind"
+	}
+
+	var entry *Entry
+	if strings.Contains(name, "=") {
+		dn, err := ldap.ParseDN(name)
+		if err != nil {
+			return ldap.LDAPResultInvalidDNSyntax
+		}
+		entry = s.findByDN(dn)
+	} else {
+		for i := range s.entries {
+			if hasValue(s.entries[i], "userPrincipalName", name) {
+				entry = &s.entries[i]
+				break
+			}
+		}
+	}
+	if entry == nil || entry.Password == "" || entry.Password != password {
+		return ldap.LDAPResultInvalidCredentials
+	}
+	return ldap.LDAPResultSuccess
+}
+
+// search trả về các entry dưới base DN khớp filter, giới hạn bởi sizeLimit của request
+func (s *Server) search(conn net.Conn, messageID int64, op *ber.Packet) {
+	if len(op.Children) < 8 {
+		writeResult(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError)
+		return
+	}
+	scope, _ := op.Children[1].Value.(int64)
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	filter := op.Children[6]
+	var attributes []string
+	for _, attribute := range op.Children[7].Children {
+		attributes = append(attributes, stringValue(attribute))
+	}
+
+	if text, err := ldap.DecompileFilter(filter); err == nil {
+		s.mu.Lock()
+		s.filters = append(s.filters, text)
+		s.mu.Unlock()
+	}
+
+	base, err := ldap.ParseDN(stringValue(op.Children[0]))
+	if err != nil {
+		writeResult(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInvalidDNSyntax)
+		return
+	}
+	if scope == ldap.ScopeBaseObject && s.findByDN(base) == nil {
+		writeResult(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultNoSuchObject)
+		return
+	}
+
+	var found []Entry
+	for _, entry := range s.entries {
+		dn, err := ldap.ParseDN(entry.DN)
+		if err != nil || !inScope(base, dn, scope) {
+			continue
+		}
+		ok, err := matches(entry, filter)
+		if err != nil {
+			writeResult(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError)
+			return
+		}
+		if ok {
+			found = append(found, entry)
+		}
+	}
+
+	code := uint16(ldap.LDAPResultSuccess)
+	if sizeLimit > 0 && int64(len(found)) > sizeLimit {
+		found = found[:sizeLimit]
+		code = ldap.LDAPResultSizeLimitExceeded
+	}
+	for _, entry := range found {
+		writeEntry(conn, messageID, entry, attributes)
+	}
+	writeResult(conn, messageID, ldap.ApplicationSearchResultDone, code)
+}
+
+func (s *Server) findByDN(dn *ldap.DN) *Entry {
+	for i := range s.entries {
+		entryDN, err := ldap.ParseDN(s.entries[i].DN)
+		if err == nil && entryDN.EqualFold(dn) {
+			return &s.entries[i]
+		}
+	}
+	return nil
+}
+
+// inScope kiểm tra DN có nằm trong phạm vi search tính từ base không
+func inScope(base, dn *ldap.DN, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return base.EqualFold(dn)
+	case ldap.ScopeSingleLevel:
+		return len(dn.RDNs) > 0 && base.EqualFold(&ldap.DN{RDNs: dn.RDNs[1:]})
+	default:
+		return base.EqualFold(dn) || base.AncestorOfFold(dn)
+	}
+}
+
+// matches đánh giá filter (dạng BER) trên entry; so sánh giá trị không phân biệt hoa thường
+func matches(entry Entry, filter *ber.Packet) (bool, error) {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			ok, err := matches(entry, child)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			ok, err := matches(entry, child)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case ldap.FilterNot:
+		if len(filter.Children) != 1 {
+			return false, errors.New("ldaptest: invalid not filter")
+		}
+		ok, err := matches(entry, filter.Children[0])
+		return !ok, err
+	case ldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false, errors.New("ldaptest: invalid equality filter")
+		}
+		return hasValue(entry, stringValue(filter.Children[0]), stringValue(filter.Children[1])), nil
+	case ldap.FilterSubstrings:
+		if len(filter.Children) != 2 {
+			return false, errors.New("ldaptest: invalid substrings filter")
+		}
+		for _, value := range values(entry, stringValue(filter.Children[0])) {
+			if matchSubstrings(strings.ToLower(value), filter.Children[1].Children) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ldap.FilterPresent:
+		return len(values(entry, stringValue(filter))) > 0, nil
+	default:
+		return false, errors.New("ldaptest: unsupported filter")
+	}
+}
+
+// matchSubstrings so khớp giá trị (đã chuyển chữ thường) với các phần initial, any, final của filter
+func matchSubstrings(value string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		sub := strings.ToLower(stringValue(part))
+		switch part.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, sub) {
+				return false
+			}
+			value = value[len(sub):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(value, sub)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(sub):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, sub) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// values trả về các giá trị của thuộc tính (tên không phân biệt hoa thường); "objectClass" luôn có giá trị
+func values(entry Entry, attribute string) []string {
+	for name, vals := range entry.Attributes {
+		if strings.EqualFold(name, attribute) {
+			return vals
+		}
+	}
+	if strings.EqualFold(attribute, "objectClass") {
+		return []string{"top"}
+	}
+	return nil
+}
+
+func hasValue(entry Entry, attribute, value string) bool {
+	for _, v := range values(entry, attribute) {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringValue(p *ber.Packet) string {
+	if p.Data == nil {
+		return ""
+	}
+	return p.Data.String()
+}
+
+// writeResult gửi LDAPResult với mã kết quả cho trước trong response có tag tương ứng
+func writeResult(conn net.Conn, messageID int64, tag ber.Tag, code uint16) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, ldap.LDAPResultCodeMap[code], "diagnosticMessage"))
+	writeMessage(conn, messageID, op)
+}
+
+// writeEntry gửi SearchResultEntry chỉ với các thuộc tính được yêu cầu (không yêu cầu = tất cả)
+func writeEntry(conn net.Conn, messageID int64, entry Entry, attributes []string) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "objectName"))
+	list := ber.NewSequence("attributes")
+	for name, vals := range entry.Attributes {
+		if !requested(attributes, name) {
+			continue
+		}
+		attribute := ber.NewSequence("attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range vals {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attribute.AppendChild(set)
+		list.AppendChild(attribute)
+	}
+	op.AppendChild(list)
+	writeMessage(conn, messageID, op)
+}
+
+func requested(attributes []string, name string) bool {
+	if len(attributes) == 0 {
+		return true
+	}
+	for _, attribute := range attributes {
+		if attribute == "*" || strings.EqualFold(attribute, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeMessage(conn net.Conn, messageID int64, op *ber.Packet) {
+	packet := ber.NewSequence("LDAP Message")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "messageID"))
+	packet.AppendChild(op)
+	_, _ = conn.Write(packet.Bytes())
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileSender ghi email vào một file định dạng mbox, có thể mở bằng các trình đọc mail thông thường
+type fileSender struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+// NewFileSender tạo Sender ghi email vào file mbox
+func NewFileSender(path, from string) Sender {
+	return &fileSender{path: path, from: from}
+}
+
+// Send ghi email vào cuối file mbox
+func (s *fileSender) Send(msg Message) error {
+	data, err := buildMIME(s.from, msg)
+	if err != nil {
+		return err
+	}
+	from, err := envelopeAddress(s.from)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("From " + from + " " + time.Now().UTC().Format(time.ANSIC) + "\n")
+	for _, line := range bytes.Split(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\n")) {
+		// Dòng bắt đầu bằng "From " phải được escape để không bị hiểu là email mới
+		if bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) {
+			buf.WriteByte('>')
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
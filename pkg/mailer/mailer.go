@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+)
+
+// Message là một email cần gửi
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string // Không bắt buộc, nếu có thì email được gửi dạng multipart/alternative
+}
+
+// Sender định nghĩa interface cho các cách gửi email
+type Sender interface {
+	Send(msg Message) error
+}
+
+// logSender chỉ ghi nội dung email ra log, dùng khi phát triển
+type logSender struct {
+	logger *logger.Logger
+}
+
+// NewLogSender tạo Sender ghi email ra log thay vì gửi thật
+func NewLogSender(logger *logger.Logger) Sender {
+	return &logSender{logger: logger}
+}
+
+// Send ghi email ra log
+func (s *logSender) Send(msg Message) error {
+	s.logger.Infof("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
@@ -0,0 +1,36 @@
+package mailer
+
+import "sync"
+
+// MemorySender lưu email trong bộ nhớ thay vì gửi, dùng cho kiểm thử
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemorySender tạo một MemorySender rỗng
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+// Send lưu email vào bộ nhớ
+func (s *MemorySender) Send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages trả về bản sao các email đã gửi
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Reset xóa các email đã lưu
+func (s *MemorySender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+}
@@ -0,0 +1,127 @@
+package mailer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrQueueFull   = errors.New("mail queue is full")
+	ErrQueueClosed = errors.New("mail queue is closed")
+)
+
+// QueueOptions cấu hình hàng đợi gửi email
+type QueueOptions struct {
+	Size        int           // Số email tối đa đang chờ gửi
+	Workers     int           // Số goroutine gửi song song
+	MaxAttempts int           // Số lần thử gửi tối đa cho mỗi email
+	RetryDelay  time.Duration // Thời gian chờ trước lần thử lại đầu tiên, tăng gấp đôi sau mỗi lần
+}
+
+// Queue là Sender gửi email bất đồng bộ qua một hàng đợi trong bộ nhớ,
+// tự động thử lại khi Sender bên dưới gặp lỗi (vd: SMTP server tạm thời không phản hồi)
+type Queue struct {
+	sender  Sender
+	options QueueOptions
+	logger  *logger.Logger
+
+	messages chan Message
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewQueue tạo hàng đợi và khởi động các worker gửi email
+func NewQueue(sender Sender, options QueueOptions, logger *logger.Logger) *Queue {
+	if options.Size <= 0 {
+		options.Size = 100
+	}
+	if options.Workers <= 0 {
+		options.Workers = 1
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = 1
+	}
+
+	q := &Queue{
+		sender:   sender,
+		options:  options,
+		logger:   logger,
+		messages: make(chan Message, options.Size),
+		done:     make(chan struct{}),
+	}
+	for i := 0; i < options.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	return q
+}
+
+// Send đưa email vào hàng đợi và trả về ngay, không chờ gửi xong
+func (q *Queue) Send(msg Message) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close ngừng nhận email mới, gửi nốt các email còn trong hàng đợi (không thử lại nữa)
+// và chờ các worker kết thúc
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.done)
+	close(q.messages)
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+func (q *Queue) worker() {
+	defer q.wg.Done()
+	for msg := range q.messages {
+		q.deliver(msg)
+	}
+}
+
+// deliver gửi một email, thử lại với thời gian chờ tăng dần khi gặp lỗi
+func (q *Queue) deliver(msg Message) {
+	delay := q.options.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err := q.sender.Send(msg)
+		if err == nil {
+			return
+		}
+		if attempt >= q.options.MaxAttempts {
+			q.logger.Errorf("Giving up sending mail to %s after %d attempts: %v", msg.To, attempt, err)
+			return
+		}
+		q.logger.Errorf("Failed to send mail to %s (attempt %d): %v", msg.To, attempt, err)
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-q.done:
+			q.logger.Errorf("Mail queue closed, dropping mail to %s", msg.To)
+			return
+		}
+	}
+}
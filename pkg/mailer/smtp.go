@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+)
+
+// SMTPConfig chứa thông tin kết nối tới SMTP server
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string // Địa chỉ gửi, dạng "Tên <email>" hoặc "email"
+}
+
+// smtpSender gửi email qua SMTP server. STARTTLS được dùng tự động nếu server hỗ trợ.
+type smtpSender struct {
+	config SMTPConfig
+}
+
+// NewSMTPSender tạo Sender gửi email qua SMTP
+func NewSMTPSender(config SMTPConfig) Sender {
+	return &smtpSender{config: config}
+}
+
+// Send gửi email qua SMTP
+func (s *smtpSender) Send(msg Message) error {
+	from, err := envelopeAddress(s.config.From)
+	if err != nil {
+		return err
+	}
+	to, err := envelopeAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	data, err := buildMIME(s.config.From, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.config.Username != "" {
+		auth = smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(s.config.Host, s.config.Port), auth, from, []string{to}, data)
+}
@@ -0,0 +1,141 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Tên các template email
+const (
+	TemplateVerification  = "verification"
+	TemplatePasswordReset = "password_reset"
+	TemplateLoginAlert    = "login_alert"
+	TemplateInvitation    = "invitation"
+	TemplateMagicLink     = "magic_link"
+)
+
+// Các ngôn ngữ được hỗ trợ
+const (
+	LocaleVietnamese = "vi"
+	LocaleEnglish    = "en"
+)
+
+var (
+	templateNames = []string{TemplateVerification, TemplatePasswordReset, TemplateLoginAlert, TemplateInvitation, TemplateMagicLink}
+	locales       = []string{LocaleVietnamese, LocaleEnglish}
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Renderer tạo nội dung email (tiêu đề, bản text và bản HTML) từ các template theo ngôn ngữ.
+// Mỗi template gồm file <locale>/<name>.txt (chứa block "subject" và nội dung text)
+// và file <locale>/<name>.html.
+type Renderer struct {
+	defaultLocale string
+	text          map[string]*texttemplate.Template
+	html          map[string]*htmltemplate.Template
+}
+
+// NewRenderer nạp tất cả template. Ngôn ngữ mặc định được dùng khi ngôn ngữ yêu cầu không được hỗ trợ.
+func NewRenderer(defaultLocale string) (*Renderer, error) {
+	if !SupportsLocale(defaultLocale) {
+		return nil, fmt.Errorf("unsupported mail locale: %s", defaultLocale)
+	}
+
+	r := &Renderer{
+		defaultLocale: defaultLocale,
+		text:          make(map[string]*texttemplate.Template),
+		html:          make(map[string]*htmltemplate.Template),
+	}
+	for _, locale := range locales {
+		funcs := map[string]interface{}{"duration": durationFormatter(locale)}
+		for _, name := range templateNames {
+			key := locale + "/" + name
+
+			textTmpl, err := texttemplate.New(name+".txt").Funcs(funcs).ParseFS(templateFS, "templates/"+key+".txt")
+			if err != nil {
+				return nil, err
+			}
+			if textTmpl.Lookup("subject") == nil {
+				return nil, fmt.Errorf("mail template %s is missing subject", key)
+			}
+			htmlTmpl, err := htmltemplate.New(name+".html").Funcs(funcs).ParseFS(templateFS, "templates/"+key+".html")
+			if err != nil {
+				return nil, err
+			}
+
+			r.text[key] = textTmpl
+			r.html[key] = htmlTmpl
+		}
+	}
+	return r, nil
+}
+
+// SupportsLocale kiểm tra ngôn ngữ có template không
+func SupportsLocale(locale string) bool {
+	for _, l := range locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// Render tạo email gửi tới địa chỉ to từ template name theo ngôn ngữ locale
+func (r *Renderer) Render(name, locale, to string, data interface{}) (Message, error) {
+	if !SupportsLocale(locale) {
+		locale = r.defaultLocale
+	}
+	key := locale + "/" + name
+
+	textTmpl, ok := r.text[key]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown mail template: %s", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := textTmpl.Execute(&text, data); err != nil {
+		return Message{}, err
+	}
+	if err := r.html[key].Execute(&html, data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
+
+// durationFormatter trả về hàm hiển thị thời lượng (vd: "24 giờ", "30 minutes") theo ngôn ngữ
+func durationFormatter(locale string) func(time.Duration) string {
+	units := map[string][3]string{
+		LocaleVietnamese: {"ngày", "giờ", "phút"},
+		LocaleEnglish:    {"day", "hour", "minute"},
+	}[locale]
+
+	return func(d time.Duration) string {
+		value, unit := int64(d/time.Minute), units[2]
+		switch {
+		case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+			value, unit = int64(d/(24*time.Hour)), units[0]
+		case d >= time.Hour && d%time.Hour == 0:
+			value, unit = int64(d/time.Hour), units[1]
+		}
+		if locale == LocaleEnglish && value != 1 {
+			unit += "s"
+		}
+		return fmt.Sprintf("%d %s", value, unit)
+	}
+}
@@ -0,0 +1,423 @@
+package oauth2client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Loại provider
+const (
+	TypeOIDC   = "oidc"   // OpenID Connect: endpoint lấy từ discovery, danh tính lấy từ ID token
+	TypeOAuth2 = "oauth2" // OAuth 2.0 thuần (vd: GitHub): danh tính lấy từ userinfo endpoint
+)
+
+// maxResponseSize giới hạn kích thước response đọc từ provider
+const maxResponseSize = 1 << 20
+
+// Định nghĩa các lỗi
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrNoSubject      = errors.New("provider did not return a subject")
+)
+
+// Fields là tên các trường trong response userinfo tương ứng với thông tin user (provider OAuth 2.0)
+type Fields struct {
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified string
+	GivenName     string
+	FamilyName    string
+}
+
+// DefaultFields là tên các claim chuẩn của OpenID Connect
+var DefaultFields = Fields{
+	Subject:       "sub",
+	Username:      "preferred_username",
+	Email:         "email",
+	EmailVerified: "email_verified",
+	GivenName:     "given_name",
+	FamilyName:    "family_name",
+}
+
+// Config là cấu hình của một identity provider
+type Config struct {
+	Name         string
+	Type         string // TypeOIDC hoặc TypeOAuth2
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// Issuer của provider OIDC; các endpoint còn trống được lấy từ <Issuer>/.well-known/openid-configuration
+	Issuer      string
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	// EmailsURL trả về danh sách email kèm trạng thái xác minh (vd: https://api.github.com/user/emails)
+	EmailsURL string
+	Fields    Fields
+}
+
+// Token là response của token endpoint
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+// Identity là danh tính của user do provider xác nhận
+type Identity struct {
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// Provider là client OAuth 2.0/OpenID Connect của một identity provider
+type Provider struct {
+	config     Config
+	httpClient *http.Client
+
+	mu         sync.Mutex
+	discovered bool
+}
+
+// discoveryDocument là các trường cần dùng của OpenID provider metadata
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// NewProvider tạo client cho provider. httpClient = nil thì dùng http.DefaultClient.
+func NewProvider(config Config, httpClient *http.Client) *Provider {
+	if config.Type == "" {
+		config.Type = TypeOIDC
+	}
+	if config.Fields == (Fields{}) {
+		config.Fields = DefaultFields
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Provider{config: config, httpClient: httpClient}
+}
+
+// Name trả về tên của provider
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL tạo URL chuyển user tới trang đăng nhập của provider (authorization code flow với PKCE S256)
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(p.config.AuthURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("state", state)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	if len(p.config.Scopes) > 0 {
+		query.Set("scope", strings.Join(p.config.Scopes, " "))
+	}
+	if p.config.Type == TypeOIDC && nonce != "" {
+		query.Set("nonce", nonce)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Exchange đổi authorization code lấy token
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"client_secret": {p.config.ClientSecret},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var response struct {
+		Token
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &response)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("token endpoint error: %s %s", response.Error, response.ErrorDescription)
+	}
+	if status != http.StatusOK || response.AccessToken == "" {
+		return nil, fmt.Errorf("token endpoint returned status %d", status)
+	}
+	return &response.Token, nil
+}
+
+// Identity lấy danh tính của user từ token. Với provider OIDC, ID token nhận trực tiếp từ token endpoint
+// qua TLS nên được kiểm tra iss, aud, exp và nonce mà không cần kiểm tra chữ ký (OpenID Connect Core mục 3.1.3.7);
+// claim còn thiếu được bổ sung từ userinfo endpoint.
+func (p *Provider) Identity(ctx context.Context, token *Token, nonce string) (*Identity, error) {
+	claims := map[string]interface{}{}
+	if p.config.Type == TypeOIDC {
+		idClaims, err := p.parseIDToken(token.IDToken, nonce)
+		if err != nil {
+			return nil, err
+		}
+		claims = idClaims
+	}
+
+	if p.config.UserInfoURL != "" {
+		userInfo, err := p.fetchUserInfo(ctx, token.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		// userinfo của provider OIDC phải thuộc về cùng user với ID token
+		if sub, ok := claims["sub"]; ok && fmt.Sprint(userInfo["sub"]) != fmt.Sprint(sub) {
+			return nil, ErrInvalidIDToken
+		}
+		for key, value := range userInfo {
+			if _, exists := claims[key]; !exists {
+				claims[key] = value
+			}
+		}
+	}
+
+	fields := p.config.Fields
+	identity := &Identity{
+		Subject:    stringClaim(claims, fields.Subject),
+		Username:   stringClaim(claims, fields.Username),
+		Email:      stringClaim(claims, fields.Email),
+		GivenName:  stringClaim(claims, fields.GivenName),
+		FamilyName: stringClaim(claims, fields.FamilyName),
+	}
+	if identity.Subject == "" {
+		return nil, ErrNoSubject
+	}
+	identity.EmailVerified = boolClaim(claims, fields.EmailVerified)
+
+	if p.config.EmailsURL != "" {
+		if err := p.fetchVerifiedEmail(ctx, token.AccessToken, identity); err != nil {
+			return nil, err
+		}
+	}
+	return identity, nil
+}
+
+// parseIDToken kiểm tra các claim của ID token và trả về toàn bộ claim
+func (p *Provider) parseIDToken(idToken, nonce string) (map[string]interface{}, error) {
+	if idToken == "" {
+		return nil, ErrInvalidIDToken
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(idToken, claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	issuer, _ := claims.GetIssuer()
+	if p.config.Issuer != "" && issuer != p.config.Issuer {
+		return nil, ErrInvalidIDToken
+	}
+	audience, err := claims.GetAudience()
+	if err != nil || !containsString(audience, p.config.ClientID) {
+		return nil, ErrInvalidIDToken
+	}
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil || !expiresAt.After(time.Now()) {
+		return nil, ErrInvalidIDToken
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, ErrInvalidIDToken
+	}
+	return claims, nil
+}
+
+// fetchUserInfo gọi userinfo endpoint bằng access token
+func (p *Provider) fetchUserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	req, err := p.newAuthorizedRequest(ctx, p.config.UserInfoURL, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	userInfo := map[string]interface{}{}
+	status, err := p.doJSON(req, &userInfo)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("userinfo endpoint returned status %d", status)
+	}
+	return userInfo, nil
+}
+
+// fetchVerifiedEmail lấy email chính đã xác minh từ EmailsURL (dạng [{"email", "primary", "verified"}])
+func (p *Provider) fetchVerifiedEmail(ctx context.Context, accessToken string, identity *Identity) error {
+	req, err := p.newAuthorizedRequest(ctx, p.config.EmailsURL, accessToken)
+	if err != nil {
+		return err
+	}
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	status, err := p.doJSON(req, &emails)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("emails endpoint returned status %d", status)
+	}
+
+	for _, email := range emails {
+		if email.Primary && email.Verified {
+			identity.Email, identity.EmailVerified = email.Email, true
+			return nil
+		}
+	}
+	for _, email := range emails {
+		if email.Verified {
+			identity.Email, identity.EmailVerified = email.Email, true
+			return nil
+		}
+	}
+	return nil
+}
+
+// discover lấy các endpoint còn thiếu từ discovery document của provider OIDC (chỉ một lần)
+func (p *Provider) discover(ctx context.Context) error {
+	if p.config.Type != TypeOIDC || p.config.Issuer == "" {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovered {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(p.config.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+	var doc discoveryDocument
+	status, err := p.doJSON(req, &doc)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("discovery endpoint returned status %d", status)
+	}
+	if doc.Issuer != p.config.Issuer {
+		return fmt.Errorf("discovery issuer mismatch: %s", doc.Issuer)
+	}
+
+	if p.config.AuthURL == "" {
+		p.config.AuthURL = doc.AuthorizationEndpoint
+	}
+	if p.config.TokenURL == "" {
+		p.config.TokenURL = doc.TokenEndpoint
+	}
+	if p.config.UserInfoURL == "" {
+		p.config.UserInfoURL = doc.UserInfoEndpoint
+	}
+	p.discovered = true
+	return nil
+}
+
+// newAuthorizedRequest tạo GET request kèm access token
+func (p *Provider) newAuthorizedRequest(ctx context.Context, endpoint, accessToken string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return req, nil
+}
+
+// doJSON gửi request và giải mã response JSON vào out, trả về status code
+func (p *Provider) doJSON(req *http.Request, out interface{}) (int, error) {
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize))
+	decoder.UseNumber()
+	if err := decoder.Decode(out); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("invalid response from %s: %w", req.URL.Host, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// stringClaim lấy claim dạng chuỗi; số (vd: id của GitHub) được chuyển thành chuỗi
+func stringClaim(claims map[string]interface{}, name string) string {
+	if name == "" {
+		return ""
+	}
+	switch value := claims[name].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case float64:
+		return fmt.Sprintf("%.0f", value)
+	default:
+		return ""
+	}
+}
+
+// boolClaim lấy claim dạng bool; một số provider trả về chuỗi "true"
+func boolClaim(claims map[string]interface{}, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	default:
+		return false
+	}
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
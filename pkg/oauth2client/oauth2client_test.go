@@ -0,0 +1,241 @@
+package oauth2client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testServer là provider OIDC tối giản: discovery, token trả về ID token do test quyết định, userinfo và /user/emails
+type testServer struct {
+	*httptest.Server
+	issuer   string // issuer trong discovery, mặc định là URL của server
+	idClaims jwt.MapClaims
+	userInfo map[string]interface{}
+	emails   []map[string]interface{}
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	s := &testServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := s.issuer
+		if issuer == "" {
+			issuer = s.URL
+		}
+		writeJSON(w, map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": s.URL + "/authorize",
+			"token_endpoint":         s.URL + "/token",
+			"userinfo_endpoint":      s.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "good-code" || r.PostFormValue("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant", "error_description": "bad code"})
+			return
+		}
+		idToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, s.idClaims).SignedString([]byte("key"))
+		if err != nil {
+			t.Errorf("sign id token: %v", err)
+		}
+		writeJSON(w, map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": idToken})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.userInfo)
+	})
+	mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, s.emails)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// validClaims trả về claim hợp lệ của ID token cho client "client" và nonce "nonce"
+func (s *testServer) validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            s.URL,
+		"aud":            "client",
+		"sub":            "user-1",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          "nonce",
+		"email":          "user@example.com",
+		"email_verified": true,
+	}
+}
+
+func (s *testServer) oidcProvider() *Provider {
+	return NewProvider(Config{Name: "corp", ClientID: "client", RedirectURL: "http://app/callback", Issuer: s.URL}, s.Client())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// identity chạy Exchange rồi Identity với code và nonce hợp lệ
+func identity(p *Provider, nonce string) (*Identity, error) {
+	ctx := context.Background()
+	token, err := p.Exchange(ctx, "good-code", "verifier")
+	if err != nil {
+		return nil, err
+	}
+	return p.Identity(ctx, token, nonce)
+}
+
+func TestAuthCodeURLUsesDiscovery(t *testing.T) {
+	s := newTestServer(t)
+	p := NewProvider(Config{Name: "corp", ClientID: "client", RedirectURL: "http://app/callback", Issuer: s.URL, Scopes: []string{"openid", "email"}}, s.Client())
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	if got := u.Scheme + "://" + u.Host + u.Path; got != s.URL+"/authorize" {
+		t.Fatalf("authorization endpoint = %s, want the one from discovery", got)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client",
+		"redirect_uri":          "http://app/callback",
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"code_challenge":        "challenge",
+		"code_challenge_method": "S256",
+		"scope":                 "openid email",
+	}
+	for key, value := range want {
+		if got := u.Query().Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	s := newTestServer(t)
+	s.issuer = "https://evil.example.com"
+
+	if _, err := s.oidcProvider().AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err == nil {
+		t.Fatal("discovery document of another issuer must be rejected")
+	}
+}
+
+func TestExchangeError(t *testing.T) {
+	s := newTestServer(t)
+	if _, err := s.oidcProvider().Exchange(context.Background(), "bad-code", "verifier"); err == nil {
+		t.Fatal("token endpoint error must be returned")
+	}
+}
+
+func TestIdentityFromIDToken(t *testing.T) {
+	s := newTestServer(t)
+	s.idClaims = s.validClaims()
+	s.userInfo = map[string]interface{}{"sub": "user-1", "given_name": "Ann", "email": "other@example.com"}
+
+	got, err := identity(s.oidcProvider(), "nonce")
+	if err != nil {
+		t.Fatalf("Identity: %v", err)
+	}
+	// Claim trong ID token được ưu tiên, userinfo chỉ bổ sung claim còn thiếu
+	if got.Subject != "user-1" || got.Email != "user@example.com" || !got.EmailVerified || got.GivenName != "Ann" {
+		t.Fatalf("unexpected identity: %+v", got)
+	}
+}
+
+func TestIdentityRejectsInvalidIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(s *testServer, claims jwt.MapClaims)
+	}{
+		{"wrong audience", func(s *testServer, c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"wrong issuer", func(s *testServer, c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"wrong nonce", func(s *testServer, c jwt.MapClaims) { c["nonce"] = "another-nonce" }},
+		{"missing nonce", func(s *testServer, c jwt.MapClaims) { delete(c, "nonce") }},
+		{"expired", func(s *testServer, c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"missing expiry", func(s *testServer, c jwt.MapClaims) { delete(c, "exp") }},
+		{"userinfo of another user", func(s *testServer, c jwt.MapClaims) { s.userInfo["sub"] = "user-2" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.idClaims = s.validClaims()
+			s.userInfo = map[string]interface{}{"sub": "user-1"}
+			tt.mutate(s, s.idClaims)
+
+			if _, err := identity(s.oidcProvider(), "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("got %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestIdentityGitHubEmails(t *testing.T) {
+	tests := []struct {
+		name         string
+		emails       []map[string]interface{}
+		wantEmail    string
+		wantVerified bool
+	}{
+		{
+			name: "primary verified email",
+			emails: []map[string]interface{}{
+				{"email": "other@example.com", "primary": false, "verified": true},
+				{"email": "octo@example.com", "primary": true, "verified": true},
+			},
+			wantEmail: "octo@example.com", wantVerified: true,
+		},
+		{
+			name: "verified email when the primary one is not",
+			emails: []map[string]interface{}{
+				{"email": "octo@example.com", "primary": true, "verified": false},
+				{"email": "other@example.com", "primary": false, "verified": true},
+			},
+			wantEmail: "other@example.com", wantVerified: true,
+		},
+		{
+			name: "no verified email",
+			emails: []map[string]interface{}{
+				{"email": "octo@example.com", "primary": true, "verified": false},
+			},
+			wantEmail: "public@example.com", wantVerified: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.userInfo = map[string]interface{}{"id": 583231, "login": "octocat", "email": "public@example.com"}
+			s.emails = tt.emails
+			config, _ := Preset("github")
+			config.ClientID = "client"
+			config.TokenURL = s.URL + "/token"
+			config.UserInfoURL = s.URL + "/userinfo"
+			config.EmailsURL = s.URL + "/user/emails"
+
+			got, err := identity(NewProvider(config, s.Client()), "")
+			if err != nil {
+				t.Fatalf("Identity: %v", err)
+			}
+			if got.Subject != "583231" || got.Username != "octocat" {
+				t.Fatalf("unexpected subject/username: %+v", got)
+			}
+			if got.Email != tt.wantEmail || got.EmailVerified != tt.wantVerified {
+				t.Fatalf("email = %q (verified %v), want %q (verified %v)", got.Email, got.EmailVerified, tt.wantEmail, tt.wantVerified)
+			}
+		})
+	}
+}
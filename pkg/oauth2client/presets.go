@@ -0,0 +1,33 @@
+package oauth2client
+
+// presets là cấu hình sẵn của các provider phổ biến; chỉ cần bổ sung client ID và client secret
+var presets = map[string]Config{
+	"google": {
+		Type:   TypeOIDC,
+		Issuer: "https://accounts.google.com",
+		Scopes: []string{"openid", "email", "profile"},
+	},
+	"github": {
+		Type:        TypeOAuth2,
+		AuthURL:     "https://github.com/login/oauth/authorize",
+		TokenURL:    "https://github.com/login/oauth/access_token",
+		UserInfoURL: "https://api.github.com/user",
+		EmailsURL:   "https://api.github.com/user/emails",
+		Scopes:      []string{"read:user", "user:email"},
+		Fields: Fields{
+			Subject:  "id",
+			Username: "login",
+			Email:    "email",
+		},
+	},
+}
+
+// Preset trả về cấu hình sẵn của provider theo tên (google, github)
+func Preset(name string) (Config, bool) {
+	config, ok := presets[name]
+	if ok {
+		config.Name = name
+		config.Scopes = append([]string(nil), config.Scopes...)
+	}
+	return config, ok
+}
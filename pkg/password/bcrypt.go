@@ -0,0 +1,56 @@
+package password
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptDefaultCost là cost mặc định của bcrypt
+const BcryptDefaultCost = bcrypt.DefaultCost
+
+// bcryptHasher băm mật khẩu bằng bcrypt
+type bcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher tạo Hasher bcrypt với cost cho trước
+func NewBcryptHasher(cost int) Hasher {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = BcryptDefaultCost
+	}
+	return &bcryptHasher{cost: cost}
+}
+
+// Hash băm mật khẩu bằng bcrypt
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// Verify kiểm tra mật khẩu với hash bcrypt
+func (h *bcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return false, ErrInvalidHash
+}
+
+// NeedsRehash trả về true nếu hash dùng cost khác cấu hình hiện tại
+func (h *bcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.cost
+}
+
+// Supports nhận biết hash bcrypt theo tiền tố $2a$, $2b$ hoặc $2y$
+func (h *bcryptHasher) Supports(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
@@ -0,0 +1,112 @@
+package password
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// BreachedList tra cứu mật khẩu trong file danh sách mật khẩu bị lộ theo định dạng của
+// Have I Been Pwned: mỗi dòng "<SHA-1 hex viết hoa>:<số lần xuất hiện>", sắp xếp tăng dần theo hash.
+// File được tìm kiếm nhị phân trực tiếp trên đĩa nên không cần nạp vào bộ nhớ.
+type BreachedList struct {
+	file *os.File
+	size int64
+}
+
+// maxLineLength đủ cho "<40 ký tự hash>:<số lần>\r\n"
+const maxLineLength = 128
+
+// OpenBreachedList mở file danh sách mật khẩu bị lộ
+func OpenBreachedList(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &BreachedList{file: file, size: info.Size()}, nil
+}
+
+// Close đóng file
+func (b *BreachedList) Close() error {
+	return b.file.Close()
+}
+
+// Contains kiểm tra mật khẩu có trong danh sách không
+func (b *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := []byte(strings.ToUpper(hex.EncodeToString(sum[:])))
+
+	// lo luôn là đầu một dòng; mọi dòng bắt đầu từ hi trở đi đều lớn hơn target
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, err := b.lineStart(mid)
+		if err != nil {
+			return false, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		line, err := b.readLine(start)
+		if err != nil {
+			return false, err
+		}
+		hash := line
+		if colon := bytes.IndexByte(line, ':'); colon >= 0 {
+			hash = line[:colon]
+		}
+
+		switch cmp := bytes.Compare(bytes.ToUpper(bytes.TrimSpace(hash)), target); {
+		case cmp == 0:
+			return true, nil
+		case cmp < 0:
+			lo = start + int64(len(line)) + 1
+		default:
+			hi = mid
+		}
+	}
+	return false, nil
+}
+
+// lineStart trả về vị trí đầu dòng đầu tiên bắt đầu tại hoặc sau offset
+func (b *BreachedList) lineStart(offset int64) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+	pos := offset - 1
+	buf := make([]byte, maxLineLength)
+	for pos < b.size {
+		n, err := b.file.ReadAt(buf, pos)
+		if n == 0 && err != nil {
+			return 0, err
+		}
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return pos + int64(i) + 1, nil
+		}
+		pos += int64(n)
+	}
+	return b.size, nil
+}
+
+// readLine đọc một dòng (không gồm ký tự xuống dòng) bắt đầu tại offset
+func (b *BreachedList) readLine(offset int64) ([]byte, error) {
+	buf := make([]byte, maxLineLength)
+	n, err := b.file.ReadAt(buf, offset)
+	if n == 0 && err != nil {
+		return nil, err
+	}
+	buf = buf[:n]
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i]
+	}
+	return buf, nil
+}
@@ -0,0 +1,109 @@
+// Package password băm và kiểm tra mật khẩu bằng bcrypt hoặc argon2id.
+// Hash argon2id được lưu theo định dạng PHC, hash bcrypt theo định dạng modular crypt ($2a$...).
+package password
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Định nghĩa các lỗi
+var (
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+	ErrInvalidHash       = errors.New("invalid password hash")
+)
+
+// Hasher định nghĩa interface cho một thuật toán băm mật khẩu
+type Hasher interface {
+	// Hash băm mật khẩu với tham số hiện tại
+	Hash(password string) (string, error)
+	// Verify kiểm tra mật khẩu với hash đã lưu
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash cho biết hash đã lưu có dùng thuật toán hoặc tham số cũ hơn cấu hình hiện tại không
+	NeedsRehash(encoded string) bool
+	// Supports cho biết hasher đọc được định dạng của hash đã lưu không
+	Supports(encoded string) bool
+}
+
+// multiHasher băm bằng thuật toán ưu tiên nhưng vẫn kiểm tra được hash của các thuật toán khác,
+// để có thể chuyển dần người dùng sang thuật toán mới
+type multiHasher struct {
+	preferred Hasher
+	hashers   []Hasher
+}
+
+// NewHasher tạo Hasher băm mật khẩu mới bằng preferred và đọc được hash của preferred cùng các fallbacks
+func NewHasher(preferred Hasher, fallbacks ...Hasher) Hasher {
+	return &multiHasher{
+		preferred: preferred,
+		hashers:   append([]Hasher{preferred}, fallbacks...),
+	}
+}
+
+// Hash băm mật khẩu bằng thuật toán ưu tiên
+func (h *multiHasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+// Verify kiểm tra mật khẩu bằng thuật toán tương ứng với định dạng của hash
+func (h *multiHasher) Verify(password, encoded string) (bool, error) {
+	for _, hasher := range h.hashers {
+		if hasher.Supports(encoded) {
+			return hasher.Verify(password, encoded)
+		}
+	}
+	return false, ErrUnknownHashFormat
+}
+
+// NeedsRehash trả về true nếu hash không thuộc thuật toán ưu tiên hoặc dùng tham số cũ
+func (h *multiHasher) NeedsRehash(encoded string) bool {
+	if !h.preferred.Supports(encoded) {
+		return true
+	}
+	return h.preferred.NeedsRehash(encoded)
+}
+
+// Supports cho biết có hasher nào đọc được hash không
+func (h *multiHasher) Supports(encoded string) bool {
+	for _, hasher := range h.hashers {
+		if hasher.Supports(encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultHasher = NewHasher(NewBcryptHasher(BcryptDefaultCost), NewArgon2idHasher(DefaultArgon2idParams))
+)
+
+// SetDefault thay Hasher dùng chung của ứng dụng (gọi một lần khi khởi động)
+func SetDefault(h Hasher) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultHasher = h
+}
+
+// Default trả về Hasher dùng chung của ứng dụng
+func Default() Hasher {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultHasher
+}
+
+// New tạo Hasher theo tên thuật toán ưu tiên ("bcrypt" hoặc "argon2id"); hash của thuật toán còn lại vẫn được kiểm tra
+func New(algorithm string, bcryptCost int, argon2Params Argon2idParams) (Hasher, error) {
+	bcryptHasher := NewBcryptHasher(bcryptCost)
+	argon2Hasher := NewArgon2idHasher(argon2Params)
+
+	switch strings.ToLower(algorithm) {
+	case "bcrypt":
+		return NewHasher(bcryptHasher, argon2Hasher), nil
+	case "argon2id":
+		return NewHasher(argon2Hasher, bcryptHasher), nil
+	default:
+		return nil, errors.New("unknown password hash algorithm: " + algorithm)
+	}
+}
@@ -0,0 +1,205 @@
+package password
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Các quy tắc của chính sách mật khẩu
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleLowercase = "lowercase"
+	RuleUppercase = "uppercase"
+	RuleDigit     = "digit"
+	RuleSymbol    = "symbol"
+	RuleUserInfo  = "user_info"
+	RuleStrength  = "strength"
+	RuleBreached  = "breached"
+)
+
+// Violation là một quy tắc mà mật khẩu không thỏa mãn
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PolicyError chứa tất cả các quy tắc bị vi phạm
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	rules := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		rules[i] = v.Rule
+	}
+	return "password does not meet policy: " + strings.Join(rules, ", ")
+}
+
+// Policy là chính sách mật khẩu
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	MinStrength   int           // Điểm tối thiểu từ 0 (rất yếu) tới 4 (rất mạnh), xem Strength
+	Breached      *BreachedList // Danh sách mật khẩu đã bị lộ, nil nếu không kiểm tra
+}
+
+// Validate kiểm tra mật khẩu theo chính sách. userInputs là các thông tin của user
+// (username, email...) không được xuất hiện trong mật khẩu. Trả về *PolicyError nếu vi phạm.
+func (p *Policy) Validate(password string, userInputs ...string) error {
+	var violations []Violation
+	add := func(rule, format string, args ...interface{}) {
+		violations = append(violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		add(RuleMinLength, "password must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add(RuleMaxLength, "password must be at most %d characters long", p.MaxLength)
+	}
+
+	classes := characterClasses(password)
+	if p.RequireLower && !classes.lower {
+		add(RuleLowercase, "password must contain a lowercase letter")
+	}
+	if p.RequireUpper && !classes.upper {
+		add(RuleUppercase, "password must contain an uppercase letter")
+	}
+	if p.RequireDigit && !classes.digit {
+		add(RuleDigit, "password must contain a digit")
+	}
+	if p.RequireSymbol && !classes.symbol {
+		add(RuleSymbol, "password must contain a symbol")
+	}
+
+	if containsUserInfo(password, userInputs) {
+		add(RuleUserInfo, "password must not contain your username or email")
+	}
+
+	if score, _ := Strength(password); score < p.MinStrength {
+		add(RuleStrength, "password is too weak (strength %d of 4, at least %d required)", score, p.MinStrength)
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			add(RuleBreached, "password has appeared in a data breach, please choose another one")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// Strength ước lượng độ mạnh của mật khẩu dựa trên entropy (bit): số ký tự hiệu dụng nhân log2 kích thước
+// bộ ký tự. Ký tự lặp lại hoặc nối tiếp ký tự trước (aaa, abc, 123) chỉ được tính nửa.
+// Điểm: 0 (< 28 bit), 1 (< 36), 2 (< 60), 3 (< 80), 4 (>= 80).
+func Strength(password string) (score int, entropy float64) {
+	classes := characterClasses(password)
+	pool := 0
+	if classes.lower {
+		pool += 26
+	}
+	if classes.upper {
+		pool += 26
+	}
+	if classes.digit {
+		pool += 10
+	}
+	if classes.symbol {
+		pool += 33
+	}
+	if classes.other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0, 0
+	}
+
+	effective := 0.0
+	var prev rune = -1
+	for _, r := range password {
+		if prev >= 0 && (r == prev || r == prev+1 || r == prev-1) {
+			effective += 0.5
+		} else {
+			effective++
+		}
+		prev = r
+	}
+	entropy = effective * math.Log2(float64(pool))
+
+	switch {
+	case entropy < 28:
+		score = 0
+	case entropy < 36:
+		score = 1
+	case entropy < 60:
+		score = 2
+	case entropy < 80:
+		score = 3
+	default:
+		score = 4
+	}
+	return score, entropy
+}
+
+type classSet struct {
+	lower, upper, digit, symbol, other bool
+}
+
+func characterClasses(password string) classSet {
+	var c classSet
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			c.lower = true
+		case r >= 'A' && r <= 'Z':
+			c.upper = true
+		case r >= '0' && r <= '9':
+			c.digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			c.symbol = true
+		case unicode.IsLower(r):
+			c.lower, c.other = true, true
+		case unicode.IsUpper(r):
+			c.upper, c.other = true, true
+		default:
+			c.other = true
+		}
+	}
+	return c
+}
+
+// containsUserInfo kiểm tra mật khẩu có chứa (không phân biệt hoa thường) một trong các thông tin của user.
+// Với email, phần trước @ cũng được kiểm tra. Chuỗi quá ngắn (< 3 ký tự) được bỏ qua.
+func containsUserInfo(password string, userInputs []string) bool {
+	lower := strings.ToLower(password)
+	for _, input := range userInputs {
+		candidates := []string{input}
+		if at := strings.Index(input, "@"); at > 0 {
+			candidates = append(candidates, input[:at])
+		}
+		for _, candidate := range candidates {
+			candidate = strings.ToLower(strings.TrimSpace(candidate))
+			if utf8.RuneCountInString(candidate) >= 3 && strings.Contains(lower, candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package sms
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidPhone được trả về khi chuỗi không phải số điện thoại hợp lệ
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// Giới hạn số chữ số của số điện thoại E.164 (không tính dấu +)
+const (
+	minPhoneDigits = 8
+	maxPhoneDigits = 15
+)
+
+// NormalizePhone chuyển số điện thoại về dạng E.164 (+<mã quốc gia><số>). Dấu cách, gạch ngang, dấu chấm
+// và ngoặc đơn được bỏ qua; số bắt đầu bằng "00" được coi như "+", số nội địa bắt đầu bằng "0" được
+// thêm defaultCountryCode (ví dụ "84": 0912 345 678 -> +84912345678).
+func NormalizePhone(s, defaultCountryCode string) (string, error) {
+	s = strings.TrimSpace(s)
+	var digits strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	number := digits.String()
+	switch {
+	case strings.HasPrefix(s, "+"):
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	case strings.HasPrefix(number, "0") && defaultCountryCode != "":
+		number = strings.TrimPrefix(defaultCountryCode, "+") + number[1:]
+	default:
+		return "", ErrInvalidPhone
+	}
+
+	if len(number) < minPhoneDigits || len(number) > maxPhoneDigits || number[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+	return "+" + number, nil
+}
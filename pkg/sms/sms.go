@@ -0,0 +1,96 @@
+// Package sms gửi tin nhắn SMS (mã OTP...) tới số điện thoại. Package chỉ có các sender dùng khi phát triển
+// và kiểm thử; sender của nhà cung cấp SMS thật chỉ cần triển khai interface Sender.
+package sms
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Thanhdat-debug/demo_login/pkg/logger"
+)
+
+// Message là một tin nhắn SMS cần gửi
+type Message struct {
+	To   string // Số điện thoại dạng E.164, ví dụ +84912345678
+	Body string
+}
+
+// Sender định nghĩa interface cho các cách gửi SMS
+type Sender interface {
+	Send(msg Message) error
+}
+
+// logSender chỉ ghi tin nhắn ra log (console), dùng khi phát triển
+type logSender struct {
+	logger *logger.Logger
+}
+
+// NewLogSender tạo Sender ghi tin nhắn ra log thay vì gửi thật
+func NewLogSender(logger *logger.Logger) Sender {
+	return &logSender{logger: logger}
+}
+
+// Send ghi tin nhắn ra log
+func (s *logSender) Send(msg Message) error {
+	s.logger.Infof("SMS to %s: %s", msg.To, msg.Body)
+	return nil
+}
+
+// fileSender ghi mỗi tin nhắn thành một dòng "<thời điểm>\t<số điện thoại>\t<nội dung>" ở cuối file
+type fileSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileSender tạo Sender ghi tin nhắn vào file
+func NewFileSender(path string) Sender {
+	return &fileSender{path: path}
+}
+
+// Send ghi tin nhắn vào cuối file
+func (s *fileSender) Send(msg Message) error {
+	body := strings.NewReplacer("\r", " ", "\n", " ").Replace(msg.Body)
+	line := fmt.Sprintf("%s\t%s\t%s\n", time.Now().UTC().Format(time.RFC3339), msg.To, body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// MemorySender lưu tin nhắn trong bộ nhớ thay vì gửi, dùng cho kiểm thử
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemorySender tạo một MemorySender rỗng
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+// Send lưu tin nhắn vào bộ nhớ
+func (s *MemorySender) Send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages trả về bản sao các tin nhắn đã gửi
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}